@@ -1,10 +1,12 @@
 // Command debug-reports is a small read/maintenance CLI for the debug_reports
 // table. It connects to the same database as the server (via DATABASE_URL or
-// a local SQLite file) and supports three subcommands:
+// a local SQLite file) and supports four subcommands:
 //
-//	list   — list recent reports with optional --user / --since / --limit filters.
-//	view   — pretty-print a single report with a color-coded breadcrumb feed.
-//	purge  — delete reports older than a duration, with a y/N confirmation.
+//	list        — list recent reports with optional --user / --since / --limit filters.
+//	view        — pretty-print a single report with a color-coded breadcrumb feed.
+//	purge       — delete reports older than a duration, with a y/N confirmation.
+//	deliveries  — list a user's recent push deliveries from push_outbox, for
+//	              "I never got my reminder" reports.
 //
 // Intentionally minimal: single file, stdlib only, no tablewriter / no color
 // library.  TTY detection uses github.com/mattn/go-isatty which is already in
@@ -28,6 +30,7 @@ import (
 	"github.com/mattn/go-isatty"
 
 	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
 )
 
 const usage = `debug-reports — inspect and maintain the debug_reports table.
@@ -36,6 +39,7 @@ Usage:
   debug-reports list  [--user EMAIL] [--since DUR] [--limit N]
   debug-reports view  <report-id>
   debug-reports purge  --older-than DUR [--yes]
+  debug-reports deliveries --user EMAIL [--since DUR] [--status S] [--limit N]
 
 Connection:
   DATABASE_URL       postgres://... — when set, connects to Postgres.
@@ -72,6 +76,8 @@ func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 		return cmdView(rest, stdout, stderr)
 	case "purge":
 		return cmdPurge(rest, stdin, stdout, stderr)
+	case "deliveries":
+		return cmdDeliveries(rest, stdout, stderr)
 	default:
 		return fmt.Errorf("unknown subcommand %q (try --help)", sub)
 	}
@@ -351,6 +357,93 @@ func cmdPurge(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
 	return nil
 }
 
+// --- deliveries ---------------------------------------------------------
+
+func cmdDeliveries(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("deliveries", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		userEmail = fs.String("user", "", "user email (required)")
+		since     = fs.String("since", "7d", "only deliveries queued within this duration")
+		status    = fs.String("status", "", "filter by status: pending, sending, sent or failed")
+		limit     = fs.Int("limit", 50, "max number of deliveries to return")
+	)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: debug-reports deliveries --user EMAIL [--since DUR] [--status S] [--limit N]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *userEmail == "" {
+		fs.Usage()
+		return errors.New("--user is required")
+	}
+
+	filter := db.PushOutboxFilter{Status: *status, Limit: *limit}
+	if *since != "" {
+		d, err := parseDuration(*since)
+		if err != nil {
+			return fmt.Errorf("--since: %w", err)
+		}
+		t := time.Now().Add(-d)
+		filter.Since = &t
+	}
+
+	database, err := openDB()
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer database.Close()
+
+	u, err := database.GetUserByEmail(*userEmail)
+	if err != nil {
+		return fmt.Errorf("lookup user by email: %w", err)
+	}
+	if u == nil {
+		return fmt.Errorf("no user with email %q", *userEmail)
+	}
+	filter.UserID = &u.ID
+
+	entries, err := database.ListPushOutbox(filter)
+	if err != nil {
+		return fmt.Errorf("list push deliveries: %w", err)
+	}
+
+	fmt.Fprintf(stdout, "queued_at\tcategory\tplatform\tdevice_id\tstatus\tattempts\tsent_or_next\tlast_error\n")
+	for _, e := range entries {
+		fmt.Fprintln(stdout, formatDelivery(e))
+	}
+	return nil
+}
+
+// formatDelivery renders one push_outbox row as a tab-separated line. The
+// sent_or_next column is sent_at for delivered entries and next_attempt_at
+// for ones still queued.
+func formatDelivery(e models.PushOutboxEntry) string {
+	when := "-"
+	switch {
+	case e.SentAt != nil:
+		when = e.SentAt.UTC().Format(time.RFC3339)
+	case e.Status == models.PushOutboxPending || e.Status == models.PushOutboxSending:
+		when = e.NextAttemptAt.UTC().Format(time.RFC3339)
+	}
+	lastError := descriptionSnippet(e.LastError, 80)
+	if lastError == "" {
+		lastError = "-"
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s",
+		e.CreatedAt.UTC().Format(time.RFC3339),
+		e.Category,
+		e.Platform,
+		e.DeviceTokenID,
+		e.Status,
+		e.Attempts,
+		when,
+		lastError,
+	)
+}
+
 // --- helpers -----------------------------------------------------------
 
 // maxDurationDays caps --since/--older-than at 100 years.  Anything larger is
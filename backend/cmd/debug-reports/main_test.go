@@ -5,6 +5,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/models"
 )
 
 func TestParseDuration(t *testing.T) {
@@ -184,3 +186,39 @@ func TestCompactJSON(t *testing.T) {
 		}
 	})
 }
+
+func TestFormatDelivery(t *testing.T) {
+	created := time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC)
+	next := created.Add(2 * time.Minute)
+
+	t.Run("sent", func(t *testing.T) {
+		sent := created.Add(time.Second)
+		got := formatDelivery(models.PushOutboxEntry{
+			CreatedAt: created, Category: "reminder", Platform: "ios", DeviceTokenID: "d1",
+			Status: models.PushOutboxSent, Attempts: 1, NextAttemptAt: created, SentAt: &sent,
+		})
+		want := "2026-03-01T20:00:00Z\treminder\tios\td1\tsent\t1\t2026-03-01T20:00:01Z\t-"
+		if got != want {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	})
+	t.Run("pending-shows-next-attempt", func(t *testing.T) {
+		got := formatDelivery(models.PushOutboxEntry{
+			CreatedAt: created, Category: "reminder", Platform: "android", DeviceTokenID: "d2",
+			Status: models.PushOutboxPending, Attempts: 2, NextAttemptAt: next, LastError: "fcm: 503 UNAVAILABLE",
+		})
+		want := "2026-03-01T20:00:00Z\treminder\tandroid\td2\tpending\t2\t2026-03-01T20:02:00Z\tfcm: 503 UNAVAILABLE"
+		if got != want {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	})
+	t.Run("failed-has-no-time", func(t *testing.T) {
+		got := formatDelivery(models.PushOutboxEntry{
+			CreatedAt: created, Category: "reminder", Platform: "web", DeviceTokenID: "d3",
+			Status: models.PushOutboxFailed, Attempts: 1, NextAttemptAt: next, LastError: "webpush: 410",
+		})
+		if !strings.HasSuffix(got, "\tfailed\t1\t-\twebpush: 410") {
+			t.Errorf("unexpected line %q", got)
+		}
+	})
+}
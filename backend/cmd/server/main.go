@@ -3,23 +3,39 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // reminder timezones must resolve even without system zoneinfo
 
 	"github.com/apsv/goal-tracker/backend/internal/api"
+	"github.com/apsv/goal-tracker/backend/internal/bus"
 	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/push"
 )
 
 func main() {
 	addr := flag.String("addr", "", "HTTP server address (defaults to :8080 or PORT env var)")
 	dbType := flag.String("db-type", "sqlite", "Database type: sqlite or postgres")
 	dbConn := flag.String("db", "", "Database connection (path for sqlite, URL for postgres). Defaults to sqlite path if empty, or DATABASE_URL env var for postgres.")
+	deviceTokenMaxAge := flag.Duration("device-token-max-age", 60*24*time.Hour, "Delete push device tokens not registered or successfully used for this long")
+	tombstoneRetention := flag.Duration("tombstone-retention", 180*24*time.Hour, "Hard-delete goals and completions this long after they were deleted; clients that last synced earlier must resync in full")
+	generateVAPID := flag.Bool("generate-vapid-keys", false, "Print a new VAPID key pair for Web Push and exit")
 	flag.Parse()
 
+	if *generateVAPID {
+		priv, pub, err := push.GenerateVAPIDKeys()
+		if err != nil {
+			log.Fatalf("Failed to generate VAPID keys: %v", err)
+		}
+		fmt.Printf("VAPID_PRIVATE_KEY=%s\nVAPID_PUBLIC_KEY=%s\n", priv, pub)
+		return
+	}
+
 	// Determine server address
 	serverAddr := *addr
 	if serverAddr == "" {
@@ -32,6 +48,9 @@ func main() {
 
 	var database db.Database
 	var err error
+	// Replicas share a PostgreSQL database, so they also share its bus. Its
+	// transactions lock each user's writes across replicas.
+	var postgresConn string
 
 	switch *dbType {
 	case "sqlite":
@@ -51,6 +70,7 @@ func main() {
 		}
 		log.Printf("Connecting to PostgreSQL database")
 		database, err = db.NewPostgres(connStr)
+		postgresConn = connStr
 	default:
 		log.Fatalf("Unknown database type: %s (use 'sqlite' or 'postgres')", *dbType)
 	}
@@ -63,10 +83,42 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	pushService, err := newPushService()
+	if err != nil {
+		log.Fatalf("Failed to configure push notifications: %v", err)
+	}
+
 	staticFS := getStaticFS()
-	handler := api.NewServer(database, staticFS)
+	handler := api.NewServer(database, staticFS, pushService)
+
+	webPush, err := newWebPushService()
+	if err != nil {
+		log.Fatalf("Failed to configure web push: %v", err)
+	}
+	if webPush != nil {
+		handler.UseWebPush(webPush)
+	}
 
-	// Create HTTP server with the handler
+	var changeBus bus.Bus
+	if postgresConn != "" {
+		changeBus, err = bus.NewPostgres(postgresConn, api.Logger)
+		if err != nil {
+			log.Fatalf("Failed to start notification bus: %v", err)
+		}
+		handler.UseBus(changeBus)
+	}
+
+	apns, err := newAPNsService()
+	if err != nil {
+		log.Fatalf("Failed to configure APNs: %v", err)
+	}
+	if apns != nil {
+		handler.RoutePush("ios", apns)
+	}
+
+	// Create HTTP server with the handler. The change stream
+	// (/api/v1/stream) lifts the read and write timeouts for its own
+	// connections and bounds each write instead.
 	server := &http.Server{
 		Addr:              serverAddr,
 		Handler:           handler,
@@ -83,8 +135,18 @@ func main() {
 	// Start background session cleanup (runs every hour)
 	cleanupCtx, cleanupCancel := context.WithCancel(context.Background())
 	handler.StartSessionCleanup(cleanupCtx, time.Hour)
+	// Server-side reminders: check for due schedules every minute
+	handler.StartReminderScheduler(cleanupCtx, time.Minute)
+	// Streak alerts: nudge users whose streak is at risk, at their local send time
+	handler.StartStreakAlerts(cleanupCtx, time.Minute)
+	// Push outbox: deliver queued notifications and retry failures
+	handler.StartPushOutboxWorker(cleanupCtx, 5*time.Second)
 	// Debug reports retention: delete rows older than 90 days, check once a day
 	handler.StartDebugReportsCleanup(cleanupCtx, 24*time.Hour)
+	// Device tokens: expire ones not seen within -device-token-max-age, check once a day
+	handler.StartDeviceTokenCleanup(cleanupCtx, 24*time.Hour, *deviceTokenMaxAge)
+	// Deleted goals and completions: purge after -tombstone-retention, check once a day
+	handler.StartTombstoneCompaction(cleanupCtx, 24*time.Hour, *tombstoneRetention)
 
 	// Start server in a goroutine
 	go func() {
@@ -115,6 +177,12 @@ func main() {
 		log.Printf("Server forced to shutdown: %v", err)
 	}
 
+	if changeBus != nil {
+		if err := changeBus.Close(); err != nil {
+			log.Printf("Error closing notification bus: %v", err)
+		}
+	}
+
 	// Close database connection
 	log.Println("Closing database connection...")
 	if err := database.Close(); err != nil {
@@ -123,3 +191,84 @@ func main() {
 
 	log.Println("Server shutdown complete")
 }
+
+// newPushService picks the push backend from the environment. When
+// FCM_CREDENTIALS_FILE (path) or FCM_CREDENTIALS_JSON (inline key) is set,
+// notifications go through Firebase Cloud Messaging; FCM_ENDPOINT optionally
+// overrides the API base URL. Otherwise the stub service only logs them.
+func newPushService() (push.PushService, error) {
+	creds := []byte(os.Getenv("FCM_CREDENTIALS_JSON"))
+	if path := os.Getenv("FCM_CREDENTIALS_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		creds = b
+	}
+	if len(creds) == 0 {
+		log.Println("Push notifications: FCM not configured, using stub service")
+		return push.NewStubService(nil), nil
+	}
+
+	svc, err := push.NewFCMService(push.FCMConfig{
+		CredentialsJSON: creds,
+		Endpoint:        os.Getenv("FCM_ENDPOINT"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Push notifications: using Firebase Cloud Messaging")
+	return svc, nil
+}
+
+// newWebPushService configures browser push from VAPID_PRIVATE_KEY and
+// VAPID_SUBJECT (a mailto: or https: contact URL). Returns nil when web push
+// is not configured. Generate a key pair with -generate-vapid-keys.
+func newWebPushService() (*push.WebPushService, error) {
+	privateKey := os.Getenv("VAPID_PRIVATE_KEY")
+	if privateKey == "" {
+		log.Println("Web push: VAPID_PRIVATE_KEY not set, browser notifications disabled")
+		return nil, nil
+	}
+	svc, err := push.NewWebPushService(push.WebPushConfig{
+		VAPIDPrivateKey: privateKey,
+		Subject:         os.Getenv("VAPID_SUBJECT"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Println("Web push: enabled")
+	return svc, nil
+}
+
+// newAPNsService configures direct delivery to iOS tokens from APNS_KEY_FILE
+// (or inline APNS_KEY), APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC (the bundle
+// ID). APNS_ENDPOINT overrides the host, e.g. the sandbox for development
+// builds. Returns nil when APNs is not configured, in which case nothing is
+// sent to iOS tokens; they are kept until it is.
+func newAPNsService() (*push.APNsService, error) {
+	key := []byte(os.Getenv("APNS_KEY"))
+	if path := os.Getenv("APNS_KEY_FILE"); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key = b
+	}
+	if len(key) == 0 {
+		log.Println("APNs: not configured, iOS notifications disabled")
+		return nil, nil
+	}
+	svc, err := push.NewAPNsService(push.APNsConfig{
+		SigningKey: key,
+		KeyID:      os.Getenv("APNS_KEY_ID"),
+		TeamID:     os.Getenv("APNS_TEAM_ID"),
+		Topic:      os.Getenv("APNS_TOPIC"),
+		Endpoint:   os.Getenv("APNS_ENDPOINT"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Println("APNs: enabled for iOS tokens")
+	return svc, nil
+}
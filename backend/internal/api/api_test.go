@@ -8,12 +8,14 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/apsv/goal-tracker/backend/internal/api"
 	"github.com/apsv/goal-tracker/backend/internal/db"
 	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/google/uuid"
 )
 
 func setupTestServer(t *testing.T) (*api.Server, func()) {
@@ -41,7 +43,7 @@ func setupTestServer(t *testing.T) (*api.Server, func()) {
 	// Enable dev login for tests (dev login endpoint is gated behind this env var)
 	t.Setenv("DEV_LOGIN", "true")
 
-	server := api.NewServer(database, nil)
+	server := api.NewServer(database, nil, nil)
 
 	cleanup := func() {
 		database.Close()
@@ -458,6 +460,64 @@ func TestListCompletions(t *testing.T) {
 	}
 }
 
+func TestListCompletions_DatesAreDays(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	testCompletionDatesAreDays(t, server, "dates@localhost")
+}
+
+// TestPostgresListCompletions_DatesAreDays runs against the database in
+// TEST_POSTGRES_URL, e.g. postgres://localhost/goals_test?sslmode=disable.
+func TestPostgresListCompletions_DatesAreDays(t *testing.T) {
+	connStr := os.Getenv("TEST_POSTGRES_URL")
+	if connStr == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+
+	database, err := db.NewPostgres(connStr)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	t.Setenv("DEV_LOGIN", "true")
+
+	// A fresh user, so reruns against the same database start empty.
+	testCompletionDatesAreDays(t, api.NewServer(database, nil, nil), "dates-"+uuid.NewString()+"@localhost")
+}
+
+// testCompletionDatesAreDays checks that completions come back from the REST
+// API with their date as a plain YYYY-MM-DD day.
+func testCompletionDatesAreDays(t *testing.T, server *api.Server, email string) {
+	t.Helper()
+	cookie := authenticateTestUser(t, server, email)
+
+	w := doJSON(t, server, cookie, "POST", "/api/v1/goals", `{"name":"Exercise","color":"#4CAF50"}`)
+	var goal models.Goal
+	json.NewDecoder(w.Body).Decode(&goal)
+	w = doJSON(t, server, cookie, "POST", "/api/v1/completions", `{"goal_id":"`+goal.ID+`","date":"2025-12-01"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create completion: %d %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{
+		"/api/v1/completions?from=2025-12-01&to=2025-12-31",
+		"/api/v1/completions?from=2025-12-01&to=2025-12-01&goal_id=" + goal.ID,
+	} {
+		w = doJSON(t, server, cookie, "GET", path, "")
+		var completions []map[string]any
+		if err := json.NewDecoder(w.Body).Decode(&completions); err != nil {
+			t.Fatalf("GET %s: decode: %v", path, err)
+		}
+		if len(completions) != 1 || completions[0]["date"] != "2025-12-01" {
+			t.Errorf("GET %s: expected the date as 2025-12-01, got %+v", path, completions)
+		}
+	}
+}
+
 func TestDeleteCompletion(t *testing.T) {
 	server, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -706,6 +766,54 @@ func TestSync_RejectsOversizedCompletions(t *testing.T) {
 	}
 }
 
+func TestEvents_RejectsEventWithoutTypeAndAppliesTheRest(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	cookie := authenticateTestUser(t, server, "test@localhost")
+
+	now := time.Now().UTC()
+	body := fmt.Sprintf(`{"events":[
+		{"id":"evt-untyped","timestamp":%q,"payload":{"id":"goal-untyped","name":"Lost"}},
+		{"id":"evt-typed","type":"goal_upsert","timestamp":%q,"payload":{"id":"goal-typed","name":"Read","color":"#000000"}}
+	]}`, now.Format(time.RFC3339Nano), now.Add(time.Second).Format(time.RFC3339Nano))
+	w := doJSON(t, server, cookie, "POST", "/api/v1/events/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Results []struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Results) != 2 {
+		t.Fatalf("expected a result per event, got %+v", resp.Results)
+	}
+	for _, r := range resp.Results {
+		switch r.ID {
+		case "evt-untyped":
+			if r.Status != "rejected" || r.Reason != "missing_type" {
+				t.Errorf("expected the untyped event rejected, got %+v", r)
+			}
+		case "evt-typed":
+			if r.Status != "applied" {
+				t.Errorf("expected the typed event applied, got %+v", r)
+			}
+		}
+	}
+
+	w = doJSON(t, server, cookie, "GET", "/api/v1/goals", "")
+	if !strings.Contains(w.Body.String(), "goal-typed") || strings.Contains(w.Body.String(), "goal-untyped") {
+		t.Errorf("expected only the typed event's goal, got %s", w.Body.String())
+	}
+}
+
 func TestDeleteCompletion_IsSoftDelete(t *testing.T) {
 	server, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -1220,3 +1328,112 @@ func TestMobileOAuthCallback_ReturnsHTMLRedirect(t *testing.T) {
 		t.Error("expected fallback anchor link")
 	}
 }
+
+func TestMetrics_RequiresToken(t *testing.T) {
+	t.Setenv("METRICS_TOKEN", "metrics-secret")
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer metrics-secret")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		SyncLocks struct {
+			Acquired *int64 `json:"acquired"`
+		} `json:"sync_locks"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil || body.SyncLocks.Acquired == nil {
+		t.Errorf("expected sync lock stats, got %s (%v)", w.Body.String(), err)
+	}
+}
+
+func TestRestore_RevertsChangesMadeSince(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	cookie := authenticateTestUser(t, server, "test@localhost")
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	var goal models.Goal
+	json.NewDecoder(do("POST", "/api/v1/goals", `{"name": "Exercise", "color": "#4CAF50"}`).Body).Decode(&goal)
+	before := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+
+	do("PATCH", "/api/v1/goals/"+goal.ID, `{"name": "Running"}`)
+	do("POST", "/api/v1/goals", `{"name": "Reading", "color": "#2196F3"}`)
+
+	if w := do("POST", "/api/v1/restore", `{"at": "2999-01-01T00:00:00Z"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a future time, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do("POST", "/api/v1/restore", fmt.Sprintf(`{"at": %q}`, before.Format(time.RFC3339Nano)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Restored int `json:"restored"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Restored != 2 {
+		t.Errorf("expected 2 rows restored, got %d", resp.Restored)
+	}
+
+	var goals []models.Goal
+	json.NewDecoder(do("GET", "/api/v1/goals", "").Body).Decode(&goals)
+	if len(goals) != 1 || goals[0].ID != goal.ID || goals[0].Name != "Exercise" {
+		t.Errorf("expected only the original goal, got %+v", goals)
+	}
+}
+
+func TestSyncDigest(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	cookie := authenticateTestUser(t, server, "test@localhost")
+	createReq := httptest.NewRequest("POST", "/api/v1/goals", bytes.NewBufferString(`{"name": "Exercise", "color": "#4CAF50"}`))
+	createReq.Header.Set("Content-Type", "application/json")
+	createReq.AddCookie(cookie)
+	server.ServeHTTP(httptest.NewRecorder(), createReq)
+
+	req := httptest.NewRequest("GET", "/api/v1/sync/digest", nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var digest struct {
+		Root   string            `json:"root"`
+		Goals  string            `json:"goals"`
+		Months []json.RawMessage `json:"months"`
+		Cursor string            `json:"cursor"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&digest); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(digest.Root) != 64 || len(digest.Goals) != 64 || digest.Cursor == "" {
+		t.Errorf("expected hex hashes and a cursor, got %+v", digest)
+	}
+	if digest.Months == nil || len(digest.Months) != 0 {
+		t.Errorf("expected an empty months list, got %v", digest.Months)
+	}
+}
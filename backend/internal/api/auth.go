@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"html/template"
 	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/apsv/goal-tracker/backend/internal/auth"
+	"github.com/apsv/goal-tracker/backend/internal/models"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -142,6 +145,62 @@ func (s *Server) deleteAccount(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// localePattern accepts BCP 47-style tags ("en", "pt-BR", "zh-Hant-TW").
+// Locales without a notification catalog are stored as given and rendered
+// in English.
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8}){0,2}$`)
+
+// updateAccount handles PATCH /api/v1/account.
+// The timezone and locale are editable; they drive server-side notifications.
+func (s *Server) updateAccount(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Timezone != nil {
+		// "Local" would resolve to the server's zone, not the user's.
+		if *req.Timezone == "" || *req.Timezone == "Local" {
+			http.Error(w, "timezone must be an IANA zone name", http.StatusBadRequest)
+			return
+		}
+		if _, err := time.LoadLocation(*req.Timezone); err != nil {
+			http.Error(w, "timezone must be an IANA zone name", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.UpdateUserTimezone(user.ID, *req.Timezone); err != nil {
+			serverError(w, err)
+			return
+		}
+	}
+
+	if req.Locale != nil {
+		if !localePattern.MatchString(*req.Locale) {
+			http.Error(w, "locale must be a language tag such as \"en\" or \"pt-BR\"", http.StatusBadRequest)
+			return
+		}
+		if err := s.db.UpdateUserLocale(user.ID, *req.Locale); err != nil {
+			serverError(w, err)
+			return
+		}
+	}
+
+	updated, err := s.db.GetUserByID(user.ID)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
 // devLogin creates a session for a given email without OAuth.
 // This endpoint is only available in development mode.
 func (s *Server) devLogin(w http.ResponseWriter, r *http.Request) {
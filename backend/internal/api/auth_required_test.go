@@ -26,8 +26,21 @@ func TestAuthRequired_ProtectedEndpoints(t *testing.T) {
 		{"DELETE", "/api/v1/completions/some-id", ""},
 		{"GET", "/api/v1/calendar?month=2026-01", ""},
 		{"POST", "/api/v1/sync", `{"goals":[],"completions":[]}`},
+		{"GET", "/api/v1/sync/digest", ""},
+		{"POST", "/api/v1/restore", `{"at":"2026-01-01T00:00:00Z"}`},
+		{"GET", "/api/v1/devices", ""},
 		{"POST", "/api/v1/devices", `{"token":"x","platform":"android"}`},
+		{"PATCH", "/api/v1/devices/some-id", `{"name":"x"}`},
 		{"DELETE", "/api/v1/devices/some-id", ""},
+		{"POST", "/api/v1/devices/some-id/test", ""},
+		{"GET", "/api/v1/push/web/public-key", ""},
+		{"GET", "/api/v1/reminders", ""},
+		{"POST", "/api/v1/reminders", `{"frequency":"daily","time":"19:00"}`},
+		{"PATCH", "/api/v1/reminders/some-id", `{"enabled":false}`},
+		{"DELETE", "/api/v1/reminders/some-id", ""},
+		{"GET", "/api/v1/streak-alerts", ""},
+		{"PATCH", "/api/v1/streak-alerts", `{"enabled":false}`},
+		{"PATCH", "/api/v1/account", `{"timezone":"UTC"}`},
 	}
 
 	for _, tc := range tests {
@@ -112,6 +112,7 @@ func (s *Server) createCompletion(w http.ResponseWriter, r *http.Request) {
 		serverError(w, err)
 		return
 	}
+	s.dataWritten(r, userID)
 
 	writeJSON(w, http.StatusCreated, completion)
 }
@@ -146,6 +147,7 @@ func (s *Server) deleteCompletion(w http.ResponseWriter, r *http.Request) {
 		serverError(w, err)
 		return
 	}
+	s.dataWritten(r, userID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -1,14 +1,92 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/apsv/goal-tracker/backend/internal/auth"
 	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/push"
 	"github.com/go-chi/chi/v5"
 )
 
+// deviceIDHeader carries the device_tokens ID (returned by POST /devices) of
+// the device making a write, so that device is left out of the "data changed"
+// push that follows.
+const deviceIDHeader = "X-Device-ID"
+
+// maxDeviceNameLength bounds user-chosen device names and app versions.
+const maxDeviceNameLength = 64
+
+// testNotificationTimeout bounds the synchronous send of a test notification.
+const testNotificationTimeout = 15 * time.Second
+
+// notifyDataChanged schedules a silent sync push to the user's other devices.
+func (s *Server) notifyDataChanged(r *http.Request, userID string) {
+	s.syncNotifier.Notify(userID, r.Header.Get(deviceIDHeader))
+}
+
+// dataWritten tells the user's open streams and other devices that a REST
+// handler changed their goals or completions.
+func (s *Server) dataWritten(r *http.Request, userID *string) {
+	if userID == nil {
+		return
+	}
+	s.syncService.PublishChange(*userID)
+	s.notifyDataChanged(r, *userID)
+}
+
+// touchDevice records that the device named by the X-Device-ID header just
+// talked to the server. Unknown IDs or other users' devices are ignored.
+func (s *Server) touchDevice(r *http.Request, userID string) {
+	deviceID := r.Header.Get(deviceIDHeader)
+	if deviceID == "" {
+		return
+	}
+	if err := s.db.TouchDeviceToken(userID, deviceID); err != nil {
+		Logger.Warn("failed to update device last seen", "error", err, "user_id", userID)
+	}
+}
+
+// normalizeDeviceLabel trims a device name or app version and enforces the
+// length limit. Returns false if it is too long.
+func normalizeDeviceLabel(v *string) (*string, bool) {
+	if v == nil {
+		return nil, true
+	}
+	trimmed := strings.TrimSpace(*v)
+	if utf8.RuneCountInString(trimmed) > maxDeviceNameLength {
+		return nil, false
+	}
+	return &trimmed, true
+}
+
+// listDevices handles GET /api/v1/devices
+// Returns the user's registered devices, newest first.
+// Requires authentication.
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	devices, err := s.db.GetDeviceTokensByUserID(user.ID)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if devices == nil {
+		devices = []models.DeviceToken{}
+	}
+	writeJSON(w, http.StatusOK, devices)
+}
+
 // registerDevice handles POST /api/v1/devices
 // Registers a device token for push notifications.
 // Requires authentication.
@@ -25,15 +103,46 @@ func (s *Server) registerDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate token
-	if req.Token == "" {
-		http.Error(w, "token is required", http.StatusBadRequest)
+	switch req.Platform {
+	case "android", "ios":
+		if req.Token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+			return
+		}
+	case "web":
+		// Without VAPID keys nothing could deliver to the subscription.
+		if s.webPush == nil {
+			http.Error(w, "web push is not configured", http.StatusNotImplemented)
+			return
+		}
+		// Browser subscriptions are stored as an encoded endpoint+keys token
+		if req.Keys == nil {
+			http.Error(w, "keys are required for web push", http.StatusBadRequest)
+			return
+		}
+		sub := push.WebSubscription{
+			Endpoint: req.Endpoint,
+			Keys:     push.WebSubscriptionKeys{P256dh: req.Keys.P256dh, Auth: req.Keys.Auth},
+		}
+		token, err := s.webPush.SubscriptionToken(sub)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Token = token
+	default:
+		http.Error(w, "platform must be 'android', 'ios' or 'web'", http.StatusBadRequest)
 		return
 	}
 
-	// Validate platform
-	if req.Platform != "android" && req.Platform != "ios" {
-		http.Error(w, "platform must be 'android' or 'ios'", http.StatusBadRequest)
+	name, ok := normalizeDeviceLabel(req.Name)
+	if !ok {
+		http.Error(w, "name is too long", http.StatusBadRequest)
+		return
+	}
+	appVersion, ok := normalizeDeviceLabel(req.AppVersion)
+	if !ok {
+		http.Error(w, "app_version is too long", http.StatusBadRequest)
 		return
 	}
 
@@ -44,6 +153,19 @@ func (s *Server) registerDevice(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to register device", http.StatusInternalServerError)
 		return
 	}
+	if name != nil || appVersion != nil {
+		if err := s.db.UpdateDeviceToken(user.ID, dt.ID, name, appVersion); err != nil {
+			Logger.Error("failed to update device metadata", "error", err, "user_id", user.ID)
+			http.Error(w, "failed to register device", http.StatusInternalServerError)
+			return
+		}
+		if name != nil {
+			dt.Name = *name
+		}
+		if appVersion != nil {
+			dt.AppVersion = *appVersion
+		}
+	}
 
 	writeJSON(w, http.StatusCreated, dt)
 }
@@ -65,22 +187,13 @@ func (s *Server) unregisterDevice(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify the token belongs to the user
-	tokens, err := s.db.GetDeviceTokensByUserID(user.ID)
+	dt, err := s.db.GetDeviceToken(user.ID, tokenID)
 	if err != nil {
-		Logger.Error("failed to get device tokens", "error", err, "user_id", user.ID)
+		Logger.Error("failed to get device token", "error", err, "user_id", user.ID)
 		http.Error(w, "failed to unregister device", http.StatusInternalServerError)
 		return
 	}
-
-	var tokenBelongsToUser bool
-	for _, t := range tokens {
-		if t.ID == tokenID {
-			tokenBelongsToUser = true
-			break
-		}
-	}
-
-	if !tokenBelongsToUser {
+	if dt == nil {
 		http.Error(w, "device token not found", http.StatusNotFound)
 		return
 	}
@@ -94,3 +207,111 @@ func (s *Server) unregisterDevice(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// updateDevice handles PATCH /api/v1/devices/{id}
+// Renames a device. An empty name clears it.
+// Requires authentication.
+func (s *Server) updateDevice(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	name, ok := normalizeDeviceLabel(req.Name)
+	if !ok {
+		http.Error(w, "name is too long", http.StatusBadRequest)
+		return
+	}
+
+	tokenID := chi.URLParam(r, "id")
+	dt, err := s.db.GetDeviceToken(user.ID, tokenID)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if dt == nil {
+		http.Error(w, "device token not found", http.StatusNotFound)
+		return
+	}
+
+	if name != nil {
+		if err := s.db.UpdateDeviceToken(user.ID, tokenID, name, nil); err != nil {
+			serverError(w, err)
+			return
+		}
+		dt.Name = *name
+	}
+
+	writeJSON(w, http.StatusOK, dt)
+}
+
+// testDevice handles POST /api/v1/devices/{id}/test
+// Sends a test notification to one device and reports the provider's answer,
+// so users can check a device is reachable. A token the provider reports as
+// dead is removed, as with any other send.
+// Requires authentication.
+func (s *Server) testDevice(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	dt, err := s.db.GetDeviceToken(user.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if dt == nil {
+		http.Error(w, "device token not found", http.StatusNotFound)
+		return
+	}
+
+	notification, err := push.DefaultTemplates().Render(user.Locale, push.KindTestNotification, push.TemplateArgs{})
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	notification.Data = map[string]string{"type": "test"}
+
+	ctx, cancel := context.WithTimeout(r.Context(), testNotificationTimeout)
+	defer cancel()
+	err = s.pushDelivery.SendToDevice(ctx, *dt, notification)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+	case push.IsTokenDead(err):
+		writeJSON(w, http.StatusGone, map[string]string{
+			"status": "removed",
+			"error":  "the push provider no longer accepts this device; it has been removed",
+		})
+	default:
+		// The provider's error can quote the token or the server's
+		// configuration, so it is only logged.
+		Logger.Warn("test notification failed", "error", err, "user_id", user.ID, "token_id", dt.ID)
+		status, msg := "failed", "the push provider did not accept the notification"
+		if errors.Is(err, push.ErrUnavailable) {
+			status, msg = "unavailable", "the push provider is unavailable; try again later"
+		}
+		writeJSON(w, http.StatusBadGateway, map[string]string{
+			"status": status,
+			"error":  msg,
+		})
+	}
+}
+
+// webPushPublicKey handles GET /api/v1/push/web/public-key
+// Returns the VAPID application server key browsers need to subscribe.
+func (s *Server) webPushPublicKey(w http.ResponseWriter, r *http.Request) {
+	if s.webPush == nil {
+		http.Error(w, "web push is not configured", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"public_key": s.webPush.PublicKey()})
+}
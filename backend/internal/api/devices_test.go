@@ -0,0 +1,207 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/apsv/goal-tracker/backend/internal/api"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/push"
+)
+
+// A valid uncompressed P-256 point and 16-byte auth secret (RFC 8291 appendix A).
+const webSubscriptionBody = `{"platform":"web","endpoint":"https://fcm.googleapis.com/fcm/send/abc",` +
+	`"keys":{"p256dh":"BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4","auth":"BTBZMqHH6r4Tts7J_aSIgg"}}`
+
+// useTestWebPush configures web push on server with a fresh VAPID key.
+func useTestWebPush(t *testing.T, server *api.Server) {
+	t.Helper()
+	key, _, err := push.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("generate VAPID keys: %v", err)
+	}
+	svc, err := push.NewWebPushService(push.WebPushConfig{VAPIDPrivateKey: key, Subject: "mailto:test@example.com"})
+	if err != nil {
+		t.Fatalf("web push service: %v", err)
+	}
+	server.UseWebPush(svc)
+}
+
+func TestDevices_RegisterWebSubscription(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	useTestWebPush(t, server)
+	cookie := authenticateTestUser(t, server, "webpush@test.com")
+
+	w := doJSON(t, server, cookie, "POST", "/api/v1/devices", webSubscriptionBody)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "BTBZMqHH6r4Tts7J_aSIgg") {
+		t.Errorf("expected the subscription's keys kept from the response, got %s", w.Body.String())
+	}
+	var first models.DeviceToken
+	json.NewDecoder(w.Body).Decode(&first)
+	if first.Platform != "web" || first.ID == "" {
+		t.Errorf("unexpected device: %+v", first)
+	}
+
+	// Re-subscribing with the same subscription must not create a second row.
+	w = doJSON(t, server, cookie, "POST", "/api/v1/devices", webSubscriptionBody)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("re-register: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var second models.DeviceToken
+	json.NewDecoder(w.Body).Decode(&second)
+	if second.ID != first.ID {
+		t.Errorf("expected the same device on re-register, got %s and %s", first.ID, second.ID)
+	}
+}
+
+func TestDevices_RegisterValidation(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	useTestWebPush(t, server)
+	cookie := authenticateTestUser(t, server, "webpush-invalid@test.com")
+
+	cases := []struct {
+		name string
+		body string
+	}{
+		{"unknown platform", `{"token":"x","platform":"windows"}`},
+		{"native without token", `{"platform":"android"}`},
+		{"web without keys", `{"platform":"web","endpoint":"https://fcm.googleapis.com/fcm/send/x"}`},
+		{"web with http endpoint", `{"platform":"web","endpoint":"http://fcm.googleapis.com/fcm/send/x","keys":{"p256dh":"BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4","auth":"BTBZMqHH6r4Tts7J_aSIgg"}}`},
+		{"web with unknown push service", `{"platform":"web","endpoint":"https://10.0.0.1/x","keys":{"p256dh":"BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4","auth":"BTBZMqHH6r4Tts7J_aSIgg"}}`},
+		{"web with bad auth", `{"platform":"web","endpoint":"https://fcm.googleapis.com/fcm/send/x","keys":{"p256dh":"BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4","auth":"abc"}}`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doJSON(t, server, cookie, "POST", "/api/v1/devices", tc.body)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected 400, got %d: %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDevices_WebPushNotConfigured(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	cookie := authenticateTestUser(t, server, "webpush-key@test.com")
+
+	w := doJSON(t, server, cookie, "GET", "/api/v1/push/web/public-key", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without VAPID keys, got %d", w.Code)
+	}
+	// Nothing could deliver to a subscription, so none is stored.
+	w = doJSON(t, server, cookie, "POST", "/api/v1/devices", webSubscriptionBody)
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected 501 registering a browser without VAPID keys, got %d", w.Code)
+	}
+	w = doJSON(t, server, cookie, "GET", "/api/v1/devices", "")
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("expected no devices stored, got %s", w.Body.String())
+	}
+}
+
+func TestDevices_ListRenameAndTest(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	cookie := authenticateTestUser(t, server, "devices-owner@test.com")
+	other := authenticateTestUser(t, server, "devices-other@test.com")
+
+	w := doJSON(t, server, cookie, "POST", "/api/v1/devices", `{"token":"phone-token","platform":"android","app_version":"2.4.0","name":" Pixel "}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var registered models.DeviceToken
+	json.NewDecoder(w.Body).Decode(&registered)
+	if registered.Name != "Pixel" || registered.AppVersion != "2.4.0" || registered.LastSeenAt == nil {
+		t.Errorf("expected metadata on the registered device, got %+v", registered)
+	}
+	doJSON(t, server, other, "POST", "/api/v1/devices", `{"token":"other-token","platform":"ios"}`)
+
+	w = doJSON(t, server, cookie, "GET", "/api/v1/devices", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "phone-token") {
+		t.Errorf("expected the push token kept from the list, got %s", w.Body.String())
+	}
+	var devices []models.DeviceToken
+	json.NewDecoder(w.Body).Decode(&devices)
+	if len(devices) != 1 || devices[0].ID != registered.ID {
+		t.Fatalf("expected only the owner's device, got %+v", devices)
+	}
+
+	// Re-registering without a name keeps the user's name.
+	doJSON(t, server, cookie, "POST", "/api/v1/devices", `{"token":"phone-token","platform":"android","app_version":"2.5.0"}`)
+	w = doJSON(t, server, cookie, "PATCH", "/api/v1/devices/"+registered.ID, `{"name":"Work phone"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("rename: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var renamed models.DeviceToken
+	json.NewDecoder(w.Body).Decode(&renamed)
+	if renamed.Name != "Work phone" || renamed.AppVersion != "2.5.0" {
+		t.Errorf("unexpected device after rename: %+v", renamed)
+	}
+
+	// Another user can neither rename, test nor delete the device.
+	for _, req := range []struct{ method, path, body string }{
+		{"PATCH", "/api/v1/devices/" + registered.ID, `{"name":"mine now"}`},
+		{"POST", "/api/v1/devices/" + registered.ID + "/test", ""},
+		{"DELETE", "/api/v1/devices/" + registered.ID, ""},
+	} {
+		if w := doJSON(t, server, other, req.method, req.path, req.body); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s as another user: expected 404, got %d", req.method, req.path, w.Code)
+		}
+	}
+
+	// The test server uses the stub push service, which accepts every send.
+	w = doJSON(t, server, cookie, "POST", "/api/v1/devices/"+registered.ID+"/test", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("test notification: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDevices_TestFailureHidesProviderError(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	cookie := authenticateTestUser(t, server, "devices-failure@test.com")
+
+	// The test server routes no iOS service, so the send fails.
+	w := doJSON(t, server, cookie, "POST", "/api/v1/devices", `{"token":"ios-token","platform":"ios"}`)
+	var dt models.DeviceToken
+	json.NewDecoder(w.Body).Decode(&dt)
+
+	w = doJSON(t, server, cookie, "POST", "/api/v1/devices/"+dt.ID+"/test", "")
+	if w.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["status"] != "failed" || resp["error"] != "the push provider did not accept the notification" {
+		t.Errorf("expected a generic failure, got %+v", resp)
+	}
+}
+
+func TestDevices_RenameValidation(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	cookie := authenticateTestUser(t, server, "devices-rename@test.com")
+
+	w := doJSON(t, server, cookie, "POST", "/api/v1/devices", `{"token":"rename-token","platform":"ios"}`)
+	var dt models.DeviceToken
+	json.NewDecoder(w.Body).Decode(&dt)
+
+	long := `{"name":"` + strings.Repeat("x", 65) + `"}`
+	if w := doJSON(t, server, cookie, "PATCH", "/api/v1/devices/"+dt.ID, long); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a long name, got %d", w.Code)
+	}
+	if w := doJSON(t, server, cookie, "PATCH", "/api/v1/devices/missing", `{"name":"x"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown device, got %d", w.Code)
+	}
+}
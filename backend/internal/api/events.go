@@ -21,6 +21,8 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.touchDevice(r, user.ID)
+
 	var req sync.EventsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{
@@ -43,7 +45,8 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate each event has an ID and type
+	// Results are reported by event ID, so an event without one cannot be
+	// answered on its own. A missing type is rejected per event instead.
 	for _, event := range req.Events {
 		if event.ID == "" {
 			writeJSON(w, http.StatusBadRequest, map[string]string{
@@ -51,12 +54,6 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 			})
 			return
 		}
-		if event.Type == "" {
-			writeJSON(w, http.StatusBadRequest, map[string]string{
-				"error": "each event must have a type",
-			})
-			return
-		}
 	}
 
 	resp, err := s.syncService.ProcessEvents(user.ID, req.Events)
@@ -70,6 +67,9 @@ func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	if resp.Applied > 0 {
+		s.notifyDataChanged(r, user.ID)
+	}
 
 	writeJSON(w, http.StatusOK, resp)
 }
@@ -119,6 +119,7 @@ func (s *Server) createGoal(w http.ResponseWriter, r *http.Request) {
 		serverError(w, err)
 		return
 	}
+	s.dataWritten(r, userID)
 
 	writeJSON(w, http.StatusCreated, goal)
 }
@@ -172,6 +173,7 @@ func (s *Server) updateGoal(w http.ResponseWriter, r *http.Request) {
 		serverError(w, err)
 		return
 	}
+	s.dataWritten(r, userID)
 
 	// Fetch updated goal
 	goal, err = s.db.GetGoal(userID, id)
@@ -202,6 +204,7 @@ func (s *Server) archiveGoal(w http.ResponseWriter, r *http.Request) {
 		serverError(w, err)
 		return
 	}
+	s.dataWritten(r, userID)
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -224,6 +227,7 @@ func (s *Server) reorderGoals(w http.ResponseWriter, r *http.Request) {
 		serverError(w, err)
 		return
 	}
+	s.dataWritten(r, userID)
 
 	// Return updated list
 	goals, err := s.db.ListGoals(userID, false)
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/apsv/goal-tracker/backend/internal/sync"
+)
+
+// metricsResponse is the body of GET /metrics.
+type metricsResponse struct {
+	SyncLocks sync.LockStats `json:"sync_locks"`
+}
+
+// handleMetrics reports internal counters for monitoring. Callers must send
+// token as a bearer token; the route is only registered when METRICS_TOKEN
+// is set.
+func (s *Server) handleMetrics(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{
+				"error": "invalid metrics token",
+			})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, metricsResponse{
+			SyncLocks: s.syncService.LockStats(),
+		})
+	}
+}
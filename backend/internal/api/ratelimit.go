@@ -126,3 +126,36 @@ func UserRateLimitMiddleware(limiters ...*RateLimiter) func(http.Handler) http.H
 		})
 	}
 }
+
+// streamCounter limits open streams per user. Unlike RateLimiter it counts
+// connections that are open now, not requests in a window.
+type streamCounter struct {
+	mu   sync.Mutex
+	open map[string]int
+	max  int
+}
+
+func newStreamCounter(max int) *streamCounter {
+	return &streamCounter{open: make(map[string]int), max: max}
+}
+
+// acquire reserves a stream for userID, or returns false if the user already
+// has max open.
+func (c *streamCounter) acquire(userID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.open[userID] >= c.max {
+		return false
+	}
+	c.open[userID]++
+	return true
+}
+
+func (c *streamCounter) release(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.open[userID]--
+	if c.open[userID] <= 0 {
+		delete(c.open, userID)
+	}
+}
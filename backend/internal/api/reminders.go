@@ -0,0 +1,232 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/apsv/goal-tracker/backend/internal/auth"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/reminders"
+	"github.com/go-chi/chi/v5"
+)
+
+// validateReminderSchedule checks frequency, time and weekday together.
+func validateReminderSchedule(frequency, timeOfDay string, weekday int) (bool, string) {
+	if frequency != "daily" && frequency != "weekly" {
+		return false, "frequency must be \"daily\" or \"weekly\""
+	}
+	if _, _, err := reminders.ParseTimeOfDay(timeOfDay); err != nil {
+		return false, "time must be in HH:MM 24-hour format"
+	}
+	if weekday < 0 || weekday > 6 {
+		return false, "weekday must be between 0 (Sunday) and 6 (Saturday)"
+	}
+	return true, ""
+}
+
+// listReminders handles GET /api/v1/reminders
+func (s *Server) listReminders(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	list, err := s.db.ListReminders(user.ID)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if list == nil {
+		list = []models.Reminder{}
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+// createReminder handles POST /api/v1/reminders
+// A reminder without goal_id covers all of the user's active goals.
+func (s *Server) createReminder(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if valid, errMsg := validateReminderSchedule(req.Frequency, req.Time, req.Weekday); !valid {
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	// Verify the goal belongs to the user
+	if req.GoalID != nil {
+		goal, err := s.db.GetGoal(&user.ID, *req.GoalID)
+		if err != nil {
+			serverError(w, err)
+			return
+		}
+		if goal == nil {
+			http.Error(w, "goal not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	reminder := &models.Reminder{
+		UserID:    user.ID,
+		GoalID:    req.GoalID,
+		Frequency: req.Frequency,
+		Time:      req.Time,
+		Weekday:   req.Weekday,
+		Enabled:   enabled,
+	}
+	if err := s.db.CreateReminder(reminder); err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, reminder)
+}
+
+// updateReminder handles PATCH /api/v1/reminders/{id}
+func (s *Server) updateReminder(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateReminderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	reminder, err := s.db.GetReminder(user.ID, chi.URLParam(r, "id"))
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if reminder == nil {
+		http.Error(w, "reminder not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Frequency != nil {
+		reminder.Frequency = *req.Frequency
+	}
+	if req.Time != nil {
+		reminder.Time = *req.Time
+	}
+	if req.Weekday != nil {
+		reminder.Weekday = *req.Weekday
+	}
+	if req.Enabled != nil {
+		reminder.Enabled = *req.Enabled
+	}
+
+	if valid, errMsg := validateReminderSchedule(reminder.Frequency, reminder.Time, reminder.Weekday); !valid {
+		http.Error(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.UpdateReminder(reminder); err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, reminder)
+}
+
+// deleteReminder handles DELETE /api/v1/reminders/{id}
+func (s *Server) deleteReminder(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	reminder, err := s.db.GetReminder(user.ID, id)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if reminder == nil {
+		http.Error(w, "reminder not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.db.DeleteReminder(user.ID, id); err != nil {
+		serverError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getStreakAlertSettings handles GET /api/v1/streak-alerts
+func (s *Server) getStreakAlertSettings(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	settings, err := s.db.GetStreakAlertSettings(user.ID)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// updateStreakAlertSettings handles PATCH /api/v1/streak-alerts
+// Setting enabled to false opts the user out of streak alerts.
+func (s *Server) updateStreakAlertSettings(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateStreakAlertSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := s.db.GetStreakAlertSettings(user.ID)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if req.Enabled != nil {
+		settings.Enabled = *req.Enabled
+	}
+	if req.Time != nil {
+		if _, _, err := reminders.ParseTimeOfDay(*req.Time); err != nil {
+			http.Error(w, "time must be in HH:MM 24-hour format", http.StatusBadRequest)
+			return
+		}
+		settings.Time = *req.Time
+	}
+
+	if err := s.db.SaveStreakAlertSettings(user.ID, *settings); err != nil {
+		serverError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, settings)
+}
@@ -0,0 +1,187 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apsv/goal-tracker/backend/internal/api"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+)
+
+func doJSON(t *testing.T, server *api.Server, cookie *http.Cookie, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	return w
+}
+
+func TestReminders_CRUD(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	cookie := authenticateTestUser(t, server, "reminders@test.com")
+
+	w := doJSON(t, server, cookie, "POST", "/api/v1/reminders", `{"frequency":"weekly","time":"19:30","weekday":2}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created models.Reminder
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.ID == "" || !created.Enabled || created.Time != "19:30" || created.Weekday != 2 {
+		t.Errorf("unexpected reminder: %+v", created)
+	}
+
+	w = doJSON(t, server, cookie, "PATCH", "/api/v1/reminders/"+created.ID, `{"time":"07:15","enabled":false}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(t, server, cookie, "GET", "/api/v1/reminders", "")
+	var list []models.Reminder
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list) != 1 || list[0].Time != "07:15" || list[0].Enabled {
+		t.Errorf("expected updated reminder in list, got %+v", list)
+	}
+
+	w = doJSON(t, server, cookie, "DELETE", "/api/v1/reminders/"+created.ID, "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete: expected 204, got %d", w.Code)
+	}
+	w = doJSON(t, server, cookie, "GET", "/api/v1/reminders", "")
+	if w.Body.String() != "[]\n" {
+		t.Errorf("expected empty list after delete, got %s", w.Body.String())
+	}
+}
+
+func TestReminders_Validation(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	cookie := authenticateTestUser(t, server, "reminders@test.com")
+
+	bodies := []string{
+		`{"frequency":"hourly","time":"19:00"}`,
+		`{"frequency":"daily","time":"7pm"}`,
+		`{"frequency":"weekly","time":"19:00","weekday":7}`,
+	}
+	for _, body := range bodies {
+		w := doJSON(t, server, cookie, "POST", "/api/v1/reminders", body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestReminders_GoalMustBelongToUser(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	alice := authenticateTestUser(t, server, "alice@test.com")
+	bob := authenticateTestUser(t, server, "bob@test.com")
+
+	w := doJSON(t, server, alice, "POST", "/api/v1/goals", `{"name":"Alice goal"}`)
+	var goal models.Goal
+	json.NewDecoder(w.Body).Decode(&goal)
+
+	w = doJSON(t, server, bob, "POST", "/api/v1/reminders", `{"goal_id":"`+goal.ID+`","frequency":"daily","time":"08:00"}`)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's goal, got %d", w.Code)
+	}
+
+	w = doJSON(t, server, alice, "POST", "/api/v1/reminders", `{"goal_id":"`+goal.ID+`","frequency":"daily","time":"08:00"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	var reminder models.Reminder
+	json.NewDecoder(w.Body).Decode(&reminder)
+
+	w = doJSON(t, server, bob, "DELETE", "/api/v1/reminders/"+reminder.ID, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting another user's reminder, got %d", w.Code)
+	}
+}
+
+func TestUpdateAccount_Timezone(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	cookie := authenticateTestUser(t, server, "tz@test.com")
+
+	w := doJSON(t, server, cookie, "PATCH", "/api/v1/account", `{"timezone":"America/Sao_Paulo"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var user models.User
+	json.NewDecoder(w.Body).Decode(&user)
+	if user.Timezone != "America/Sao_Paulo" {
+		t.Errorf("expected timezone to be saved, got %q", user.Timezone)
+	}
+
+	w = doJSON(t, server, cookie, "PATCH", "/api/v1/account", `{"timezone":"Mars/Olympus_Mons"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown zone, got %d", w.Code)
+	}
+}
+
+func TestUpdateAccount_Locale(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	cookie := authenticateTestUser(t, server, "locale@test.com")
+
+	w := doJSON(t, server, cookie, "GET", "/api/v1/auth/me", "")
+	var user models.User
+	json.NewDecoder(w.Body).Decode(&user)
+	if user.Locale != "en" {
+		t.Errorf("expected default locale en, got %q", user.Locale)
+	}
+
+	w = doJSON(t, server, cookie, "PATCH", "/api/v1/account", `{"locale":"pt-BR"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	json.NewDecoder(w.Body).Decode(&user)
+	if user.Locale != "pt-BR" {
+		t.Errorf("expected locale to be saved, got %q", user.Locale)
+	}
+
+	for _, bad := range []string{`""`, `"pt_BR!"`, `"english please"`} {
+		w = doJSON(t, server, cookie, "PATCH", "/api/v1/account", `{"locale":`+bad+`}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("locale %s: expected 400, got %d", bad, w.Code)
+		}
+	}
+}
+
+func TestStreakAlertSettings(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	cookie := authenticateTestUser(t, server, "streaks@test.com")
+
+	w := doJSON(t, server, cookie, "GET", "/api/v1/streak-alerts", "")
+	var settings models.StreakAlertSettings
+	json.NewDecoder(w.Body).Decode(&settings)
+	if w.Code != http.StatusOK || !settings.Enabled || settings.Time != "20:00" {
+		t.Fatalf("expected opted-in defaults, got %d %+v", w.Code, settings)
+	}
+
+	w = doJSON(t, server, cookie, "PATCH", "/api/v1/streak-alerts", `{"time":"25:00"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid time: expected 400, got %d", w.Code)
+	}
+
+	w = doJSON(t, server, cookie, "PATCH", "/api/v1/streak-alerts", `{"enabled":false,"time":"21:30"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = doJSON(t, server, cookie, "GET", "/api/v1/streak-alerts", "")
+	settings = models.StreakAlertSettings{}
+	json.NewDecoder(w.Body).Decode(&settings)
+	if settings.Enabled || settings.Time != "21:30" {
+		t.Errorf("expected saved settings, got %+v", settings)
+	}
+}
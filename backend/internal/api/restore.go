@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/auth"
+	"github.com/apsv/goal-tracker/backend/internal/db"
+)
+
+// restoreRequest is the body of POST /api/v1/restore.
+type restoreRequest struct {
+	// At is the point in time to restore the user's data to.
+	At time.Time `json:"at"`
+}
+
+// restoreResponse reports how many goals and completions a restore rewrote.
+type restoreResponse struct {
+	Restored int `json:"restored"`
+}
+
+// handleRestore rewrites the user's goals and completions to their state at
+// a past time. Other devices receive the result through sync.
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "authentication required",
+		})
+		return
+	}
+
+	var req restoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+		return
+	}
+	if req.At.IsZero() || req.At.After(time.Now()) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "at must be a time in the past",
+		})
+		return
+	}
+
+	n, err := s.syncService.Restore(user.ID, req.At)
+	if errors.Is(err, db.ErrBeforeHistory) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "at is before the history kept for your data",
+		})
+		return
+	}
+	if err != nil {
+		Logger.Error("restore failed",
+			"user_id", user.ID,
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "restore failed",
+		})
+		return
+	}
+	if n > 0 {
+		s.notifyDataChanged(r, user.ID)
+	}
+
+	writeJSON(w, http.StatusOK, restoreResponse{Restored: n})
+}
@@ -12,7 +12,10 @@ import (
 	"time"
 
 	"github.com/apsv/goal-tracker/backend/internal/auth"
+	"github.com/apsv/goal-tracker/backend/internal/bus"
 	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/push"
+	"github.com/apsv/goal-tracker/backend/internal/reminders"
 	"github.com/apsv/goal-tracker/backend/internal/sync"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -65,9 +68,20 @@ type Server struct {
 	frontendURL            string
 	authCodeStore          *auth.AuthCodeStore
 	syncService            *sync.Service
+	pushService            push.PushService
+	pushDispatcher         *push.Dispatcher
+	pushDelivery           *push.Delivery
+	pushOutbox             *push.Outbox
+	webPush                *push.WebPushService
+	syncNotifier           *push.SyncNotifier
+	reminderScheduler      *reminders.Scheduler
+	streakAlerts           *reminders.StreakAlerts
+	streams                *streamCounter
 }
 
-func NewServer(database db.Database, staticFS fs.FS) *Server {
+// NewServer builds the HTTP server. pushService may be nil, in which case
+// notifications are only logged (push.StubService).
+func NewServer(database db.Database, staticFS fs.FS, pushService push.PushService) *Server {
 	// Get base URL from environment, default to localhost for dev
 	baseURL := os.Getenv("BASE_URL")
 	if baseURL == "" {
@@ -95,6 +109,14 @@ func NewServer(database db.Database, staticFS fs.FS) *Server {
 	debugReportHourly := NewRateLimiter(5, time.Hour)
 	debugReportDaily := NewRateLimiter(20, 24*time.Hour)
 
+	if pushService == nil {
+		pushService = push.NewStubService(Logger)
+	}
+
+	pushDispatcher := push.NewDispatcher(pushService)
+	pushDelivery := push.NewDelivery(database, pushDispatcher, Logger)
+	pushOutbox := push.NewOutbox(database, pushDelivery, Logger)
+
 	s := &Server{
 		db:                database,
 		staticFS:          staticFS,
@@ -108,11 +130,40 @@ func NewServer(database db.Database, staticFS fs.FS) *Server {
 		frontendURL:       frontendURL,
 		authCodeStore:     auth.NewAuthCodeStore(30 * time.Second),
 		syncService:       sync.NewService(database),
+		pushService:       pushService,
+		pushDispatcher:    pushDispatcher,
+		pushDelivery:      pushDelivery,
+		pushOutbox:        pushOutbox,
+		syncNotifier:      push.NewSyncNotifier(database, pushDelivery, push.DefaultSyncDebounce, Logger),
+		reminderScheduler: reminders.NewScheduler(database, pushOutbox, Logger),
+		streakAlerts:      reminders.NewStreakAlerts(database, pushOutbox, Logger),
+		streams:           newStreamCounter(maxStreamsPerUser),
 	}
 	s.setupRoutes()
 	return s
 }
 
+// RoutePush sends device tokens registered for platform through svc. Only
+// "android" goes through the default push service otherwise. Must be called
+// before the server starts serving.
+func (s *Server) RoutePush(platform string, svc push.PushService) {
+	s.pushDispatcher.Route(platform, svc)
+}
+
+// UseWebPush routes "web" device tokens through svc and publishes its VAPID
+// public key to clients. Must be called before the server starts serving.
+func (s *Server) UseWebPush(svc *push.WebPushService) {
+	s.webPush = svc
+	s.RoutePush("web", svc)
+}
+
+// UseBus shares change notifications with other server instances through b,
+// so a change made on one reaches streams open on all of them. Must be called
+// before the server starts serving.
+func (s *Server) UseBus(b bus.Bus) {
+	s.syncService.UseBus(b)
+}
+
 func (s *Server) setupRoutes() {
 	r := chi.NewRouter()
 
@@ -136,6 +187,11 @@ func (s *Server) setupRoutes() {
 	// Health endpoint
 	r.Get("/health", s.healthCheck)
 
+	// Metrics - only enabled when METRICS_TOKEN is set
+	if token := os.Getenv("METRICS_TOKEN"); token != "" {
+		r.Get("/metrics", s.handleMetrics(token))
+	}
+
 	// API routes
 	r.Route("/api/v1", func(r chi.Router) {
 		// Auth routes with strict rate limiting (10/min - prevent brute force)
@@ -168,11 +224,13 @@ func (s *Server) setupRoutes() {
 
 			// Account deletion
 			r.Delete("/account", s.deleteAccount)
+			r.Patch("/account", s.updateAccount)
 
 			// Sync endpoint with moderate rate limiting (30/min - expensive operation)
 			r.Route("/sync", func(r chi.Router) {
 				r.Use(RateLimitMiddleware(s.syncRateLimiter))
 				r.Post("/", s.handleSync)
+				r.Get("/digest", s.handleSyncDigest)
 			})
 
 			// Events endpoint with moderate rate limiting (like sync)
@@ -181,6 +239,14 @@ func (s *Server) setupRoutes() {
 				r.Post("/", s.handleEvents)
 			})
 
+			// Point-in-time restore, rate limited like sync: it rewrites
+			// every goal and completion that changed since.
+			r.With(RateLimitMiddleware(s.syncRateLimiter)).Post("/restore", s.handleRestore)
+
+			// Change stream (Server-Sent Events). Long-lived, so it is exempt
+			// from requestTimeout and limited by open streams per user instead.
+			r.With(RateLimitMiddleware(s.apiRateLimiter)).Get("/stream", s.handleStream)
+
 			// Data endpoints with generous rate limiting (100/min - normal API use)
 			r.Group(func(r chi.Router) {
 				r.Use(RateLimitMiddleware(s.apiRateLimiter))
@@ -201,8 +267,22 @@ func (s *Server) setupRoutes() {
 				r.Get("/calendar", s.getCalendar)
 
 				// Device tokens (push notifications) - requires authentication
+				r.Get("/devices", s.listDevices)
 				r.Post("/devices", s.registerDevice)
+				r.Patch("/devices/{id}", s.updateDevice)
 				r.Delete("/devices/{id}", s.unregisterDevice)
+				r.Post("/devices/{id}/test", s.testDevice)
+				r.Get("/push/web/public-key", s.webPushPublicKey)
+
+				// Reminders (server-side push schedules)
+				r.Get("/reminders", s.listReminders)
+				r.Post("/reminders", s.createReminder)
+				r.Patch("/reminders/{id}", s.updateReminder)
+				r.Delete("/reminders/{id}", s.deleteReminder)
+
+				// Streak alerts (evening "don't break your streak" push)
+				r.Get("/streak-alerts", s.getStreakAlertSettings)
+				r.Patch("/streak-alerts", s.updateStreakAlertSettings)
 			})
 
 			// Debug reports: user-keyed rate limiting (hourly + daily)
@@ -339,10 +419,14 @@ func securityHeaders(next http.Handler) http.Handler {
 	})
 }
 
-// requestTimeout adds a timeout to all requests
+// requestTimeout adds a timeout to all requests except the change stream
 func requestTimeout(timeout time.Duration) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == streamPath {
+				next.ServeHTTP(w, r)
+				return
+			}
 			ctx, cancel := context.WithTimeout(r.Context(), timeout)
 			defer cancel()
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -401,7 +485,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 
 		if originAllowed {
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+deviceIDHeader)
 		}
 
 		if r.Method == "OPTIONS" {
@@ -443,6 +527,85 @@ func (s *Server) StartSessionCleanup(ctx context.Context, cleanupInterval time.D
 	}()
 }
 
+// StartReminderScheduler starts a background goroutine that sends due
+// reminders every checkInterval. Reminder times have minute resolution, so the
+// interval should be a minute or less. Stops when the context is cancelled.
+func (s *Server) StartReminderScheduler(ctx context.Context, checkInterval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				Logger.Info("reminder scheduler stopped")
+				return
+			case <-ticker.C:
+				if err := s.reminderScheduler.RunOnce(ctx); err != nil {
+					Logger.Error("reminder scheduler pass failed", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// StartStreakAlerts starts a background goroutine that queues streak-at-risk
+// notifications every checkInterval. Like reminders, send times have minute
+// resolution. Stops when the context is cancelled.
+func (s *Server) StartStreakAlerts(ctx context.Context, checkInterval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				Logger.Info("streak alerts stopped")
+				return
+			case <-ticker.C:
+				if err := s.streakAlerts.RunOnce(ctx); err != nil {
+					Logger.Error("streak alerts pass failed", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+// pushOutboxRetention is how long finished push deliveries are kept for
+// inspection (debug-reports deliveries) before the worker deletes them.
+const pushOutboxRetention = 30 * 24 * time.Hour
+
+// StartPushOutboxWorker starts a background goroutine that delivers queued
+// push notifications every pollInterval, retrying transient failures, and
+// prunes finished entries older than pushOutboxRetention once a day.
+func (s *Server) StartPushOutboxWorker(ctx context.Context, pollInterval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		pruneTicker := time.NewTicker(24 * time.Hour)
+		defer pruneTicker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				Logger.Info("push outbox worker stopped")
+				return
+			case <-ticker.C:
+				if _, err := s.pushOutbox.RunOnce(ctx); err != nil && ctx.Err() == nil {
+					Logger.Error("push outbox pass failed", slog.String("error", err.Error()))
+				}
+			case <-pruneTicker.C:
+				n, err := s.pushOutbox.Prune(pushOutboxRetention)
+				if err != nil {
+					Logger.Error("push outbox cleanup failed", slog.String("error", err.Error()))
+					continue
+				}
+				Logger.Info("push outbox cleanup completed", slog.Int64("deleted", n))
+			}
+		}
+	}()
+}
+
 // debugReportRetention is how long debug reports are kept before the cleanup
 // goroutine deletes them. Matches the privacy-policy disclosure.
 const debugReportRetention = 90 * 24 * time.Hour
@@ -480,6 +643,72 @@ func (s *Server) StartDebugReportsCleanup(ctx context.Context, cleanupInterval t
 	}()
 }
 
+// StartDeviceTokenCleanup starts a background goroutine that deletes device
+// tokens not seen for longer than maxAge. Runs immediately on start, then
+// every cleanupInterval, and stops when the context is cancelled.
+func (s *Server) StartDeviceTokenCleanup(ctx context.Context, cleanupInterval, maxAge time.Duration) {
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+
+		runOnce := func() {
+			n, err := s.pushDelivery.PruneStale(maxAge)
+			if err != nil {
+				Logger.Error("device token cleanup failed", slog.String("error", err.Error()))
+				return
+			}
+			Logger.Info("device token cleanup completed", slog.Int64("deleted", n))
+		}
+
+		// Run immediately on startup
+		runOnce()
+
+		for {
+			select {
+			case <-ctx.Done():
+				Logger.Info("device token cleanup stopped")
+				return
+			case <-ticker.C:
+				runOnce()
+			}
+		}
+	}()
+}
+
+// StartTombstoneCompaction starts a background goroutine that hard-deletes
+// goals and completions soft-deleted more than retention ago. Clients that
+// last synced before a purge are told to resync in full. Runs immediately on
+// start, then every interval, and stops when the context is cancelled.
+func (s *Server) StartTombstoneCompaction(ctx context.Context, interval, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		runOnce := func() {
+			cutoff := time.Now().UTC().Add(-retention)
+			n, err := s.db.PurgeTombstones(cutoff)
+			if err != nil {
+				Logger.Error("tombstone compaction failed", slog.String("error", err.Error()))
+				return
+			}
+			Logger.Info("tombstone compaction completed", slog.Int64("deleted", n))
+		}
+
+		// Run immediately on startup
+		runOnce()
+
+		for {
+			select {
+			case <-ctx.Done():
+				Logger.Info("tombstone compaction stopped")
+				return
+			case <-ticker.C:
+				runOnce()
+			}
+		}
+	}()
+}
+
 func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
 	// Ping the database to check connectivity
 	if err := s.db.Ping(); err != nil {
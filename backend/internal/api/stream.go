@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/auth"
+	"github.com/apsv/goal-tracker/backend/internal/sync"
+)
+
+// streamPath is exempt from requestTimeout; a stream stays open for up to
+// streamMaxDuration.
+const streamPath = "/api/v1/stream"
+
+const (
+	// streamHeartbeat is how often an idle stream sends a comment, so proxies
+	// and clients can tell it is still alive.
+	streamHeartbeat = 25 * time.Second
+	// streamMaxDuration is how long one stream stays open. The client then
+	// reconnects with Last-Event-ID and misses nothing.
+	streamMaxDuration = 30 * time.Minute
+	// streamWriteTimeout bounds each write, replacing the server's
+	// WriteTimeout, so a stalled client is dropped.
+	streamWriteTimeout = 10 * time.Second
+	// streamRetry is the reconnect delay sent to EventSource clients.
+	streamRetry = 5 * time.Second
+	// maxStreamsPerUser caps a user's open streams across devices and tabs.
+	maxStreamsPerUser = 10
+)
+
+// streamChanges is the data of a stream's "ready" and "changes" events.
+// Cursor is also the event ID, so a reconnecting client resumes after it.
+type streamChanges struct {
+	Cursor      string                  `json:"cursor"`
+	HLC         sync.HLC                `json:"hlc"`
+	Goals       []sync.GoalChange       `json:"goals"`
+	Completions []sync.CompletionChange `json:"completions"`
+}
+
+// handleStream sends the user's goal and completion changes as Server-Sent
+// Events as soon as a sync, events or REST request writes them.
+//
+// A new stream starts with a "ready" event carrying the current cursor. A
+// client that reconnects with Last-Event-ID (or passes ?cursor=) first
+// receives everything written after that cursor. Each "changes" event holds
+// the changes and the cursor to resume from, which is also its event ID.
+//
+// If the cursor predates tombstones the server has purged, the stream sends
+// a "resync" event and closes: the client must discard its local state, pull
+// again without a cursor and reconnect with the new one.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "authentication required",
+		})
+		return
+	}
+
+	cursor := r.Header.Get("Last-Event-ID")
+	if cursor == "" {
+		cursor = r.URL.Query().Get("cursor")
+	}
+
+	if !s.streams.acquire(user.ID) {
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{
+			"error": "too many open streams",
+		})
+		return
+	}
+	defer s.streams.release(user.ID)
+
+	// Subscribe before the first read so no change falls in between.
+	changed, unsubscribe := s.syncService.Subscribe(user.ID)
+	defer unsubscribe()
+
+	resp, err := s.syncService.ChangesSince(user.ID, cursor)
+	if errors.Is(err, sync.ErrInvalidCursor) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid cursor",
+		})
+		return
+	}
+	resync := errors.Is(err, sync.ErrResyncRequired)
+	if err != nil && !resync {
+		serverError(w, err)
+		return
+	}
+
+	// The server's ReadTimeout and WriteTimeout would end the stream; each
+	// write sets its own deadline instead.
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(format string, args ...any) error {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	send := func(event string, resp *sync.SyncResponse) error {
+		data, err := json.Marshal(streamChanges{
+			Cursor:      resp.Cursor,
+			HLC:         resp.HLC,
+			Goals:       resp.Goals,
+			Completions: resp.Completions,
+		})
+		if err != nil {
+			return err
+		}
+		return write("id: %s\nevent: %s\ndata: %s\n\n", resp.Cursor, event, data)
+	}
+
+	if err := write("retry: %d\n\n", streamRetry.Milliseconds()); err != nil {
+		return
+	}
+	if resync {
+		write("event: resync\ndata: {}\n\n")
+		return
+	}
+	if cursor == "" {
+		err = send("ready", resp)
+	} else if len(resp.Goals) > 0 || len(resp.Completions) > 0 {
+		err = send("changes", resp)
+	}
+	if err != nil {
+		return
+	}
+	cursor = resp.Cursor
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	deadline := time.NewTimer(streamMaxDuration)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline.C:
+			return
+		case <-heartbeat.C:
+			if err := write(": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-changed:
+			resp, err := s.syncService.ChangesSince(user.ID, cursor)
+			if errors.Is(err, sync.ErrResyncRequired) {
+				write("event: resync\ndata: {}\n\n")
+				return
+			}
+			if err != nil {
+				Logger.Error("stream changes failed", "user_id", user.ID, "error", err)
+				return
+			}
+			if len(resp.Goals) == 0 && len(resp.Completions) == 0 {
+				continue
+			}
+			if err := send("changes", resp); err != nil {
+				return
+			}
+			cursor = resp.Cursor
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package api_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// openStream connects to the change stream, resuming after lastEventID if set.
+func openStream(t *testing.T, ts *httptest.Server, cookie *http.Cookie, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/api/v1/stream", nil)
+	req.AddCookie(cookie)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readEvent returns the next event from a stream, skipping comments and
+// retry hints.
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var e sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if e.event != "" {
+				return e
+			}
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func syncGoal(t *testing.T, server http.Handler, cookie *http.Cookie, id, name string) {
+	t.Helper()
+
+	body := `{"goals":[{"id":"` + id + `","name":"` + name + `","color":"#000000","updated_at":"` + time.Now().UTC().Format(time.RFC3339Nano) + `"}],"completions":[]}`
+	req := httptest.NewRequest("POST", "/api/v1/sync", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("sync: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStream_PushesChangesAndResumes(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	t.Cleanup(cleanup)
+	// Cleanups run last-in first-out, so streams close before the server.
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	cookie := authenticateTestUser(t, server, "stream@localhost")
+
+	resp, stream := openStream(t, ts, cookie, "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	ready := readEvent(t, stream)
+	if ready.event != "ready" || ready.id == "" {
+		t.Fatalf("expected a ready event with a cursor, got %+v", ready)
+	}
+
+	syncGoal(t, server, cookie, "goal-stream-1", "Read")
+
+	var changes struct {
+		Cursor string `json:"cursor"`
+		Goals  []struct {
+			ID string `json:"id"`
+		} `json:"goals"`
+	}
+	e := readEvent(t, stream)
+	if e.event != "changes" {
+		t.Fatalf("expected a changes event, got %+v", e)
+	}
+	if err := json.Unmarshal([]byte(e.data), &changes); err != nil {
+		t.Fatalf("decode changes: %v", err)
+	}
+	if len(changes.Goals) != 1 || changes.Goals[0].ID != "goal-stream-1" || changes.Cursor != e.id {
+		t.Fatalf("expected goal-stream-1 with the event ID as cursor, got %+v (id %q)", changes, e.id)
+	}
+
+	// A change made while disconnected is sent first on reconnect.
+	resp.Body.Close()
+	syncGoal(t, server, cookie, "goal-stream-2", "Run")
+
+	_, stream = openStream(t, ts, cookie, e.id)
+	e = readEvent(t, stream)
+	if err := json.Unmarshal([]byte(e.data), &changes); err != nil {
+		t.Fatalf("decode changes: %v", err)
+	}
+	if e.event != "changes" || len(changes.Goals) != 1 || changes.Goals[0].ID != "goal-stream-2" {
+		t.Fatalf("expected only goal-stream-2 on resume, got %+v", e)
+	}
+}
+
+func TestStream_PushesRESTWrites(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	t.Cleanup(cleanup)
+	// Cleanups run last-in first-out, so streams close before the server.
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	cookie := authenticateTestUser(t, server, "stream@localhost")
+	syncGoal(t, server, cookie, "goal-rest", "Read")
+
+	_, stream := openStream(t, ts, cookie, "")
+	if e := readEvent(t, stream); e.event != "ready" {
+		t.Fatalf("expected a ready event, got %+v", e)
+	}
+
+	w := doJSON(t, server, cookie, "PATCH", "/api/v1/goals/goal-rest", `{"name":"Read more"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update goal: %d %s", w.Code, w.Body.String())
+	}
+
+	var changes struct {
+		Goals []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"goals"`
+	}
+	e := readEvent(t, stream)
+	if e.event != "changes" {
+		t.Fatalf("expected a changes event, got %+v", e)
+	}
+	if err := json.Unmarshal([]byte(e.data), &changes); err != nil {
+		t.Fatalf("decode changes: %v", err)
+	}
+	if len(changes.Goals) != 1 || changes.Goals[0].ID != "goal-rest" || changes.Goals[0].Name != "Read more" {
+		t.Fatalf("expected the renamed goal, got %+v", changes)
+	}
+}
+
+func TestStream_RejectsInvalidLastEventID(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	t.Cleanup(cleanup)
+	// Cleanups run last-in first-out, so streams close before the server.
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+
+	cookie := authenticateTestUser(t, server, "stream@localhost")
+
+	resp, _ := openStream(t, ts, cookie, "not-a-cursor")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestStream_RequiresAuth(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/api/v1/stream", nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", w.Code)
+	}
+}
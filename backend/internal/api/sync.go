@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -22,6 +23,8 @@ func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.touchDevice(r, user.ID)
+
 	// Parse sync request
 	var req sync.SyncRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -56,6 +59,22 @@ func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
 
 	// Process sync
 	resp, err := s.syncService.ApplyChanges(user.ID, &req)
+	if errors.Is(err, sync.ErrInvalidCursor) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "invalid cursor",
+		})
+		return
+	}
+	if errors.Is(err, sync.ErrInvalidPageToken) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "invalid page token",
+		})
+		return
+	}
 	if err != nil {
 		Logger.Error("sync failed",
 			"user_id", user.ID,
@@ -68,7 +87,36 @@ func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	if resp.Applied > 0 {
+		s.notifyDataChanged(r, user.ID)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// handleSyncDigest returns the hash tree of the user's goals and completions,
+// for clients checking whether their local state has drifted.
+func (s *Server) handleSyncDigest(w http.ResponseWriter, r *http.Request) {
+	user := auth.GetUserFromContext(r.Context())
+	if user == nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{
+			"error": "authentication required",
+		})
+		return
+	}
+
+	digest, err := s.syncService.Digest(user.ID)
+	if err != nil {
+		Logger.Error("sync digest failed",
+			"user_id", user.ID,
+			"error", err,
+		)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{
+			"error": "sync digest failed",
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, digest)
+}
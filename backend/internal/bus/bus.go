@@ -0,0 +1,116 @@
+// Package bus delivers notifications to every server instance, so a change
+// made through one replica reaches streams and caches held by the others.
+//
+// Notifications are hints, not data: a topic names what kind of thing
+// changed and a key (usually a user ID) names which one. Receivers read the
+// current state themselves, so a notification can be coalesced or delivered
+// twice without harm.
+package bus
+
+import "sync"
+
+// Topics published by the server.
+const (
+	// TopicChanges is published after a user's goals or completions change.
+	// The key is the user ID.
+	TopicChanges = "changes"
+)
+
+// Bus publishes notifications to every instance, including the publisher.
+type Bus interface {
+	// Publish notifies subscribers of topic on every instance that key
+	// changed.
+	Publish(topic, key string) error
+	// Subscribe calls fn for each notification on topic until the returned
+	// function is called. fn runs on the bus's delivery goroutine and must
+	// not block. A key of "" means notifications may have been lost (for
+	// example while reconnecting), and fn should treat every key as changed.
+	Subscribe(topic string, fn func(key string)) (unsubscribe func())
+	// Close stops delivery and releases the bus's resources.
+	Close() error
+}
+
+// handlers holds subscriptions by topic. Both Bus implementations use it
+// for their local fan-out.
+type handlers struct {
+	mu     sync.RWMutex
+	next   int
+	topics map[string]map[int]func(key string)
+}
+
+func newHandlers() *handlers {
+	return &handlers{topics: make(map[string]map[int]func(key string))}
+}
+
+func (h *handlers) add(topic string, fn func(key string)) func() {
+	h.mu.Lock()
+	id := h.next
+	h.next++
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[int]func(key string))
+	}
+	h.topics[topic][id] = fn
+	h.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.topics[topic], id)
+			if len(h.topics[topic]) == 0 {
+				delete(h.topics, topic)
+			}
+		})
+	}
+}
+
+// topicNames returns the topics that have subscribers.
+func (h *handlers) topicNames() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	names := make([]string, 0, len(h.topics))
+	for topic := range h.topics {
+		names = append(names, topic)
+	}
+	return names
+}
+
+func (h *handlers) deliver(topic, key string) {
+	h.mu.RLock()
+	fns := make([]func(string), 0, len(h.topics[topic]))
+	for _, fn := range h.topics[topic] {
+		fns = append(fns, fn)
+	}
+	h.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(key)
+	}
+}
+
+// Memory is a Bus for a single instance, used with SQLite.
+type Memory struct {
+	handlers *handlers
+}
+
+var _ Bus = (*Memory)(nil)
+
+// NewMemory creates an in-process bus.
+func NewMemory() *Memory {
+	return &Memory{handlers: newHandlers()}
+}
+
+// Publish delivers the notification to local subscribers before returning.
+func (m *Memory) Publish(topic, key string) error {
+	m.handlers.deliver(topic, key)
+	return nil
+}
+
+func (m *Memory) Subscribe(topic string, fn func(key string)) func() {
+	return m.handlers.add(topic, fn)
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,92 @@
+package bus
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// receive subscribes to topic and returns a channel of delivered keys.
+func receive(b Bus, topic string) (<-chan string, func()) {
+	keys := make(chan string, 16)
+	unsubscribe := b.Subscribe(topic, func(key string) { keys <- key })
+	return keys, unsubscribe
+}
+
+func expectKey(t *testing.T, keys <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-keys:
+		if got != want {
+			t.Fatalf("expected key %q, got %q", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for key %q", want)
+	}
+}
+
+func expectNone(t *testing.T, keys <-chan string) {
+	t.Helper()
+	select {
+	case got := <-keys:
+		t.Fatalf("expected no notification, got %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestMemory_DeliversByTopicUntilUnsubscribed(t *testing.T) {
+	b := NewMemory()
+	defer b.Close()
+
+	changes, unsubscribe := receive(b, TopicChanges)
+	other, _ := receive(b, "other")
+
+	if err := b.Publish(TopicChanges, "user-1"); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	expectKey(t, changes, "user-1")
+	expectNone(t, other)
+
+	unsubscribe()
+	b.Publish(TopicChanges, "user-1")
+	expectNone(t, changes)
+}
+
+// TestPostgres_ReachesEveryInstance runs against the database in
+// TEST_POSTGRES_URL, e.g. postgres://localhost/goals_test?sslmode=disable.
+func TestPostgres_ReachesEveryInstance(t *testing.T) {
+	connStr := os.Getenv("TEST_POSTGRES_URL")
+	if connStr == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+
+	// Two buses stand in for two server instances.
+	a, err := NewPostgres(connStr, nil)
+	if err != nil {
+		t.Fatalf("NewPostgres: %v", err)
+	}
+	defer a.Close()
+	b, err := NewPostgres(connStr, nil)
+	if err != nil {
+		t.Fatalf("NewPostgres: %v", err)
+	}
+	defer b.Close()
+
+	onA, _ := receive(a, TopicChanges)
+	onB, unsubscribeB := receive(b, TopicChanges)
+	otherOnB, _ := receive(b, "other")
+
+	if err := a.Publish(TopicChanges, "user-1"); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	expectKey(t, onA, "user-1")
+	expectKey(t, onB, "user-1")
+	expectNone(t, otherOnB)
+
+	unsubscribeB()
+	if err := b.Publish(TopicChanges, "user-2"); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	expectKey(t, onA, "user-2")
+	expectNone(t, onB)
+}
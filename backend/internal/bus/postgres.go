@@ -0,0 +1,145 @@
+package bus
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresChannel is the LISTEN/NOTIFY channel every topic shares.
+const postgresChannel = "goal_tracker_bus"
+
+const (
+	listenerMinReconnect = 10 * time.Second
+	listenerMaxReconnect = time.Minute
+	// listenerPingInterval checks an idle listener connection, so a dropped
+	// one is noticed and re-established.
+	listenerPingInterval = 90 * time.Second
+)
+
+// postgresMessage is the NOTIFY payload.
+type postgresMessage struct {
+	Topic string `json:"topic"`
+	Key   string `json:"key"`
+}
+
+// Postgres is a Bus shared by every instance connected to one PostgreSQL
+// database, using LISTEN/NOTIFY. Notifications sent while an instance is
+// reconnecting are lost; subscribers then receive an empty key.
+type Postgres struct {
+	db       *sql.DB
+	listener *pq.Listener
+	handlers *handlers
+	logger   *slog.Logger
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+var _ Bus = (*Postgres)(nil)
+
+// NewPostgres connects a bus to the database at connStr. It holds one
+// connection for LISTEN and publishes through a small pool of its own.
+func NewPostgres(connStr string, logger *slog.Logger) (*Postgres, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	db.SetMaxOpenConns(2)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+
+	listener := pq.NewListener(connStr, listenerMinReconnect, listenerMaxReconnect, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Warn("bus listener connection problem", slog.String("error", err.Error()))
+		}
+	})
+	if err := listener.Listen(postgresChannel); err != nil {
+		listener.Close()
+		db.Close()
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	p := &Postgres{
+		db:       db,
+		listener: listener,
+		handlers: newHandlers(),
+		logger:   logger,
+		done:     make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.run()
+	return p, nil
+}
+
+// Publish sends the notification with NOTIFY. It reaches this instance's
+// subscribers through the listener, like every other instance's.
+func (p *Postgres) Publish(topic, key string) error {
+	payload, err := json.Marshal(postgresMessage{Topic: topic, Key: key})
+	if err != nil {
+		return err
+	}
+	if _, err := p.db.Exec(`SELECT pg_notify($1, $2)`, postgresChannel, string(payload)); err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	return nil
+}
+
+func (p *Postgres) Subscribe(topic string, fn func(key string)) func() {
+	return p.handlers.add(topic, fn)
+}
+
+// Close stops the listener and waits for delivery to finish.
+func (p *Postgres) Close() error {
+	close(p.done)
+	err := p.listener.Close()
+	p.wg.Wait()
+	if dbErr := p.db.Close(); err == nil {
+		err = dbErr
+	}
+	return err
+}
+
+func (p *Postgres) run() {
+	defer p.wg.Done()
+
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case n, ok := <-p.listener.Notify:
+			if !ok {
+				return
+			}
+			if n == nil {
+				// The listener reconnected and may have missed notifications.
+				for _, topic := range p.handlers.topicNames() {
+					p.handlers.deliver(topic, "")
+				}
+				continue
+			}
+			var msg postgresMessage
+			if err := json.Unmarshal([]byte(n.Extra), &msg); err != nil {
+				p.logger.Warn("bus: malformed notification", slog.String("error", err.Error()))
+				continue
+			}
+			p.handlers.deliver(msg.Topic, msg.Key)
+		case <-ping.C:
+			go p.listener.Ping()
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"time"
 
 	"github.com/apsv/goal-tracker/backend/internal/models"
@@ -21,6 +22,8 @@ type Database interface {
 	// Completions
 	// userID: filters completions by goal owner; nil filters by user_id IS NULL
 	ListCompletions(userID *string, from, to string, goalID *string) ([]models.Completion, error)
+	// ListAllCompletions returns every live completion, whatever its date.
+	ListAllCompletions(userID *string) ([]models.Completion, error)
 	GetCompletionByID(id string) (*models.Completion, error)
 	GetCompletionByGoalAndDate(goalID, date string) (*models.Completion, error)
 	GetCompletionByGoalAndDateIncludingDeleted(goalID, date string) (*models.Completion, error)
@@ -33,6 +36,8 @@ type Database interface {
 	CreateUser(user *models.User) error
 	UpdateUserLastLogin(id string) error
 	GetOrCreateUserByProvider(provider, providerUserID, email, name, avatarURL string) (*models.User, error)
+	UpdateUserTimezone(id, timezone string) error
+	UpdateUserLocale(id, locale string) error
 
 	// Sessions
 	CreateSession(session *models.Session) error
@@ -43,6 +48,22 @@ type Database interface {
 	// Sync operations
 	GetGoalChangesSince(userID *string, since *time.Time) ([]models.Goal, error)
 	GetCompletionChangesSince(userID *string, since *time.Time) ([]models.Completion, error)
+	// GetChangeSeq returns the owner's latest change sequence number. Every
+	// goal and completion write takes the next one; rows numbered at or below
+	// the returned value are committed.
+	GetChangeSeq(userID *string) (int64, error)
+	GetGoalChangesSinceSeq(userID *string, seq int64) ([]models.Goal, error)
+	GetCompletionChangesSinceSeq(userID *string, seq int64) ([]models.Completion, error)
+	// GetGoalChangesPage and GetCompletionChangesPage return up to limit rows
+	// numbered at most upTo, in ChangeKey order, starting after after.
+	GetGoalChangesPage(userID *string, after ChangeKey, upTo int64, limit int) ([]models.Goal, error)
+	GetCompletionChangesPage(userID *string, after ChangeKey, upTo int64, limit int) ([]models.Completion, error)
+	// GetTombstoneHorizon reports how far the owner's tombstones have been
+	// purged; the zero value means never.
+	GetTombstoneHorizon(userID *string) (TombstoneHorizon, error)
+	// PurgeTombstones hard-deletes goals and completions soft-deleted before
+	// before, advancing each affected owner's TombstoneHorizon.
+	PurgeTombstones(before time.Time) (int64, error)
 	UpsertGoal(goal *models.Goal) error
 	UpsertCompletion(c *models.Completion) error
 	SoftDeleteGoal(userID *string, id string) error
@@ -52,29 +73,154 @@ type Database interface {
 	// Device Tokens (Push Notifications)
 	CreateDeviceToken(userID, token, platform string) (*models.DeviceToken, error)
 	GetDeviceTokensByUserID(userID string) ([]models.DeviceToken, error)
+	// GetDeviceToken returns the user's device token, or nil if the ID does
+	// not exist or belongs to another user.
+	GetDeviceToken(userID, tokenID string) (*models.DeviceToken, error)
+	// UpdateDeviceToken sets the non-nil fields on the user's device token.
+	UpdateDeviceToken(userID, tokenID string, name, appVersion *string) error
+	// TouchDeviceToken records that the device just talked to the server.
+	TouchDeviceToken(userID, tokenID string) error
 	DeleteDeviceToken(tokenID string) error
 	UpdateDeviceTokenLastUsed(tokenID string) error
+	DeleteStaleDeviceTokens(olderThan time.Time) (int64, error)
+
+	// Reminders (server-side push schedules)
+	CreateReminder(r *models.Reminder) error
+	GetReminder(userID, id string) (*models.Reminder, error)
+	ListReminders(userID string) ([]models.Reminder, error)
+	ListEnabledReminders() ([]models.Reminder, error)
+	UpdateReminder(r *models.Reminder) error
+	DeleteReminder(userID, id string) error
+	// ClaimReminder sets the reminder's last_sent_at to sentAt and queues
+	// entries, in one transaction, unless it was already sent at or after
+	// occurrence. It reports whether this call claimed the occurrence, so
+	// only one of several concurrent schedulers queues it.
+	ClaimReminder(id string, occurrence, sentAt time.Time, entries []models.PushOutboxEntry) (bool, error)
+
+	// Streak alerts (evening "don't break your streak" push)
+	// GetStreakAlertSettings returns the defaults for users who never saved any.
+	GetStreakAlertSettings(userID string) (*models.StreakAlertSettings, error)
+	SaveStreakAlertSettings(userID string, settings models.StreakAlertSettings) error
+	// ListStreakAlertRecipients returns opted-in users that have a device.
+	ListStreakAlertRecipients() ([]models.StreakAlertRecipient, error)
+	// ClaimStreakAlert records day as the user's local date of the last alert
+	// run and queues entries, in one transaction, unless day was already
+	// recorded. It reports whether this call recorded it, so only one of
+	// several concurrent runs queues the alerts.
+	ClaimStreakAlert(userID, day string, entries []models.PushOutboxEntry) (bool, error)
 
 	// Account
 	DeleteAccount(userID string) error
 
 	// Event idempotency
-	IsEventProcessed(eventID string) (bool, error)
-	MarkEventProcessed(eventID string) error
+	// IsEventProcessed returns the user's record of eventID, or nil if the
+	// user never sent it.
+	IsEventProcessed(userID, eventID string) (*ProcessedEvent, error)
+	MarkEventProcessed(e *ProcessedEvent) error
 	PruneProcessedEvents(olderThan time.Time) error
 
+	// Event log (every goal and completion write, oldest first)
+	// ReplayEventLog rebuilds the user's goals and completions, tombstones
+	// included, as they stood at the given time. It returns
+	// ErrBeforeHistory for a time the log cannot rebuild.
+	ReplayEventLog(userID string, at time.Time) ([]models.Goal, []models.Completion, error)
+	// RestoreToTime rewrites the user's goals and completions to their state
+	// at the given time, as new changes that sync clients pull like any
+	// other, and returns how many rows it wrote. It returns
+	// ErrBeforeHistory for a time the log cannot rebuild.
+	RestoreToTime(userID string, at time.Time) (int, error)
+
 	// Debug reports (on-device diagnostic collection)
 	CreateDebugReport(report *models.DebugReport) error
 	ListDebugReports(filter DebugReportFilter) ([]models.DebugReport, error)
 	GetDebugReport(id string) (*models.DebugReport, error)
 	DeleteOldDebugReports(olderThan time.Time) (int64, error)
 
+	// Push outbox (durable delivery with retries)
+	CreatePushOutboxEntry(entry *models.PushOutboxEntry) error
+	// ClaimPushOutbox marks up to limit due entries as sending, bumps their
+	// attempt count and leases them until now+lease. Entries whose lease has
+	// expired (a worker crashed mid-send) are claimable again.
+	ClaimPushOutbox(now time.Time, lease time.Duration, limit int) ([]models.PushOutboxEntry, error)
+	// UpdatePushOutboxEntry persists status, attempts, next_attempt_at,
+	// last_error and sent_at.
+	UpdatePushOutboxEntry(entry *models.PushOutboxEntry) error
+	ListPushOutbox(filter PushOutboxFilter) ([]models.PushOutboxEntry, error)
+	// DeleteOldPushOutbox removes sent and failed entries created before olderThan.
+	DeleteOldPushOutbox(olderThan time.Time) (int64, error)
+
+	// InTx runs fn in one transaction, committing if it returns nil and
+	// rolling back otherwise. fn must only use tx until it returns. On
+	// PostgreSQL the transaction first takes userID's write lock, which every
+	// other write to the user's data takes too, so no replica's write lands
+	// between fn's reads and its writes.
+	InTx(userID string, fn func(tx Tx) error) error
+
 	// Lifecycle
 	Migrate() error
 	Close() error
 	Ping() error
 }
 
+// ChangeKey orders sync rows for paging: by change sequence, then by ID,
+// since rows written before change sequences existed all share 0.
+type ChangeKey struct {
+	Seq int64
+	ID  string
+}
+
+// ErrBeforeHistory is returned for a replay or restore to a time before the
+// event log started keeping the user's rows, or before their tombstone
+// horizon.
+var ErrBeforeHistory = errors.New("time is before the kept history")
+
+// TombstoneHorizon records what PurgeTombstones has removed for one owner.
+// A client that last synced before it may still hold rows whose deletes it
+// never saw, and must discard its local state and resync in full.
+type TombstoneHorizon struct {
+	// Seq is the highest change sequence number purged.
+	Seq int64
+	// Before is the deleted_at cutoff of the last purge, for clients that
+	// sync by timestamp.
+	Before time.Time
+}
+
+// ProcessedEvent is the idempotency record of one sync event, kept so a
+// resent event is not applied twice and gets its first outcome back.
+type ProcessedEvent struct {
+	UserID  string
+	EventID string
+	// Status and Reason are the outcome reported when the event was
+	// processed.
+	Status      string
+	Reason      string
+	ProcessedAt time.Time
+}
+
+// Tx is a unit of work for sync: the reads and writes needed to apply client
+// changes and record processed events, all in one transaction.
+type Tx interface {
+	GetGoalByID(id string) (*models.Goal, error)
+	GetCompletionByGoalAndDateIncludingDeleted(goalID, date string) (*models.Completion, error)
+	UpsertGoal(goal *models.Goal) error
+	// RebalanceGoalRanks rewrites the user's goal ranks as short keys in
+	// their current order, for when a new rank would not fit.
+	RebalanceGoalRanks(userID string) error
+	UpsertCompletion(c *models.Completion) error
+	IsEventProcessed(userID, eventID string) (*ProcessedEvent, error)
+	MarkEventProcessed(e *ProcessedEvent) error
+}
+
+// DefaultTimezone is assigned to users who have not reported a timezone.
+const DefaultTimezone = "UTC"
+
+// DefaultLocale is assigned to users who have not chosen a language.
+const DefaultLocale = "en"
+
+// DefaultStreakAlertTime is the local send time of streak alerts for users
+// who have not picked one.
+const DefaultStreakAlertTime = "20:00"
+
 // DebugReportFilter narrows ListDebugReports results.
 // All fields are optional — nil/zero means "no filter on this field".
 // Used by the CLI viewer (list --user email --since 7d --limit N).
@@ -83,3 +229,12 @@ type DebugReportFilter struct {
 	Since  *time.Time // created_at >= Since
 	Limit  int        // max rows to return; 0 means no limit
 }
+
+// PushOutboxFilter narrows ListPushOutbox results, newest first.
+// Used by the CLI viewer (deliveries --user email --since 2d).
+type PushOutboxFilter struct {
+	UserID *string    // exact user_id match
+	Since  *time.Time // created_at >= Since
+	Status string     // exact status match; empty means any
+	Limit  int        // max rows to return; 0 means no limit
+}
@@ -0,0 +1,19 @@
+-- Server-side reminder schedules. goal_id NULL means "remind me about all goals".
+-- time_of_day is a wall-clock HH:MM in the owner's timezone (users.timezone).
+ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC';
+
+CREATE TABLE IF NOT EXISTS reminders (
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    goal_id      TEXT REFERENCES goals(id) ON DELETE CASCADE,
+    frequency    TEXT NOT NULL CHECK (frequency IN ('daily', 'weekly')),
+    time_of_day  TEXT NOT NULL,
+    weekday      INTEGER NOT NULL DEFAULT 0,
+    enabled      BOOLEAN NOT NULL DEFAULT 1,
+    last_sent_at DATETIME,
+    created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reminders_user_id ON reminders(user_id);
+CREATE INDEX IF NOT EXISTS idx_reminders_enabled ON reminders(enabled);
@@ -0,0 +1,18 @@
+-- SQLite cannot alter a CHECK constraint, so rebuild device_tokens to allow
+-- the "web" platform (browser Web Push subscriptions).
+CREATE TABLE device_tokens_new (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    platform TEXT NOT NULL CHECK (platform IN ('android', 'ios', 'web')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME
+);
+
+INSERT INTO device_tokens_new (id, user_id, token, platform, created_at, last_used_at)
+SELECT id, user_id, token, platform, created_at, last_used_at FROM device_tokens;
+
+DROP TABLE device_tokens;
+ALTER TABLE device_tokens_new RENAME TO device_tokens;
+
+CREATE INDEX idx_device_tokens_user_id ON device_tokens(user_id);
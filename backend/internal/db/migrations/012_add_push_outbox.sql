@@ -0,0 +1,25 @@
+-- Durable push delivery: one row per (notification, device). The worker
+-- claims due rows, retries transient failures with backoff and records the
+-- final status. token/platform are snapshotted so a row stays sendable (and
+-- inspectable) even if the device token row changes.
+CREATE TABLE IF NOT EXISTS push_outbox (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_token_id TEXT NOT NULL,
+    platform TEXT NOT NULL,
+    token TEXT NOT NULL,
+    category TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL DEFAULT '',
+    data TEXT NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    sent_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_outbox_due ON push_outbox(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_push_outbox_user_created ON push_outbox(user_id, created_at);
@@ -0,0 +1,14 @@
+-- Server-assigned change sequence for cursor-based sync. Every write to a goal
+-- or completion takes its owner's next number from change_seqs and stores it
+-- in change_seq, so clients pull "everything after N" instead of comparing
+-- client-supplied timestamps. Goals without a user share the '' counter.
+CREATE TABLE IF NOT EXISTS change_seqs (
+    user_id TEXT PRIMARY KEY,
+    seq     INTEGER NOT NULL DEFAULT 0
+);
+
+ALTER TABLE goals ADD COLUMN change_seq INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE completions ADD COLUMN change_seq INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_goals_user_change_seq ON goals(user_id, change_seq);
+CREATE INDEX IF NOT EXISTS idx_completions_change_seq ON completions(change_seq);
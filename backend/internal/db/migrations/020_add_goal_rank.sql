@@ -0,0 +1,6 @@
+-- Goals are ordered by rank, a fractional sort key (see package rank), so
+-- moving one goal rewrites only that goal's row. position is kept for
+-- clients that predate ranks. Existing goals take the key of their position.
+ALTER TABLE goals ADD COLUMN rank TEXT NOT NULL DEFAULT '';
+UPDATE goals SET rank = printf('%06d', MAX(position, 0));
+CREATE INDEX idx_goals_user_rank ON goals(user_id, rank);
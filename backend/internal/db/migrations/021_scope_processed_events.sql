@@ -0,0 +1,29 @@
+-- Idempotency records are scoped by user, so one user's event ID cannot
+-- collide with another's, and keep the outcome reported the first time so a
+-- retry gets the same answer. Existing records predate outcomes and are kept
+-- as applied. They do not say who sent the event, so each is kept for every
+-- user who owns a goal: event IDs are client-generated UUIDs, so a copy only
+-- ever matches a retry from the user who sent it. Pruning removes the copies
+-- with the rest once they age out.
+CREATE TABLE processed_events_unscoped AS SELECT event_id, processed_at FROM processed_events;
+
+DROP TABLE processed_events;
+
+CREATE TABLE processed_events (
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    processed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at ON processed_events(processed_at);
+
+INSERT INTO processed_events (user_id, event_id, status, reason, processed_at)
+SELECT u.id, p.event_id, 'applied', '', p.processed_at
+FROM processed_events_unscoped p
+CROSS JOIN users u
+WHERE EXISTS (SELECT 1 FROM goals g WHERE g.user_id = u.id);
+
+DROP TABLE processed_events_unscoped;
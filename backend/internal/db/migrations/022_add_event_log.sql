@@ -0,0 +1,44 @@
+-- Every write to a goal or completion appends the state it left the row in,
+-- keyed by owner ('' for goals without a user) and change sequence. Rows are
+-- never updated, so replaying a user's rows up to a time rebuilds their
+-- goals and completions as they stood then. Tombstone purges leave the log
+-- alone; only account deletion removes a user's rows.
+--
+-- Rows written before the log existed are seeded with one 'snapshot' row
+-- each, holding the goal or completion as it stands when the log starts.
+-- Their history before then is unknown, so a restore to an earlier time is
+-- refused rather than rebuilt from it.
+CREATE TABLE IF NOT EXISTS event_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL,
+    change_seq INTEGER NOT NULL,
+    kind TEXT NOT NULL, -- 'goal', 'completion' or 'snapshot'
+    item_id TEXT NOT NULL,
+    data TEXT NOT NULL, -- the row as JSON, under "goal" or "completion" in a snapshot
+    recorded_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_log_user_recorded ON event_log(user_id, recorded_at);
+
+-- Stored timestamps are not in a format SQLite's date functions read, so
+-- they are cut to RFC 3339 text (to the second) for the JSON.
+INSERT INTO event_log (user_id, change_seq, kind, item_id, data, recorded_at)
+SELECT COALESCE(user_id, ''), change_seq, 'snapshot', id,
+    json_object('goal', json_object('id', id, 'name', name, 'color', color, 'position', position, 'rank', rank,
+        'target_count', target_count, 'target_period', target_period, 'user_id', user_id,
+        'created_at', substr(created_at, 1, 10) || 'T' || substr(created_at, 12, 8) || 'Z',
+        'updated_at', substr(updated_at, 1, 10) || 'T' || substr(updated_at, 12, 8) || 'Z',
+        'archived_at', substr(archived_at, 1, 10) || 'T' || substr(archived_at, 12, 8) || 'Z',
+        'deleted_at', substr(deleted_at, 1, 10) || 'T' || substr(deleted_at, 12, 8) || 'Z')),
+    CURRENT_TIMESTAMP
+FROM goals;
+
+INSERT INTO event_log (user_id, change_seq, kind, item_id, data, recorded_at)
+SELECT COALESCE(g.user_id, ''), c.change_seq, 'snapshot', c.id,
+    json_object('completion', json_object('id', c.id, 'goal_id', c.goal_id, 'date', substr(c.date, 1, 10),
+        'created_at', substr(c.created_at, 1, 10) || 'T' || substr(c.created_at, 12, 8) || 'Z',
+        'updated_at', substr(c.updated_at, 1, 10) || 'T' || substr(c.updated_at, 12, 8) || 'Z',
+        'deleted_at', substr(c.deleted_at, 1, 10) || 'T' || substr(c.deleted_at, 12, 8) || 'Z')),
+    CURRENT_TIMESTAMP
+FROM completions c
+INNER JOIN goals g ON c.goal_id = g.id;
@@ -0,0 +1,3 @@
+-- The collapse key is kept with the rest of the notification, so a retried
+-- entry still replaces an older undelivered one instead of stacking up.
+ALTER TABLE push_outbox ADD COLUMN collapse_key TEXT NOT NULL DEFAULT '';
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/rank"
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 )
@@ -99,7 +100,7 @@ func (d *PostgresDB) Migrate() error {
 // Goals
 
 func (d *PostgresDB) ListGoals(userID *string, includeArchived bool) ([]models.Goal, error) {
-	query := `SELECT id, name, color, position, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE `
+	query := `SELECT id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE `
 	var args []any
 	paramNum := 1
 
@@ -117,7 +118,8 @@ func (d *PostgresDB) ListGoals(userID *string, includeArchived bool) ([]models.G
 	}
 	// Always exclude soft-deleted goals
 	query += ` AND deleted_at IS NULL`
-	query += ` ORDER BY position ASC, created_at ASC`
+	// Ties between ranks are possible after concurrent moves; IDs break them.
+	query += ` ORDER BY rank ASC, id ASC`
 
 	rows, err := d.Query(query, args...)
 	if err != nil {
@@ -133,7 +135,7 @@ func (d *PostgresDB) ListGoals(userID *string, includeArchived bool) ([]models.G
 		var goalUserID sql.NullString
 		var targetCount sql.NullInt64
 		var targetPeriod sql.NullString
-		if err := rows.Scan(&g.ID, &g.Name, &g.Color, &g.Position, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt); err != nil {
+		if err := rows.Scan(&g.ID, &g.Name, &g.Color, &g.Position, &g.Rank, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt); err != nil {
 			return nil, fmt.Errorf("scan goal: %w", err)
 		}
 		if archivedAt.Valid {
@@ -157,6 +159,8 @@ func (d *PostgresDB) ListGoals(userID *string, includeArchived bool) ([]models.G
 		if targetPeriod.Valid {
 			g.TargetPeriod = &targetPeriod.String
 		}
+		// Listed positions follow rank order, for clients that sort by them.
+		g.Position = len(goals)
 		goals = append(goals, g)
 	}
 	return goals, rows.Err()
@@ -170,7 +174,7 @@ func (d *PostgresDB) GetGoal(userID *string, id string) (*models.Goal, error) {
 	var targetCount sql.NullInt64
 	var targetPeriod sql.NullString
 
-	query := `SELECT id, name, color, position, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE id = $1`
+	query := `SELECT id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE id = $1`
 	args := []any{id}
 
 	// Add user_id filter
@@ -181,7 +185,7 @@ func (d *PostgresDB) GetGoal(userID *string, id string) (*models.Goal, error) {
 		args = append(args, *userID)
 	}
 
-	err := d.QueryRow(query, args...).Scan(&g.ID, &g.Name, &g.Color, &g.Position, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt)
+	err := d.QueryRow(query, args...).Scan(&g.ID, &g.Name, &g.Color, &g.Position, &g.Rank, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -218,29 +222,52 @@ func (d *PostgresDB) CreateGoal(g *models.Goal) error {
 		g.UpdatedAt = now
 	}
 
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextChangeSeq(tx, g.UserID)
+	if err != nil {
+		return err
+	}
+	goalRank, err := d.lastGoalRank(tx, g.UserID, seq)
+	if err != nil {
+		return err
+	}
+
 	var position int
 	if g.UserID == nil {
-		err := d.QueryRow(
-			`INSERT INTO goals (id, name, color, position, target_count, target_period, user_id, created_at, updated_at)
-			 VALUES ($1, $2, $3, COALESCE((SELECT MAX(position) FROM goals WHERE user_id IS NULL AND deleted_at IS NULL), -1) + 1, $4, $5, $6, $7, $8)
+		err := tx.QueryRow(
+			`INSERT INTO goals (id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, change_seq)
+			 VALUES ($1, $2, $3, COALESCE((SELECT MAX(position) FROM goals WHERE user_id IS NULL AND deleted_at IS NULL), -1) + 1, $4, $5, $6, $7, $8, $9, $10)
 			 RETURNING position`,
-			g.ID, g.Name, g.Color, g.TargetCount, g.TargetPeriod, g.UserID, g.CreatedAt, g.UpdatedAt,
+			g.ID, g.Name, g.Color, goalRank, g.TargetCount, g.TargetPeriod, g.UserID, g.CreatedAt, g.UpdatedAt, seq,
 		).Scan(&position)
 		if err != nil {
 			return fmt.Errorf("insert goal: %w", err)
 		}
 	} else {
-		err := d.QueryRow(
-			`INSERT INTO goals (id, name, color, position, target_count, target_period, user_id, created_at, updated_at)
-			 VALUES ($1, $2, $3, COALESCE((SELECT MAX(position) FROM goals WHERE user_id = $4 AND deleted_at IS NULL), -1) + 1, $5, $6, $7, $8, $9)
+		err := tx.QueryRow(
+			`INSERT INTO goals (id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, change_seq)
+			 VALUES ($1, $2, $3, COALESCE((SELECT MAX(position) FROM goals WHERE user_id = $4 AND deleted_at IS NULL), -1) + 1, $5, $6, $7, $8, $9, $10, $11)
 			 RETURNING position`,
-			g.ID, g.Name, g.Color, *g.UserID, g.TargetCount, g.TargetPeriod, g.UserID, g.CreatedAt, g.UpdatedAt,
+			g.ID, g.Name, g.Color, *g.UserID, goalRank, g.TargetCount, g.TargetPeriod, g.UserID, g.CreatedAt, g.UpdatedAt, seq,
 		).Scan(&position)
 		if err != nil {
 			return fmt.Errorf("insert goal: %w", err)
 		}
 	}
+	if err := logChangesPostgres(tx, g.UserID, seq); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	g.Position = position
+	g.Rank = goalRank
 	return nil
 }
 
@@ -275,10 +302,21 @@ func (d *PostgresDB) UpdateGoal(userID *string, id string, name, color *string,
 		paramNum++
 	}
 
-	// Always update updated_at
-	updates = append(updates, fmt.Sprintf(`updated_at = $%d`, paramNum))
-	args = append(args, time.Now().UTC())
-	paramNum++
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextChangeSeq(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Always update updated_at and change_seq
+	updates = append(updates, fmt.Sprintf(`updated_at = $%d`, paramNum), fmt.Sprintf(`change_seq = $%d`, paramNum+1), resetGoalClocks)
+	args = append(args, time.Now().UTC(), seq)
+	paramNum += 2
 
 	query += strings.Join(updates, ", ")
 	query += fmt.Sprintf(` WHERE id = $%d`, paramNum)
@@ -293,60 +331,129 @@ func (d *PostgresDB) UpdateGoal(userID *string, id string, name, color *string,
 		args = append(args, *userID)
 	}
 
-	_, err := d.Exec(query, args...)
-	if err != nil {
+	if _, err := tx.Exec(query, args...); err != nil {
 		return fmt.Errorf("update goal: %w", err)
 	}
+	if err := logChangesPostgres(tx, userID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
 func (d *PostgresDB) ArchiveGoal(userID *string, id string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextChangeSeq(tx, userID)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now().UTC()
-	query := `UPDATE goals SET archived_at = $1, updated_at = $2 WHERE id = $3`
-	args := []any{now, now, id}
+	query := `UPDATE goals SET archived_at = $1, updated_at = $2, change_seq = $3, ` + resetGoalClocks + ` WHERE id = $4`
+	args := []any{now, now, seq, id}
 
 	// Add user_id filter for ownership verification
 	if userID == nil {
 		query += ` AND user_id IS NULL`
 	} else {
-		query += ` AND user_id = $4`
+		query += ` AND user_id = $5`
 		args = append(args, *userID)
 	}
 
-	_, err := d.Exec(query, args...)
-	if err != nil {
+	if _, err := tx.Exec(query, args...); err != nil {
 		return fmt.Errorf("archive goal: %w", err)
 	}
+	if err := logChangesPostgres(tx, userID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
+// ReorderGoals ranks the owner's goals in the order of goalIDs, rewriting
+// only the goals that have to move. IDs of other users' goals are ignored.
 func (d *PostgresDB) ReorderGoals(userID *string, goalIDs []string) error {
-	tx, err := d.Begin()
-	if err != nil {
-		return fmt.Errorf("begin transaction: %w", err)
-	}
-	defer tx.Rollback()
+	return runInTx(d.DB, func(tx *sql.Tx) error {
+		seq, err := d.nextChangeSeq(tx, userID)
+		if err != nil {
+			return err
+		}
 
-	for i, id := range goalIDs {
-		query := `UPDATE goals SET position = $1 WHERE id = $2`
-		args := []any{i, id}
+		load := func() ([]rank.Item, error) {
+			var items []rank.Item
+			for _, id := range goalIDs {
+				item := rank.Item{ID: id}
+				err := tx.QueryRow(`SELECT rank FROM goals WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2`, id, userID).Scan(&item.Key)
+				if err == sql.ErrNoRows {
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("query rank of %s: %w", id, err)
+				}
+				items = append(items, item)
+			}
+			return items, nil
+		}
+		items, keys, err := reorderRanks(load, func() error {
+			return d.rebalanceGoalRanks(tx, userID, seq)
+		})
+		if err != nil {
+			return err
+		}
 
-		// Add user_id filter for ownership verification
-		if userID == nil {
-			query += ` AND user_id IS NULL`
-		} else {
-			query += ` AND user_id = $3`
-			args = append(args, *userID)
+		for i, item := range items {
+			if keys[i] == item.Key {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE goals SET rank = $1, position = $2, change_seq = $3 WHERE id = $4`, keys[i], i, seq, item.ID); err != nil {
+				return fmt.Errorf("update rank for %s: %w", item.ID, err)
+			}
 		}
+		return logChangesPostgres(tx, userID, seq)
+	})
+}
 
-		_, err := tx.Exec(query, args...)
-		if err != nil {
-			return fmt.Errorf("update position for %s: %w", id, err)
+// lastGoalRank returns the rank that puts a new goal after the owner's
+// others, rebalancing them first if that rank would be too long.
+func (d *PostgresDB) lastGoalRank(tx *sql.Tx, userID *string, seq int64) (string, error) {
+	last := func() (string, error) {
+		var key string
+		if err := tx.QueryRow(`SELECT COALESCE(MAX(rank), '') FROM goals WHERE user_id IS NOT DISTINCT FROM $1`, userID).Scan(&key); err != nil {
+			return "", fmt.Errorf("query last rank: %w", err)
 		}
+		return key, nil
 	}
+	return appendRank(last, func() error {
+		return d.rebalanceGoalRanks(tx, userID, seq)
+	})
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit transaction: %w", err)
+// rebalanceGoalRanks gives the owner's goals short, evenly spaced ranks in
+// their current order, with positions to match. Clocks are left alone: the
+// order itself does not change.
+func (d *PostgresDB) rebalanceGoalRanks(tx *sql.Tx, userID *string, seq int64) error {
+	rows, err := tx.Query(`SELECT id FROM goals WHERE user_id IS NOT DISTINCT FROM $1 ORDER BY rank, id`, userID)
+	if err != nil {
+		return fmt.Errorf("query goal ranks: %w", err)
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		position := rebalancedPosition(i)
+		if _, err := tx.Exec(`UPDATE goals SET rank = $1, position = $2, change_seq = $3 WHERE id = $4`, rank.FromPosition(position), position, seq, id); err != nil {
+			return fmt.Errorf("rebalance rank for %s: %w", id, err)
+		}
 	}
 	return nil
 }
@@ -384,27 +491,28 @@ func (d *PostgresDB) ListCompletions(userID *string, from, to string, goalID *st
 	if err != nil {
 		return nil, fmt.Errorf("query completions: %w", err)
 	}
-	defer rows.Close()
+	return scanCompletions(rows)
+}
 
-	var completions []models.Completion
-	for rows.Next() {
-		var c models.Completion
-		var updatedAt sql.NullTime
-		var deletedAt sql.NullTime
-		if err := rows.Scan(&c.ID, &c.GoalID, &c.Date, &c.CreatedAt, &updatedAt, &deletedAt); err != nil {
-			return nil, fmt.Errorf("scan completion: %w", err)
-		}
-		if updatedAt.Valid {
-			c.UpdatedAt = updatedAt.Time
-		} else {
-			c.UpdatedAt = c.CreatedAt
-		}
-		if deletedAt.Valid {
-			c.DeletedAt = &deletedAt.Time
-		}
-		completions = append(completions, c)
+func (d *PostgresDB) ListAllCompletions(userID *string) ([]models.Completion, error) {
+	query := `SELECT c.id, c.goal_id, c.date, c.created_at, c.updated_at, c.deleted_at
+		FROM completions c
+		INNER JOIN goals g ON c.goal_id = g.id
+		WHERE c.deleted_at IS NULL`
+	var args []any
+	if userID == nil {
+		query += ` AND g.user_id IS NULL`
+	} else {
+		query += ` AND g.user_id = $1`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY c.date ASC`
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query completions: %w", err)
 	}
-	return completions, rows.Err()
+	return scanCompletions(rows)
 }
 
 func (d *PostgresDB) GetCompletionByID(id string) (*models.Completion, error) {
@@ -421,6 +529,7 @@ func (d *PostgresDB) GetCompletionByID(id string) (*models.Completion, error) {
 	if err != nil {
 		return nil, fmt.Errorf("query completion by id: %w", err)
 	}
+	c.Date = completionDate(c.Date)
 	if updatedAt.Valid {
 		c.UpdatedAt = updatedAt.Time
 	} else {
@@ -446,6 +555,7 @@ func (d *PostgresDB) GetCompletionByGoalAndDate(goalID, date string) (*models.Co
 	if err != nil {
 		return nil, fmt.Errorf("query completion: %w", err)
 	}
+	c.Date = completionDate(c.Date)
 	if updatedAt.Valid {
 		c.UpdatedAt = updatedAt.Time
 	} else {
@@ -458,19 +568,24 @@ func (d *PostgresDB) GetCompletionByGoalAndDate(goalID, date string) (*models.Co
 }
 
 func (d *PostgresDB) GetCompletionByGoalAndDateIncludingDeleted(goalID, date string) (*models.Completion, error) {
+	return getCompletionIncludingDeletedPostgres(d, goalID, date)
+}
+
+func getCompletionIncludingDeletedPostgres(q querier, goalID, date string) (*models.Completion, error) {
 	var c models.Completion
 	var deletedAt sql.NullTime
 	var updatedAt sql.NullTime
-	err := d.QueryRow(
-		`SELECT id, goal_id, date, created_at, updated_at, deleted_at FROM completions WHERE goal_id = $1 AND date = $2`,
+	err := q.QueryRow(
+		`SELECT id, goal_id, date, created_at, updated_at, deleted_at, hlc_logical, hlc_node FROM completions WHERE goal_id = $1 AND date = $2`,
 		goalID, date,
-	).Scan(&c.ID, &c.GoalID, &c.Date, &c.CreatedAt, &updatedAt, &deletedAt)
+	).Scan(&c.ID, &c.GoalID, &c.Date, &c.CreatedAt, &updatedAt, &deletedAt, &c.ClockLogical, &c.ClockNode)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("query completion including deleted: %w", err)
 	}
+	c.Date = completionDate(c.Date)
 	if updatedAt.Valid {
 		c.UpdatedAt = updatedAt.Time
 	}
@@ -485,27 +600,69 @@ func (d *PostgresDB) CreateCompletion(c *models.Completion) error {
 		c.UpdatedAt = time.Now().UTC()
 	}
 
-	_, err := d.Exec(
-		`INSERT INTO completions (id, goal_id, date, created_at, updated_at)
-		 VALUES ($1, $2, $3, $4, $5)
-		 ON CONFLICT (goal_id, date) DO UPDATE SET deleted_at = NULL, updated_at = $5`,
-		c.ID, c.GoalID, c.Date, c.CreatedAt, c.UpdatedAt,
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextGoalChangeSeq(tx, c.GoalID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO completions (id, goal_id, date, created_at, updated_at, change_seq)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (goal_id, date) DO UPDATE SET deleted_at = NULL, updated_at = $5, change_seq = $6`,
+		c.ID, c.GoalID, c.Date, c.CreatedAt, c.UpdatedAt, seq,
 	)
 	if err != nil {
 		return fmt.Errorf("insert completion: %w", err)
 	}
+	if err := logGoalChangesPostgres(tx, c.GoalID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
 func (d *PostgresDB) DeleteCompletion(id string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var goalID string
+	err = tx.QueryRow(`SELECT goal_id FROM completions WHERE id = $1`, id).Scan(&goalID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get completion: %w", err)
+	}
+	seq, err := d.nextGoalChangeSeq(tx, goalID)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now().UTC()
-	_, err := d.Exec(
-		`UPDATE completions SET deleted_at = $1, updated_at = $2 WHERE id = $3`,
-		now, now, id,
+	_, err = tx.Exec(
+		`UPDATE completions SET deleted_at = $1, updated_at = $2, change_seq = $3 WHERE id = $4`,
+		now, now, seq, id,
 	)
 	if err != nil {
 		return fmt.Errorf("soft delete completion: %w", err)
 	}
+	if err := logGoalChangesPostgres(tx, goalID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
@@ -519,9 +676,9 @@ func (d *PostgresDB) GetUserByID(id string) (*models.User, error) {
 	var u models.User
 	var lastLoginAt sql.NullTime
 	err := d.QueryRow(
-		`SELECT id, email, name, avatar_url, created_at, last_login_at FROM users WHERE id = $1`,
+		`SELECT id, email, name, avatar_url, created_at, last_login_at, timezone, locale FROM users WHERE id = $1`,
 		id,
-	).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt)
+	).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt, &u.Timezone, &u.Locale)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -538,9 +695,9 @@ func (d *PostgresDB) GetUserByEmail(email string) (*models.User, error) {
 	var u models.User
 	var lastLoginAt sql.NullTime
 	err := d.QueryRow(
-		`SELECT id, email, name, avatar_url, created_at, last_login_at FROM users WHERE email = $1`,
+		`SELECT id, email, name, avatar_url, created_at, last_login_at, timezone, locale FROM users WHERE email = $1`,
 		email,
-	).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt)
+	).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt, &u.Timezone, &u.Locale)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -554,9 +711,15 @@ func (d *PostgresDB) GetUserByEmail(email string) (*models.User, error) {
 }
 
 func (d *PostgresDB) CreateUser(u *models.User) error {
+	if u.Timezone == "" {
+		u.Timezone = DefaultTimezone
+	}
+	if u.Locale == "" {
+		u.Locale = DefaultLocale
+	}
 	_, err := d.Exec(
-		`INSERT INTO users (id, email, name, avatar_url, created_at) VALUES ($1, $2, $3, $4, $5)`,
-		u.ID, u.Email, u.Name, u.AvatarURL, u.CreatedAt,
+		`INSERT INTO users (id, email, name, avatar_url, created_at, timezone, locale) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		u.ID, u.Email, u.Name, u.AvatarURL, u.CreatedAt, u.Timezone, u.Locale,
 	)
 	if err != nil {
 		return fmt.Errorf("insert user: %w", err)
@@ -575,6 +738,22 @@ func (d *PostgresDB) UpdateUserLastLogin(id string) error {
 	return nil
 }
 
+func (d *PostgresDB) UpdateUserTimezone(id, timezone string) error {
+	_, err := d.Exec(`UPDATE users SET timezone = $1 WHERE id = $2`, timezone, id)
+	if err != nil {
+		return fmt.Errorf("update user timezone: %w", err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) UpdateUserLocale(id, locale string) error {
+	_, err := d.Exec(`UPDATE users SET locale = $1 WHERE id = $2`, locale, id)
+	if err != nil {
+		return fmt.Errorf("update user locale: %w", err)
+	}
+	return nil
+}
+
 func (d *PostgresDB) GetOrCreateUserByProvider(provider, providerUserID, email, name, avatarURL string) (*models.User, error) {
 	tx, err := d.Begin()
 	if err != nil {
@@ -594,9 +773,9 @@ func (d *PostgresDB) GetOrCreateUserByProvider(provider, providerUserID, email,
 		var u models.User
 		var lastLoginAt sql.NullTime
 		err = tx.QueryRow(
-			`SELECT id, email, name, avatar_url, created_at, last_login_at FROM users WHERE id = $1`,
+			`SELECT id, email, name, avatar_url, created_at, last_login_at, timezone, locale FROM users WHERE id = $1`,
 			userID,
-		).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt)
+		).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt, &u.Timezone, &u.Locale)
 		if err != nil {
 			return nil, fmt.Errorf("get user: %w", err)
 		}
@@ -626,9 +805,9 @@ func (d *PostgresDB) GetOrCreateUserByProvider(provider, providerUserID, email,
 	var existingUser models.User
 	var lastLoginAt sql.NullTime
 	err = tx.QueryRow(
-		`SELECT id, email, name, avatar_url, created_at, last_login_at FROM users WHERE email = $1`,
+		`SELECT id, email, name, avatar_url, created_at, last_login_at, timezone, locale FROM users WHERE email = $1`,
 		email,
-	).Scan(&existingUser.ID, &existingUser.Email, &existingUser.Name, &existingUser.AvatarURL, &existingUser.CreatedAt, &lastLoginAt)
+	).Scan(&existingUser.ID, &existingUser.Email, &existingUser.Name, &existingUser.AvatarURL, &existingUser.CreatedAt, &lastLoginAt, &existingUser.Timezone, &existingUser.Locale)
 
 	if err == nil {
 		// User exists, add auth provider
@@ -671,6 +850,8 @@ func (d *PostgresDB) GetOrCreateUserByProvider(provider, providerUserID, email,
 		AvatarURL:   avatarURL,
 		CreatedAt:   now,
 		LastLoginAt: &now,
+		Timezone:    DefaultTimezone,
+		Locale:      DefaultLocale,
 	}
 
 	_, err = tx.Exec(
@@ -749,7 +930,7 @@ func generatePostgresUUID() string {
 // Sync operations
 
 func (d *PostgresDB) GetGoalChangesSince(userID *string, since *time.Time) ([]models.Goal, error) {
-	query := `SELECT id, name, color, position, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE `
+	query := `SELECT ` + goalChangeColumns + ` FROM goals WHERE `
 	var args []any
 	paramNum := 1
 
@@ -775,48 +956,30 @@ func (d *PostgresDB) GetGoalChangesSince(userID *string, since *time.Time) ([]mo
 	if err != nil {
 		return nil, fmt.Errorf("query goals: %w", err)
 	}
-	defer rows.Close()
+	return scanGoalChanges(rows)
+}
 
-	var goals []models.Goal
-	for rows.Next() {
-		var g models.Goal
-		var archivedAt, deletedAt sql.NullTime
-		var updatedAt sql.NullTime
-		var goalUserID sql.NullString
-		var targetCount sql.NullInt64
-		var targetPeriod sql.NullString
-		if err := rows.Scan(&g.ID, &g.Name, &g.Color, &g.Position, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt); err != nil {
-			return nil, fmt.Errorf("scan goal: %w", err)
-		}
-		if archivedAt.Valid {
-			g.ArchivedAt = &archivedAt.Time
-		}
-		if deletedAt.Valid {
-			g.DeletedAt = &deletedAt.Time
-		}
-		if updatedAt.Valid {
-			g.UpdatedAt = updatedAt.Time
-		} else {
-			g.UpdatedAt = g.CreatedAt
-		}
-		if goalUserID.Valid {
-			g.UserID = &goalUserID.String
-		}
-		if targetCount.Valid {
-			tc := int(targetCount.Int64)
-			g.TargetCount = &tc
-		}
-		if targetPeriod.Valid {
-			g.TargetPeriod = &targetPeriod.String
-		}
-		goals = append(goals, g)
+func (d *PostgresDB) GetGoalChangesSinceSeq(userID *string, seq int64) ([]models.Goal, error) {
+	query := `SELECT ` + goalChangeColumns + ` FROM goals WHERE change_seq > $1 AND `
+	args := []any{seq}
+	if userID == nil {
+		query += `user_id IS NULL`
+	} else {
+		query += `user_id = $2`
+		args = append(args, *userID)
 	}
-	return goals, rows.Err()
+	query += ` ORDER BY change_seq ASC`
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query goals: %w", err)
+	}
+	return scanGoalChanges(rows)
 }
 
 func (d *PostgresDB) GetCompletionChangesSince(userID *string, since *time.Time) ([]models.Completion, error) {
 	// For completions, we need to join with goals to filter by user_id
-	query := `SELECT c.id, c.goal_id, c.date, c.created_at, c.updated_at, c.deleted_at
+	query := `SELECT ` + completionChangeColumns + `
 		FROM completions c
 		INNER JOIN goals g ON c.goal_id = g.id
 		WHERE `
@@ -845,98 +1008,339 @@ func (d *PostgresDB) GetCompletionChangesSince(userID *string, since *time.Time)
 	if err != nil {
 		return nil, fmt.Errorf("query completions: %w", err)
 	}
-	defer rows.Close()
-
-	var completions []models.Completion
-	for rows.Next() {
-		var c models.Completion
-		var updatedAt sql.NullTime
-		var deletedAt sql.NullTime
-		if err := rows.Scan(&c.ID, &c.GoalID, &c.Date, &c.CreatedAt, &updatedAt, &deletedAt); err != nil {
-			return nil, fmt.Errorf("scan completion: %w", err)
-		}
-		if updatedAt.Valid {
-			c.UpdatedAt = updatedAt.Time
-		} else {
-			c.UpdatedAt = c.CreatedAt
-		}
-		if deletedAt.Valid {
-			c.DeletedAt = &deletedAt.Time
-		}
-		completions = append(completions, c)
-	}
-	return completions, rows.Err()
+	return scanCompletionChanges(rows)
 }
 
-func (d *PostgresDB) UpsertGoal(goal *models.Goal) error {
-	now := time.Now().UTC()
-	if goal.UpdatedAt.IsZero() {
-		goal.UpdatedAt = now
+func (d *PostgresDB) GetCompletionChangesSinceSeq(userID *string, seq int64) ([]models.Completion, error) {
+	query := `SELECT ` + completionChangeColumns + `
+		FROM completions c
+		INNER JOIN goals g ON c.goal_id = g.id
+		WHERE c.change_seq > $1 AND `
+	args := []any{seq}
+	if userID == nil {
+		query += `g.user_id IS NULL`
+	} else {
+		query += `g.user_id = $2`
+		args = append(args, *userID)
 	}
+	query += ` ORDER BY c.change_seq ASC`
 
-	_, err := d.Exec(`
-		INSERT INTO goals (id, name, color, position, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		ON CONFLICT(id) DO UPDATE SET
-			name = EXCLUDED.name,
-			color = EXCLUDED.color,
-			position = EXCLUDED.position,
-			target_count = EXCLUDED.target_count,
-			target_period = EXCLUDED.target_period,
-			updated_at = EXCLUDED.updated_at,
-			archived_at = EXCLUDED.archived_at,
-			deleted_at = EXCLUDED.deleted_at
-		WHERE EXCLUDED.updated_at > goals.updated_at
-	`, goal.ID, goal.Name, goal.Color, goal.Position, goal.TargetCount, goal.TargetPeriod, goal.UserID, goal.CreatedAt, goal.UpdatedAt, goal.ArchivedAt, goal.DeletedAt)
-
+	rows, err := d.Query(query, args...)
 	if err != nil {
-		return fmt.Errorf("upsert goal: %w", err)
+		return nil, fmt.Errorf("query completions: %w", err)
 	}
-	return nil
+	return scanCompletionChanges(rows)
 }
 
-func (d *PostgresDB) UpsertCompletion(c *models.Completion) error {
-	now := time.Now().UTC()
-	if c.UpdatedAt.IsZero() {
-		c.UpdatedAt = now
+func (d *PostgresDB) GetGoalChangesPage(userID *string, after ChangeKey, upTo int64, limit int) ([]models.Goal, error) {
+	query := `SELECT ` + goalChangeColumns + ` FROM goals WHERE change_seq <= $1 AND (change_seq, id) > ($2, $3) AND `
+	args := []any{upTo, after.Seq, after.ID}
+	if userID == nil {
+		query += `user_id IS NULL`
+	} else {
+		query += `user_id = $4`
+		args = append(args, *userID)
 	}
+	query += fmt.Sprintf(` ORDER BY change_seq, id LIMIT $%d`, len(args)+1)
+	args = append(args, limit)
 
-	// Multi-step upsert to handle dual unique constraints
-	// (PK on id + UNIQUE on goal_id,date).
-
-	// Step 1: Try to update by PK (most common path: same id for same row).
-	res, err := d.Exec(`
-		UPDATE completions SET
-			updated_at = $1,
-			deleted_at = $2
-		WHERE id = $3 AND $1 > updated_at
-	`, c.UpdatedAt, c.DeletedAt, c.ID)
+	rows, err := d.Query(query, args...)
 	if err != nil {
-		return fmt.Errorf("upsert completion (update by id): %w", err)
-	}
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected > 0 {
-		return nil
+		return nil, fmt.Errorf("query goals: %w", err)
 	}
+	return scanGoalChanges(rows)
+}
 
-	// Check if the row exists by id but wasn't updated (server is newer).
-	var existsByID int
-	if err := d.QueryRow(`SELECT COUNT(*) FROM completions WHERE id = $1`, c.ID).Scan(&existsByID); err != nil {
-		return fmt.Errorf("upsert completion (check id): %w", err)
+func (d *PostgresDB) GetCompletionChangesPage(userID *string, after ChangeKey, upTo int64, limit int) ([]models.Completion, error) {
+	query := `SELECT ` + completionChangeColumns + `
+		FROM completions c
+		INNER JOIN goals g ON c.goal_id = g.id
+		WHERE c.change_seq <= $1 AND (c.change_seq, c.id) > ($2, $3) AND `
+	args := []any{upTo, after.Seq, after.ID}
+	if userID == nil {
+		query += `g.user_id IS NULL`
+	} else {
+		query += `g.user_id = $4`
+		args = append(args, *userID)
 	}
-	if existsByID > 0 {
-		return nil // Row exists but server is newer; LWW keeps server version
+	query += fmt.Sprintf(` ORDER BY c.change_seq, c.id LIMIT $%d`, len(args)+1)
+	args = append(args, limit)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query completions: %w", err)
+	}
+	return scanCompletionChanges(rows)
+}
+
+func (d *PostgresDB) GetChangeSeq(userID *string) (int64, error) {
+	var seq int64
+	err := d.QueryRow(`SELECT seq FROM change_seqs WHERE user_id = $1`, changeSeqOwner(userID)).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query change seq: %w", err)
+	}
+	return seq, nil
+}
+
+func (d *PostgresDB) GetTombstoneHorizon(userID *string) (TombstoneHorizon, error) {
+	var h TombstoneHorizon
+	var before sql.NullTime
+	err := d.QueryRow(`SELECT purged_seq, purged_before FROM change_seqs WHERE user_id = $1`, changeSeqOwner(userID)).Scan(&h.Seq, &before)
+	if err == sql.ErrNoRows {
+		return TombstoneHorizon{}, nil
+	}
+	if err != nil {
+		return TombstoneHorizon{}, fmt.Errorf("query tombstone horizon: %w", err)
+	}
+	h.Before = before.Time
+	return h, nil
+}
+
+func (d *PostgresDB) PurgeTombstones(before time.Time) (int64, error) {
+	var purged int64
+	err := runInTx(d.DB, func(tx *sql.Tx) error {
+		// Record the horizon before the rows that define it are gone.
+		rows, err := tx.Query(
+			`SELECT owner, MAX(seq) FROM (
+				SELECT COALESCE(user_id, '') AS owner, change_seq AS seq FROM goals WHERE deleted_at < $1
+				UNION ALL
+				SELECT COALESCE(g.user_id, ''), c.change_seq FROM completions c JOIN goals g ON c.goal_id = g.id WHERE c.deleted_at < $2
+			) tombstones GROUP BY owner`,
+			before, before,
+		)
+		if err != nil {
+			return fmt.Errorf("query tombstone owners: %w", err)
+		}
+		horizons := make(map[string]int64)
+		for rows.Next() {
+			var owner string
+			var seq int64
+			if err := rows.Scan(&owner, &seq); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan tombstone owner: %w", err)
+			}
+			horizons[owner] = seq
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("iterate tombstone owners: %w", err)
+		}
+
+		for owner, seq := range horizons {
+			_, err := tx.Exec(
+				`INSERT INTO change_seqs (user_id, seq, purged_seq, purged_before) VALUES ($1, $2, $3, $4)
+				 ON CONFLICT (user_id) DO UPDATE SET
+					purged_seq = GREATEST(change_seqs.purged_seq, excluded.purged_seq),
+					purged_before = excluded.purged_before`,
+				owner, seq, seq, before,
+			)
+			if err != nil {
+				return fmt.Errorf("advance tombstone horizon: %w", err)
+			}
+		}
+
+		// Completions of a purged goal go with it, as in SQLite.
+		result, err := tx.Exec(
+			`DELETE FROM completions WHERE deleted_at < $1 OR goal_id IN (SELECT id FROM goals WHERE deleted_at < $1)`,
+			before,
+		)
+		if err != nil {
+			return fmt.Errorf("purge completion tombstones: %w", err)
+		}
+		completions, _ := result.RowsAffected()
+		result, err = tx.Exec(`DELETE FROM goals WHERE deleted_at < $1`, before)
+		if err != nil {
+			return fmt.Errorf("purge goal tombstones: %w", err)
+		}
+		goals, _ := result.RowsAffected()
+		purged = completions + goals
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// ownerLockNamespace is the first key of every owner's advisory lock, so they
+// cannot collide with advisory locks taken for anything else.
+const ownerLockNamespace = 0x676f616c // "goal"
+
+// ownerLockTimeout bounds the wait for an owner's advisory lock.
+const ownerLockTimeout = 30 * time.Second
+
+// lockOwner takes owner's write lock for the rest of tx. Every write to an
+// owner's goals and completions takes it, through InTx or nextChangeSeq, so
+// replicas sharing the database apply one owner's writes one at a time. The
+// lock is an advisory transaction lock: it ends with tx, even if the
+// instance holding it dies.
+func lockOwner(tx *sql.Tx, owner string) error {
+	if _, err := tx.Exec(fmt.Sprintf(`SET LOCAL lock_timeout = %d`, ownerLockTimeout.Milliseconds())); err != nil {
+		return fmt.Errorf("set lock timeout: %w", err)
+	}
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, hashtext($2))`, ownerLockNamespace, owner); err != nil {
+		return fmt.Errorf("lock owner: %w", err)
+	}
+	return nil
+}
+
+// nextChangeSeq allocates the owner's next change sequence number; see
+// SQLiteDB.nextChangeSeq. It takes the owner's write lock first, and the
+// upsert row-locks the counter until commit.
+func (d *PostgresDB) nextChangeSeq(tx *sql.Tx, userID *string) (int64, error) {
+	if err := lockOwner(tx, changeSeqOwner(userID)); err != nil {
+		return 0, err
+	}
+	var seq int64
+	err := tx.QueryRow(
+		`INSERT INTO change_seqs (user_id, seq) VALUES ($1, 1)
+		 ON CONFLICT (user_id) DO UPDATE SET seq = change_seqs.seq + 1
+		 RETURNING seq`,
+		changeSeqOwner(userID),
+	).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("next change seq: %w", err)
+	}
+	return seq, nil
+}
+
+// nextGoalChangeSeq is nextChangeSeq for the owner of goalID. It returns 0
+// when the goal does not exist.
+func (d *PostgresDB) nextGoalChangeSeq(tx *sql.Tx, goalID string) (int64, error) {
+	var owner sql.NullString
+	err := tx.QueryRow(`SELECT user_id FROM goals WHERE id = $1`, goalID).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get goal owner: %w", err)
+	}
+	var userID *string
+	if owner.Valid {
+		userID = &owner.String
+	}
+	return d.nextChangeSeq(tx, userID)
+}
+
+func (d *PostgresDB) UpsertGoal(goal *models.Goal) error {
+	return runInTx(d.DB, func(tx *sql.Tx) error {
+		return d.upsertGoal(tx, goal)
+	})
+}
+
+// upsertGoal writes goal unless the stored version's clock is later.
+func (d *PostgresDB) upsertGoal(tx *sql.Tx, goal *models.Goal) error {
+	if goal.UpdatedAt.IsZero() {
+		goal.UpdatedAt = time.Now().UTC()
+	}
+	if goal.Rank == "" {
+		goal.Rank = rank.FromPosition(goal.Position)
+	}
+
+	seq, err := d.nextChangeSeq(tx, goal.UserID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO goals (id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at, change_seq, hlc_logical, hlc_node, `+goalFieldClockColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+		ON CONFLICT(id) DO UPDATE SET
+			name = EXCLUDED.name,
+			color = EXCLUDED.color,
+			position = EXCLUDED.position,
+			rank = EXCLUDED.rank,
+			target_count = EXCLUDED.target_count,
+			target_period = EXCLUDED.target_period,
+			updated_at = EXCLUDED.updated_at,
+			archived_at = EXCLUDED.archived_at,
+			deleted_at = EXCLUDED.deleted_at,
+			change_seq = EXCLUDED.change_seq,
+			hlc_logical = EXCLUDED.hlc_logical,
+			hlc_node = EXCLUDED.hlc_node,
+			name_hlc = EXCLUDED.name_hlc,
+			color_hlc = EXCLUDED.color_hlc,
+			position_hlc = EXCLUDED.position_hlc,
+			target_hlc = EXCLUDED.target_hlc,
+			archived_hlc = EXCLUDED.archived_hlc
+		WHERE (EXCLUDED.updated_at, EXCLUDED.hlc_logical, EXCLUDED.hlc_node) >= (goals.updated_at, goals.hlc_logical, goals.hlc_node)
+	`, goal.ID, goal.Name, goal.Color, goal.Position, goal.Rank, goal.TargetCount, goal.TargetPeriod, goal.UserID, goal.CreatedAt, goal.UpdatedAt, goal.ArchivedAt, goal.DeletedAt, seq, goal.ClockLogical, goal.ClockNode,
+		goal.FieldClocks.Name, goal.FieldClocks.Color, goal.FieldClocks.Position, goal.FieldClocks.Target, goal.FieldClocks.Archived)
+
+	if err != nil {
+		return fmt.Errorf("upsert goal: %w", err)
+	}
+	return logChangesPostgres(tx, goal.UserID, seq)
+}
+
+func (d *PostgresDB) UpsertCompletion(c *models.Completion) error {
+	return runInTx(d.DB, func(tx *sql.Tx) error {
+		return d.upsertCompletion(tx, c)
+	})
+}
+
+// upsertCompletion writes c unless the stored version's clock is later.
+func (d *PostgresDB) upsertCompletion(tx *sql.Tx, c *models.Completion) error {
+	if c.UpdatedAt.IsZero() {
+		c.UpdatedAt = time.Now().UTC()
+	}
+
+	seq, err := d.nextGoalChangeSeq(tx, c.GoalID)
+	if err != nil {
+		return err
+	}
+	if err := upsertCompletionPostgres(tx, c, seq); err != nil {
+		return err
+	}
+	return logGoalChangesPostgres(tx, c.GoalID, seq)
+}
+
+func upsertCompletionPostgres(tx *sql.Tx, c *models.Completion, seq int64) error {
+	// Multi-step upsert to handle dual unique constraints
+	// (PK on id + UNIQUE on goal_id,date).
+
+	// Step 1: Try to update by PK (most common path: same id for same row).
+	res, err := tx.Exec(`
+		UPDATE completions SET
+			updated_at = $1,
+			deleted_at = $2,
+			change_seq = $3,
+			hlc_logical = $4,
+			hlc_node = $5
+		WHERE id = $6 AND ($1, $4, $5) > (updated_at, hlc_logical, hlc_node)
+	`, c.UpdatedAt, c.DeletedAt, seq, c.ClockLogical, c.ClockNode, c.ID)
+	if err != nil {
+		return fmt.Errorf("upsert completion (update by id): %w", err)
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	// Check if the row exists by id but wasn't updated (server is newer).
+	var existsByID int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM completions WHERE id = $1`, c.ID).Scan(&existsByID); err != nil {
+		return fmt.Errorf("upsert completion (check id): %w", err)
+	}
+	if existsByID > 0 {
+		return nil // Row exists but server is newer; LWW keeps server version
 	}
 
 	// Step 2: Try to update by (goal_id, date) — handles the case where a
 	// different id maps to the same (goal_id, date) pair (sync race).
-	res, err = d.Exec(`
+	res, err = tx.Exec(`
 		UPDATE completions SET
 			id = $1,
 			updated_at = $2,
-			deleted_at = $3
-		WHERE goal_id = $4 AND date = $5 AND $2 > updated_at
-	`, c.ID, c.UpdatedAt, c.DeletedAt, c.GoalID, c.Date)
+			deleted_at = $3,
+			change_seq = $4,
+			hlc_logical = $5,
+			hlc_node = $6
+		WHERE goal_id = $7 AND date = $8 AND ($2, $5, $6) > (updated_at, hlc_logical, hlc_node)
+	`, c.ID, c.UpdatedAt, c.DeletedAt, seq, c.ClockLogical, c.ClockNode, c.GoalID, c.Date)
 	if err != nil {
 		return fmt.Errorf("upsert completion (update by goal_date): %w", err)
 	}
@@ -946,11 +1350,11 @@ func (d *PostgresDB) UpsertCompletion(c *models.Completion) error {
 	}
 
 	// Step 3: No existing row; insert new (ignore conflicts from races).
-	_, err = d.Exec(`
-		INSERT INTO completions (id, goal_id, date, created_at, updated_at, deleted_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+	_, err = tx.Exec(`
+		INSERT INTO completions (id, goal_id, date, created_at, updated_at, deleted_at, change_seq, hlc_logical, hlc_node)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		ON CONFLICT DO NOTHING
-	`, c.ID, c.GoalID, c.Date, c.CreatedAt, c.UpdatedAt, c.DeletedAt)
+	`, c.ID, c.GoalID, c.Date, c.CreatedAt, c.UpdatedAt, c.DeletedAt, seq, c.ClockLogical, c.ClockNode)
 	if err != nil {
 		return fmt.Errorf("upsert completion (insert): %w", err)
 	}
@@ -958,31 +1362,58 @@ func (d *PostgresDB) UpsertCompletion(c *models.Completion) error {
 }
 
 func (d *PostgresDB) SoftDeleteGoal(userID *string, id string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextChangeSeq(tx, userID)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now().UTC()
-	query := `UPDATE goals SET deleted_at = $1, updated_at = $2 WHERE id = $3`
-	args := []any{now, now, id}
+	query := `UPDATE goals SET deleted_at = $1, updated_at = $2, change_seq = $3, ` + resetGoalClocks + ` WHERE id = $4`
+	args := []any{now, now, seq, id}
 
 	// Add user_id filter for ownership verification
 	if userID == nil {
 		query += ` AND user_id IS NULL`
 	} else {
-		query += ` AND user_id = $4`
+		query += ` AND user_id = $5`
 		args = append(args, *userID)
 	}
 
-	_, err := d.Exec(query, args...)
-	if err != nil {
+	if _, err := tx.Exec(query, args...); err != nil {
 		return fmt.Errorf("soft delete goal: %w", err)
 	}
+	if err := logChangesPostgres(tx, userID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
 func (d *PostgresDB) SoftDeleteCompletion(userID *string, goalID, date string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextChangeSeq(tx, userID)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now().UTC()
-	query := `UPDATE completions SET deleted_at = $1, updated_at = $2
-		WHERE goal_id = $3 AND date = $4
+	query := `UPDATE completions SET deleted_at = $1, updated_at = $2, change_seq = $3
+		WHERE goal_id = $4 AND date = $5
 		AND goal_id IN (SELECT id FROM goals WHERE `
-	args := []any{now, now, goalID, date}
+	args := []any{now, now, seq, goalID, date}
 
 	if userID == nil {
 		query += `user_id IS NULL)`
@@ -991,14 +1422,23 @@ func (d *PostgresDB) SoftDeleteCompletion(userID *string, goalID, date string) e
 		args = append(args, *userID)
 	}
 
-	_, err := d.Exec(query, args...)
-	if err != nil {
+	if _, err := tx.Exec(query, args...); err != nil {
 		return fmt.Errorf("soft delete completion: %w", err)
 	}
+	if err := logChangesPostgres(tx, userID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
 func (d *PostgresDB) GetGoalByID(id string) (*models.Goal, error) {
+	return getGoalByIDPostgres(d, id)
+}
+
+func getGoalByIDPostgres(q querier, id string) (*models.Goal, error) {
 	var g models.Goal
 	var archivedAt, deletedAt sql.NullTime
 	var updatedAt sql.NullTime
@@ -1006,10 +1446,11 @@ func (d *PostgresDB) GetGoalByID(id string) (*models.Goal, error) {
 	var targetCount sql.NullInt64
 	var targetPeriod sql.NullString
 
-	err := d.QueryRow(
-		`SELECT id, name, color, position, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE id = $1`,
+	err := q.QueryRow(
+		`SELECT id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at, hlc_logical, hlc_node, `+goalFieldClockColumns+` FROM goals WHERE id = $1`,
 		id,
-	).Scan(&g.ID, &g.Name, &g.Color, &g.Position, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt)
+	).Scan(&g.ID, &g.Name, &g.Color, &g.Position, &g.Rank, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt, &g.ClockLogical, &g.ClockNode,
+		&g.FieldClocks.Name, &g.FieldClocks.Color, &g.FieldClocks.Position, &g.FieldClocks.Target, &g.FieldClocks.Archived)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -1053,8 +1494,9 @@ func (d *PostgresDB) CreateDeviceToken(userID, token, platform string) (*models.
 	}
 
 	_, err := d.Exec(
-		`INSERT INTO device_tokens (id, user_id, token, platform, created_at) VALUES ($1, $2, $3, $4, $5)
-		ON CONFLICT(token) DO UPDATE SET user_id = EXCLUDED.user_id, platform = EXCLUDED.platform`,
+		`INSERT INTO device_tokens (id, user_id, token, platform, created_at, last_seen_at) VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT(token) DO UPDATE SET user_id = EXCLUDED.user_id, platform = EXCLUDED.platform,
+			last_used_at = EXCLUDED.created_at, last_seen_at = EXCLUDED.last_seen_at`,
 		dt.ID, dt.UserID, dt.Token, dt.Platform, dt.CreatedAt,
 	)
 	if err != nil {
@@ -1062,24 +1504,16 @@ func (d *PostgresDB) CreateDeviceToken(userID, token, platform string) (*models.
 	}
 
 	// If token already existed, fetch the actual record
-	var existing models.DeviceToken
-	var lastUsedAt sql.NullTime
-	err = d.QueryRow(
-		`SELECT id, user_id, token, platform, created_at, last_used_at FROM device_tokens WHERE token = $1`,
-		token,
-	).Scan(&existing.ID, &existing.UserID, &existing.Token, &existing.Platform, &existing.CreatedAt, &lastUsedAt)
+	existing, err := scanDeviceToken(d.QueryRow(`SELECT `+deviceTokenColumns+` FROM device_tokens WHERE token = $1`, token))
 	if err != nil {
 		return nil, fmt.Errorf("fetch device token: %w", err)
 	}
-	if lastUsedAt.Valid {
-		existing.LastUsedAt = &lastUsedAt.Time
-	}
-	return &existing, nil
+	return existing, nil
 }
 
 func (d *PostgresDB) GetDeviceTokensByUserID(userID string) ([]models.DeviceToken, error) {
 	rows, err := d.Query(
-		`SELECT id, user_id, token, platform, created_at, last_used_at FROM device_tokens WHERE user_id = $1 ORDER BY created_at DESC`,
+		`SELECT `+deviceTokenColumns+` FROM device_tokens WHERE user_id = $1 ORDER BY created_at DESC`,
 		userID,
 	)
 	if err != nil {
@@ -1089,19 +1523,51 @@ func (d *PostgresDB) GetDeviceTokensByUserID(userID string) ([]models.DeviceToke
 
 	var tokens []models.DeviceToken
 	for rows.Next() {
-		var dt models.DeviceToken
-		var lastUsedAt sql.NullTime
-		if err := rows.Scan(&dt.ID, &dt.UserID, &dt.Token, &dt.Platform, &dt.CreatedAt, &lastUsedAt); err != nil {
+		dt, err := scanDeviceToken(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan device token: %w", err)
 		}
-		if lastUsedAt.Valid {
-			dt.LastUsedAt = &lastUsedAt.Time
-		}
-		tokens = append(tokens, dt)
+		tokens = append(tokens, *dt)
 	}
 	return tokens, rows.Err()
 }
 
+func (d *PostgresDB) GetDeviceToken(userID, tokenID string) (*models.DeviceToken, error) {
+	dt, err := scanDeviceToken(d.QueryRow(
+		`SELECT `+deviceTokenColumns+` FROM device_tokens WHERE id = $1 AND user_id = $2`,
+		tokenID, userID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get device token: %w", err)
+	}
+	return dt, nil
+}
+
+func (d *PostgresDB) UpdateDeviceToken(userID, tokenID string, name, appVersion *string) error {
+	_, err := d.Exec(
+		`UPDATE device_tokens SET name = COALESCE($1, name), app_version = COALESCE($2, app_version) WHERE id = $3 AND user_id = $4`,
+		name, appVersion, tokenID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("update device token: %w", err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) TouchDeviceToken(userID, tokenID string) error {
+	_, err := d.Exec(
+		`UPDATE device_tokens SET last_seen_at = $1 WHERE id = $2 AND user_id = $3`,
+		time.Now().UTC(), tokenID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("touch device token: %w", err)
+	}
+	return nil
+}
+
 func (d *PostgresDB) DeleteDeviceToken(tokenID string) error {
 	_, err := d.Exec(`DELETE FROM device_tokens WHERE id = $1`, tokenID)
 	if err != nil {
@@ -1121,19 +1587,373 @@ func (d *PostgresDB) UpdateDeviceTokenLastUsed(tokenID string) error {
 	return nil
 }
 
-func (d *PostgresDB) IsEventProcessed(eventID string) (bool, error) {
-	var count int
-	err := d.QueryRow(`SELECT COUNT(*) FROM processed_events WHERE event_id = $1`, eventID).Scan(&count)
+// DeleteStaleDeviceTokens removes tokens not seen since olderThan. A token is
+// seen when it is (re-)registered or a push to it succeeds.
+func (d *PostgresDB) DeleteStaleDeviceTokens(olderThan time.Time) (int64, error) {
+	res, err := d.Exec(
+		`DELETE FROM device_tokens WHERE COALESCE(last_used_at, created_at) < $1`,
+		olderThan,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete stale device tokens: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+	return n, nil
+}
+
+// Reminders
+
+func (d *PostgresDB) CreateReminder(r *models.Reminder) error {
+	if r.ID == "" {
+		r.ID = generatePostgresUUID()
+	}
+	now := time.Now().UTC()
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = now
+	}
+	r.UpdatedAt = now
+	_, err := d.Exec(
+		`INSERT INTO reminders (id, user_id, goal_id, frequency, time_of_day, weekday, enabled, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		r.ID, r.UserID, r.GoalID, r.Frequency, r.Time, r.Weekday, r.Enabled, r.CreatedAt, r.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert reminder: %w", err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) GetReminder(userID, id string) (*models.Reminder, error) {
+	r, err := scanReminder(d.QueryRow(
+		`SELECT `+reminderColumns+` FROM reminders WHERE id = $1 AND user_id = $2`,
+		id, userID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query reminder: %w", err)
+	}
+	return r, nil
+}
+
+func (d *PostgresDB) ListReminders(userID string) ([]models.Reminder, error) {
+	rows, err := d.Query(
+		`SELECT `+reminderColumns+` FROM reminders WHERE user_id = $1 ORDER BY time_of_day ASC, created_at ASC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query reminders: %w", err)
+	}
+	return scanReminders(rows)
+}
+
+func (d *PostgresDB) ListEnabledReminders() ([]models.Reminder, error) {
+	rows, err := d.Query(`SELECT ` + reminderColumns + ` FROM reminders WHERE enabled ORDER BY user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("query enabled reminders: %w", err)
+	}
+	return scanReminders(rows)
+}
+
+func (d *PostgresDB) UpdateReminder(r *models.Reminder) error {
+	r.UpdatedAt = time.Now().UTC()
+	_, err := d.Exec(
+		`UPDATE reminders SET frequency = $1, time_of_day = $2, weekday = $3, enabled = $4, updated_at = $5
+		 WHERE id = $6 AND user_id = $7`,
+		r.Frequency, r.Time, r.Weekday, r.Enabled, r.UpdatedAt, r.ID, r.UserID,
+	)
+	if err != nil {
+		return fmt.Errorf("update reminder: %w", err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) DeleteReminder(userID, id string) error {
+	_, err := d.Exec(`DELETE FROM reminders WHERE id = $1 AND user_id = $2`, id, userID)
 	if err != nil {
-		return false, fmt.Errorf("check processed event: %w", err)
+		return fmt.Errorf("delete reminder: %w", err)
 	}
-	return count > 0, nil
+	return nil
 }
 
-func (d *PostgresDB) MarkEventProcessed(eventID string) error {
+func (d *PostgresDB) ClaimReminder(id string, occurrence, sentAt time.Time, entries []models.PushOutboxEntry) (bool, error) {
+	claimed := false
+	err := runInTx(d.DB, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`UPDATE reminders SET last_sent_at = $1 WHERE id = $2 AND (last_sent_at IS NULL OR last_sent_at < $3)`,
+			sentAt.UTC(), id, occurrence.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("claim reminder: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		claimed = true
+		for i := range entries {
+			if err := createPushOutboxEntryPostgres(tx, &entries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return claimed, nil
+}
+
+// Streak Alerts
+
+func (d *PostgresDB) GetStreakAlertSettings(userID string) (*models.StreakAlertSettings, error) {
+	settings := models.StreakAlertSettings{Enabled: true, Time: DefaultStreakAlertTime}
+	err := d.QueryRow(
+		`SELECT enabled, time_of_day FROM streak_alert_settings WHERE user_id = $1`,
+		userID,
+	).Scan(&settings.Enabled, &settings.Time)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("query streak alert settings: %w", err)
+	}
+	return &settings, nil
+}
+
+func (d *PostgresDB) SaveStreakAlertSettings(userID string, settings models.StreakAlertSettings) error {
 	_, err := d.Exec(
-		`INSERT INTO processed_events (event_id, processed_at) VALUES ($1, $2) ON CONFLICT (event_id) DO NOTHING`,
-		eventID, time.Now().UTC(),
+		`INSERT INTO streak_alert_settings (user_id, enabled, time_of_day, updated_at) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (user_id) DO UPDATE SET enabled = excluded.enabled, time_of_day = excluded.time_of_day, updated_at = excluded.updated_at`,
+		userID, settings.Enabled, settings.Time, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("save streak alert settings: %w", err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) ListStreakAlertRecipients() ([]models.StreakAlertRecipient, error) {
+	rows, err := d.Query(
+		`SELECT u.id, u.timezone, u.locale, COALESCE(s.time_of_day, $1), COALESCE(s.last_sent_on, '')
+		 FROM users u
+		 LEFT JOIN streak_alert_settings s ON s.user_id = u.id
+		 WHERE COALESCE(s.enabled, TRUE) AND EXISTS (SELECT 1 FROM device_tokens t WHERE t.user_id = u.id)
+		 ORDER BY u.id`,
+		DefaultStreakAlertTime,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query streak alert recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var recipients []models.StreakAlertRecipient
+	for rows.Next() {
+		var r models.StreakAlertRecipient
+		if err := rows.Scan(&r.UserID, &r.Timezone, &r.Locale, &r.Time, &r.LastSentOn); err != nil {
+			return nil, fmt.Errorf("scan streak alert recipient: %w", err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+func (d *PostgresDB) ClaimStreakAlert(userID, day string, entries []models.PushOutboxEntry) (bool, error) {
+	claimed := false
+	err := runInTx(d.DB, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`INSERT INTO streak_alert_settings (user_id, time_of_day, last_sent_on) VALUES ($1, $2, $3)
+			 ON CONFLICT (user_id) DO UPDATE SET last_sent_on = excluded.last_sent_on
+			 WHERE streak_alert_settings.last_sent_on IS DISTINCT FROM excluded.last_sent_on`,
+			userID, DefaultStreakAlertTime, day,
+		)
+		if err != nil {
+			return fmt.Errorf("claim streak alert: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		claimed = true
+		for i := range entries {
+			if err := createPushOutboxEntryPostgres(tx, &entries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return claimed, nil
+}
+
+// Push Outbox
+
+func (d *PostgresDB) CreatePushOutboxEntry(e *models.PushOutboxEntry) error {
+	return createPushOutboxEntryPostgres(d, e)
+}
+
+func createPushOutboxEntryPostgres(q querier, e *models.PushOutboxEntry) error {
+	now := time.Now().UTC()
+	if e.ID == "" {
+		e.ID = generatePostgresUUID()
+	}
+	if e.Status == "" {
+		e.Status = models.PushOutboxPending
+	}
+	if e.NextAttemptAt.IsZero() {
+		e.NextAttemptAt = now
+	}
+	e.CreatedAt = now
+	e.UpdatedAt = now
+
+	data, err := encodePushOutboxData(e.Data)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(
+		`INSERT INTO push_outbox (`+pushOutboxColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`,
+		e.ID, e.UserID, e.DeviceTokenID, e.Platform, e.Token, e.Category, e.Title, e.Body, data,
+		e.Status, e.Attempts, e.NextAttemptAt.UTC(), e.LastError, e.CreatedAt, e.UpdatedAt, e.SentAt, e.CollapseKey,
+	)
+	if err != nil {
+		return fmt.Errorf("insert push outbox entry: %w", err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) ClaimPushOutbox(now time.Time, lease time.Duration, limit int) ([]models.PushOutboxEntry, error) {
+	now = now.UTC()
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT `+pushOutboxColumns+` FROM push_outbox
+		 WHERE status IN ('pending', 'sending') AND next_attempt_at <= $1
+		 ORDER BY next_attempt_at LIMIT $2
+		 FOR UPDATE SKIP LOCKED`,
+		now, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query due push outbox: %w", err)
+	}
+	entries, err := scanPushOutboxEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	leaseUntil := now.Add(lease)
+	for i := range entries {
+		e := &entries[i]
+		e.Status = models.PushOutboxSending
+		e.Attempts++
+		e.NextAttemptAt = leaseUntil
+		e.UpdatedAt = now
+		if _, err := tx.Exec(
+			`UPDATE push_outbox SET status = $1, attempts = $2, next_attempt_at = $3, updated_at = $4 WHERE id = $5`,
+			e.Status, e.Attempts, e.NextAttemptAt, e.UpdatedAt, e.ID,
+		); err != nil {
+			return nil, fmt.Errorf("claim push outbox entry: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit push outbox claim: %w", err)
+	}
+	return entries, nil
+}
+
+func (d *PostgresDB) UpdatePushOutboxEntry(e *models.PushOutboxEntry) error {
+	e.UpdatedAt = time.Now().UTC()
+	_, err := d.Exec(
+		`UPDATE push_outbox SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, updated_at = $5, sent_at = $6 WHERE id = $7`,
+		e.Status, e.Attempts, e.NextAttemptAt.UTC(), e.LastError, e.UpdatedAt, e.SentAt, e.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update push outbox entry: %w", err)
+	}
+	return nil
+}
+
+func (d *PostgresDB) ListPushOutbox(filter PushOutboxFilter) ([]models.PushOutboxEntry, error) {
+	query := `SELECT ` + pushOutboxColumns + ` FROM push_outbox WHERE 1=1`
+	var args []any
+	paramNum := 1
+	if filter.UserID != nil {
+		query += fmt.Sprintf(` AND user_id = $%d`, paramNum)
+		args = append(args, *filter.UserID)
+		paramNum++
+	}
+	if filter.Since != nil {
+		query += fmt.Sprintf(` AND created_at >= $%d`, paramNum)
+		args = append(args, filter.Since.UTC())
+		paramNum++
+	}
+	if filter.Status != "" {
+		query += fmt.Sprintf(` AND status = $%d`, paramNum)
+		args = append(args, filter.Status)
+		paramNum++
+	}
+	query += ` ORDER BY created_at DESC`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT $%d`, paramNum)
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query push outbox: %w", err)
+	}
+	return scanPushOutboxEntries(rows)
+}
+
+func (d *PostgresDB) DeleteOldPushOutbox(olderThan time.Time) (int64, error) {
+	res, err := d.Exec(
+		`DELETE FROM push_outbox WHERE status IN ('sent', 'failed') AND created_at < $1`,
+		olderThan.UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete old push outbox: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+	return n, nil
+}
+
+func (d *PostgresDB) IsEventProcessed(userID, eventID string) (*ProcessedEvent, error) {
+	return isEventProcessedPostgres(d, userID, eventID)
+}
+
+func isEventProcessedPostgres(q querier, userID, eventID string) (*ProcessedEvent, error) {
+	e := &ProcessedEvent{UserID: userID, EventID: eventID}
+	err := q.QueryRow(
+		`SELECT status, reason, processed_at FROM processed_events WHERE user_id = $1 AND event_id = $2`,
+		userID, eventID,
+	).Scan(&e.Status, &e.Reason, &e.ProcessedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("check processed event: %w", err)
+	}
+	return e, nil
+}
+
+func (d *PostgresDB) MarkEventProcessed(e *ProcessedEvent) error {
+	return markEventProcessedPostgres(d, e)
+}
+
+func markEventProcessedPostgres(q querier, e *ProcessedEvent) error {
+	if e.ProcessedAt.IsZero() {
+		e.ProcessedAt = time.Now().UTC()
+	}
+	_, err := q.Exec(
+		`INSERT INTO processed_events (user_id, event_id, status, reason, processed_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (user_id, event_id) DO NOTHING`,
+		e.UserID, e.EventID, e.Status, e.Reason, e.ProcessedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("mark event processed: %w", err)
@@ -1149,6 +1969,238 @@ func (d *PostgresDB) PruneProcessedEvents(olderThan time.Time) error {
 	return nil
 }
 
+// Event log
+
+// logChangesPostgres appends the goals and completions the owner wrote with
+// change sequence seq to the event log.
+func logChangesPostgres(q querier, userID *string, seq int64) error {
+	rows, err := q.Query(`SELECT `+goalChangeColumns+` FROM goals WHERE user_id IS NOT DISTINCT FROM $1 AND change_seq = $2`, userID, seq)
+	if err != nil {
+		return fmt.Errorf("query written goals: %w", err)
+	}
+	goals, err := scanGoalChanges(rows)
+	if err != nil {
+		return err
+	}
+	rows, err = q.Query(`SELECT `+completionChangeColumns+`
+		FROM completions c
+		INNER JOIN goals g ON c.goal_id = g.id
+		WHERE g.user_id IS NOT DISTINCT FROM $1 AND c.change_seq = $2`, userID, seq)
+	if err != nil {
+		return fmt.Errorf("query written completions: %w", err)
+	}
+	completions, err := scanCompletionChanges(rows)
+	if err != nil {
+		return err
+	}
+
+	entries, err := eventLogEntries(goals, completions)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, e := range entries {
+		if _, err := q.Exec(
+			`INSERT INTO event_log (user_id, change_seq, kind, item_id, data, recorded_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+			changeSeqOwner(userID), seq, e.kind, e.itemID, string(e.data), now,
+		); err != nil {
+			return fmt.Errorf("append event log: %w", err)
+		}
+	}
+	return nil
+}
+
+// logGoalChangesPostgres is logChangesPostgres for the owner of goalID, after a
+// write whose sequence came from nextGoalChangeSeq.
+func logGoalChangesPostgres(q querier, goalID string, seq int64) error {
+	if seq == 0 {
+		return nil
+	}
+	var userID sql.NullString
+	if err := q.QueryRow(`SELECT user_id FROM goals WHERE id = $1`, goalID).Scan(&userID); err != nil {
+		return fmt.Errorf("query goal owner: %w", err)
+	}
+	var owner *string
+	if userID.Valid {
+		owner = &userID.String
+	}
+	return logChangesPostgres(q, owner, seq)
+}
+
+func (d *PostgresDB) ReplayEventLog(userID string, at time.Time) ([]models.Goal, []models.Completion, error) {
+	if err := checkRestorablePostgres(d, userID, at); err != nil {
+		return nil, nil, err
+	}
+	return replayEventLogPostgres(d, userID, at)
+}
+
+func checkRestorablePostgres(q querier, userID string, at time.Time) error {
+	var snapshotAt time.Time
+	err := q.QueryRow(`SELECT recorded_at FROM event_log WHERE user_id = $1 AND kind = $2 ORDER BY id DESC LIMIT 1`,
+		userID, eventLogSnapshot).Scan(&snapshotAt)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("query event log snapshot: %w", err)
+	}
+	var purgedBefore sql.NullTime
+	err = q.QueryRow(`SELECT purged_before FROM change_seqs WHERE user_id = $1`, userID).Scan(&purgedBefore)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("query tombstone horizon: %w", err)
+	}
+	return checkRestorable(at, snapshotAt, purgedBefore.Time)
+}
+
+func replayEventLogPostgres(q querier, userID string, at time.Time) ([]models.Goal, []models.Completion, error) {
+	rows, err := q.Query(`SELECT kind, data FROM event_log WHERE user_id = $1 AND recorded_at <= $2 ORDER BY id`, userID, at)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query event log: %w", err)
+	}
+	return replayEventLog(rows)
+}
+
+// loggedAfterPostgres returns the items the user's event log rows recorded
+// after at wrote.
+func loggedAfterPostgres(q querier, userID string, at time.Time) (eventLogItems, error) {
+	rows, err := q.Query(`SELECT kind, data FROM event_log WHERE user_id = $1 AND recorded_at > $2 ORDER BY id`, userID, at)
+	if err != nil {
+		return eventLogItems{}, fmt.Errorf("query event log: %w", err)
+	}
+	goals, completions, err := replayEventLog(rows)
+	if err != nil {
+		return eventLogItems{}, err
+	}
+	return loggedItems(goals, completions), nil
+}
+
+func (d *PostgresDB) RestoreToTime(userID string, at time.Time) (int, error) {
+	var written int
+	err := runInTx(d.DB, func(tx *sql.Tx) error {
+		if err := checkRestorablePostgres(tx, userID, at); err != nil {
+			return err
+		}
+		replayedGoals, replayedCompletions, err := replayEventLogPostgres(tx, userID, at)
+		if err != nil {
+			return err
+		}
+		later, err := loggedAfterPostgres(tx, userID, at)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(`SELECT `+goalChangeColumns+` FROM goals WHERE user_id = $1`, userID)
+		if err != nil {
+			return fmt.Errorf("query goals: %w", err)
+		}
+		currentGoals, err := scanGoalChanges(rows)
+		if err != nil {
+			return err
+		}
+		rows, err = tx.Query(`SELECT `+completionChangeColumns+`
+			FROM completions c
+			INNER JOIN goals g ON c.goal_id = g.id
+			WHERE g.user_id = $1`, userID)
+		if err != nil {
+			return fmt.Errorf("query completions: %w", err)
+		}
+		currentCompletions, err := scanCompletionChanges(rows)
+		if err != nil {
+			return err
+		}
+
+		goals, completions := restoreWrites(currentGoals, replayedGoals, currentCompletions, replayedCompletions, later, time.Now().UTC())
+		if len(goals) == 0 && len(completions) == 0 {
+			return nil
+		}
+		seq, err := d.nextChangeSeq(tx, &userID)
+		if err != nil {
+			return err
+		}
+		// Goals first: a restored completion may belong to a restored goal.
+		for _, g := range goals {
+			n, err := restoreGoalPostgres(tx, userID, g, seq)
+			if err != nil {
+				return err
+			}
+			written += n
+		}
+		for _, c := range completions {
+			n, err := restoreCompletionPostgres(tx, userID, c, seq)
+			if err != nil {
+				return err
+			}
+			written += n
+		}
+		return logChangesPostgres(tx, &userID, seq)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// restoreGoalPostgres writes g over the user's goal regardless of clocks, as
+// a server-side write.
+func restoreGoalPostgres(tx *sql.Tx, userID string, g models.Goal, seq int64) (int, error) {
+	res, err := tx.Exec(`
+		INSERT INTO goals (id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at, change_seq)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT(id) DO UPDATE SET
+			name = EXCLUDED.name,
+			color = EXCLUDED.color,
+			position = EXCLUDED.position,
+			rank = EXCLUDED.rank,
+			target_count = EXCLUDED.target_count,
+			target_period = EXCLUDED.target_period,
+			updated_at = EXCLUDED.updated_at,
+			archived_at = EXCLUDED.archived_at,
+			deleted_at = EXCLUDED.deleted_at,
+			change_seq = EXCLUDED.change_seq,
+			`+resetGoalClocks+`
+		WHERE goals.user_id = EXCLUDED.user_id
+	`, g.ID, g.Name, g.Color, g.Position, g.Rank, g.TargetCount, g.TargetPeriod, userID, g.CreatedAt, g.UpdatedAt, g.ArchivedAt, g.DeletedAt, seq)
+	if err != nil {
+		return 0, fmt.Errorf("restore goal %s: %w", g.ID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+	return int(n), nil
+}
+
+// restoreCompletionPostgres writes c over the completion for its goal and
+// date regardless of clocks. Completions of goals the user no longer has
+// are skipped.
+func restoreCompletionPostgres(tx *sql.Tx, userID string, c models.Completion, seq int64) (int, error) {
+	res, err := tx.Exec(`
+		UPDATE completions SET updated_at = $1, deleted_at = $2, change_seq = $3, hlc_logical = 0, hlc_node = ''
+		WHERE goal_id = $4 AND date = $5 AND goal_id IN (SELECT id FROM goals WHERE user_id = $6)
+	`, c.UpdatedAt, c.DeletedAt, seq, c.GoalID, c.Date, userID)
+	if err != nil {
+		return 0, fmt.Errorf("restore completion %s: %w", c.ID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+	if n > 0 {
+		return int(n), nil
+	}
+
+	var owned bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM goals WHERE id = $1 AND user_id = $2)`, c.GoalID, userID).Scan(&owned); err != nil {
+		return 0, fmt.Errorf("check goal %s: %w", c.GoalID, err)
+	}
+	if !owned {
+		return 0, nil
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO completions (id, goal_id, date, created_at, updated_at, deleted_at, change_seq) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		c.ID, c.GoalID, c.Date, c.CreatedAt, c.UpdatedAt, c.DeletedAt, seq,
+	); err != nil {
+		return 0, fmt.Errorf("restore completion %s: %w", c.ID, err)
+	}
+	return 1, nil
+}
+
 // Debug reports
 
 func (d *PostgresDB) CreateDebugReport(r *models.DebugReport) error {
@@ -1278,6 +2330,14 @@ func (d *PostgresDB) DeleteAccount(userID string) error {
 	if _, err := tx.Exec(`DELETE FROM device_tokens WHERE user_id = $1`, userID); err != nil {
 		return fmt.Errorf("delete device tokens: %w", err)
 	}
+	// Delete reminders
+	if _, err := tx.Exec(`DELETE FROM reminders WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete reminders: %w", err)
+	}
+	// Delete queued and historical push deliveries
+	if _, err := tx.Exec(`DELETE FROM push_outbox WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete push outbox: %w", err)
+	}
 	// Delete auth providers
 	if _, err := tx.Exec(`DELETE FROM auth_providers WHERE user_id = $1`, userID); err != nil {
 		return fmt.Errorf("delete auth providers: %w", err)
@@ -1290,6 +2350,22 @@ func (d *PostgresDB) DeleteAccount(userID string) error {
 	if _, err := tx.Exec(`DELETE FROM debug_reports WHERE user_id = $1`, userID); err != nil {
 		return fmt.Errorf("delete debug reports: %w", err)
 	}
+	// Delete streak alert settings
+	if _, err := tx.Exec(`DELETE FROM streak_alert_settings WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete streak alert settings: %w", err)
+	}
+	// Delete event idempotency records
+	if _, err := tx.Exec(`DELETE FROM processed_events WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete processed events: %w", err)
+	}
+	// Delete the event log
+	if _, err := tx.Exec(`DELETE FROM event_log WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete event log: %w", err)
+	}
+	// Delete the change sequence counter
+	if _, err := tx.Exec(`DELETE FROM change_seqs WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete change seq: %w", err)
+	}
 	// Delete user
 	if _, err := tx.Exec(`DELETE FROM users WHERE id = $1`, userID); err != nil {
 		return fmt.Errorf("delete user: %w", err)
@@ -1297,3 +2373,57 @@ func (d *PostgresDB) DeleteAccount(userID string) error {
 
 	return tx.Commit()
 }
+
+// Transactions
+
+// postgresTx implements Tx on an open PostgreSQL transaction.
+type postgresTx struct {
+	d  *PostgresDB
+	tx *sql.Tx
+}
+
+var _ Tx = postgresTx{}
+
+func (d *PostgresDB) InTx(userID string, fn func(tx Tx) error) error {
+	return runInTx(d.DB, func(tx *sql.Tx) error {
+		if err := lockOwner(tx, userID); err != nil {
+			return err
+		}
+		return fn(postgresTx{d: d, tx: tx})
+	})
+}
+
+func (t postgresTx) GetGoalByID(id string) (*models.Goal, error) {
+	return getGoalByIDPostgres(t.tx, id)
+}
+
+func (t postgresTx) GetCompletionByGoalAndDateIncludingDeleted(goalID, date string) (*models.Completion, error) {
+	return getCompletionIncludingDeletedPostgres(t.tx, goalID, date)
+}
+
+func (t postgresTx) UpsertGoal(goal *models.Goal) error {
+	return t.d.upsertGoal(t.tx, goal)
+}
+
+func (t postgresTx) RebalanceGoalRanks(userID string) error {
+	seq, err := t.d.nextChangeSeq(t.tx, &userID)
+	if err != nil {
+		return err
+	}
+	if err := t.d.rebalanceGoalRanks(t.tx, &userID, seq); err != nil {
+		return err
+	}
+	return logChangesPostgres(t.tx, &userID, seq)
+}
+
+func (t postgresTx) UpsertCompletion(c *models.Completion) error {
+	return t.d.upsertCompletion(t.tx, c)
+}
+
+func (t postgresTx) IsEventProcessed(userID, eventID string) (*ProcessedEvent, error) {
+	return isEventProcessedPostgres(t.tx, userID, eventID)
+}
+
+func (t postgresTx) MarkEventProcessed(e *ProcessedEvent) error {
+	return markEventProcessedPostgres(t.tx, e)
+}
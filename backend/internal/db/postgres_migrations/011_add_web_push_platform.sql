@@ -0,0 +1,4 @@
+-- Allow the "web" platform (browser Web Push subscriptions).
+ALTER TABLE device_tokens DROP CONSTRAINT device_tokens_platform_check;
+ALTER TABLE device_tokens ADD CONSTRAINT device_tokens_platform_check
+    CHECK (platform IN ('android', 'ios', 'web'));
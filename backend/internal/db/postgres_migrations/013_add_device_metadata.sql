@@ -0,0 +1,5 @@
+-- Device metadata for the device management API: a user-editable name, the
+-- app version reported at registration, and when the device last talked to us.
+ALTER TABLE device_tokens ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE device_tokens ADD COLUMN app_version TEXT NOT NULL DEFAULT '';
+ALTER TABLE device_tokens ADD COLUMN last_seen_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+-- Preferred language for server-rendered notifications (BCP 47, e.g. "pt-BR").
+ALTER TABLE users ADD COLUMN locale TEXT NOT NULL DEFAULT 'en';
@@ -0,0 +1,10 @@
+-- Evening "don't break your streak" push preferences. Users without a row are
+-- opted in at the default time. time_of_day is a wall-clock HH:MM in the
+-- user's timezone; last_sent_on is the local date (YYYY-MM-DD) of the last run.
+CREATE TABLE IF NOT EXISTS streak_alert_settings (
+    user_id      TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    enabled      BOOLEAN NOT NULL DEFAULT TRUE,
+    time_of_day  TEXT NOT NULL DEFAULT '20:00',
+    last_sent_on TEXT,
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,7 @@
+-- Hybrid logical clock parts for sync conflict resolution. A version's clock
+-- is (updated_at, hlc_logical, hlc_node): the logical counter orders changes
+-- within the same millisecond and the node ID breaks the remaining ties.
+ALTER TABLE goals ADD COLUMN hlc_logical BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE goals ADD COLUMN hlc_node TEXT NOT NULL DEFAULT '';
+ALTER TABLE completions ADD COLUMN hlc_logical BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE completions ADD COLUMN hlc_node TEXT NOT NULL DEFAULT '';
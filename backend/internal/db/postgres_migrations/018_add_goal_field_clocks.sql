@@ -0,0 +1,9 @@
+-- Per-field hybrid logical clocks for goals, so sync can merge concurrent
+-- edits to different fields instead of keeping only the newer record. An
+-- empty value means the field carries the record clock (updated_at,
+-- hlc_logical, hlc_node); writes outside sync reset them all to empty.
+ALTER TABLE goals ADD COLUMN name_hlc TEXT NOT NULL DEFAULT '';
+ALTER TABLE goals ADD COLUMN color_hlc TEXT NOT NULL DEFAULT '';
+ALTER TABLE goals ADD COLUMN position_hlc TEXT NOT NULL DEFAULT '';
+ALTER TABLE goals ADD COLUMN target_hlc TEXT NOT NULL DEFAULT '';
+ALTER TABLE goals ADD COLUMN archived_hlc TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+-- Tombstones (rows with deleted_at) are hard-deleted once older than the
+-- retention horizon. change_seqs records, per owner, the highest change_seq
+-- purged so far and the deleted_at cutoff of the last purge: a client whose
+-- cursor or last_synced_at is older may have missed those deletes and must
+-- resync from scratch.
+ALTER TABLE change_seqs ADD COLUMN purged_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE change_seqs ADD COLUMN purged_before TIMESTAMPTZ;
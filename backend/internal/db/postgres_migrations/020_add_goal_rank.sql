@@ -0,0 +1,7 @@
+-- Goals are ordered by rank, a fractional sort key (see package rank), so
+-- moving one goal rewrites only that goal's row. position is kept for
+-- clients that predate ranks. Existing goals take the key of their position.
+-- The "C" collation compares ranks byte by byte, as the keys require.
+ALTER TABLE goals ADD COLUMN rank TEXT COLLATE "C" NOT NULL DEFAULT '';
+UPDATE goals SET rank = lpad(GREATEST(position, 0)::text, 6, '0');
+CREATE INDEX idx_goals_user_rank ON goals(user_id, rank);
@@ -0,0 +1,38 @@
+-- Every write to a goal or completion appends the state it left the row in,
+-- keyed by owner ('' for goals without a user) and change sequence. Rows are
+-- never updated, so replaying a user's rows up to a time rebuilds their
+-- goals and completions as they stood then. Tombstone purges leave the log
+-- alone; only account deletion removes a user's rows.
+--
+-- Rows written before the log existed are seeded with one 'snapshot' row
+-- each, holding the goal or completion as it stands when the log starts.
+-- Their history before then is unknown, so a restore to an earlier time is
+-- refused rather than rebuilt from it.
+CREATE TABLE IF NOT EXISTS event_log (
+    id BIGSERIAL PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    change_seq BIGINT NOT NULL,
+    kind TEXT NOT NULL, -- 'goal', 'completion' or 'snapshot'
+    item_id TEXT NOT NULL,
+    data TEXT NOT NULL, -- the row as JSON, under "goal" or "completion" in a snapshot
+    recorded_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_log_user_recorded ON event_log(user_id, recorded_at);
+
+INSERT INTO event_log (user_id, change_seq, kind, item_id, data, recorded_at)
+SELECT COALESCE(user_id::text, ''), change_seq, 'snapshot', id::text,
+    json_build_object('goal', json_build_object('id', id, 'name', name, 'color', color, 'position', position, 'rank', rank,
+        'target_count', target_count, 'target_period', target_period, 'user_id', user_id,
+        'created_at', created_at, 'updated_at', updated_at, 'archived_at', archived_at,
+        'deleted_at', deleted_at))::text,
+    now()
+FROM goals;
+
+INSERT INTO event_log (user_id, change_seq, kind, item_id, data, recorded_at)
+SELECT COALESCE(g.user_id::text, ''), c.change_seq, 'snapshot', c.id::text,
+    json_build_object('completion', json_build_object('id', c.id, 'goal_id', c.goal_id, 'date', c.date,
+        'created_at', c.created_at, 'updated_at', c.updated_at, 'deleted_at', c.deleted_at))::text,
+    now()
+FROM completions c
+INNER JOIN goals g ON c.goal_id = g.id;
@@ -2,17 +2,20 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/rank"
 	"github.com/google/uuid"
 )
 
 // Goals
 
 func (d *SQLiteDB) ListGoals(userID *string, includeArchived bool) ([]models.Goal, error) {
-	query := `SELECT id, name, color, position, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE `
+	query := `SELECT id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE `
 	var args []any
 
 	// Filter by user_id
@@ -28,7 +31,8 @@ func (d *SQLiteDB) ListGoals(userID *string, includeArchived bool) ([]models.Goa
 	}
 	// Always exclude soft-deleted goals
 	query += ` AND deleted_at IS NULL`
-	query += ` ORDER BY position ASC, created_at ASC`
+	// Ties between ranks are possible after concurrent moves; IDs break them.
+	query += ` ORDER BY rank ASC, id ASC`
 
 	rows, err := d.Query(query, args...)
 	if err != nil {
@@ -44,7 +48,7 @@ func (d *SQLiteDB) ListGoals(userID *string, includeArchived bool) ([]models.Goa
 		var goalUserID sql.NullString
 		var targetCount sql.NullInt64
 		var targetPeriod sql.NullString
-		if err := rows.Scan(&g.ID, &g.Name, &g.Color, &g.Position, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt); err != nil {
+		if err := rows.Scan(&g.ID, &g.Name, &g.Color, &g.Position, &g.Rank, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt); err != nil {
 			return nil, fmt.Errorf("scan goal: %w", err)
 		}
 		if archivedAt.Valid {
@@ -68,6 +72,8 @@ func (d *SQLiteDB) ListGoals(userID *string, includeArchived bool) ([]models.Goa
 		if targetPeriod.Valid {
 			g.TargetPeriod = &targetPeriod.String
 		}
+		// Listed positions follow rank order, for clients that sort by them.
+		g.Position = len(goals)
 		goals = append(goals, g)
 	}
 	return goals, rows.Err()
@@ -81,7 +87,7 @@ func (d *SQLiteDB) GetGoal(userID *string, id string) (*models.Goal, error) {
 	var targetCount sql.NullInt64
 	var targetPeriod sql.NullString
 
-	query := `SELECT id, name, color, position, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE id = ?`
+	query := `SELECT id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE id = ?`
 	args := []any{id}
 
 	// Add user_id filter
@@ -92,7 +98,7 @@ func (d *SQLiteDB) GetGoal(userID *string, id string) (*models.Goal, error) {
 		args = append(args, *userID)
 	}
 
-	err := d.QueryRow(query, args...).Scan(&g.ID, &g.Name, &g.Color, &g.Position, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt)
+	err := d.QueryRow(query, args...).Scan(&g.ID, &g.Name, &g.Color, &g.Position, &g.Rank, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -129,29 +135,52 @@ func (d *SQLiteDB) CreateGoal(g *models.Goal) error {
 		g.UpdatedAt = now
 	}
 
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextChangeSeq(tx, g.UserID)
+	if err != nil {
+		return err
+	}
+	goalRank, err := d.lastGoalRank(tx, g.UserID, seq)
+	if err != nil {
+		return err
+	}
+
 	var position int
 	if g.UserID == nil {
-		err := d.QueryRow(
-			`INSERT INTO goals (id, name, color, position, target_count, target_period, user_id, created_at, updated_at)
-			 VALUES (?, ?, ?, COALESCE((SELECT MAX(position) FROM goals WHERE user_id IS NULL AND deleted_at IS NULL), -1) + 1, ?, ?, ?, ?, ?)
+		err := tx.QueryRow(
+			`INSERT INTO goals (id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, change_seq)
+			 VALUES (?, ?, ?, COALESCE((SELECT MAX(position) FROM goals WHERE user_id IS NULL AND deleted_at IS NULL), -1) + 1, ?, ?, ?, ?, ?, ?, ?)
 			 RETURNING position`,
-			g.ID, g.Name, g.Color, g.TargetCount, g.TargetPeriod, g.UserID, g.CreatedAt, g.UpdatedAt,
+			g.ID, g.Name, g.Color, goalRank, g.TargetCount, g.TargetPeriod, g.UserID, g.CreatedAt, g.UpdatedAt, seq,
 		).Scan(&position)
 		if err != nil {
 			return fmt.Errorf("insert goal: %w", err)
 		}
 	} else {
-		err := d.QueryRow(
-			`INSERT INTO goals (id, name, color, position, target_count, target_period, user_id, created_at, updated_at)
-			 VALUES (?, ?, ?, COALESCE((SELECT MAX(position) FROM goals WHERE user_id = ? AND deleted_at IS NULL), -1) + 1, ?, ?, ?, ?, ?)
+		err := tx.QueryRow(
+			`INSERT INTO goals (id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, change_seq)
+			 VALUES (?, ?, ?, COALESCE((SELECT MAX(position) FROM goals WHERE user_id = ? AND deleted_at IS NULL), -1) + 1, ?, ?, ?, ?, ?, ?, ?)
 			 RETURNING position`,
-			g.ID, g.Name, g.Color, *g.UserID, g.TargetCount, g.TargetPeriod, g.UserID, g.CreatedAt, g.UpdatedAt,
+			g.ID, g.Name, g.Color, *g.UserID, goalRank, g.TargetCount, g.TargetPeriod, g.UserID, g.CreatedAt, g.UpdatedAt, seq,
 		).Scan(&position)
 		if err != nil {
 			return fmt.Errorf("insert goal: %w", err)
 		}
 	}
+	if err := logChangesSQLite(tx, g.UserID, seq); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	g.Position = position
+	g.Rank = goalRank
 	return nil
 }
 
@@ -181,9 +210,20 @@ func (d *SQLiteDB) UpdateGoal(userID *string, id string, name, color *string, ta
 		args = append(args, *targetPeriod)
 	}
 
-	// Always update updated_at
-	updates = append(updates, `updated_at = ?`)
-	args = append(args, time.Now().UTC())
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextChangeSeq(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Always update updated_at and change_seq
+	updates = append(updates, `updated_at = ?`, `change_seq = ?`, resetGoalClocks)
+	args = append(args, time.Now().UTC(), seq)
 
 	for i, u := range updates {
 		if i > 0 {
@@ -202,17 +242,33 @@ func (d *SQLiteDB) UpdateGoal(userID *string, id string, name, color *string, ta
 		args = append(args, *userID)
 	}
 
-	_, err := d.Exec(query, args...)
-	if err != nil {
+	if _, err := tx.Exec(query, args...); err != nil {
 		return fmt.Errorf("update goal: %w", err)
 	}
+	if err := logChangesSQLite(tx, userID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
 func (d *SQLiteDB) ArchiveGoal(userID *string, id string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextChangeSeq(tx, userID)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now().UTC()
-	query := `UPDATE goals SET archived_at = ?, updated_at = ? WHERE id = ?`
-	args := []any{now, now, id}
+	query := `UPDATE goals SET archived_at = ?, updated_at = ?, change_seq = ?, ` + resetGoalClocks + ` WHERE id = ?`
+	args := []any{now, now, seq, id}
 
 	// Add user_id filter for ownership verification
 	if userID == nil {
@@ -222,10 +278,15 @@ func (d *SQLiteDB) ArchiveGoal(userID *string, id string) error {
 		args = append(args, *userID)
 	}
 
-	_, err := d.Exec(query, args...)
-	if err != nil {
+	if _, err := tx.Exec(query, args...); err != nil {
 		return fmt.Errorf("archive goal: %w", err)
 	}
+	if err := logChangesSQLite(tx, userID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
@@ -259,6 +320,33 @@ func (d *SQLiteDB) ListCompletions(userID *string, from, to string, goalID *stri
 	if err != nil {
 		return nil, fmt.Errorf("query completions: %w", err)
 	}
+	return scanCompletions(rows)
+}
+
+func (d *SQLiteDB) ListAllCompletions(userID *string) ([]models.Completion, error) {
+	query := `SELECT c.id, c.goal_id, c.date, c.created_at, c.updated_at, c.deleted_at
+		FROM completions c
+		INNER JOIN goals g ON c.goal_id = g.id
+		WHERE c.deleted_at IS NULL`
+	var args []any
+	if userID == nil {
+		query += ` AND g.user_id IS NULL`
+	} else {
+		query += ` AND g.user_id = ?`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY c.date ASC`
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query completions: %w", err)
+	}
+	return scanCompletions(rows)
+}
+
+// scanCompletions reads rows of c.id, c.goal_id, c.date, c.created_at,
+// c.updated_at and c.deleted_at, and closes them.
+func scanCompletions(rows *sql.Rows) ([]models.Completion, error) {
 	defer rows.Close()
 
 	var completions []models.Completion
@@ -269,6 +357,7 @@ func (d *SQLiteDB) ListCompletions(userID *string, from, to string, goalID *stri
 		if err := rows.Scan(&c.ID, &c.GoalID, &c.Date, &c.CreatedAt, &updatedAt, &deletedAt); err != nil {
 			return nil, fmt.Errorf("scan completion: %w", err)
 		}
+		c.Date = completionDate(c.Date)
 		if updatedAt.Valid {
 			c.UpdatedAt = updatedAt.Time
 		} else {
@@ -296,6 +385,7 @@ func (d *SQLiteDB) GetCompletionByID(id string) (*models.Completion, error) {
 	if err != nil {
 		return nil, fmt.Errorf("query completion by id: %w", err)
 	}
+	c.Date = completionDate(c.Date)
 	if updatedAt.Valid {
 		c.UpdatedAt = updatedAt.Time
 	} else {
@@ -321,6 +411,7 @@ func (d *SQLiteDB) GetCompletionByGoalAndDate(goalID, date string) (*models.Comp
 	if err != nil {
 		return nil, fmt.Errorf("query completion: %w", err)
 	}
+	c.Date = completionDate(c.Date)
 	if updatedAt.Valid {
 		c.UpdatedAt = updatedAt.Time
 	} else {
@@ -333,19 +424,24 @@ func (d *SQLiteDB) GetCompletionByGoalAndDate(goalID, date string) (*models.Comp
 }
 
 func (d *SQLiteDB) GetCompletionByGoalAndDateIncludingDeleted(goalID, date string) (*models.Completion, error) {
+	return getCompletionIncludingDeletedSQLite(d, goalID, date)
+}
+
+func getCompletionIncludingDeletedSQLite(q querier, goalID, date string) (*models.Completion, error) {
 	var c models.Completion
 	var deletedAt sql.NullTime
 	var updatedAt sql.NullTime
-	err := d.QueryRow(
-		`SELECT id, goal_id, date, created_at, updated_at, deleted_at FROM completions WHERE goal_id = ? AND date = ?`,
+	err := q.QueryRow(
+		`SELECT id, goal_id, date, created_at, updated_at, deleted_at, hlc_logical, hlc_node FROM completions WHERE goal_id = ? AND date = ?`,
 		goalID, date,
-	).Scan(&c.ID, &c.GoalID, &c.Date, &c.CreatedAt, &updatedAt, &deletedAt)
+	).Scan(&c.ID, &c.GoalID, &c.Date, &c.CreatedAt, &updatedAt, &deletedAt, &c.ClockLogical, &c.ClockNode)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("query completion including deleted: %w", err)
 	}
+	c.Date = completionDate(c.Date)
 	if updatedAt.Valid {
 		c.UpdatedAt = updatedAt.Time
 	}
@@ -360,57 +456,147 @@ func (d *SQLiteDB) CreateCompletion(c *models.Completion) error {
 		c.UpdatedAt = time.Now().UTC()
 	}
 
-	_, err := d.Exec(
-		`INSERT INTO completions (id, goal_id, date, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?)
-		 ON CONFLICT (goal_id, date) DO UPDATE SET deleted_at = NULL, updated_at = excluded.updated_at`,
-		c.ID, c.GoalID, c.Date, c.CreatedAt, c.UpdatedAt,
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextGoalChangeSeq(tx, c.GoalID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO completions (id, goal_id, date, created_at, updated_at, change_seq)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT (goal_id, date) DO UPDATE SET deleted_at = NULL, updated_at = excluded.updated_at, change_seq = excluded.change_seq`,
+		c.ID, c.GoalID, c.Date, c.CreatedAt, c.UpdatedAt, seq,
 	)
 	if err != nil {
 		return fmt.Errorf("insert completion: %w", err)
 	}
+	if err := logGoalChangesSQLite(tx, c.GoalID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
 func (d *SQLiteDB) DeleteCompletion(id string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var goalID string
+	err = tx.QueryRow(`SELECT goal_id FROM completions WHERE id = ?`, id).Scan(&goalID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get completion: %w", err)
+	}
+	seq, err := d.nextGoalChangeSeq(tx, goalID)
+	if err != nil {
+		return err
+	}
+
 	now := time.Now().UTC()
-	_, err := d.Exec(
-		`UPDATE completions SET deleted_at = ?, updated_at = ? WHERE id = ?`,
-		now, now, id,
+	_, err = tx.Exec(
+		`UPDATE completions SET deleted_at = ?, updated_at = ?, change_seq = ? WHERE id = ?`,
+		now, now, seq, id,
 	)
 	if err != nil {
 		return fmt.Errorf("soft delete completion: %w", err)
 	}
+	if err := logGoalChangesSQLite(tx, goalID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
 	return nil
 }
 
+// ReorderGoals ranks the owner's goals in the order of goalIDs, rewriting
+// only the goals that have to move. IDs of other users' goals are ignored.
 func (d *SQLiteDB) ReorderGoals(userID *string, goalIDs []string) error {
-	tx, err := d.Begin()
-	if err != nil {
-		return fmt.Errorf("begin transaction: %w", err)
-	}
-	defer tx.Rollback()
+	return runInTx(d.DB, func(tx *sql.Tx) error {
+		seq, err := d.nextChangeSeq(tx, userID)
+		if err != nil {
+			return err
+		}
 
-	for i, id := range goalIDs {
-		query := `UPDATE goals SET position = ? WHERE id = ?`
-		args := []any{i, id}
+		load := func() ([]rank.Item, error) {
+			var items []rank.Item
+			for _, id := range goalIDs {
+				item := rank.Item{ID: id}
+				err := tx.QueryRow(`SELECT rank FROM goals WHERE id = ? AND user_id IS ?`, id, userID).Scan(&item.Key)
+				if err == sql.ErrNoRows {
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("query rank of %s: %w", id, err)
+				}
+				items = append(items, item)
+			}
+			return items, nil
+		}
+		items, keys, err := reorderRanks(load, func() error {
+			return d.rebalanceGoalRanks(tx, userID, seq)
+		})
+		if err != nil {
+			return err
+		}
 
-		// Add user_id filter for ownership verification
-		if userID == nil {
-			query += ` AND user_id IS NULL`
-		} else {
-			query += ` AND user_id = ?`
-			args = append(args, *userID)
+		for i, item := range items {
+			if keys[i] == item.Key {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE goals SET rank = ?, position = ?, change_seq = ? WHERE id = ?`, keys[i], i, seq, item.ID); err != nil {
+				return fmt.Errorf("update rank for %s: %w", item.ID, err)
+			}
 		}
+		return logChangesSQLite(tx, userID, seq)
+	})
+}
 
-		_, err := tx.Exec(query, args...)
-		if err != nil {
-			return fmt.Errorf("update position for %s: %w", id, err)
+// lastGoalRank returns the rank that puts a new goal after the owner's
+// others, rebalancing them first if that rank would be too long.
+func (d *SQLiteDB) lastGoalRank(tx *sql.Tx, userID *string, seq int64) (string, error) {
+	last := func() (string, error) {
+		var key string
+		if err := tx.QueryRow(`SELECT COALESCE(MAX(rank), '') FROM goals WHERE user_id IS ?`, userID).Scan(&key); err != nil {
+			return "", fmt.Errorf("query last rank: %w", err)
 		}
+		return key, nil
 	}
+	return appendRank(last, func() error {
+		return d.rebalanceGoalRanks(tx, userID, seq)
+	})
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit transaction: %w", err)
+// rebalanceGoalRanks gives the owner's goals short, evenly spaced ranks in
+// their current order, with positions to match. Clocks are left alone: the
+// order itself does not change.
+func (d *SQLiteDB) rebalanceGoalRanks(tx *sql.Tx, userID *string, seq int64) error {
+	rows, err := tx.Query(`SELECT id FROM goals WHERE user_id IS ? ORDER BY rank, id`, userID)
+	if err != nil {
+		return fmt.Errorf("query goal ranks: %w", err)
+	}
+	ids, err := scanIDs(rows)
+	if err != nil {
+		return err
+	}
+	for i, id := range ids {
+		position := rebalancedPosition(i)
+		if _, err := tx.Exec(`UPDATE goals SET rank = ?, position = ?, change_seq = ? WHERE id = ?`, rank.FromPosition(position), position, seq, id); err != nil {
+			return fmt.Errorf("rebalance rank for %s: %w", id, err)
+		}
 	}
 	return nil
 }
@@ -421,9 +607,9 @@ func (d *SQLiteDB) GetUserByID(id string) (*models.User, error) {
 	var u models.User
 	var lastLoginAt sql.NullTime
 	err := d.QueryRow(
-		`SELECT id, email, name, avatar_url, created_at, last_login_at FROM users WHERE id = ?`,
+		`SELECT id, email, name, avatar_url, created_at, last_login_at, timezone, locale FROM users WHERE id = ?`,
 		id,
-	).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt)
+	).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt, &u.Timezone, &u.Locale)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -440,9 +626,9 @@ func (d *SQLiteDB) GetUserByEmail(email string) (*models.User, error) {
 	var u models.User
 	var lastLoginAt sql.NullTime
 	err := d.QueryRow(
-		`SELECT id, email, name, avatar_url, created_at, last_login_at FROM users WHERE email = ?`,
+		`SELECT id, email, name, avatar_url, created_at, last_login_at, timezone, locale FROM users WHERE email = ?`,
 		email,
-	).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt)
+	).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt, &u.Timezone, &u.Locale)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -456,9 +642,15 @@ func (d *SQLiteDB) GetUserByEmail(email string) (*models.User, error) {
 }
 
 func (d *SQLiteDB) CreateUser(u *models.User) error {
+	if u.Timezone == "" {
+		u.Timezone = DefaultTimezone
+	}
+	if u.Locale == "" {
+		u.Locale = DefaultLocale
+	}
 	_, err := d.Exec(
-		`INSERT INTO users (id, email, name, avatar_url, created_at) VALUES (?, ?, ?, ?, ?)`,
-		u.ID, u.Email, u.Name, u.AvatarURL, u.CreatedAt,
+		`INSERT INTO users (id, email, name, avatar_url, created_at, timezone, locale) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		u.ID, u.Email, u.Name, u.AvatarURL, u.CreatedAt, u.Timezone, u.Locale,
 	)
 	if err != nil {
 		return fmt.Errorf("insert user: %w", err)
@@ -477,6 +669,22 @@ func (d *SQLiteDB) UpdateUserLastLogin(id string) error {
 	return nil
 }
 
+func (d *SQLiteDB) UpdateUserTimezone(id, timezone string) error {
+	_, err := d.Exec(`UPDATE users SET timezone = ? WHERE id = ?`, timezone, id)
+	if err != nil {
+		return fmt.Errorf("update user timezone: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) UpdateUserLocale(id, locale string) error {
+	_, err := d.Exec(`UPDATE users SET locale = ? WHERE id = ?`, locale, id)
+	if err != nil {
+		return fmt.Errorf("update user locale: %w", err)
+	}
+	return nil
+}
+
 func (d *SQLiteDB) GetOrCreateUserByProvider(provider, providerUserID, email, name, avatarURL string) (*models.User, error) {
 	tx, err := d.Begin()
 	if err != nil {
@@ -496,9 +704,9 @@ func (d *SQLiteDB) GetOrCreateUserByProvider(provider, providerUserID, email, na
 		var u models.User
 		var lastLoginAt sql.NullTime
 		err = tx.QueryRow(
-			`SELECT id, email, name, avatar_url, created_at, last_login_at FROM users WHERE id = ?`,
+			`SELECT id, email, name, avatar_url, created_at, last_login_at, timezone, locale FROM users WHERE id = ?`,
 			userID,
-		).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt)
+		).Scan(&u.ID, &u.Email, &u.Name, &u.AvatarURL, &u.CreatedAt, &lastLoginAt, &u.Timezone, &u.Locale)
 		if err != nil {
 			return nil, fmt.Errorf("get user: %w", err)
 		}
@@ -528,9 +736,9 @@ func (d *SQLiteDB) GetOrCreateUserByProvider(provider, providerUserID, email, na
 	var existingUser models.User
 	var lastLoginAt sql.NullTime
 	err = tx.QueryRow(
-		`SELECT id, email, name, avatar_url, created_at, last_login_at FROM users WHERE email = ?`,
+		`SELECT id, email, name, avatar_url, created_at, last_login_at, timezone, locale FROM users WHERE email = ?`,
 		email,
-	).Scan(&existingUser.ID, &existingUser.Email, &existingUser.Name, &existingUser.AvatarURL, &existingUser.CreatedAt, &lastLoginAt)
+	).Scan(&existingUser.ID, &existingUser.Email, &existingUser.Name, &existingUser.AvatarURL, &existingUser.CreatedAt, &lastLoginAt, &existingUser.Timezone, &existingUser.Locale)
 
 	if err == nil {
 		// User exists, add auth provider
@@ -573,6 +781,8 @@ func (d *SQLiteDB) GetOrCreateUserByProvider(provider, providerUserID, email, na
 		AvatarURL:   avatarURL,
 		CreatedAt:   now,
 		LastLoginAt: &now,
+		Timezone:    DefaultTimezone,
+		Locale:      DefaultLocale,
 	}
 
 	_, err = tx.Exec(
@@ -650,398 +860,1749 @@ func generateUUID() string {
 
 // Sync operations
 
-func (d *SQLiteDB) GetGoalChangesSince(userID *string, since *time.Time) ([]models.Goal, error) {
-	query := `SELECT id, name, color, position, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE `
-	var args []any
+// querier is the part of *sql.DB and *sql.Tx that queries use, so a query
+// can run inside or outside a transaction.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
 
-	// Filter by user_id
+// runInTx runs fn in a transaction on db, committing if it returns nil.
+func runInTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// changeSeqOwner is the change_seqs key of a goal owner; goals without a
+// user share the "" counter.
+func changeSeqOwner(userID *string) string {
 	if userID == nil {
-		query += `user_id IS NULL`
-	} else {
-		query += `user_id = ?`
-		args = append(args, *userID)
+		return ""
 	}
+	return *userID
+}
 
-	// Filter by updated_at if since is provided
-	if since != nil {
-		query += ` AND updated_at > ?`
-		args = append(args, *since)
+// reorderRanks loads goals with load and returns their new ranks, in load
+// order, for rank.Reorder. If no ranks fit it calls rebalance, then loads and
+// tries again.
+func reorderRanks(load func() ([]rank.Item, error), rebalance func() error) ([]rank.Item, []string, error) {
+	items, err := load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if keys, ok := rank.Reorder(items); ok {
+		return items, keys, nil
 	}
 
-	query += ` ORDER BY updated_at ASC`
+	if err := rebalance(); err != nil {
+		return nil, nil, err
+	}
+	if items, err = load(); err != nil {
+		return nil, nil, err
+	}
+	keys, ok := rank.Reorder(items)
+	if !ok {
+		return nil, nil, fmt.Errorf("reorder goals: no ranks fit after rebalancing")
+	}
+	return items, keys, nil
+}
 
-	rows, err := d.Query(query, args...)
+// appendRank returns the rank after the one returned by last, calling
+// rebalance first if that rank would be longer than rank.MaxLength.
+func appendRank(last func() (string, error), rebalance func() error) (string, error) {
+	key, err := last()
 	if err != nil {
-		return nil, fmt.Errorf("query goals: %w", err)
+		return "", err
+	}
+	if next, _ := rank.Between(key, ""); len(next) <= rank.MaxLength {
+		return next, nil
+	}
+
+	if err := rebalance(); err != nil {
+		return "", err
+	}
+	if key, err = last(); err != nil {
+		return "", err
 	}
+	next, _ := rank.Between(key, "")
+	return next, nil
+}
+
+// rebalancedPosition is the position of the i'th goal after rebalancing.
+// Positions start at 1, leaving a rank free for moving a goal to the front.
+func rebalancedPosition(i int) int {
+	return i + 1
+}
+
+// scanIDs reads a single column of IDs and closes rows.
+func scanIDs(rows *sql.Rows) ([]string, error) {
 	defer rows.Close()
 
-	var goals []models.Goal
+	var ids []string
 	for rows.Next() {
-		var g models.Goal
-		var archivedAt, deletedAt sql.NullTime
-		var updatedAt sql.NullTime
-		var goalUserID sql.NullString
-		var targetCount sql.NullInt64
-		var targetPeriod sql.NullString
-		if err := rows.Scan(&g.ID, &g.Name, &g.Color, &g.Position, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt); err != nil {
-			return nil, fmt.Errorf("scan goal: %w", err)
-		}
-		if archivedAt.Valid {
-			g.ArchivedAt = &archivedAt.Time
-		}
-		if deletedAt.Valid {
-			g.DeletedAt = &deletedAt.Time
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan id: %w", err)
 		}
-		if updatedAt.Valid {
-			g.UpdatedAt = updatedAt.Time
-		} else {
-			g.UpdatedAt = g.CreatedAt
-		}
-		if goalUserID.Valid {
-			g.UserID = &goalUserID.String
-		}
-		if targetCount.Valid {
-			tc := int(targetCount.Int64)
-			g.TargetCount = &tc
-		}
-		if targetPeriod.Valid {
-			g.TargetPeriod = &targetPeriod.String
-		}
-		goals = append(goals, g)
+		ids = append(ids, id)
 	}
-	return goals, rows.Err()
+	return ids, rows.Err()
 }
 
-func (d *SQLiteDB) GetCompletionChangesSince(userID *string, since *time.Time) ([]models.Completion, error) {
-	// For completions, we need to join with goals to filter by user_id
-	query := `SELECT c.id, c.goal_id, c.date, c.created_at, c.updated_at, c.deleted_at
-		FROM completions c
-		INNER JOIN goals g ON c.goal_id = g.id
-		WHERE `
-	var args []any
+// Kinds of event log rows. A snapshot seeds the log with a row that existed
+// before it, as the row stood when the log started.
+const (
+	eventLogGoal       = "goal"
+	eventLogCompletion = "completion"
+	eventLogSnapshot   = "snapshot"
+)
 
-	// Filter by user_id through goals
-	if userID == nil {
-		query += `g.user_id IS NULL`
-	} else {
-		query += `g.user_id = ?`
-		args = append(args, *userID)
-	}
+// eventLogSnapshotData is the data of a snapshot row: one goal or completion.
+type eventLogSnapshotData struct {
+	Goal       *models.Goal       `json:"goal"`
+	Completion *models.Completion `json:"completion"`
+}
 
-	// Filter by updated_at if since is provided
-	if since != nil {
-		query += ` AND c.updated_at > ?`
-		args = append(args, *since)
+// eventLogEntry is one event_log row: the state a write left a goal or
+// completion in.
+type eventLogEntry struct {
+	kind   string
+	itemID string
+	data   []byte
+}
+
+// eventLogEntries encodes written goals and completions for the event log.
+func eventLogEntries(goals []models.Goal, completions []models.Completion) ([]eventLogEntry, error) {
+	entries := make([]eventLogEntry, 0, len(goals)+len(completions))
+	for _, g := range goals {
+		data, err := json.Marshal(g)
+		if err != nil {
+			return nil, fmt.Errorf("encode goal %s: %w", g.ID, err)
+		}
+		entries = append(entries, eventLogEntry{kind: eventLogGoal, itemID: g.ID, data: data})
+	}
+	for _, c := range completions {
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil, fmt.Errorf("encode completion %s: %w", c.ID, err)
+		}
+		entries = append(entries, eventLogEntry{kind: eventLogCompletion, itemID: c.ID, data: data})
 	}
+	return entries, nil
+}
 
-	query += ` ORDER BY c.updated_at ASC`
+// completionKey identifies a completion the way the (goal_id, date) unique
+// index does; its ID can change when two devices create it at once.
+type completionKey struct {
+	goalID string
+	date   string
+}
 
-	rows, err := d.Query(query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("query completions: %w", err)
+// completionDate trims a scanned completion date to YYYY-MM-DD. Both drivers
+// scan DATE columns as timestamps, which the date text then carries; every
+// completion read from the database goes through it.
+func completionDate(date string) string {
+	if len(date) > len("2006-01-02") {
+		return date[:len("2006-01-02")]
 	}
+	return date
+}
+
+// replayEventLog folds event log rows of kind and data, oldest first, into
+// the last state of each goal and completion, and closes rows. Goals come
+// back in rank order and completions by date.
+func replayEventLog(rows *sql.Rows) ([]models.Goal, []models.Completion, error) {
 	defer rows.Close()
 
-	var completions []models.Completion
+	goalsByID := make(map[string]models.Goal)
+	completionsByKey := make(map[completionKey]models.Completion)
 	for rows.Next() {
-		var c models.Completion
-		var updatedAt sql.NullTime
-		var deletedAt sql.NullTime
-		if err := rows.Scan(&c.ID, &c.GoalID, &c.Date, &c.CreatedAt, &updatedAt, &deletedAt); err != nil {
-			return nil, fmt.Errorf("scan completion: %w", err)
+		var kind string
+		var data []byte
+		if err := rows.Scan(&kind, &data); err != nil {
+			return nil, nil, fmt.Errorf("scan event log: %w", err)
 		}
-		if updatedAt.Valid {
-			c.UpdatedAt = updatedAt.Time
-		} else {
-			c.UpdatedAt = c.CreatedAt
+		switch kind {
+		case eventLogGoal:
+			var g models.Goal
+			if err := json.Unmarshal(data, &g); err != nil {
+				return nil, nil, fmt.Errorf("decode logged goal: %w", err)
+			}
+			goalsByID[g.ID] = g
+		case eventLogCompletion:
+			var c models.Completion
+			if err := json.Unmarshal(data, &c); err != nil {
+				return nil, nil, fmt.Errorf("decode logged completion: %w", err)
+			}
+			completionsByKey[completionKey{c.GoalID, c.Date}] = c
+		case eventLogSnapshot:
+			var s eventLogSnapshotData
+			if err := json.Unmarshal(data, &s); err != nil {
+				return nil, nil, fmt.Errorf("decode logged snapshot: %w", err)
+			}
+			if s.Goal != nil {
+				goalsByID[s.Goal.ID] = *s.Goal
+			}
+			if s.Completion != nil {
+				s.Completion.Date = completionDate(s.Completion.Date)
+				completionsByKey[completionKey{s.Completion.GoalID, s.Completion.Date}] = *s.Completion
+			}
 		}
-		if deletedAt.Valid {
-			c.DeletedAt = &deletedAt.Time
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	goals := make([]models.Goal, 0, len(goalsByID))
+	for _, g := range goalsByID {
+		goals = append(goals, g)
+	}
+	sort.Slice(goals, func(i, j int) bool {
+		if goals[i].Rank != goals[j].Rank {
+			return goals[i].Rank < goals[j].Rank
+		}
+		return goals[i].ID < goals[j].ID
+	})
+	completions := make([]models.Completion, 0, len(completionsByKey))
+	for _, c := range completionsByKey {
+		completions = append(completions, c)
+	}
+	sort.Slice(completions, func(i, j int) bool {
+		if completions[i].Date != completions[j].Date {
+			return completions[i].Date < completions[j].Date
+		}
+		return completions[i].GoalID < completions[j].GoalID
+	})
+	return goals, completions, nil
+}
+
+// checkRestorable returns ErrBeforeHistory if at is before history starts:
+// before the user's snapshot rows, whose earlier history the log never saw,
+// or before the tombstone horizon, past which deleted rows have been purged.
+func checkRestorable(at, snapshotAt, purgedBefore time.Time) error {
+	if at.Before(snapshotAt) || at.Before(purgedBefore) {
+		return ErrBeforeHistory
+	}
+	return nil
+}
+
+// eventLogItems holds the goals and completions some event log rows wrote.
+type eventLogItems struct {
+	goals       map[string]bool
+	completions map[completionKey]bool
+}
+
+func loggedItems(goals []models.Goal, completions []models.Completion) eventLogItems {
+	items := eventLogItems{
+		goals:       make(map[string]bool, len(goals)),
+		completions: make(map[completionKey]bool, len(completions)),
+	}
+	for _, g := range goals {
+		items.goals[g.ID] = true
+	}
+	for _, c := range completions {
+		items.completions[completionKey{c.GoalID, c.Date}] = true
+	}
+	return items
+}
+
+// restoreWrites returns the writes that take the current goals and
+// completions back to the replayed ones: replayed rows that differ from
+// their current version or were purged while live, and current rows the
+// replay does not know but later holds, deleted, as they were created after
+// the restore time. Current rows the log has never seen are left alone.
+// Every write is stamped now, so it wins over what clients hold.
+func restoreWrites(currentGoals, replayedGoals []models.Goal, currentCompletions, replayedCompletions []models.Completion, later eventLogItems, now time.Time) ([]models.Goal, []models.Completion) {
+	var goals []models.Goal
+	currentGoal := make(map[string]models.Goal, len(currentGoals))
+	for _, g := range currentGoals {
+		currentGoal[g.ID] = g
+	}
+	replayedGoal := make(map[string]bool, len(replayedGoals))
+	for _, g := range replayedGoals {
+		replayedGoal[g.ID] = true
+		cur, ok := currentGoal[g.ID]
+		if ok && sameGoalState(cur, g) || !ok && g.DeletedAt != nil {
+			continue
+		}
+		g.UpdatedAt = now
+		goals = append(goals, g)
+	}
+	for _, g := range currentGoals {
+		if replayedGoal[g.ID] || !later.goals[g.ID] || g.DeletedAt != nil {
+			continue
+		}
+		g.UpdatedAt = now
+		g.DeletedAt = &now
+		goals = append(goals, g)
+	}
+
+	var completions []models.Completion
+	currentCompletion := make(map[completionKey]models.Completion, len(currentCompletions))
+	for _, c := range currentCompletions {
+		currentCompletion[completionKey{c.GoalID, c.Date}] = c
+	}
+	replayedCompletion := make(map[completionKey]bool, len(replayedCompletions))
+	for _, c := range replayedCompletions {
+		key := completionKey{c.GoalID, c.Date}
+		replayedCompletion[key] = true
+		cur, ok := currentCompletion[key]
+		if ok && (cur.DeletedAt == nil) == (c.DeletedAt == nil) || !ok && c.DeletedAt != nil {
+			continue
+		}
+		c.UpdatedAt = now
+		completions = append(completions, c)
+	}
+	for _, c := range currentCompletions {
+		key := completionKey{c.GoalID, c.Date}
+		if replayedCompletion[key] || !later.completions[key] || c.DeletedAt != nil {
+			continue
+		}
+		c.UpdatedAt = now
+		c.DeletedAt = &now
+		completions = append(completions, c)
+	}
+	return goals, completions
+}
+
+// sameGoalState reports whether two versions of a goal look the same to
+// the user.
+func sameGoalState(a, b models.Goal) bool {
+	return a.Name == b.Name &&
+		a.Color == b.Color &&
+		a.Rank == b.Rank &&
+		equalPtr(a.TargetCount, b.TargetCount) &&
+		equalPtr(a.TargetPeriod, b.TargetPeriod) &&
+		(a.ArchivedAt == nil) == (b.ArchivedAt == nil) &&
+		(a.DeletedAt == nil) == (b.DeletedAt == nil)
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// goalFieldClockColumns are the per-field sync clocks, in the order of
+// models.GoalFieldClocks.
+const goalFieldClockColumns = `name_hlc, color_hlc, position_hlc, target_hlc, archived_hlc`
+
+// resetGoalClocks is the SET clause for goal writes made outside sync. They
+// replace the record at the server's time, so every field takes the new
+// updated_at as its clock.
+const resetGoalClocks = `hlc_logical = 0, hlc_node = '', name_hlc = '', color_hlc = '', position_hlc = '', target_hlc = '', archived_hlc = ''`
+
+const goalChangeColumns = `id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at, hlc_logical, hlc_node, change_seq, ` + goalFieldClockColumns
+
+func scanGoalChanges(rows *sql.Rows) ([]models.Goal, error) {
+	defer rows.Close()
+
+	var goals []models.Goal
+	for rows.Next() {
+		var g models.Goal
+		var archivedAt, deletedAt sql.NullTime
+		var updatedAt sql.NullTime
+		var goalUserID sql.NullString
+		var targetCount sql.NullInt64
+		var targetPeriod sql.NullString
+		if err := rows.Scan(&g.ID, &g.Name, &g.Color, &g.Position, &g.Rank, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt, &g.ClockLogical, &g.ClockNode, &g.ChangeSeq,
+			&g.FieldClocks.Name, &g.FieldClocks.Color, &g.FieldClocks.Position, &g.FieldClocks.Target, &g.FieldClocks.Archived); err != nil {
+			return nil, fmt.Errorf("scan goal: %w", err)
+		}
+		if archivedAt.Valid {
+			g.ArchivedAt = &archivedAt.Time
+		}
+		if deletedAt.Valid {
+			g.DeletedAt = &deletedAt.Time
+		}
+		if updatedAt.Valid {
+			g.UpdatedAt = updatedAt.Time
+		} else {
+			g.UpdatedAt = g.CreatedAt
+		}
+		if goalUserID.Valid {
+			g.UserID = &goalUserID.String
+		}
+		if targetCount.Valid {
+			tc := int(targetCount.Int64)
+			g.TargetCount = &tc
+		}
+		if targetPeriod.Valid {
+			g.TargetPeriod = &targetPeriod.String
+		}
+		goals = append(goals, g)
+	}
+	return goals, rows.Err()
+}
+
+const completionChangeColumns = `c.id, c.goal_id, c.date, c.created_at, c.updated_at, c.deleted_at, c.hlc_logical, c.hlc_node, c.change_seq`
+
+func scanCompletionChanges(rows *sql.Rows) ([]models.Completion, error) {
+	defer rows.Close()
+
+	var completions []models.Completion
+	for rows.Next() {
+		var c models.Completion
+		var updatedAt sql.NullTime
+		var deletedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.GoalID, &c.Date, &c.CreatedAt, &updatedAt, &deletedAt, &c.ClockLogical, &c.ClockNode, &c.ChangeSeq); err != nil {
+			return nil, fmt.Errorf("scan completion: %w", err)
+		}
+		c.Date = completionDate(c.Date)
+		if updatedAt.Valid {
+			c.UpdatedAt = updatedAt.Time
+		} else {
+			c.UpdatedAt = c.CreatedAt
+		}
+		if deletedAt.Valid {
+			c.DeletedAt = &deletedAt.Time
 		}
 		completions = append(completions, c)
 	}
 	return completions, rows.Err()
 }
 
-func (d *SQLiteDB) UpsertGoal(goal *models.Goal) error {
-	now := time.Now().UTC()
-	if goal.UpdatedAt.IsZero() {
-		goal.UpdatedAt = now
+func (d *SQLiteDB) GetGoalChangesSince(userID *string, since *time.Time) ([]models.Goal, error) {
+	query := `SELECT ` + goalChangeColumns + ` FROM goals WHERE `
+	var args []any
+
+	// Filter by user_id
+	if userID == nil {
+		query += `user_id IS NULL`
+	} else {
+		query += `user_id = ?`
+		args = append(args, *userID)
 	}
 
-	_, err := d.Exec(`
-		INSERT INTO goals (id, name, color, position, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(id) DO UPDATE SET
-			name = excluded.name,
-			color = excluded.color,
-			position = excluded.position,
-			target_count = excluded.target_count,
-			target_period = excluded.target_period,
-			updated_at = excluded.updated_at,
-			archived_at = excluded.archived_at,
-			deleted_at = excluded.deleted_at
-		WHERE excluded.updated_at > goals.updated_at
-	`, goal.ID, goal.Name, goal.Color, goal.Position, goal.TargetCount, goal.TargetPeriod, goal.UserID, goal.CreatedAt, goal.UpdatedAt, goal.ArchivedAt, goal.DeletedAt)
+	// Filter by updated_at if since is provided
+	if since != nil {
+		query += ` AND updated_at > ?`
+		args = append(args, *since)
+	}
+
+	query += ` ORDER BY updated_at ASC`
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query goals: %w", err)
+	}
+	return scanGoalChanges(rows)
+}
+
+func (d *SQLiteDB) GetGoalChangesSinceSeq(userID *string, seq int64) ([]models.Goal, error) {
+	query := `SELECT ` + goalChangeColumns + ` FROM goals WHERE change_seq > ? AND `
+	args := []any{seq}
+	if userID == nil {
+		query += `user_id IS NULL`
+	} else {
+		query += `user_id = ?`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY change_seq ASC`
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query goals: %w", err)
+	}
+	return scanGoalChanges(rows)
+}
+
+func (d *SQLiteDB) GetCompletionChangesSince(userID *string, since *time.Time) ([]models.Completion, error) {
+	// For completions, we need to join with goals to filter by user_id
+	query := `SELECT ` + completionChangeColumns + `
+		FROM completions c
+		INNER JOIN goals g ON c.goal_id = g.id
+		WHERE `
+	var args []any
+
+	// Filter by user_id through goals
+	if userID == nil {
+		query += `g.user_id IS NULL`
+	} else {
+		query += `g.user_id = ?`
+		args = append(args, *userID)
+	}
+
+	// Filter by updated_at if since is provided
+	if since != nil {
+		query += ` AND c.updated_at > ?`
+		args = append(args, *since)
+	}
+
+	query += ` ORDER BY c.updated_at ASC`
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query completions: %w", err)
+	}
+	return scanCompletionChanges(rows)
+}
+
+func (d *SQLiteDB) GetCompletionChangesSinceSeq(userID *string, seq int64) ([]models.Completion, error) {
+	query := `SELECT ` + completionChangeColumns + `
+		FROM completions c
+		INNER JOIN goals g ON c.goal_id = g.id
+		WHERE c.change_seq > ? AND `
+	args := []any{seq}
+	if userID == nil {
+		query += `g.user_id IS NULL`
+	} else {
+		query += `g.user_id = ?`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY c.change_seq ASC`
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query completions: %w", err)
+	}
+	return scanCompletionChanges(rows)
+}
+
+func (d *SQLiteDB) GetGoalChangesPage(userID *string, after ChangeKey, upTo int64, limit int) ([]models.Goal, error) {
+	query := `SELECT ` + goalChangeColumns + ` FROM goals WHERE change_seq <= ? AND (change_seq, id) > (?, ?) AND `
+	args := []any{upTo, after.Seq, after.ID}
+	if userID == nil {
+		query += `user_id IS NULL`
+	} else {
+		query += `user_id = ?`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY change_seq, id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query goals: %w", err)
+	}
+	return scanGoalChanges(rows)
+}
+
+func (d *SQLiteDB) GetCompletionChangesPage(userID *string, after ChangeKey, upTo int64, limit int) ([]models.Completion, error) {
+	query := `SELECT ` + completionChangeColumns + `
+		FROM completions c
+		INNER JOIN goals g ON c.goal_id = g.id
+		WHERE c.change_seq <= ? AND (c.change_seq, c.id) > (?, ?) AND `
+	args := []any{upTo, after.Seq, after.ID}
+	if userID == nil {
+		query += `g.user_id IS NULL`
+	} else {
+		query += `g.user_id = ?`
+		args = append(args, *userID)
+	}
+	query += ` ORDER BY c.change_seq, c.id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query completions: %w", err)
+	}
+	return scanCompletionChanges(rows)
+}
+
+func (d *SQLiteDB) GetChangeSeq(userID *string) (int64, error) {
+	var seq int64
+	err := d.QueryRow(`SELECT seq FROM change_seqs WHERE user_id = ?`, changeSeqOwner(userID)).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query change seq: %w", err)
+	}
+	return seq, nil
+}
+
+func (d *SQLiteDB) GetTombstoneHorizon(userID *string) (TombstoneHorizon, error) {
+	var h TombstoneHorizon
+	var before sql.NullTime
+	err := d.QueryRow(`SELECT purged_seq, purged_before FROM change_seqs WHERE user_id = ?`, changeSeqOwner(userID)).Scan(&h.Seq, &before)
+	if err == sql.ErrNoRows {
+		return TombstoneHorizon{}, nil
+	}
+	if err != nil {
+		return TombstoneHorizon{}, fmt.Errorf("query tombstone horizon: %w", err)
+	}
+	h.Before = before.Time
+	return h, nil
+}
+
+func (d *SQLiteDB) PurgeTombstones(before time.Time) (int64, error) {
+	var purged int64
+	err := runInTx(d.DB, func(tx *sql.Tx) error {
+		// Record the horizon before the rows that define it are gone.
+		rows, err := tx.Query(
+			`SELECT owner, MAX(seq) FROM (
+				SELECT COALESCE(user_id, '') AS owner, change_seq AS seq FROM goals WHERE deleted_at < ?
+				UNION ALL
+				SELECT COALESCE(g.user_id, ''), c.change_seq FROM completions c JOIN goals g ON c.goal_id = g.id WHERE c.deleted_at < ?
+			) tombstones GROUP BY owner`,
+			before, before,
+		)
+		if err != nil {
+			return fmt.Errorf("query tombstone owners: %w", err)
+		}
+		horizons := make(map[string]int64)
+		for rows.Next() {
+			var owner string
+			var seq int64
+			if err := rows.Scan(&owner, &seq); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan tombstone owner: %w", err)
+			}
+			horizons[owner] = seq
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("iterate tombstone owners: %w", err)
+		}
+
+		for owner, seq := range horizons {
+			_, err := tx.Exec(
+				`INSERT INTO change_seqs (user_id, seq, purged_seq, purged_before) VALUES (?, ?, ?, ?)
+				 ON CONFLICT (user_id) DO UPDATE SET
+					purged_seq = MAX(change_seqs.purged_seq, excluded.purged_seq),
+					purged_before = excluded.purged_before`,
+				owner, seq, seq, before,
+			)
+			if err != nil {
+				return fmt.Errorf("advance tombstone horizon: %w", err)
+			}
+		}
+
+		// Completions of a purged goal go with it. ON DELETE CASCADE is not
+		// relied on: SQLite enforces it only on connections that turned
+		// foreign keys on, and the pool opens more than one.
+		result, err := tx.Exec(
+			`DELETE FROM completions WHERE deleted_at < ? OR goal_id IN (SELECT id FROM goals WHERE deleted_at < ?)`,
+			before, before,
+		)
+		if err != nil {
+			return fmt.Errorf("purge completion tombstones: %w", err)
+		}
+		completions, _ := result.RowsAffected()
+		result, err = tx.Exec(`DELETE FROM goals WHERE deleted_at < ?`, before)
+		if err != nil {
+			return fmt.Errorf("purge goal tombstones: %w", err)
+		}
+		goals, _ := result.RowsAffected()
+		purged = completions + goals
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+// nextChangeSeq allocates the owner's next change sequence number. Call it
+// in the transaction that writes the changed row: the counter row stays
+// locked until commit, so once GetChangeSeq returns N every row numbered N or
+// lower is visible. After the write, logChangesSQLite records what it wrote.
+func (d *SQLiteDB) nextChangeSeq(tx *sql.Tx, userID *string) (int64, error) {
+	var seq int64
+	err := tx.QueryRow(
+		`INSERT INTO change_seqs (user_id, seq) VALUES (?, 1)
+		 ON CONFLICT (user_id) DO UPDATE SET seq = change_seqs.seq + 1
+		 RETURNING seq`,
+		changeSeqOwner(userID),
+	).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("next change seq: %w", err)
+	}
+	return seq, nil
+}
+
+// nextGoalChangeSeq is nextChangeSeq for the owner of goalID. It returns 0
+// when the goal does not exist.
+func (d *SQLiteDB) nextGoalChangeSeq(tx *sql.Tx, goalID string) (int64, error) {
+	var seq int64
+	err := tx.QueryRow(
+		`INSERT INTO change_seqs (user_id, seq) SELECT COALESCE(user_id, ''), 1 FROM goals WHERE id = ?
+		 ON CONFLICT (user_id) DO UPDATE SET seq = change_seqs.seq + 1
+		 RETURNING seq`,
+		goalID,
+	).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("next change seq: %w", err)
+	}
+	return seq, nil
+}
+
+func (d *SQLiteDB) UpsertGoal(goal *models.Goal) error {
+	return runInTx(d.DB, func(tx *sql.Tx) error {
+		return d.upsertGoal(tx, goal)
+	})
+}
+
+// upsertGoal writes goal unless the stored version's clock is later.
+func (d *SQLiteDB) upsertGoal(tx *sql.Tx, goal *models.Goal) error {
+	if goal.UpdatedAt.IsZero() {
+		goal.UpdatedAt = time.Now().UTC()
+	}
+	if goal.Rank == "" {
+		goal.Rank = rank.FromPosition(goal.Position)
+	}
+
+	seq, err := d.nextChangeSeq(tx, goal.UserID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO goals (id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at, change_seq, hlc_logical, hlc_node, `+goalFieldClockColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			color = excluded.color,
+			position = excluded.position,
+			rank = excluded.rank,
+			target_count = excluded.target_count,
+			target_period = excluded.target_period,
+			updated_at = excluded.updated_at,
+			archived_at = excluded.archived_at,
+			deleted_at = excluded.deleted_at,
+			change_seq = excluded.change_seq,
+			hlc_logical = excluded.hlc_logical,
+			hlc_node = excluded.hlc_node,
+			name_hlc = excluded.name_hlc,
+			color_hlc = excluded.color_hlc,
+			position_hlc = excluded.position_hlc,
+			target_hlc = excluded.target_hlc,
+			archived_hlc = excluded.archived_hlc
+		WHERE (excluded.updated_at, excluded.hlc_logical, excluded.hlc_node) >= (goals.updated_at, goals.hlc_logical, goals.hlc_node)
+	`, goal.ID, goal.Name, goal.Color, goal.Position, goal.Rank, goal.TargetCount, goal.TargetPeriod, goal.UserID, goal.CreatedAt, goal.UpdatedAt, goal.ArchivedAt, goal.DeletedAt, seq, goal.ClockLogical, goal.ClockNode,
+		goal.FieldClocks.Name, goal.FieldClocks.Color, goal.FieldClocks.Position, goal.FieldClocks.Target, goal.FieldClocks.Archived)
+
+	if err != nil {
+		return fmt.Errorf("upsert goal: %w", err)
+	}
+	return logChangesSQLite(tx, goal.UserID, seq)
+}
+
+func (d *SQLiteDB) UpsertCompletion(c *models.Completion) error {
+	return runInTx(d.DB, func(tx *sql.Tx) error {
+		return d.upsertCompletion(tx, c)
+	})
+}
+
+// upsertCompletion writes c unless the stored version's clock is later.
+func (d *SQLiteDB) upsertCompletion(tx *sql.Tx, c *models.Completion) error {
+	if c.UpdatedAt.IsZero() {
+		c.UpdatedAt = time.Now().UTC()
+	}
+
+	seq, err := d.nextGoalChangeSeq(tx, c.GoalID)
+	if err != nil {
+		return err
+	}
+	if err := upsertCompletionSQLite(tx, c, seq); err != nil {
+		return err
+	}
+	return logGoalChangesSQLite(tx, c.GoalID, seq)
+}
+
+func upsertCompletionSQLite(tx *sql.Tx, c *models.Completion, seq int64) error {
+	// Multi-step upsert to handle SQLite's limitation with multiple unique
+	// constraints (PK on id + UNIQUE on goal_id,date).
+
+	// Step 1: Try to update by PK (most common path: same id for same row).
+	res, err := tx.Exec(`
+		UPDATE completions SET
+			updated_at = ?,
+			deleted_at = ?,
+			change_seq = ?,
+			hlc_logical = ?,
+			hlc_node = ?
+		WHERE id = ? AND (?, ?, ?) > (updated_at, hlc_logical, hlc_node)
+	`, c.UpdatedAt, c.DeletedAt, seq, c.ClockLogical, c.ClockNode, c.ID, c.UpdatedAt, c.ClockLogical, c.ClockNode)
+	if err != nil {
+		return fmt.Errorf("upsert completion (update by id): %w", err)
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	// Check if the row exists by id but wasn't updated (server is newer).
+	var existsByID int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM completions WHERE id = ?`, c.ID).Scan(&existsByID); err != nil {
+		return fmt.Errorf("upsert completion (check id): %w", err)
+	}
+	if existsByID > 0 {
+		return nil // Row exists but server is newer; LWW keeps server version
+	}
+
+	// Step 2: Try to update by (goal_id, date) — handles the case where a
+	// different id maps to the same (goal_id, date) pair (sync race).
+	res, err = tx.Exec(`
+		UPDATE completions SET
+			id = ?,
+			updated_at = ?,
+			deleted_at = ?,
+			change_seq = ?,
+			hlc_logical = ?,
+			hlc_node = ?
+		WHERE goal_id = ? AND date = ? AND (?, ?, ?) > (updated_at, hlc_logical, hlc_node)
+	`, c.ID, c.UpdatedAt, c.DeletedAt, seq, c.ClockLogical, c.ClockNode, c.GoalID, c.Date, c.UpdatedAt, c.ClockLogical, c.ClockNode)
+	if err != nil {
+		return fmt.Errorf("upsert completion (update by goal_date): %w", err)
+	}
+	rowsAffected, _ = res.RowsAffected()
+	if rowsAffected > 0 {
+		return nil
+	}
+
+	// Step 3: No existing row; insert new.
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO completions (id, goal_id, date, created_at, updated_at, deleted_at, change_seq, hlc_logical, hlc_node)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.ID, c.GoalID, c.Date, c.CreatedAt, c.UpdatedAt, c.DeletedAt, seq, c.ClockLogical, c.ClockNode)
+	if err != nil {
+		return fmt.Errorf("upsert completion (insert): %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) SoftDeleteGoal(userID *string, id string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextChangeSeq(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	query := `UPDATE goals SET deleted_at = ?, updated_at = ?, change_seq = ?, ` + resetGoalClocks + ` WHERE id = ?`
+	args := []any{now, now, seq, id}
+
+	// Add user_id filter for ownership verification
+	if userID == nil {
+		query += ` AND user_id IS NULL`
+	} else {
+		query += ` AND user_id = ?`
+		args = append(args, *userID)
+	}
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		return fmt.Errorf("soft delete goal: %w", err)
+	}
+	if err := logChangesSQLite(tx, userID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) SoftDeleteCompletion(userID *string, goalID, date string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seq, err := d.nextChangeSeq(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	query := `UPDATE completions SET deleted_at = ?, updated_at = ?, change_seq = ?
+		WHERE goal_id = ? AND date = ?
+		AND goal_id IN (SELECT id FROM goals WHERE `
+	args := []any{now, now, seq, goalID, date}
+
+	if userID == nil {
+		query += `user_id IS NULL)`
+	} else {
+		query += `user_id = ?)`
+		args = append(args, *userID)
+	}
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		return fmt.Errorf("soft delete completion: %w", err)
+	}
+	if err := logChangesSQLite(tx, userID, seq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) GetGoalByID(id string) (*models.Goal, error) {
+	return getGoalByIDSQLite(d, id)
+}
+
+func getGoalByIDSQLite(q querier, id string) (*models.Goal, error) {
+	var g models.Goal
+	var archivedAt, deletedAt sql.NullTime
+	var updatedAt sql.NullTime
+	var goalUserID sql.NullString
+	var targetCount sql.NullInt64
+	var targetPeriod sql.NullString
+
+	err := q.QueryRow(
+		`SELECT id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at, hlc_logical, hlc_node, `+goalFieldClockColumns+` FROM goals WHERE id = ?`,
+		id,
+	).Scan(&g.ID, &g.Name, &g.Color, &g.Position, &g.Rank, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt, &g.ClockLogical, &g.ClockNode,
+		&g.FieldClocks.Name, &g.FieldClocks.Color, &g.FieldClocks.Position, &g.FieldClocks.Target, &g.FieldClocks.Archived)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query goal: %w", err)
+	}
+	if archivedAt.Valid {
+		g.ArchivedAt = &archivedAt.Time
+	}
+	if deletedAt.Valid {
+		g.DeletedAt = &deletedAt.Time
+	}
+	if updatedAt.Valid {
+		g.UpdatedAt = updatedAt.Time
+	} else {
+		g.UpdatedAt = g.CreatedAt
+	}
+	if goalUserID.Valid {
+		g.UserID = &goalUserID.String
+	}
+	if targetCount.Valid {
+		tc := int(targetCount.Int64)
+		g.TargetCount = &tc
+	}
+	if targetPeriod.Valid {
+		g.TargetPeriod = &targetPeriod.String
+	}
+	return &g, nil
+}
+
+// Device Tokens (Push Notifications)
+
+const deviceTokenColumns = `id, user_id, token, platform, name, app_version, created_at, last_used_at, last_seen_at`
+
+func scanDeviceToken(row rowScanner) (*models.DeviceToken, error) {
+	var dt models.DeviceToken
+	var lastUsedAt, lastSeenAt sql.NullTime
+	if err := row.Scan(&dt.ID, &dt.UserID, &dt.Token, &dt.Platform, &dt.Name, &dt.AppVersion, &dt.CreatedAt, &lastUsedAt, &lastSeenAt); err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		dt.LastUsedAt = &lastUsedAt.Time
+	}
+	if lastSeenAt.Valid {
+		dt.LastSeenAt = &lastSeenAt.Time
+	}
+	return &dt, nil
+}
+
+func (d *SQLiteDB) CreateDeviceToken(userID, token, platform string) (*models.DeviceToken, error) {
+	now := time.Now().UTC()
+	dt := &models.DeviceToken{
+		ID:        generateUUID(),
+		UserID:    userID,
+		Token:     token,
+		Platform:  platform,
+		CreatedAt: now,
+	}
+
+	_, err := d.Exec(
+		`INSERT INTO device_tokens (id, user_id, token, platform, created_at, last_seen_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(token) DO UPDATE SET user_id = excluded.user_id, platform = excluded.platform,
+			last_used_at = excluded.created_at, last_seen_at = excluded.last_seen_at`,
+		dt.ID, dt.UserID, dt.Token, dt.Platform, dt.CreatedAt, dt.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("insert device token: %w", err)
+	}
+
+	// If token already existed, fetch the actual record
+	existing, err := scanDeviceToken(d.QueryRow(`SELECT `+deviceTokenColumns+` FROM device_tokens WHERE token = ?`, token))
+	if err != nil {
+		return nil, fmt.Errorf("fetch device token: %w", err)
+	}
+	return existing, nil
+}
+
+func (d *SQLiteDB) GetDeviceTokensByUserID(userID string) ([]models.DeviceToken, error) {
+	rows, err := d.Query(
+		`SELECT `+deviceTokenColumns+` FROM device_tokens WHERE user_id = ? ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query device tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.DeviceToken
+	for rows.Next() {
+		dt, err := scanDeviceToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan device token: %w", err)
+		}
+		tokens = append(tokens, *dt)
+	}
+	return tokens, rows.Err()
+}
+
+func (d *SQLiteDB) GetDeviceToken(userID, tokenID string) (*models.DeviceToken, error) {
+	dt, err := scanDeviceToken(d.QueryRow(
+		`SELECT `+deviceTokenColumns+` FROM device_tokens WHERE id = ? AND user_id = ?`,
+		tokenID, userID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get device token: %w", err)
+	}
+	return dt, nil
+}
+
+func (d *SQLiteDB) UpdateDeviceToken(userID, tokenID string, name, appVersion *string) error {
+	_, err := d.Exec(
+		`UPDATE device_tokens SET name = COALESCE(?, name), app_version = COALESCE(?, app_version) WHERE id = ? AND user_id = ?`,
+		name, appVersion, tokenID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("update device token: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) TouchDeviceToken(userID, tokenID string) error {
+	_, err := d.Exec(
+		`UPDATE device_tokens SET last_seen_at = ? WHERE id = ? AND user_id = ?`,
+		time.Now().UTC(), tokenID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("touch device token: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) DeleteDeviceToken(tokenID string) error {
+	_, err := d.Exec(`DELETE FROM device_tokens WHERE id = ?`, tokenID)
+	if err != nil {
+		return fmt.Errorf("delete device token: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) UpdateDeviceTokenLastUsed(tokenID string) error {
+	_, err := d.Exec(
+		`UPDATE device_tokens SET last_used_at = ? WHERE id = ?`,
+		time.Now().UTC(), tokenID,
+	)
+	if err != nil {
+		return fmt.Errorf("update device token last used: %w", err)
+	}
+	return nil
+}
+
+// DeleteStaleDeviceTokens removes tokens not seen since olderThan. A token is
+// seen when it is (re-)registered or a push to it succeeds.
+func (d *SQLiteDB) DeleteStaleDeviceTokens(olderThan time.Time) (int64, error) {
+	res, err := d.Exec(
+		`DELETE FROM device_tokens WHERE COALESCE(last_used_at, created_at) < ?`,
+		olderThan,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete stale device tokens: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+	return n, nil
+}
+
+// Reminders
+
+const reminderColumns = `id, user_id, goal_id, frequency, time_of_day, weekday, enabled, last_sent_at, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanReminder(row rowScanner) (*models.Reminder, error) {
+	var r models.Reminder
+	var goalID sql.NullString
+	var lastSentAt sql.NullTime
+	if err := row.Scan(&r.ID, &r.UserID, &goalID, &r.Frequency, &r.Time, &r.Weekday, &r.Enabled, &lastSentAt, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if goalID.Valid {
+		r.GoalID = &goalID.String
+	}
+	if lastSentAt.Valid {
+		r.LastSentAt = &lastSentAt.Time
+	}
+	return &r, nil
+}
+
+func scanReminders(rows *sql.Rows) ([]models.Reminder, error) {
+	defer rows.Close()
+	var reminders []models.Reminder
+	for rows.Next() {
+		r, err := scanReminder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan reminder: %w", err)
+		}
+		reminders = append(reminders, *r)
+	}
+	return reminders, rows.Err()
+}
+
+func (d *SQLiteDB) CreateReminder(r *models.Reminder) error {
+	if r.ID == "" {
+		r.ID = generateUUID()
+	}
+	now := time.Now().UTC()
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = now
+	}
+	r.UpdatedAt = now
+	_, err := d.Exec(
+		`INSERT INTO reminders (id, user_id, goal_id, frequency, time_of_day, weekday, enabled, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.UserID, r.GoalID, r.Frequency, r.Time, r.Weekday, r.Enabled, r.CreatedAt, r.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert reminder: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) GetReminder(userID, id string) (*models.Reminder, error) {
+	r, err := scanReminder(d.QueryRow(
+		`SELECT `+reminderColumns+` FROM reminders WHERE id = ? AND user_id = ?`,
+		id, userID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query reminder: %w", err)
+	}
+	return r, nil
+}
+
+func (d *SQLiteDB) ListReminders(userID string) ([]models.Reminder, error) {
+	rows, err := d.Query(
+		`SELECT `+reminderColumns+` FROM reminders WHERE user_id = ? ORDER BY time_of_day ASC, created_at ASC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query reminders: %w", err)
+	}
+	return scanReminders(rows)
+}
+
+func (d *SQLiteDB) ListEnabledReminders() ([]models.Reminder, error) {
+	rows, err := d.Query(`SELECT ` + reminderColumns + ` FROM reminders WHERE enabled = 1 ORDER BY user_id`)
+	if err != nil {
+		return nil, fmt.Errorf("query enabled reminders: %w", err)
+	}
+	return scanReminders(rows)
+}
+
+func (d *SQLiteDB) UpdateReminder(r *models.Reminder) error {
+	r.UpdatedAt = time.Now().UTC()
+	_, err := d.Exec(
+		`UPDATE reminders SET frequency = ?, time_of_day = ?, weekday = ?, enabled = ?, updated_at = ?
+		 WHERE id = ? AND user_id = ?`,
+		r.Frequency, r.Time, r.Weekday, r.Enabled, r.UpdatedAt, r.ID, r.UserID,
+	)
+	if err != nil {
+		return fmt.Errorf("update reminder: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) DeleteReminder(userID, id string) error {
+	_, err := d.Exec(`DELETE FROM reminders WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("delete reminder: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) ClaimReminder(id string, occurrence, sentAt time.Time, entries []models.PushOutboxEntry) (bool, error) {
+	claimed := false
+	err := runInTx(d.DB, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`UPDATE reminders SET last_sent_at = ? WHERE id = ? AND (last_sent_at IS NULL OR last_sent_at < ?)`,
+			sentAt.UTC(), id, occurrence.UTC(),
+		)
+		if err != nil {
+			return fmt.Errorf("claim reminder: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		claimed = true
+		for i := range entries {
+			if err := createPushOutboxEntrySQLite(tx, &entries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return claimed, nil
+}
+
+// Streak Alerts
+
+func (d *SQLiteDB) GetStreakAlertSettings(userID string) (*models.StreakAlertSettings, error) {
+	settings := models.StreakAlertSettings{Enabled: true, Time: DefaultStreakAlertTime}
+	err := d.QueryRow(
+		`SELECT enabled, time_of_day FROM streak_alert_settings WHERE user_id = ?`,
+		userID,
+	).Scan(&settings.Enabled, &settings.Time)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("query streak alert settings: %w", err)
+	}
+	return &settings, nil
+}
+
+func (d *SQLiteDB) SaveStreakAlertSettings(userID string, settings models.StreakAlertSettings) error {
+	_, err := d.Exec(
+		`INSERT INTO streak_alert_settings (user_id, enabled, time_of_day, updated_at) VALUES (?, ?, ?, ?)
+		 ON CONFLICT (user_id) DO UPDATE SET enabled = excluded.enabled, time_of_day = excluded.time_of_day, updated_at = excluded.updated_at`,
+		userID, settings.Enabled, settings.Time, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("save streak alert settings: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) ListStreakAlertRecipients() ([]models.StreakAlertRecipient, error) {
+	rows, err := d.Query(
+		`SELECT u.id, u.timezone, u.locale, COALESCE(s.time_of_day, ?), COALESCE(s.last_sent_on, '')
+		 FROM users u
+		 LEFT JOIN streak_alert_settings s ON s.user_id = u.id
+		 WHERE COALESCE(s.enabled, 1) AND EXISTS (SELECT 1 FROM device_tokens t WHERE t.user_id = u.id)
+		 ORDER BY u.id`,
+		DefaultStreakAlertTime,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query streak alert recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var recipients []models.StreakAlertRecipient
+	for rows.Next() {
+		var r models.StreakAlertRecipient
+		if err := rows.Scan(&r.UserID, &r.Timezone, &r.Locale, &r.Time, &r.LastSentOn); err != nil {
+			return nil, fmt.Errorf("scan streak alert recipient: %w", err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+func (d *SQLiteDB) ClaimStreakAlert(userID, day string, entries []models.PushOutboxEntry) (bool, error) {
+	claimed := false
+	err := runInTx(d.DB, func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			`INSERT INTO streak_alert_settings (user_id, time_of_day, last_sent_on) VALUES (?, ?, ?)
+			 ON CONFLICT (user_id) DO UPDATE SET last_sent_on = excluded.last_sent_on
+			 WHERE streak_alert_settings.last_sent_on IS NOT excluded.last_sent_on`,
+			userID, DefaultStreakAlertTime, day,
+		)
+		if err != nil {
+			return fmt.Errorf("claim streak alert: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		claimed = true
+		for i := range entries {
+			if err := createPushOutboxEntrySQLite(tx, &entries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return claimed, nil
+}
+
+// Push Outbox
+
+const pushOutboxColumns = `id, user_id, device_token_id, platform, token, category, title, body, data, status, attempts, next_attempt_at, last_error, created_at, updated_at, sent_at, collapse_key`
+
+func scanPushOutboxEntries(rows *sql.Rows) ([]models.PushOutboxEntry, error) {
+	defer rows.Close()
+	var entries []models.PushOutboxEntry
+	for rows.Next() {
+		var e models.PushOutboxEntry
+		var data string
+		var sentAt sql.NullTime
+		if err := rows.Scan(&e.ID, &e.UserID, &e.DeviceTokenID, &e.Platform, &e.Token, &e.Category, &e.Title, &e.Body, &data,
+			&e.Status, &e.Attempts, &e.NextAttemptAt, &e.LastError, &e.CreatedAt, &e.UpdatedAt, &sentAt, &e.CollapseKey); err != nil {
+			return nil, fmt.Errorf("scan push outbox entry: %w", err)
+		}
+		if data != "" && data != "{}" {
+			if err := json.Unmarshal([]byte(data), &e.Data); err != nil {
+				return nil, fmt.Errorf("decode push outbox data: %w", err)
+			}
+		}
+		if sentAt.Valid {
+			e.SentAt = &sentAt.Time
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// encodePushOutboxData serialises the notification data map for storage.
+func encodePushOutboxData(data map[string]string) (string, error) {
+	if len(data) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("encode push outbox data: %w", err)
+	}
+	return string(b), nil
+}
+
+func (d *SQLiteDB) CreatePushOutboxEntry(e *models.PushOutboxEntry) error {
+	return createPushOutboxEntrySQLite(d, e)
+}
+
+func createPushOutboxEntrySQLite(q querier, e *models.PushOutboxEntry) error {
+	now := time.Now().UTC()
+	if e.ID == "" {
+		e.ID = generateUUID()
+	}
+	if e.Status == "" {
+		e.Status = models.PushOutboxPending
+	}
+	if e.NextAttemptAt.IsZero() {
+		e.NextAttemptAt = now
+	}
+	e.CreatedAt = now
+	e.UpdatedAt = now
+
+	data, err := encodePushOutboxData(e.Data)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(
+		`INSERT INTO push_outbox (`+pushOutboxColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.UserID, e.DeviceTokenID, e.Platform, e.Token, e.Category, e.Title, e.Body, data,
+		e.Status, e.Attempts, e.NextAttemptAt.UTC(), e.LastError, e.CreatedAt, e.UpdatedAt, e.SentAt, e.CollapseKey,
+	)
+	if err != nil {
+		return fmt.Errorf("insert push outbox entry: %w", err)
+	}
+	return nil
+}
+
+func (d *SQLiteDB) ClaimPushOutbox(now time.Time, lease time.Duration, limit int) ([]models.PushOutboxEntry, error) {
+	now = now.UTC()
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		`SELECT `+pushOutboxColumns+` FROM push_outbox
+		 WHERE status IN ('pending', 'sending') AND next_attempt_at <= ?
+		 ORDER BY next_attempt_at LIMIT ?`,
+		now, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query due push outbox: %w", err)
+	}
+	entries, err := scanPushOutboxEntries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	leaseUntil := now.Add(lease)
+	for i := range entries {
+		e := &entries[i]
+		e.Status = models.PushOutboxSending
+		e.Attempts++
+		e.NextAttemptAt = leaseUntil
+		e.UpdatedAt = now
+		if _, err := tx.Exec(
+			`UPDATE push_outbox SET status = ?, attempts = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?`,
+			e.Status, e.Attempts, e.NextAttemptAt, e.UpdatedAt, e.ID,
+		); err != nil {
+			return nil, fmt.Errorf("claim push outbox entry: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit push outbox claim: %w", err)
+	}
+	return entries, nil
+}
 
+func (d *SQLiteDB) UpdatePushOutboxEntry(e *models.PushOutboxEntry) error {
+	e.UpdatedAt = time.Now().UTC()
+	_, err := d.Exec(
+		`UPDATE push_outbox SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ?, updated_at = ?, sent_at = ? WHERE id = ?`,
+		e.Status, e.Attempts, e.NextAttemptAt.UTC(), e.LastError, e.UpdatedAt, e.SentAt, e.ID,
+	)
 	if err != nil {
-		return fmt.Errorf("upsert goal: %w", err)
+		return fmt.Errorf("update push outbox entry: %w", err)
 	}
 	return nil
 }
 
-func (d *SQLiteDB) UpsertCompletion(c *models.Completion) error {
-	now := time.Now().UTC()
-	if c.UpdatedAt.IsZero() {
-		c.UpdatedAt = now
-	}
-
-	// Multi-step upsert to handle SQLite's limitation with multiple unique
-	// constraints (PK on id + UNIQUE on goal_id,date).
-
-	// Step 1: Try to update by PK (most common path: same id for same row).
-	res, err := d.Exec(`
-		UPDATE completions SET
-			updated_at = ?,
-			deleted_at = ?
-		WHERE id = ? AND ? > updated_at
-	`, c.UpdatedAt, c.DeletedAt, c.ID, c.UpdatedAt)
-	if err != nil {
-		return fmt.Errorf("upsert completion (update by id): %w", err)
+func (d *SQLiteDB) ListPushOutbox(filter PushOutboxFilter) ([]models.PushOutboxEntry, error) {
+	query := `SELECT ` + pushOutboxColumns + ` FROM push_outbox WHERE 1=1`
+	var args []any
+	if filter.UserID != nil {
+		query += ` AND user_id = ?`
+		args = append(args, *filter.UserID)
 	}
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected > 0 {
-		return nil
+	if filter.Since != nil {
+		query += ` AND created_at >= ?`
+		args = append(args, filter.Since.UTC())
 	}
-
-	// Check if the row exists by id but wasn't updated (server is newer).
-	var existsByID int
-	if err := d.QueryRow(`SELECT COUNT(*) FROM completions WHERE id = ?`, c.ID).Scan(&existsByID); err != nil {
-		return fmt.Errorf("upsert completion (check id): %w", err)
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
 	}
-	if existsByID > 0 {
-		return nil // Row exists but server is newer; LWW keeps server version
+	query += ` ORDER BY created_at DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
 	}
 
-	// Step 2: Try to update by (goal_id, date) — handles the case where a
-	// different id maps to the same (goal_id, date) pair (sync race).
-	res, err = d.Exec(`
-		UPDATE completions SET
-			id = ?,
-			updated_at = ?,
-			deleted_at = ?
-		WHERE goal_id = ? AND date = ? AND ? > updated_at
-	`, c.ID, c.UpdatedAt, c.DeletedAt, c.GoalID, c.Date, c.UpdatedAt)
+	rows, err := d.Query(query, args...)
 	if err != nil {
-		return fmt.Errorf("upsert completion (update by goal_date): %w", err)
-	}
-	rowsAffected, _ = res.RowsAffected()
-	if rowsAffected > 0 {
-		return nil
+		return nil, fmt.Errorf("query push outbox: %w", err)
 	}
+	return scanPushOutboxEntries(rows)
+}
 
-	// Step 3: No existing row; insert new.
-	_, err = d.Exec(`
-		INSERT OR IGNORE INTO completions (id, goal_id, date, created_at, updated_at, deleted_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, c.ID, c.GoalID, c.Date, c.CreatedAt, c.UpdatedAt, c.DeletedAt)
+func (d *SQLiteDB) DeleteOldPushOutbox(olderThan time.Time) (int64, error) {
+	res, err := d.Exec(
+		`DELETE FROM push_outbox WHERE status IN ('sent', 'failed') AND created_at < ?`,
+		olderThan.UTC(),
+	)
 	if err != nil {
-		return fmt.Errorf("upsert completion (insert): %w", err)
+		return 0, fmt.Errorf("delete old push outbox: %w", err)
 	}
-	return nil
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+	return n, nil
 }
 
-func (d *SQLiteDB) SoftDeleteGoal(userID *string, id string) error {
-	now := time.Now().UTC()
-	query := `UPDATE goals SET deleted_at = ?, updated_at = ? WHERE id = ?`
-	args := []any{now, now, id}
+func (d *SQLiteDB) IsEventProcessed(userID, eventID string) (*ProcessedEvent, error) {
+	return isEventProcessedSQLite(d, userID, eventID)
+}
 
-	// Add user_id filter for ownership verification
-	if userID == nil {
-		query += ` AND user_id IS NULL`
-	} else {
-		query += ` AND user_id = ?`
-		args = append(args, *userID)
+func isEventProcessedSQLite(q querier, userID, eventID string) (*ProcessedEvent, error) {
+	e := &ProcessedEvent{UserID: userID, EventID: eventID}
+	err := q.QueryRow(
+		`SELECT status, reason, processed_at FROM processed_events WHERE user_id = ? AND event_id = ?`,
+		userID, eventID,
+	).Scan(&e.Status, &e.Reason, &e.ProcessedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-
-	_, err := d.Exec(query, args...)
 	if err != nil {
-		return fmt.Errorf("soft delete goal: %w", err)
+		return nil, fmt.Errorf("check processed event: %w", err)
 	}
-	return nil
+	return e, nil
 }
 
-func (d *SQLiteDB) SoftDeleteCompletion(userID *string, goalID, date string) error {
-	now := time.Now().UTC()
-	query := `UPDATE completions SET deleted_at = ?, updated_at = ?
-		WHERE goal_id = ? AND date = ?
-		AND goal_id IN (SELECT id FROM goals WHERE `
-	args := []any{now, now, goalID, date}
+func (d *SQLiteDB) MarkEventProcessed(e *ProcessedEvent) error {
+	return markEventProcessedSQLite(d, e)
+}
 
-	if userID == nil {
-		query += `user_id IS NULL)`
-	} else {
-		query += `user_id = ?)`
-		args = append(args, *userID)
+func markEventProcessedSQLite(q querier, e *ProcessedEvent) error {
+	if e.ProcessedAt.IsZero() {
+		e.ProcessedAt = time.Now().UTC()
+	}
+	_, err := q.Exec(
+		`INSERT OR IGNORE INTO processed_events (user_id, event_id, status, reason, processed_at) VALUES (?, ?, ?, ?, ?)`,
+		e.UserID, e.EventID, e.Status, e.Reason, e.ProcessedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("mark event processed: %w", err)
 	}
+	return nil
+}
 
-	_, err := d.Exec(query, args...)
+func (d *SQLiteDB) PruneProcessedEvents(olderThan time.Time) error {
+	_, err := d.Exec(`DELETE FROM processed_events WHERE processed_at < ?`, olderThan)
 	if err != nil {
-		return fmt.Errorf("soft delete completion: %w", err)
+		return fmt.Errorf("prune processed events: %w", err)
 	}
 	return nil
 }
 
-func (d *SQLiteDB) GetGoalByID(id string) (*models.Goal, error) {
-	var g models.Goal
-	var archivedAt, deletedAt sql.NullTime
-	var updatedAt sql.NullTime
-	var goalUserID sql.NullString
-	var targetCount sql.NullInt64
-	var targetPeriod sql.NullString
+// Event log
 
-	err := d.QueryRow(
-		`SELECT id, name, color, position, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at FROM goals WHERE id = ?`,
-		id,
-	).Scan(&g.ID, &g.Name, &g.Color, &g.Position, &targetCount, &targetPeriod, &goalUserID, &g.CreatedAt, &updatedAt, &archivedAt, &deletedAt)
-	if err == sql.ErrNoRows {
-		return nil, nil
+// logChangesSQLite appends the goals and completions the owner wrote with
+// change sequence seq to the event log.
+func logChangesSQLite(q querier, userID *string, seq int64) error {
+	rows, err := q.Query(`SELECT `+goalChangeColumns+` FROM goals WHERE user_id IS ? AND change_seq = ?`, userID, seq)
+	if err != nil {
+		return fmt.Errorf("query written goals: %w", err)
 	}
+	goals, err := scanGoalChanges(rows)
 	if err != nil {
-		return nil, fmt.Errorf("query goal: %w", err)
+		return err
 	}
-	if archivedAt.Valid {
-		g.ArchivedAt = &archivedAt.Time
+	rows, err = q.Query(`SELECT `+completionChangeColumns+`
+		FROM completions c
+		INNER JOIN goals g ON c.goal_id = g.id
+		WHERE g.user_id IS ? AND c.change_seq = ?`, userID, seq)
+	if err != nil {
+		return fmt.Errorf("query written completions: %w", err)
 	}
-	if deletedAt.Valid {
-		g.DeletedAt = &deletedAt.Time
+	completions, err := scanCompletionChanges(rows)
+	if err != nil {
+		return err
 	}
-	if updatedAt.Valid {
-		g.UpdatedAt = updatedAt.Time
-	} else {
-		g.UpdatedAt = g.CreatedAt
+
+	entries, err := eventLogEntries(goals, completions)
+	if err != nil {
+		return err
 	}
-	if goalUserID.Valid {
-		g.UserID = &goalUserID.String
+	now := time.Now().UTC()
+	for _, e := range entries {
+		if _, err := q.Exec(
+			`INSERT INTO event_log (user_id, change_seq, kind, item_id, data, recorded_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			changeSeqOwner(userID), seq, e.kind, e.itemID, string(e.data), now,
+		); err != nil {
+			return fmt.Errorf("append event log: %w", err)
+		}
 	}
-	if targetCount.Valid {
-		tc := int(targetCount.Int64)
-		g.TargetCount = &tc
+	return nil
+}
+
+// logGoalChangesSQLite is logChangesSQLite for the owner of goalID, after a
+// write whose sequence came from nextGoalChangeSeq.
+func logGoalChangesSQLite(q querier, goalID string, seq int64) error {
+	if seq == 0 {
+		return nil
 	}
-	if targetPeriod.Valid {
-		g.TargetPeriod = &targetPeriod.String
+	var userID sql.NullString
+	if err := q.QueryRow(`SELECT user_id FROM goals WHERE id = ?`, goalID).Scan(&userID); err != nil {
+		return fmt.Errorf("query goal owner: %w", err)
 	}
-	return &g, nil
+	var owner *string
+	if userID.Valid {
+		owner = &userID.String
+	}
+	return logChangesSQLite(q, owner, seq)
 }
 
-// Device Tokens (Push Notifications)
+func (d *SQLiteDB) ReplayEventLog(userID string, at time.Time) ([]models.Goal, []models.Completion, error) {
+	if err := checkRestorableSQLite(d, userID, at); err != nil {
+		return nil, nil, err
+	}
+	return replayEventLogSQLite(d, userID, at)
+}
 
-func (d *SQLiteDB) CreateDeviceToken(userID, token, platform string) (*models.DeviceToken, error) {
-	now := time.Now().UTC()
-	dt := &models.DeviceToken{
-		ID:        generateUUID(),
-		UserID:    userID,
-		Token:     token,
-		Platform:  platform,
-		CreatedAt: now,
+func checkRestorableSQLite(q querier, userID string, at time.Time) error {
+	var snapshotAt time.Time
+	err := q.QueryRow(`SELECT recorded_at FROM event_log WHERE user_id = ? AND kind = ? ORDER BY id DESC LIMIT 1`,
+		userID, eventLogSnapshot).Scan(&snapshotAt)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("query event log snapshot: %w", err)
 	}
+	var purgedBefore sql.NullTime
+	err = q.QueryRow(`SELECT purged_before FROM change_seqs WHERE user_id = ?`, userID).Scan(&purgedBefore)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("query tombstone horizon: %w", err)
+	}
+	return checkRestorable(at, snapshotAt, purgedBefore.Time)
+}
 
-	_, err := d.Exec(
-		`INSERT INTO device_tokens (id, user_id, token, platform, created_at) VALUES (?, ?, ?, ?, ?)
-		ON CONFLICT(token) DO UPDATE SET user_id = excluded.user_id, platform = excluded.platform`,
-		dt.ID, dt.UserID, dt.Token, dt.Platform, dt.CreatedAt,
-	)
+func replayEventLogSQLite(q querier, userID string, at time.Time) ([]models.Goal, []models.Completion, error) {
+	rows, err := q.Query(`SELECT kind, data FROM event_log WHERE user_id = ? AND recorded_at <= ? ORDER BY id`, userID, at)
 	if err != nil {
-		return nil, fmt.Errorf("insert device token: %w", err)
+		return nil, nil, fmt.Errorf("query event log: %w", err)
 	}
+	return replayEventLog(rows)
+}
 
-	// If token already existed, fetch the actual record
-	var existing models.DeviceToken
-	var lastUsedAt sql.NullTime
-	err = d.QueryRow(
-		`SELECT id, user_id, token, platform, created_at, last_used_at FROM device_tokens WHERE token = ?`,
-		token,
-	).Scan(&existing.ID, &existing.UserID, &existing.Token, &existing.Platform, &existing.CreatedAt, &lastUsedAt)
+// loggedAfterSQLite returns the items the user's event log rows recorded
+// after at wrote.
+func loggedAfterSQLite(q querier, userID string, at time.Time) (eventLogItems, error) {
+	rows, err := q.Query(`SELECT kind, data FROM event_log WHERE user_id = ? AND recorded_at > ? ORDER BY id`, userID, at)
 	if err != nil {
-		return nil, fmt.Errorf("fetch device token: %w", err)
+		return eventLogItems{}, fmt.Errorf("query event log: %w", err)
 	}
-	if lastUsedAt.Valid {
-		existing.LastUsedAt = &lastUsedAt.Time
+	goals, completions, err := replayEventLog(rows)
+	if err != nil {
+		return eventLogItems{}, err
 	}
-	return &existing, nil
+	return loggedItems(goals, completions), nil
 }
 
-func (d *SQLiteDB) GetDeviceTokensByUserID(userID string) ([]models.DeviceToken, error) {
-	rows, err := d.Query(
-		`SELECT id, user_id, token, platform, created_at, last_used_at FROM device_tokens WHERE user_id = ? ORDER BY created_at DESC`,
-		userID,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("query device tokens: %w", err)
-	}
-	defer rows.Close()
+func (d *SQLiteDB) RestoreToTime(userID string, at time.Time) (int, error) {
+	var written int
+	err := runInTx(d.DB, func(tx *sql.Tx) error {
+		if err := checkRestorableSQLite(tx, userID, at); err != nil {
+			return err
+		}
+		replayedGoals, replayedCompletions, err := replayEventLogSQLite(tx, userID, at)
+		if err != nil {
+			return err
+		}
+		later, err := loggedAfterSQLite(tx, userID, at)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(`SELECT `+goalChangeColumns+` FROM goals WHERE user_id = ?`, userID)
+		if err != nil {
+			return fmt.Errorf("query goals: %w", err)
+		}
+		currentGoals, err := scanGoalChanges(rows)
+		if err != nil {
+			return err
+		}
+		rows, err = tx.Query(`SELECT `+completionChangeColumns+`
+			FROM completions c
+			INNER JOIN goals g ON c.goal_id = g.id
+			WHERE g.user_id = ?`, userID)
+		if err != nil {
+			return fmt.Errorf("query completions: %w", err)
+		}
+		currentCompletions, err := scanCompletionChanges(rows)
+		if err != nil {
+			return err
+		}
 
-	var tokens []models.DeviceToken
-	for rows.Next() {
-		var dt models.DeviceToken
-		var lastUsedAt sql.NullTime
-		if err := rows.Scan(&dt.ID, &dt.UserID, &dt.Token, &dt.Platform, &dt.CreatedAt, &lastUsedAt); err != nil {
-			return nil, fmt.Errorf("scan device token: %w", err)
+		goals, completions := restoreWrites(currentGoals, replayedGoals, currentCompletions, replayedCompletions, later, time.Now().UTC())
+		if len(goals) == 0 && len(completions) == 0 {
+			return nil
+		}
+		seq, err := d.nextChangeSeq(tx, &userID)
+		if err != nil {
+			return err
 		}
-		if lastUsedAt.Valid {
-			dt.LastUsedAt = &lastUsedAt.Time
+		// Goals first: a restored completion may belong to a restored goal.
+		for _, g := range goals {
+			n, err := restoreGoalSQLite(tx, userID, g, seq)
+			if err != nil {
+				return err
+			}
+			written += n
 		}
-		tokens = append(tokens, dt)
+		for _, c := range completions {
+			n, err := restoreCompletionSQLite(tx, userID, c, seq)
+			if err != nil {
+				return err
+			}
+			written += n
+		}
+		return logChangesSQLite(tx, &userID, seq)
+	})
+	if err != nil {
+		return 0, err
 	}
-	return tokens, rows.Err()
+	return written, nil
 }
 
-func (d *SQLiteDB) DeleteDeviceToken(tokenID string) error {
-	_, err := d.Exec(`DELETE FROM device_tokens WHERE id = ?`, tokenID)
+// restoreGoalSQLite writes g over the user's goal regardless of clocks, as
+// a server-side write.
+func restoreGoalSQLite(tx *sql.Tx, userID string, g models.Goal, seq int64) (int, error) {
+	res, err := tx.Exec(`
+		INSERT INTO goals (id, name, color, position, rank, target_count, target_period, user_id, created_at, updated_at, archived_at, deleted_at, change_seq)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			color = excluded.color,
+			position = excluded.position,
+			rank = excluded.rank,
+			target_count = excluded.target_count,
+			target_period = excluded.target_period,
+			updated_at = excluded.updated_at,
+			archived_at = excluded.archived_at,
+			deleted_at = excluded.deleted_at,
+			change_seq = excluded.change_seq,
+			`+resetGoalClocks+`
+		WHERE goals.user_id = excluded.user_id
+	`, g.ID, g.Name, g.Color, g.Position, g.Rank, g.TargetCount, g.TargetPeriod, userID, g.CreatedAt, g.UpdatedAt, g.ArchivedAt, g.DeletedAt, seq)
 	if err != nil {
-		return fmt.Errorf("delete device token: %w", err)
+		return 0, fmt.Errorf("restore goal %s: %w", g.ID, err)
 	}
-	return nil
-}
-
-func (d *SQLiteDB) UpdateDeviceTokenLastUsed(tokenID string) error {
-	_, err := d.Exec(
-		`UPDATE device_tokens SET last_used_at = ? WHERE id = ?`,
-		time.Now().UTC(), tokenID,
-	)
+	n, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("update device token last used: %w", err)
+		return 0, fmt.Errorf("rows affected: %w", err)
 	}
-	return nil
+	return int(n), nil
 }
 
-func (d *SQLiteDB) IsEventProcessed(eventID string) (bool, error) {
-	var count int
-	err := d.QueryRow(`SELECT COUNT(*) FROM processed_events WHERE event_id = ?`, eventID).Scan(&count)
+// restoreCompletionSQLite writes c over the completion for its goal and
+// date regardless of clocks. Completions of goals the user no longer has
+// are skipped.
+func restoreCompletionSQLite(tx *sql.Tx, userID string, c models.Completion, seq int64) (int, error) {
+	res, err := tx.Exec(`
+		UPDATE completions SET updated_at = ?, deleted_at = ?, change_seq = ?, hlc_logical = 0, hlc_node = ''
+		WHERE goal_id = ? AND date = ? AND goal_id IN (SELECT id FROM goals WHERE user_id = ?)
+	`, c.UpdatedAt, c.DeletedAt, seq, c.GoalID, c.Date, userID)
 	if err != nil {
-		return false, fmt.Errorf("check processed event: %w", err)
+		return 0, fmt.Errorf("restore completion %s: %w", c.ID, err)
 	}
-	return count > 0, nil
-}
-
-func (d *SQLiteDB) MarkEventProcessed(eventID string) error {
-	_, err := d.Exec(
-		`INSERT OR IGNORE INTO processed_events (event_id, processed_at) VALUES (?, ?)`,
-		eventID, time.Now().UTC(),
-	)
+	n, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("mark event processed: %w", err)
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+	if n > 0 {
+		return int(n), nil
 	}
-	return nil
-}
 
-func (d *SQLiteDB) PruneProcessedEvents(olderThan time.Time) error {
-	_, err := d.Exec(`DELETE FROM processed_events WHERE processed_at < ?`, olderThan)
-	if err != nil {
-		return fmt.Errorf("prune processed events: %w", err)
+	var owned bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM goals WHERE id = ? AND user_id = ?)`, c.GoalID, userID).Scan(&owned); err != nil {
+		return 0, fmt.Errorf("check goal %s: %w", c.GoalID, err)
 	}
-	return nil
+	if !owned {
+		return 0, nil
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO completions (id, goal_id, date, created_at, updated_at, deleted_at, change_seq) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		c.ID, c.GoalID, c.Date, c.CreatedAt, c.UpdatedAt, c.DeletedAt, seq,
+	); err != nil {
+		return 0, fmt.Errorf("restore completion %s: %w", c.ID, err)
+	}
+	return 1, nil
 }
 
 // Debug reports
@@ -1177,6 +2738,14 @@ func (d *SQLiteDB) DeleteAccount(userID string) error {
 	if _, err := tx.Exec(`DELETE FROM device_tokens WHERE user_id = ?`, userID); err != nil {
 		return fmt.Errorf("delete device tokens: %w", err)
 	}
+	// Delete reminders
+	if _, err := tx.Exec(`DELETE FROM reminders WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete reminders: %w", err)
+	}
+	// Delete queued and historical push deliveries
+	if _, err := tx.Exec(`DELETE FROM push_outbox WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete push outbox: %w", err)
+	}
 	// Delete auth providers
 	if _, err := tx.Exec(`DELETE FROM auth_providers WHERE user_id = ?`, userID); err != nil {
 		return fmt.Errorf("delete auth providers: %w", err)
@@ -1189,6 +2758,22 @@ func (d *SQLiteDB) DeleteAccount(userID string) error {
 	if _, err := tx.Exec(`DELETE FROM debug_reports WHERE user_id = ?`, userID); err != nil {
 		return fmt.Errorf("delete debug reports: %w", err)
 	}
+	// Delete streak alert settings
+	if _, err := tx.Exec(`DELETE FROM streak_alert_settings WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete streak alert settings: %w", err)
+	}
+	// Delete event idempotency records
+	if _, err := tx.Exec(`DELETE FROM processed_events WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete processed events: %w", err)
+	}
+	// Delete the event log
+	if _, err := tx.Exec(`DELETE FROM event_log WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete event log: %w", err)
+	}
+	// Delete the change sequence counter
+	if _, err := tx.Exec(`DELETE FROM change_seqs WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete change seq: %w", err)
+	}
 	// Delete user
 	if _, err := tx.Exec(`DELETE FROM users WHERE id = ?`, userID); err != nil {
 		return fmt.Errorf("delete user: %w", err)
@@ -1196,3 +2781,54 @@ func (d *SQLiteDB) DeleteAccount(userID string) error {
 
 	return tx.Commit()
 }
+
+// Transactions
+
+// sqliteTx implements Tx on an open SQLite transaction.
+type sqliteTx struct {
+	d  *SQLiteDB
+	tx *sql.Tx
+}
+
+var _ Tx = sqliteTx{}
+
+func (d *SQLiteDB) InTx(userID string, fn func(tx Tx) error) error {
+	return runInTx(d.DB, func(tx *sql.Tx) error {
+		return fn(sqliteTx{d: d, tx: tx})
+	})
+}
+
+func (t sqliteTx) GetGoalByID(id string) (*models.Goal, error) {
+	return getGoalByIDSQLite(t.tx, id)
+}
+
+func (t sqliteTx) GetCompletionByGoalAndDateIncludingDeleted(goalID, date string) (*models.Completion, error) {
+	return getCompletionIncludingDeletedSQLite(t.tx, goalID, date)
+}
+
+func (t sqliteTx) UpsertGoal(goal *models.Goal) error {
+	return t.d.upsertGoal(t.tx, goal)
+}
+
+func (t sqliteTx) RebalanceGoalRanks(userID string) error {
+	seq, err := t.d.nextChangeSeq(t.tx, &userID)
+	if err != nil {
+		return err
+	}
+	if err := t.d.rebalanceGoalRanks(t.tx, &userID, seq); err != nil {
+		return err
+	}
+	return logChangesSQLite(t.tx, &userID, seq)
+}
+
+func (t sqliteTx) UpsertCompletion(c *models.Completion) error {
+	return t.d.upsertCompletion(t.tx, c)
+}
+
+func (t sqliteTx) IsEventProcessed(userID, eventID string) (*ProcessedEvent, error) {
+	return isEventProcessedSQLite(t.tx, userID, eventID)
+}
+
+func (t sqliteTx) MarkEventProcessed(e *ProcessedEvent) error {
+	return markEventProcessedSQLite(t.tx, e)
+}
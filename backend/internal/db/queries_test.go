@@ -2,6 +2,7 @@ package db
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/rank"
 )
 
 func setupTestDB(t *testing.T) (*SQLiteDB, func()) {
@@ -454,3 +456,908 @@ func TestDebugReports_AccountDeleteCascades(t *testing.T) {
 		t.Errorf("expected cascade delete to remove debug report, still present: %+v", got)
 	}
 }
+
+func TestReminders_ListEnabledAndClaim(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	userID := "rem-user"
+	if err := db.CreateUser(&models.User{ID: userID, Email: "rem@t.com", Name: "Rem", CreatedAt: now}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	u, err := db.GetUserByID(userID)
+	if err != nil || u.Timezone != DefaultTimezone {
+		t.Fatalf("expected default timezone %q, got %+v (err %v)", DefaultTimezone, u, err)
+	}
+
+	on := &models.Reminder{UserID: userID, Frequency: "daily", Time: "20:00", Enabled: true}
+	off := &models.Reminder{UserID: userID, Frequency: "weekly", Time: "09:00", Weekday: 1, Enabled: false}
+	for _, r := range []*models.Reminder{on, off} {
+		if err := db.CreateReminder(r); err != nil {
+			t.Fatalf("create reminder: %v", err)
+		}
+	}
+
+	enabled, err := db.ListEnabledReminders()
+	if err != nil {
+		t.Fatalf("list enabled: %v", err)
+	}
+	if len(enabled) != 1 || enabled[0].ID != on.ID {
+		t.Fatalf("expected only the enabled reminder, got %+v", enabled)
+	}
+
+	occurrence := now.Add(-5 * time.Minute)
+	if claimed, err := db.ClaimReminder(on.ID, occurrence, now, nil); err != nil || !claimed {
+		t.Fatalf("expected the occurrence claimed, got %v (err %v)", claimed, err)
+	}
+	got, err := db.GetReminder(userID, on.ID)
+	if err != nil || got == nil || got.LastSentAt == nil {
+		t.Fatalf("expected last_sent_at to be set, got %+v (err %v)", got, err)
+	}
+	if claimed, err := db.ClaimReminder(on.ID, occurrence, now.Add(time.Second), nil); err != nil || claimed {
+		t.Errorf("expected the occurrence claimed only once, got %v (err %v)", claimed, err)
+	}
+
+	if err := db.DeleteAccount(userID); err != nil {
+		t.Fatalf("delete account: %v", err)
+	}
+	all, err := db.ListReminders(userID)
+	if err != nil {
+		t.Fatalf("list reminders: %v", err)
+	}
+	if len(all) != 0 {
+		t.Errorf("expected reminders removed with account, got %d", len(all))
+	}
+}
+
+func TestDeviceTokens_DeleteStale(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	userID := "token-user"
+	if err := db.CreateUser(&models.User{ID: userID, Email: "tok@t.com", Name: "Tok", CreatedAt: now}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	stale, err := db.CreateDeviceToken(userID, "stale", "android")
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	used, err := db.CreateDeviceToken(userID, "used", "android")
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	fresh, err := db.CreateDeviceToken(userID, "fresh", "android")
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	// Backdate registrations; "used" was delivered to recently.
+	old := now.AddDate(0, 0, -90)
+	if _, err := db.Exec(`UPDATE device_tokens SET created_at = ? WHERE id IN (?, ?)`, old, stale.ID, used.ID); err != nil {
+		t.Fatalf("backdate tokens: %v", err)
+	}
+	if err := db.UpdateDeviceTokenLastUsed(used.ID); err != nil {
+		t.Fatalf("update last used: %v", err)
+	}
+
+	n, err := db.DeleteStaleDeviceTokens(now.AddDate(0, 0, -60))
+	if err != nil {
+		t.Fatalf("delete stale: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 stale token deleted, got %d", n)
+	}
+
+	tokens, err := db.GetDeviceTokensByUserID(userID)
+	if err != nil {
+		t.Fatalf("list tokens: %v", err)
+	}
+	remaining := map[string]bool{}
+	for _, tok := range tokens {
+		remaining[tok.ID] = true
+	}
+	if remaining[stale.ID] || !remaining[used.ID] || !remaining[fresh.ID] {
+		t.Errorf("unexpected remaining tokens: %+v", tokens)
+	}
+}
+
+func TestDeviceTokens_ReRegisterMarksSeen(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	userID := "rereg-user"
+	if err := db.CreateUser(&models.User{ID: userID, Email: "rereg@t.com", Name: "Re", CreatedAt: now}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	first, err := db.CreateDeviceToken(userID, "same-token", "android")
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if first.LastUsedAt != nil {
+		t.Fatalf("expected new token to have no last_used_at, got %v", first.LastUsedAt)
+	}
+
+	again, err := db.CreateDeviceToken(userID, "same-token", "android")
+	if err != nil {
+		t.Fatalf("re-register token: %v", err)
+	}
+	if again.ID != first.ID || again.LastUsedAt == nil {
+		t.Errorf("expected re-registration to keep the row and set last_used_at, got %+v", again)
+	}
+}
+
+func TestPushOutbox_ClaimListAndDeleteOld(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	userID := "outbox-user"
+	if err := db.CreateUser(&models.User{ID: userID, Email: "outbox@t.com", Name: "Outbox", CreatedAt: now}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	due := &models.PushOutboxEntry{UserID: userID, DeviceTokenID: "d1", Platform: "android", Token: "tok", Category: "reminder",
+		Title: "Read", Data: map[string]string{"goal_id": "g1"}, NextAttemptAt: now.Add(-time.Minute)}
+	later := &models.PushOutboxEntry{UserID: userID, DeviceTokenID: "d1", Platform: "android", Token: "tok", Category: "reminder",
+		NextAttemptAt: now.Add(time.Hour)}
+	for _, e := range []*models.PushOutboxEntry{due, later} {
+		if err := db.CreatePushOutboxEntry(e); err != nil {
+			t.Fatalf("create entry: %v", err)
+		}
+	}
+
+	claimed, err := db.ClaimPushOutbox(now, 5*time.Minute, 10)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != due.ID {
+		t.Fatalf("expected only the due entry to be claimed, got %+v", claimed)
+	}
+	got := claimed[0]
+	if got.Status != models.PushOutboxSending || got.Attempts != 1 || got.Token != "tok" || got.Data["goal_id"] != "g1" {
+		t.Errorf("unexpected claimed entry: %+v", got)
+	}
+
+	// A claimed entry is leased: it is not claimable again until the lease ends.
+	again, err := db.ClaimPushOutbox(now, 5*time.Minute, 10)
+	if err != nil {
+		t.Fatalf("second claim: %v", err)
+	}
+	if len(again) != 0 {
+		t.Errorf("expected leased entry to be skipped, got %+v", again)
+	}
+	reclaimed, err := db.ClaimPushOutbox(now.Add(6*time.Minute), 5*time.Minute, 10)
+	if err != nil {
+		t.Fatalf("reclaim: %v", err)
+	}
+	if len(reclaimed) != 1 || reclaimed[0].Attempts != 2 {
+		t.Fatalf("expected expired lease to be reclaimed, got %+v", reclaimed)
+	}
+
+	sentAt := now
+	got = reclaimed[0]
+	got.Status = models.PushOutboxSent
+	got.SentAt = &sentAt
+	if err := db.UpdatePushOutboxEntry(&got); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	sent, err := db.ListPushOutbox(PushOutboxFilter{UserID: &userID, Status: models.PushOutboxSent})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(sent) != 1 || sent[0].SentAt == nil {
+		t.Fatalf("expected one sent entry, got %+v", sent)
+	}
+	all, err := db.ListPushOutbox(PushOutboxFilter{UserID: &userID})
+	if err != nil {
+		t.Fatalf("list all: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected 2 entries, got %d", len(all))
+	}
+
+	// Only finished entries are pruned, however old the pending ones are.
+	n, err := db.DeleteOldPushOutbox(now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("delete old: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 finished entry deleted, got %d", n)
+	}
+	all, _ = db.ListPushOutbox(PushOutboxFilter{UserID: &userID})
+	if len(all) != 1 || all[0].ID != later.ID {
+		t.Errorf("expected only the pending entry to remain, got %+v", all)
+	}
+}
+
+func TestDeviceTokens_MetadataScopedToOwner(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	for _, id := range []string{"meta-owner", "meta-other"} {
+		if err := db.CreateUser(&models.User{ID: id, Email: id + "@t.com", Name: id, CreatedAt: now}); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	dt, err := db.CreateDeviceToken("meta-owner", "meta-token", "ios")
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	name, version := "iPad", "3.1"
+	if err := db.UpdateDeviceToken("meta-owner", dt.ID, &name, &version); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	// Updates and touches from another user are no-ops.
+	stolen := "stolen"
+	if err := db.UpdateDeviceToken("meta-other", dt.ID, &stolen, nil); err != nil {
+		t.Fatalf("update as other: %v", err)
+	}
+	if err := db.TouchDeviceToken("meta-owner", dt.ID); err != nil {
+		t.Fatalf("touch: %v", err)
+	}
+
+	got, err := db.GetDeviceToken("meta-owner", dt.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got == nil || got.Name != "iPad" || got.AppVersion != "3.1" || got.LastSeenAt == nil {
+		t.Errorf("unexpected device: %+v", got)
+	}
+	if other, err := db.GetDeviceToken("meta-other", dt.ID); err != nil || other != nil {
+		t.Errorf("expected nil for another user's device, got %+v, %v", other, err)
+	}
+
+	// Updating only the app version keeps the name.
+	newVersion := "3.2"
+	if err := db.UpdateDeviceToken("meta-owner", dt.ID, nil, &newVersion); err != nil {
+		t.Fatalf("update version: %v", err)
+	}
+	got, _ = db.GetDeviceToken("meta-owner", dt.ID)
+	if got.Name != "iPad" || got.AppVersion != "3.2" {
+		t.Errorf("expected name kept and version updated, got %+v", got)
+	}
+}
+
+func TestChangeSeq_TracksWritesPerUser(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	userA, userB := "user-a", "user-b"
+	for _, id := range []string{userA, userB} {
+		if err := db.CreateUser(&models.User{ID: id, Email: id + "@test.com", CreatedAt: now}); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+
+	if err := db.CreateGoal(&models.Goal{ID: "goal-a", Name: "A", Color: "#000000", UserID: &userA, CreatedAt: now}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+	if err := db.CreateGoal(&models.Goal{ID: "goal-b", Name: "B", Color: "#000000", UserID: &userB, CreatedAt: now}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+	if err := db.CreateCompletion(&models.Completion{ID: "c1", GoalID: "goal-a", Date: "2026-01-10", CreatedAt: now}); err != nil {
+		t.Fatalf("create completion: %v", err)
+	}
+
+	seqA, err := db.GetChangeSeq(&userA)
+	if err != nil || seqA != 2 {
+		t.Fatalf("user A: expected seq 2, got %d, %v", seqA, err)
+	}
+	if seqB, _ := db.GetChangeSeq(&userB); seqB != 1 {
+		t.Errorf("user B has its own counter: expected 1, got %d", seqB)
+	}
+
+	goals, err := db.GetGoalChangesSinceSeq(&userA, 0)
+	if err != nil || len(goals) != 1 || goals[0].ID != "goal-a" {
+		t.Fatalf("expected only user A's goal, got %+v, %v", goals, err)
+	}
+	if goals, _ := db.GetGoalChangesSinceSeq(&userA, 1); len(goals) != 0 {
+		t.Errorf("expected no goal changes after seq 1, got %+v", goals)
+	}
+
+	// Reorders never touched updated_at, but they do move the sequence, for
+	// the goals that move only.
+	if err := db.CreateGoal(&models.Goal{ID: "goal-a2", Name: "A2", Color: "#000000", UserID: &userA, CreatedAt: now}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+	seqA, _ = db.GetChangeSeq(&userA)
+	if err := db.ReorderGoals(&userA, []string{"goal-a2", "goal-a"}); err != nil {
+		t.Fatalf("reorder: %v", err)
+	}
+	if goals, _ := db.GetGoalChangesSinceSeq(&userA, seqA); len(goals) != 1 || goals[0].ID != "goal-a2" {
+		t.Errorf("expected only the moved goal after seq %d, got %+v", seqA, goals)
+	}
+
+	// A write that loses last-write-wins is not reported as a change.
+	seqA, _ = db.GetChangeSeq(&userA)
+	stale := &models.Goal{ID: "goal-a", Name: "Stale", Color: "#000000", UserID: &userA, CreatedAt: now, UpdatedAt: now.Add(-time.Hour)}
+	if err := db.UpsertGoal(stale); err != nil {
+		t.Fatalf("upsert goal: %v", err)
+	}
+	if goals, _ := db.GetGoalChangesSinceSeq(&userA, seqA); len(goals) != 0 {
+		t.Errorf("expected a rejected upsert to leave no change, got %+v", goals)
+	}
+
+	if err := db.DeleteCompletion("c1"); err != nil {
+		t.Fatalf("delete completion: %v", err)
+	}
+	completions, err := db.GetCompletionChangesSinceSeq(&userA, seqA)
+	if err != nil || len(completions) != 1 || completions[0].DeletedAt == nil {
+		t.Errorf("expected the deleted completion, got %+v, %v", completions, err)
+	}
+}
+
+func TestGoalFieldClocks_StoredBySyncAndResetByEdits(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	userID := "user-clocks"
+	if err := db.CreateUser(&models.User{ID: userID, Email: "clocks@test.com", CreatedAt: now}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	clocks := models.GoalFieldClocks{Name: "1773230400000-0001-phone", Color: "1773230399000-0000-tablet"}
+	goal := &models.Goal{ID: "goal-clocks", Name: "Read", Color: "#000000", UserID: &userID, CreatedAt: now, UpdatedAt: now, ClockLogical: 2, ClockNode: "phone", FieldClocks: clocks}
+	if err := db.UpsertGoal(goal); err != nil {
+		t.Fatalf("upsert goal: %v", err)
+	}
+
+	got, err := db.GetGoalByID("goal-clocks")
+	if err != nil || got == nil {
+		t.Fatalf("GetGoalByID: %v", err)
+	}
+	if got.FieldClocks != clocks || got.ClockLogical != 2 || got.ClockNode != "phone" {
+		t.Fatalf("expected the sync clocks stored, got %+v %d %q", got.FieldClocks, got.ClockLogical, got.ClockNode)
+	}
+
+	// An edit through the API replaces the record, so the clocks start over.
+	name := "Read more"
+	if err := db.UpdateGoal(&userID, "goal-clocks", &name, nil, nil, nil); err != nil {
+		t.Fatalf("update goal: %v", err)
+	}
+	got, _ = db.GetGoalByID("goal-clocks")
+	if got.FieldClocks != (models.GoalFieldClocks{}) || got.ClockLogical != 0 || got.ClockNode != "" {
+		t.Errorf("expected the clocks reset, got %+v %d %q", got.FieldClocks, got.ClockLogical, got.ClockNode)
+	}
+}
+
+func TestInTx_CommitsOrRollsBackTogether(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	userID := "user-tx"
+	if err := db.CreateUser(&models.User{ID: userID, Email: "tx@test.com", CreatedAt: now}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	seq, _ := db.GetChangeSeq(&userID)
+
+	// A failure after the writes leaves none of them behind.
+	errFail := fmt.Errorf("fail")
+	err := db.InTx(userID, func(tx Tx) error {
+		goal := &models.Goal{ID: "goal-tx", Name: "Run", Color: "#000000", UserID: &userID, CreatedAt: now, UpdatedAt: now}
+		if err := tx.UpsertGoal(goal); err != nil {
+			return err
+		}
+		if err := tx.UpsertCompletion(&models.Completion{ID: "c-tx", GoalID: "goal-tx", Date: "2026-01-01", CreatedAt: now, UpdatedAt: now}); err != nil {
+			return err
+		}
+		if err := tx.MarkEventProcessed(&ProcessedEvent{UserID: userID, EventID: "event-tx", Status: "applied"}); err != nil {
+			return err
+		}
+		// Writes are visible inside the transaction.
+		if got, err := tx.GetGoalByID("goal-tx"); err != nil || got == nil {
+			t.Errorf("expected the goal inside the transaction, got %+v, %v", got, err)
+		}
+		return errFail
+	})
+	if err != errFail {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+	if got, _ := db.GetGoalByID("goal-tx"); got != nil {
+		t.Errorf("expected the goal rolled back, got %+v", got)
+	}
+	if got, _ := db.GetCompletionByGoalAndDateIncludingDeleted("goal-tx", "2026-01-01"); got != nil {
+		t.Errorf("expected the completion rolled back, got %+v", got)
+	}
+	if done, _ := db.IsEventProcessed(userID, "event-tx"); done != nil {
+		t.Error("expected the event not marked processed")
+	}
+	if after, _ := db.GetChangeSeq(&userID); after != seq {
+		t.Errorf("expected the change sequence rolled back to %d, got %d", seq, after)
+	}
+
+	// Without an error everything commits.
+	err = db.InTx(userID, func(tx Tx) error {
+		goal := &models.Goal{ID: "goal-tx", Name: "Run", Color: "#000000", UserID: &userID, CreatedAt: now, UpdatedAt: now}
+		if err := tx.UpsertGoal(goal); err != nil {
+			return err
+		}
+		return tx.MarkEventProcessed(&ProcessedEvent{UserID: userID, EventID: "event-tx", Status: "applied"})
+	})
+	if err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+	if got, _ := db.GetGoalByID("goal-tx"); got == nil {
+		t.Error("expected the goal committed")
+	}
+	if done, _ := db.IsEventProcessed(userID, "event-tx"); done == nil {
+		t.Error("expected the event marked processed")
+	}
+}
+
+func TestProcessedEvents_ScopedByUserWithOutcome(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	alice, err := db.GetOrCreateUserByProvider("test", "alice", "alice@test.com", "Alice", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	bob, err := db.GetOrCreateUserByProvider("test", "bob", "bob@test.com", "Bob", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	if err := db.MarkEventProcessed(&ProcessedEvent{UserID: alice.ID, EventID: "evt", Status: "rejected", Reason: "unknown_type", ProcessedAt: old}); err != nil {
+		t.Fatalf("MarkEventProcessed: %v", err)
+	}
+	// A second mark keeps the first outcome.
+	if err := db.MarkEventProcessed(&ProcessedEvent{UserID: alice.ID, EventID: "evt", Status: "applied"}); err != nil {
+		t.Fatalf("MarkEventProcessed: %v", err)
+	}
+	if err := db.MarkEventProcessed(&ProcessedEvent{UserID: bob.ID, EventID: "evt", Status: "applied"}); err != nil {
+		t.Fatalf("MarkEventProcessed: %v", err)
+	}
+
+	got, err := db.IsEventProcessed(alice.ID, "evt")
+	if err != nil || got == nil {
+		t.Fatalf("expected alice's record, got %+v, %v", got, err)
+	}
+	if got.Status != "rejected" || got.Reason != "unknown_type" {
+		t.Errorf("expected the first outcome, got %+v", got)
+	}
+	if got, _ := db.IsEventProcessed(bob.ID, "evt"); got == nil || got.Status != "applied" {
+		t.Errorf("expected bob's own record, got %+v", got)
+	}
+	if got, _ := db.IsEventProcessed(bob.ID, "other"); got != nil {
+		t.Errorf("expected no record for an unseen event, got %+v", got)
+	}
+
+	if err := db.PruneProcessedEvents(time.Now().UTC().Add(-24 * time.Hour)); err != nil {
+		t.Fatalf("PruneProcessedEvents: %v", err)
+	}
+	if got, _ := db.IsEventProcessed(alice.ID, "evt"); got != nil {
+		t.Errorf("expected alice's old record pruned, got %+v", got)
+	}
+	if got, _ := db.IsEventProcessed(bob.ID, "evt"); got == nil {
+		t.Error("expected bob's recent record kept")
+	}
+}
+
+func TestProcessedEvents_MigrationKeepsUnscopedRecords(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	alice, err := db.GetOrCreateUserByProvider("test", "alice", "alice@test.com", "Alice", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	bob, err := db.GetOrCreateUserByProvider("test", "bob", "bob@test.com", "Bob", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := db.CreateGoal(&models.Goal{ID: "goal-a", Name: "Read", Color: "#000000", UserID: &alice.ID, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("CreateGoal: %v", err)
+	}
+	// Put back the table as it was before records were scoped, and rerun
+	// the migration as an upgrade would.
+	if _, err := db.Exec(`DROP TABLE processed_events`); err != nil {
+		t.Fatalf("drop processed events: %v", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE processed_events (
+		event_id TEXT PRIMARY KEY,
+		processed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		t.Fatalf("create unscoped processed events: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO processed_events (event_id, processed_at) VALUES (?, ?)`, "evt-old", time.Now().UTC()); err != nil {
+		t.Fatalf("insert unscoped record: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM _migrations WHERE name = '021_scope_processed_events.sql'`); err != nil {
+		t.Fatalf("forget migration: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	got, err := db.IsEventProcessed(alice.ID, "evt-old")
+	if err != nil || got == nil {
+		t.Fatalf("expected the record kept for the goal owner, got %+v, %v", got, err)
+	}
+	if got.Status != "applied" {
+		t.Errorf("expected the record kept as applied, got %+v", got)
+	}
+	if got, _ := db.IsEventProcessed(bob.ID, "evt-old"); got != nil {
+		t.Errorf("expected no copy for a user without goals, got %+v", got)
+	}
+	if err := db.MarkEventProcessed(&ProcessedEvent{UserID: bob.ID, EventID: "evt-new", Status: "applied"}); err != nil {
+		t.Fatalf("MarkEventProcessed after migration: %v", err)
+	}
+}
+
+func TestPurgeTombstones_DeletesAndAdvancesHorizon(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	userA, userB := "user-a", "user-b"
+	for _, id := range []string{userA, userB} {
+		if err := db.CreateUser(&models.User{ID: id, Email: id + "@test.com", CreatedAt: now}); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	for _, g := range []models.Goal{
+		{ID: "kept", Name: "Kept", Color: "#000000", UserID: &userA, CreatedAt: now},
+		{ID: "deleted", Name: "Deleted", Color: "#000000", UserID: &userA, CreatedAt: now},
+		{ID: "other", Name: "Other", Color: "#000000", UserID: &userB, CreatedAt: now},
+	} {
+		if err := db.CreateGoal(&g); err != nil {
+			t.Fatalf("create goal: %v", err)
+		}
+	}
+	for _, c := range []models.Completion{
+		{ID: "c-kept", GoalID: "kept", Date: "2026-01-10", CreatedAt: now},
+		{ID: "c-deleted", GoalID: "kept", Date: "2026-01-11", CreatedAt: now},
+		{ID: "c-cascade", GoalID: "deleted", Date: "2026-01-10", CreatedAt: now},
+	} {
+		if err := db.CreateCompletion(&c); err != nil {
+			t.Fatalf("create completion: %v", err)
+		}
+	}
+	if err := db.DeleteCompletion("c-deleted"); err != nil {
+		t.Fatalf("delete completion: %v", err)
+	}
+	if err := db.SoftDeleteGoal(&userA, "deleted"); err != nil {
+		t.Fatalf("delete goal: %v", err)
+	}
+	seqA, _ := db.GetChangeSeq(&userA)
+
+	// Nothing is old enough yet.
+	if n, err := db.PurgeTombstones(now.Add(-time.Hour)); err != nil || n != 0 {
+		t.Fatalf("expected nothing purged, got %d, %v", n, err)
+	}
+	if h, _ := db.GetTombstoneHorizon(&userA); h != (TombstoneHorizon{}) {
+		t.Errorf("expected no horizon before a purge, got %+v", h)
+	}
+
+	// Purge on a connection without foreign keys, as most of the pool is,
+	// so nothing cascades.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`PRAGMA foreign_keys = OFF`); err != nil {
+		t.Fatalf("disable foreign keys: %v", err)
+	}
+	before := now.Add(time.Minute)
+	n, err := db.PurgeTombstones(before)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected the goal, its completion and the completion tombstone purged, got %d", n)
+	}
+
+	if g, _ := db.GetGoalByID("deleted"); g != nil {
+		t.Errorf("expected the deleted goal gone, got %+v", g)
+	}
+	var orphans int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM completions WHERE id = 'c-cascade'`).Scan(&orphans); err != nil || orphans != 0 {
+		t.Errorf("expected the deleted goal's completion gone, got %d rows, %v", orphans, err)
+	}
+	if c, _ := db.GetCompletionByGoalAndDateIncludingDeleted("kept", "2026-01-11"); c != nil {
+		t.Errorf("expected the deleted completion gone, got %+v", c)
+	}
+	if c, _ := db.GetCompletionByID("c-kept"); c == nil {
+		t.Error("expected the live completion kept")
+	}
+
+	h, err := db.GetTombstoneHorizon(&userA)
+	if err != nil {
+		t.Fatalf("horizon: %v", err)
+	}
+	if h.Seq != seqA || !h.Before.Equal(before) {
+		t.Errorf("expected horizon {%d %v}, got %+v", seqA, before, h)
+	}
+	if seq, _ := db.GetChangeSeq(&userA); seq != seqA {
+		t.Errorf("expected purging to leave the change seq at %d, got %d", seqA, seq)
+	}
+	if h, _ := db.GetTombstoneHorizon(&userB); h != (TombstoneHorizon{}) {
+		t.Errorf("expected user B untouched, got %+v", h)
+	}
+}
+
+func TestReorderGoals_MovesOnlyWhatItMustAndRebalances(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	user := "user-a"
+	if err := db.CreateUser(&models.User{ID: user, Email: "a@test.com", CreatedAt: now}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		if err := db.CreateGoal(&models.Goal{ID: id, Name: id, Color: "#000000", UserID: &user, CreatedAt: now}); err != nil {
+			t.Fatalf("create goal: %v", err)
+		}
+	}
+
+	order := func() string {
+		t.Helper()
+		goals, err := db.ListGoals(&user, false)
+		if err != nil {
+			t.Fatalf("list goals: %v", err)
+		}
+		var ids string
+		for i, g := range goals {
+			if g.Position != i {
+				t.Errorf("expected %s listed at position %d, got %d", g.ID, i, g.Position)
+			}
+			ids += g.ID
+		}
+		return ids
+	}
+	if got := order(); got != "abcd" {
+		t.Fatalf("expected creation order, got %s", got)
+	}
+
+	seq, _ := db.GetChangeSeq(&user)
+	if err := db.ReorderGoals(&user, []string{"d", "a", "b", "c"}); err != nil {
+		t.Fatalf("reorder: %v", err)
+	}
+	if got := order(); got != "dabc" {
+		t.Errorf("expected dabc, got %s", got)
+	}
+	if goals, _ := db.GetGoalChangesSinceSeq(&user, seq); len(goals) != 1 || goals[0].ID != "d" {
+		t.Errorf("expected only d rewritten, got %+v", goals)
+	}
+
+	// Two goals tied by concurrent moves leave no room between them, so the
+	// list is rebalanced first.
+	if _, err := db.Exec(`UPDATE goals SET rank = CASE id WHEN 'c' THEN 'k' ELSE 'V' END WHERE id IN ('a', 'b', 'c')`); err != nil {
+		t.Fatalf("tie ranks: %v", err)
+	}
+	if err := db.ReorderGoals(&user, []string{"a", "c", "b"}); err != nil {
+		t.Fatalf("reorder: %v", err)
+	}
+	if got := order(); got != "dacb" {
+		t.Errorf("expected dacb, got %s", got)
+	}
+	goals, _ := db.ListGoals(&user, false)
+	if goals[0].Rank != rank.FromPosition(1) {
+		t.Errorf("expected d rebalanced to %q, got %q", rank.FromPosition(1), goals[0].Rank)
+	}
+}
+
+func TestEventLog_ReplaysAndRestores(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user, err := db.GetOrCreateUserByProvider("test", "history", "history@test.com", "History", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	now := time.Now().UTC()
+	run := &models.Goal{ID: "goal-run", Name: "Run", Color: "#000000", UserID: &user.ID, CreatedAt: now}
+	if err := db.CreateGoal(run); err != nil {
+		t.Fatalf("CreateGoal: %v", err)
+	}
+	if err := db.CreateCompletion(&models.Completion{ID: "c-1", GoalID: "goal-run", Date: "2026-03-01", CreatedAt: now}); err != nil {
+		t.Fatalf("CreateCompletion: %v", err)
+	}
+	march := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+
+	name := "Jog"
+	if err := db.UpdateGoal(&user.ID, "goal-run", &name, nil, nil, nil); err != nil {
+		t.Fatalf("UpdateGoal: %v", err)
+	}
+	if err := db.DeleteCompletion("c-1"); err != nil {
+		t.Fatalf("DeleteCompletion: %v", err)
+	}
+	if err := db.CreateGoal(&models.Goal{ID: "goal-swim", Name: "Swim", Color: "#000000", UserID: &user.ID, CreatedAt: now}); err != nil {
+		t.Fatalf("CreateGoal: %v", err)
+	}
+
+	goals, completions, err := db.ReplayEventLog(user.ID, march)
+	if err != nil {
+		t.Fatalf("ReplayEventLog: %v", err)
+	}
+	if len(goals) != 1 || goals[0].Name != "Run" {
+		t.Errorf("expected only Run at the time, got %+v", goals)
+	}
+	if len(completions) != 1 || completions[0].DeletedAt != nil {
+		t.Errorf("expected the completion live at the time, got %+v", completions)
+	}
+
+	// Renamed goal, deleted completion and the newer goal: three rows.
+	n, err := db.RestoreToTime(user.ID, march)
+	if err != nil {
+		t.Fatalf("RestoreToTime: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected 3 rows restored, got %d", n)
+	}
+	goals, _ = db.ListGoals(&user.ID, false)
+	if len(goals) != 1 || goals[0].ID != "goal-run" || goals[0].Name != "Run" {
+		t.Errorf("expected Run restored alone, got %+v", goals)
+	}
+	if c, _ := db.GetCompletionByGoalAndDate("goal-run", "2026-03-01"); c == nil {
+		t.Error("expected the completion restored")
+	}
+
+	// The restore is itself logged, so restoring again changes nothing.
+	if n, err := db.RestoreToTime(user.ID, march); err != nil || n != 0 {
+		t.Errorf("expected nothing left to restore, got %d, %v", n, err)
+	}
+	goals, _, _ = db.ReplayEventLog(user.ID, time.Now().UTC())
+	for _, g := range goals {
+		if g.ID == "goal-swim" && g.DeletedAt == nil {
+			t.Error("expected the log to end with Swim deleted")
+		}
+	}
+}
+
+func TestEventLog_RestoreKeepsRowsFromBeforeTheLog(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user, err := db.GetOrCreateUserByProvider("test", "legacy", "legacy@test.com", "Legacy", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	now := time.Now().UTC()
+	if err := db.CreateGoal(&models.Goal{ID: "goal-old", Name: "Read", Color: "#000000", UserID: &user.ID, CreatedAt: now}); err != nil {
+		t.Fatalf("CreateGoal: %v", err)
+	}
+	if err := db.CreateCompletion(&models.Completion{ID: "c-old", GoalID: "goal-old", Date: "2026-03-01", CreatedAt: now}); err != nil {
+		t.Fatalf("CreateCompletion: %v", err)
+	}
+	name := "Books"
+	if err := db.UpdateGoal(&user.ID, "goal-old", &name, nil, nil, nil); err != nil {
+		t.Fatalf("UpdateGoal: %v", err)
+	}
+	// Rerun the event log migration as an upgrade would, over rows written
+	// before it.
+	if _, err := db.Exec(`DROP TABLE event_log`); err != nil {
+		t.Fatalf("drop event log: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM _migrations WHERE name = '022_add_event_log.sql'`); err != nil {
+		t.Fatalf("forget migration: %v", err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	goals, completions, err := db.ReplayEventLog(user.ID, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("ReplayEventLog: %v", err)
+	}
+	if len(goals) != 1 || goals[0].ID != "goal-old" || goals[0].Name != "Books" {
+		t.Errorf("expected the seeded goal as it is now, got %+v", goals)
+	}
+	if len(completions) != 1 || completions[0].Date != "2026-03-01" || completions[0].DeletedAt != nil {
+		t.Errorf("expected the seeded completion, got %+v", completions)
+	}
+
+	// The log knows nothing from before the seed, not even the old name.
+	earlier := time.Now().UTC().Add(-time.Hour)
+	if _, _, err := db.ReplayEventLog(user.ID, earlier); !errors.Is(err, ErrBeforeHistory) {
+		t.Errorf("expected a replay before the seed refused, got %v", err)
+	}
+	if _, err := db.RestoreToTime(user.ID, earlier); !errors.Is(err, ErrBeforeHistory) {
+		t.Errorf("expected a restore before the seed refused, got %v", err)
+	}
+
+	// A row the log has no entry for at all is left alone too.
+	if err := db.CreateGoal(&models.Goal{ID: "goal-unlogged", Name: "Walk", Color: "#000000", UserID: &user.ID, CreatedAt: now}); err != nil {
+		t.Fatalf("CreateGoal: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM event_log WHERE item_id = 'goal-unlogged'`); err != nil {
+		t.Fatalf("clear log: %v", err)
+	}
+	before := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	if err := db.CreateGoal(&models.Goal{ID: "goal-new", Name: "Swim", Color: "#000000", UserID: &user.ID, CreatedAt: now}); err != nil {
+		t.Fatalf("CreateGoal: %v", err)
+	}
+
+	n, err := db.RestoreToTime(user.ID, before)
+	if err != nil {
+		t.Fatalf("RestoreToTime: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected only the newer goal deleted, got %d rows", n)
+	}
+	goals, _ = db.ListGoals(&user.ID, false)
+	if len(goals) != 2 || goals[0].ID != "goal-old" || goals[0].Name != "Books" || goals[1].ID != "goal-unlogged" {
+		t.Errorf("expected the older goals kept, got %+v", goals)
+	}
+	if c, _ := db.GetCompletionByGoalAndDate("goal-old", "2026-03-01"); c == nil {
+		t.Error("expected the older completion kept")
+	}
+}
+
+func TestEventLog_RefusesRestoreAcrossTombstoneHorizon(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	user, err := db.GetOrCreateUserByProvider("test", "purged", "purged@test.com", "Purged", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := db.CreateGoal(&models.Goal{ID: "goal-gone", Name: "Run", Color: "#000000", UserID: &user.ID, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("CreateGoal: %v", err)
+	}
+	before := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	if err := db.SoftDeleteGoal(&user.ID, "goal-gone"); err != nil {
+		t.Fatalf("SoftDeleteGoal: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	purged := time.Now().UTC()
+	if n, err := db.PurgeTombstones(purged); err != nil || n == 0 {
+		t.Fatalf("expected the goal purged, got %d, %v", n, err)
+	}
+
+	// Clients may have dropped the purged goal for good; bringing it back
+	// would hand them a row they can no longer reconcile.
+	if _, err := db.RestoreToTime(user.ID, before); !errors.Is(err, ErrBeforeHistory) {
+		t.Fatalf("expected a restore across the horizon refused, got %v", err)
+	}
+	if g, _ := db.GetGoal(&user.ID, "goal-gone"); g != nil {
+		t.Errorf("expected the purged goal to stay gone, got %+v", g)
+	}
+
+	if n, err := db.RestoreToTime(user.ID, purged); err != nil || n != 0 {
+		t.Errorf("expected a restore at the horizon to change nothing, got %d, %v", n, err)
+	}
+}
+
+func TestCompletions_ScanDatesAsPlainDates(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	userID := "dates-user"
+	now := time.Now().UTC()
+	if err := db.CreateUser(&models.User{ID: userID, Email: "dates@test.com", CreatedAt: now}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := db.CreateGoal(&models.Goal{ID: "goal-dates", Name: "Read", Color: "#000000", UserID: &userID, CreatedAt: now}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+	if err := db.CreateCompletion(&models.Completion{ID: "c-dates", GoalID: "goal-dates", Date: "2026-03-01", CreatedAt: now}); err != nil {
+		t.Fatalf("create completion: %v", err)
+	}
+
+	ranged, _ := db.ListCompletions(&userID, "2026-03-01", "2026-03-31", nil)
+	all, _ := db.ListAllCompletions(&userID)
+	byID, _ := db.GetCompletionByID("c-dates")
+	changes, _ := db.GetCompletionChangesSinceSeq(&userID, 0)
+	if len(ranged) != 1 || len(all) != 1 || byID == nil || len(changes) != 1 {
+		t.Fatalf("expected the completion from every query, got %v, %v, %v, %v", ranged, all, byID, changes)
+	}
+	for _, date := range []string{ranged[0].Date, all[0].Date, byID.Date, changes[0].Date} {
+		if date != "2026-03-01" {
+			t.Errorf("expected 2026-03-01, got %q", date)
+		}
+	}
+}
@@ -10,6 +10,7 @@ type Goal struct {
 	Name         string     `json:"name"`
 	Color        string     `json:"color"`
 	Position     int        `json:"position"`
+	Rank         string     `json:"rank"` // sort key; position is for clients that predate ranks
 	TargetCount  *int       `json:"target_count,omitempty"`
 	TargetPeriod *string    `json:"target_period,omitempty"` // "week" or "month"
 	UserID       *string    `json:"user_id,omitempty"`
@@ -17,6 +18,25 @@ type Goal struct {
 	UpdatedAt    time.Time  `json:"updated_at"`
 	ArchivedAt   *time.Time `json:"archived_at,omitempty"`
 	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	// ClockLogical and ClockNode complete the hybrid logical clock whose wall
+	// time is UpdatedAt. They are only used by sync.
+	ClockLogical uint32          `json:"-"`
+	ClockNode    string          `json:"-"`
+	FieldClocks  GoalFieldClocks `json:"-"`
+	// ChangeSeq is the server change sequence of the last write. Only read
+	// by sync queries.
+	ChangeSeq int64 `json:"-"`
+}
+
+// GoalFieldClocks holds, in text form, the hybrid logical clock of each goal
+// field that sync merges separately. An empty value means the field was last
+// written with the goal's own clock.
+type GoalFieldClocks struct {
+	Name     string
+	Color    string
+	Position string
+	Target   string
+	Archived string
 }
 
 type Completion struct {
@@ -26,6 +46,13 @@ type Completion struct {
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// ClockLogical and ClockNode complete the hybrid logical clock whose wall
+	// time is UpdatedAt. They are only used by sync.
+	ClockLogical uint32 `json:"-"`
+	ClockNode    string `json:"-"`
+	// ChangeSeq is the server change sequence of the last write. Only read
+	// by sync queries.
+	ChangeSeq int64 `json:"-"`
 }
 
 type CalendarResponse struct {
@@ -67,6 +94,14 @@ type User struct {
 	AvatarURL   string     `json:"avatar_url,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	Timezone    string     `json:"timezone"` // IANA name, e.g. "America/Sao_Paulo"
+	Locale      string     `json:"locale"`   // notification language, e.g. "pt-BR"
+}
+
+// UpdateAccountRequest is the PATCH /api/v1/account body.
+type UpdateAccountRequest struct {
+	Timezone *string `json:"timezone,omitempty"`
+	Locale   *string `json:"locale,omitempty"`
 }
 
 type Session struct {
@@ -82,15 +117,123 @@ type Session struct {
 type DeviceToken struct {
 	ID         string     `json:"id"`
 	UserID     string     `json:"user_id"`
-	Token      string     `json:"token"`
-	Platform   string     `json:"platform"` // "android" or "ios"
+	Token      string     `json:"-"`           // a push credential, never sent to clients
+	Platform   string     `json:"platform"`    // "android", "ios" or "web"
+	Name       string     `json:"name"`        // user-chosen label, e.g. "Work phone"
+	AppVersion string     `json:"app_version"` // reported by the app at registration
 	CreatedAt  time.Time  `json:"created_at"`
-	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"` // last successful push
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"` // last registration or sync from the device
 }
 
+// RegisterDeviceRequest registers a push target. Native platforms send the
+// FCM/APNs token; "web" sends the browser PushSubscription's endpoint and
+// keys instead.
 type RegisterDeviceRequest struct {
-	Token    string `json:"token"`
-	Platform string `json:"platform"` // "android" or "ios"
+	Token      string       `json:"token"`
+	Platform   string       `json:"platform"` // "android", "ios" or "web"
+	Endpoint   string       `json:"endpoint,omitempty"`
+	Keys       *WebPushKeys `json:"keys,omitempty"`
+	Name       *string      `json:"name,omitempty"`        // optional; a re-registration without it keeps the current name
+	AppVersion *string      `json:"app_version,omitempty"` // optional
+}
+
+// UpdateDeviceRequest renames a device (PATCH /devices/{id}).
+type UpdateDeviceRequest struct {
+	Name *string `json:"name"`
+}
+
+// WebPushKeys are the base64url-encoded PushSubscription keys.
+type WebPushKeys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// Push outbox statuses. pending and sending rows are picked up by the worker;
+// sent and failed are final.
+const (
+	PushOutboxPending = "pending"
+	PushOutboxSending = "sending"
+	PushOutboxSent    = "sent"
+	PushOutboxFailed  = "failed"
+)
+
+// PushOutboxEntry is one notification queued for delivery to one device.
+// Token and Platform are copied from the device token when enqueued.
+type PushOutboxEntry struct {
+	ID            string            `json:"id"`
+	UserID        string            `json:"user_id"`
+	DeviceTokenID string            `json:"device_token_id"`
+	Platform      string            `json:"platform"`
+	Token         string            `json:"-"`
+	Category      string            `json:"category"` // e.g. "reminder"
+	Title         string            `json:"title"`
+	Body          string            `json:"body"`
+	Data          map[string]string `json:"data,omitempty"`
+	CollapseKey   string            `json:"collapse_key,omitempty"`
+	Status        string            `json:"status"`
+	Attempts      int               `json:"attempts"`
+	NextAttemptAt time.Time         `json:"next_attempt_at"`
+	LastError     string            `json:"last_error,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	SentAt        *time.Time        `json:"sent_at,omitempty"`
+}
+
+// Reminder types
+
+// Reminder is a server-side push reminder schedule. GoalID nil means the
+// reminder covers all of the user's active goals.
+type Reminder struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	GoalID     *string    `json:"goal_id,omitempty"`
+	Frequency  string     `json:"frequency"` // "daily" or "weekly"
+	Time       string     `json:"time"`      // "HH:MM" in the user's timezone
+	Weekday    int        `json:"weekday"`   // 0=Sunday..6=Saturday, used when weekly
+	Enabled    bool       `json:"enabled"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type CreateReminderRequest struct {
+	GoalID    *string `json:"goal_id,omitempty"`
+	Frequency string  `json:"frequency"`
+	Time      string  `json:"time"`
+	Weekday   int     `json:"weekday"`
+	Enabled   *bool   `json:"enabled,omitempty"` // defaults to true
+}
+
+type UpdateReminderRequest struct {
+	Frequency *string `json:"frequency,omitempty"`
+	Time      *string `json:"time,omitempty"`
+	Weekday   *int    `json:"weekday,omitempty"`
+	Enabled   *bool   `json:"enabled,omitempty"`
+}
+
+// Streak alert types
+
+// StreakAlertSettings controls the evening "don't break your streak" push.
+// Users are opted in until they turn it off.
+type StreakAlertSettings struct {
+	Enabled bool   `json:"enabled"`
+	Time    string `json:"time"` // "HH:MM" in the user's timezone
+}
+
+type UpdateStreakAlertSettingsRequest struct {
+	Enabled *bool   `json:"enabled,omitempty"`
+	Time    *string `json:"time,omitempty"`
+}
+
+// StreakAlertRecipient is an opted-in user with at least one device, as seen
+// by the streak alert job.
+type StreakAlertRecipient struct {
+	UserID     string
+	Timezone   string
+	Locale     string
+	Time       string // "HH:MM" in Timezone
+	LastSentOn string // local date of the last alert run, "" if never
 }
 
 // Debug report types
@@ -0,0 +1,313 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// APNsProductionEndpoint and APNsSandboxEndpoint are the HTTP/2 provider
+	// API hosts. Development builds of the app register sandbox tokens.
+	APNsProductionEndpoint = "https://api.push.apple.com"
+	APNsSandboxEndpoint    = "https://api.sandbox.push.apple.com"
+
+	defaultAPNsConcurrency = 10
+	// apnsTokenRefresh is how long a provider JWT is reused. Apple rejects
+	// tokens older than an hour and throttles refreshes more frequent than
+	// every 20 minutes.
+	apnsTokenRefresh = 50 * time.Minute
+)
+
+// APNsConfig configures an APNsService.
+type APNsConfig struct {
+	// SigningKey is the contents of the .p8 auth key downloaded from the
+	// Apple developer portal (PEM-encoded PKCS#8 P-256 key).
+	SigningKey []byte
+	// KeyID is the 10-character identifier of the signing key.
+	KeyID string
+	// TeamID is the Apple developer team the key belongs to.
+	TeamID string
+	// Topic is the app's bundle identifier.
+	Topic string
+	// Endpoint overrides the provider API base URL. Defaults to
+	// APNsProductionEndpoint.
+	Endpoint string
+	// HTTPClient must speak HTTP/2; the default client negotiates it over TLS.
+	// Defaults to a client with a 10s timeout.
+	HTTPClient *http.Client
+	// Concurrency is the number of parallel sends used by SendMultiple.
+	// Defaults to 10.
+	Concurrency int
+	Logger      *slog.Logger
+}
+
+// APNsService sends notifications through the Apple Push Notification
+// service HTTP/2 provider API using token-based (.p8) authentication.
+type APNsService struct {
+	client      *http.Client
+	endpoint    string
+	key         *ecdsa.PrivateKey
+	keyID       string
+	teamID      string
+	topic       string
+	concurrency int
+	logger      *slog.Logger
+	now         func() time.Time
+
+	mu        sync.Mutex
+	jwt       string
+	jwtIssued time.Time
+}
+
+// NewAPNsService parses the signing key and returns a service ready to send.
+func NewAPNsService(cfg APNsConfig) (*APNsService, error) {
+	if cfg.KeyID == "" || cfg.TeamID == "" || cfg.Topic == "" {
+		return nil, errors.New("apns key id, team id and topic are required")
+	}
+	key, err := parseAPNsKey(cfg.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := strings.TrimRight(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = APNsProductionEndpoint
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultAPNsConcurrency
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &APNsService{
+		client:      client,
+		endpoint:    endpoint,
+		key:         key,
+		keyID:       cfg.KeyID,
+		teamID:      cfg.TeamID,
+		topic:       cfg.Topic,
+		concurrency: concurrency,
+		logger:      logger,
+		now:         time.Now,
+	}, nil
+}
+
+// parseAPNsKey decodes a .p8 file.
+func parseAPNsKey(p8 []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(p8)
+	if block == nil {
+		return nil, errors.New("apns signing key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse apns signing key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("apns signing key must be an ECDSA key")
+	}
+	return key, nil
+}
+
+// apnsAps is the Apple-reserved "aps" dictionary of the payload. Custom data
+// keys sit beside it at the top level, where the app's handler reads them.
+type apnsAps struct {
+	Alert            *apnsAlert `json:"alert,omitempty"`
+	Sound            string     `json:"sound,omitempty"`
+	ContentAvailable int        `json:"content-available,omitempty"`
+}
+
+type apnsAlert struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type apnsErrorResponse struct {
+	Reason string `json:"reason"`
+}
+
+// Send delivers a notification to a single APNs device token. Messages
+// without a title or body are sent as background (content-available) pushes.
+func (s *APNsService) Send(ctx context.Context, token string, notification *Notification) error {
+	payload := map[string]any{}
+	for k, v := range notification.Data {
+		payload[k] = v
+	}
+	pushType, priority := "alert", "10"
+	if notification.Title != "" || notification.Body != "" {
+		payload["aps"] = apnsAps{
+			Alert: &apnsAlert{Title: notification.Title, Body: notification.Body},
+			Sound: "default",
+		}
+	} else {
+		// Apple requires priority 5 for background pushes.
+		payload["aps"] = apnsAps{ContentAvailable: 1}
+		pushType, priority = "background", "5"
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal apns payload: %w", err)
+	}
+	jwt, err := s.providerToken()
+	if err != nil {
+		return fmt.Errorf("sign apns token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build apns request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "bearer "+jwt)
+	req.Header.Set("apns-topic", s.topic)
+	req.Header.Set("apns-push-type", pushType)
+	req.Header.Set("apns-priority", priority)
+	if notification.CollapseKey != "" {
+		req.Header.Set("apns-collapse-id", notification.CollapseKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &ProviderError{Provider: "apns", Kind: ErrUnavailable, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	pe := classifyAPNsError(resp, respBody)
+	if errors.Is(pe, ErrAuth) {
+		// Force a fresh provider token on the next send.
+		s.mu.Lock()
+		s.jwt = ""
+		s.mu.Unlock()
+	}
+	return pe
+}
+
+// classifyAPNsError maps an APNs error response onto the push error sentinels.
+// See "Handling notification responses from APNs" in Apple's documentation.
+func classifyAPNsError(resp *http.Response, body []byte) *ProviderError {
+	pe := &ProviderError{Provider: "apns", Status: resp.StatusCode}
+
+	var parsed apnsErrorResponse
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		pe.Reason = parsed.Reason
+	}
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			pe.RetryAfter = time.Duration(secs) * time.Second
+		}
+	}
+
+	switch pe.Reason {
+	case "Unregistered", "ExpiredToken":
+		pe.Kind = ErrUnregistered
+	case "BadDeviceToken", "DeviceTokenNotForTopic", "MissingDeviceToken":
+		pe.Kind = ErrInvalidToken
+	case "InvalidProviderToken", "ExpiredProviderToken", "MissingProviderToken", "Forbidden":
+		pe.Kind = ErrAuth
+	case "TooManyRequests", "TooManyProviderTokenUpdates", "InternalServerError", "ServiceUnavailable", "Shutdown":
+		pe.Kind = ErrUnavailable
+	default:
+		switch {
+		case resp.StatusCode == http.StatusGone:
+			pe.Kind = ErrUnregistered
+		case resp.StatusCode == http.StatusForbidden:
+			pe.Kind = ErrAuth
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			pe.Kind = ErrUnavailable
+		default:
+			pe.Kind = ErrRejected
+		}
+	}
+	return pe
+}
+
+// SendMultiple sends to every token with bounded concurrency. APNs has no
+// batch endpoint; HTTP/2 multiplexes the requests over one connection.
+func (s *APNsService) SendMultiple(ctx context.Context, tokens []string, notification *Notification) map[string]error {
+	var (
+		mu     sync.Mutex
+		failed = make(map[string]error)
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, s.concurrency)
+	)
+	for _, token := range tokens {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(token string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := s.Send(ctx, token, notification); err != nil {
+				s.logger.Warn("apns send failed",
+					slog.String("token", maskToken(token)),
+					slog.String("error", err.Error()),
+				)
+				mu.Lock()
+				failed[token] = err
+				mu.Unlock()
+			}
+		}(token)
+	}
+	wg.Wait()
+	return failed
+}
+
+// providerToken returns the cached ES256 provider JWT, signing a new one
+// when it is older than apnsTokenRefresh.
+func (s *APNsService) providerToken() (string, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.jwt != "" && now.Sub(s.jwtIssued) < apnsTokenRefresh {
+		return s.jwt, nil
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "kid": s.keyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{"iss": s.teamID, "iat": now.Unix()})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sig, err := signES256(s.key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	s.jwt = signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+	s.jwtIssued = now
+	return s.jwt, nil
+}
+
+// Ensure APNsService implements PushService
+var _ PushService = (*APNsService)(nil)
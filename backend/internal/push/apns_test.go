@@ -0,0 +1,248 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAPNs is a local stand-in for the APNs provider API. It requires
+// HTTP/2, verifies the provider JWT and answers per-token failures.
+type fakeAPNs struct {
+	server   *httptest.Server
+	key      *ecdsa.PrivateKey
+	failures map[string]fakeAPNsFailure
+
+	mu       sync.Mutex
+	requests []fakeAPNsRequest
+}
+
+type fakeAPNsFailure struct {
+	status int
+	reason string
+}
+
+type fakeAPNsRequest struct {
+	token      string
+	pushType   string
+	priority   string
+	topic      string
+	collapseID string
+	payload    map[string]any
+}
+
+func newFakeAPNs(t *testing.T) *fakeAPNs {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	f := &fakeAPNs{key: key, failures: map[string]fakeAPNsFailure{}}
+
+	f.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			http.Error(w, `{"reason":"BadRequest"}`, http.StatusBadRequest)
+			return
+		}
+		if !f.validJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "bearer ")) {
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `{"reason":"InvalidProviderToken"}`)
+			return
+		}
+		token := strings.TrimPrefix(r.URL.Path, "/3/device/")
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		f.mu.Lock()
+		f.requests = append(f.requests, fakeAPNsRequest{
+			token:      token,
+			pushType:   r.Header.Get("apns-push-type"),
+			priority:   r.Header.Get("apns-priority"),
+			topic:      r.Header.Get("apns-topic"),
+			collapseID: r.Header.Get("apns-collapse-id"),
+			payload:    payload,
+		})
+		f.mu.Unlock()
+
+		if fail, ok := f.failures[token]; ok {
+			w.WriteHeader(fail.status)
+			json.NewEncoder(w).Encode(apnsErrorResponse{Reason: fail.reason})
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	f.server.EnableHTTP2 = true
+	f.server.StartTLS()
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeAPNs) validJWT(token string) bool {
+	segs := strings.Split(token, ".")
+	if len(segs) != 3 {
+		return false
+	}
+	sig, err := decodeBase64URL(segs[2])
+	if err != nil || len(sig) != 64 {
+		return false
+	}
+	digest := sha256.Sum256([]byte(segs[0] + "." + segs[1]))
+	if !ecdsa.Verify(&f.key.PublicKey, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return false
+	}
+	var header struct{ Alg, Kid string }
+	var claims struct {
+		Iss string `json:"iss"`
+		Iat int64  `json:"iat"`
+	}
+	h, _ := decodeBase64URL(segs[0])
+	c, _ := decodeBase64URL(segs[1])
+	if json.Unmarshal(h, &header) != nil || json.Unmarshal(c, &claims) != nil {
+		return false
+	}
+	return header.Alg == "ES256" && header.Kid == "KEY123" && claims.Iss == "TEAM123" && claims.Iat > 0
+}
+
+func (f *fakeAPNs) p8(t *testing.T) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(f.key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func newTestAPNsService(t *testing.T, f *fakeAPNs) *APNsService {
+	t.Helper()
+	svc, err := NewAPNsService(APNsConfig{
+		SigningKey: f.p8(t),
+		KeyID:      "KEY123",
+		TeamID:     "TEAM123",
+		Topic:      "com.example.goals",
+		Endpoint:   f.server.URL,
+		HTTPClient: f.server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("NewAPNsService: %v", err)
+	}
+	return svc
+}
+
+func TestAPNsService_SendAlert(t *testing.T) {
+	f := newFakeAPNs(t)
+	svc := newTestAPNsService(t, f)
+
+	n := &Notification{Title: "Read", Body: "Did you complete this goal today?", Data: map[string]string{"goal_id": "g1"}}
+	if err := svc.Send(context.Background(), "abc123", n); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(f.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(f.requests))
+	}
+	req := f.requests[0]
+	if req.token != "abc123" || req.pushType != "alert" || req.priority != "10" || req.topic != "com.example.goals" {
+		t.Errorf("unexpected request: %+v", req)
+	}
+	aps, _ := req.payload["aps"].(map[string]any)
+	alert, _ := aps["alert"].(map[string]any)
+	if alert["title"] != "Read" || req.payload["goal_id"] != "g1" {
+		t.Errorf("unexpected payload: %v", req.payload)
+	}
+}
+
+func TestAPNsService_DataOnlyIsBackgroundPush(t *testing.T) {
+	f := newFakeAPNs(t)
+	svc := newTestAPNsService(t, f)
+
+	if err := svc.Send(context.Background(), "abc123", DataChangedNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	req := f.requests[0]
+	aps, _ := req.payload["aps"].(map[string]any)
+	if req.pushType != "background" || req.priority != "5" || aps["content-available"] != float64(1) || aps["alert"] != nil {
+		t.Errorf("expected a background push, got %+v", req)
+	}
+	if req.collapseID != SyncCollapseKey || req.payload["type"] != "sync" {
+		t.Errorf("expected a collapsible sync push, got %+v", req)
+	}
+}
+
+func TestAPNsService_ReusesProviderToken(t *testing.T) {
+	f := newFakeAPNs(t)
+	svc := newTestAPNsService(t, f)
+
+	first, err := svc.providerToken()
+	if err != nil {
+		t.Fatalf("providerToken: %v", err)
+	}
+	second, _ := svc.providerToken()
+	if first != second {
+		t.Error("expected the provider token to be cached")
+	}
+}
+
+func TestAPNsService_ClassifiesErrors(t *testing.T) {
+	f := newFakeAPNs(t)
+	f.failures["bad"] = fakeAPNsFailure{http.StatusBadRequest, "BadDeviceToken"}
+	f.failures["gone"] = fakeAPNsFailure{http.StatusGone, "Unregistered"}
+	f.failures["topic"] = fakeAPNsFailure{http.StatusBadRequest, "DeviceTokenNotForTopic"}
+	f.failures["busy"] = fakeAPNsFailure{http.StatusServiceUnavailable, "ServiceUnavailable"}
+	f.failures["big"] = fakeAPNsFailure{http.StatusRequestEntityTooLarge, "PayloadTooLarge"}
+	svc := newTestAPNsService(t, f)
+
+	failed := svc.SendMultiple(context.Background(), []string{"ok", "bad", "gone", "topic", "busy", "big"}, &Notification{Title: "t"})
+
+	want := map[string]error{
+		"bad":   ErrInvalidToken,
+		"gone":  ErrUnregistered,
+		"topic": ErrInvalidToken,
+		"busy":  ErrUnavailable,
+		"big":   ErrRejected,
+	}
+	if len(failed) != len(want) {
+		t.Fatalf("expected %d failures, got %v", len(want), failed)
+	}
+	for token, kind := range want {
+		if !errors.Is(failed[token], kind) {
+			t.Errorf("%s: expected %v, got %v", token, kind, failed[token])
+		}
+	}
+	var pe *ProviderError
+	if !errors.As(failed["bad"], &pe) || pe.Reason != "BadDeviceToken" {
+		t.Errorf("expected the APNs reason to be preserved, got %v", failed["bad"])
+	}
+}
+
+func TestAPNsService_AuthFailureResetsToken(t *testing.T) {
+	f := newFakeAPNs(t)
+	svc := newTestAPNsService(t, f)
+	svc.jwt = "stale.token.value"
+	svc.jwtIssued = svc.now()
+
+	err := svc.Send(context.Background(), "abc123", &Notification{Title: "t"})
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("expected ErrAuth, got %v", err)
+	}
+	if err := svc.Send(context.Background(), "abc123", &Notification{Title: "t"}); err != nil {
+		t.Errorf("expected a fresh provider token to succeed, got %v", err)
+	}
+}
+
+func TestNewAPNsService_RejectsBadKey(t *testing.T) {
+	if _, err := NewAPNsService(APNsConfig{SigningKey: []byte("nope"), KeyID: "K", TeamID: "T", Topic: "x"}); err == nil {
+		t.Error("expected an error for a non-PEM key")
+	}
+}
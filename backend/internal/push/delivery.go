@@ -0,0 +1,113 @@
+package push
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+)
+
+// Delivery sends notifications to a user's registered devices and keeps the
+// device_tokens table healthy from the results: tokens the provider reports
+// as dead are deleted, and successful sends refresh last_used_at.
+type Delivery struct {
+	db       db.Database
+	dispatch *Dispatcher
+	logger   *slog.Logger
+}
+
+// DeliveryResult summarises a SendToUser call.
+type DeliveryResult struct {
+	Sent   int // tokens the provider accepted
+	Failed int // tokens that failed for any reason (including pruned ones)
+	Pruned int // dead tokens removed from storage
+}
+
+// NewDelivery creates a delivery layer that sends through dispatcher.
+func NewDelivery(database db.Database, dispatcher *Dispatcher, logger *slog.Logger) *Delivery {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Delivery{db: database, dispatch: dispatcher, logger: logger}
+}
+
+// SendToUser delivers the notification to every device the user has
+// registered. A user with no devices is not an error.
+func (d *Delivery) SendToUser(ctx context.Context, userID string, notification *Notification) (*DeliveryResult, error) {
+	tokens, err := d.db.GetDeviceTokensByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("get device tokens: %w", err)
+	}
+	return d.SendToDevices(ctx, tokens, notification), nil
+}
+
+// SendToDevices delivers the notification to the given devices with the same
+// token bookkeeping as SendToUser.
+func (d *Delivery) SendToDevices(ctx context.Context, devices []models.DeviceToken, notification *Notification) *DeliveryResult {
+	result := &DeliveryResult{}
+	if len(devices) == 0 {
+		return result
+	}
+
+	failed := d.dispatch.SendToDevices(ctx, devices, notification)
+
+	for _, t := range devices {
+		sendErr, didFail := failed[t.Token]
+		if !didFail {
+			result.Sent++
+		} else {
+			result.Failed++
+		}
+		if d.recordResult(t, sendErr) {
+			result.Pruned++
+		}
+	}
+	return result
+}
+
+// SendToDevice delivers the notification to a single device and applies the
+// same token bookkeeping as SendToUser. The send error is returned as-is so
+// callers can inspect it with IsTokenDead / IsRetryable.
+func (d *Delivery) SendToDevice(ctx context.Context, device models.DeviceToken, notification *Notification) error {
+	err := d.dispatch.ServiceFor(device.Platform).Send(ctx, device.Token, notification)
+	d.recordResult(device, err)
+	return err
+}
+
+// recordResult refreshes last_used_at after a successful send and deletes
+// the token when the provider reports it dead. Reports whether it pruned.
+func (d *Delivery) recordResult(t models.DeviceToken, sendErr error) bool {
+	if sendErr == nil {
+		if err := d.db.UpdateDeviceTokenLastUsed(t.ID); err != nil {
+			d.logger.Warn("update device token last used failed", slog.String("token_id", t.ID), slog.String("error", err.Error()))
+		}
+		return false
+	}
+	if !IsTokenDead(sendErr) {
+		return false
+	}
+	if err := d.db.DeleteDeviceToken(t.ID); err != nil {
+		d.logger.Warn("prune dead device token failed", slog.String("token_id", t.ID), slog.String("error", err.Error()))
+		return false
+	}
+	d.logger.Info("pruned dead device token",
+		slog.String("token_id", t.ID),
+		slog.String("user_id", t.UserID),
+		slog.String("platform", t.Platform),
+		slog.String("reason", sendErr.Error()),
+	)
+	return true
+}
+
+// PruneStale deletes tokens that have not been seen (registered or
+// successfully delivered to) for longer than maxAge.
+func (d *Delivery) PruneStale(maxAge time.Duration) (int64, error) {
+	n, err := d.db.DeleteStaleDeviceTokens(time.Now().UTC().Add(-maxAge))
+	if err != nil {
+		return 0, fmt.Errorf("delete stale device tokens: %w", err)
+	}
+	return n, nil
+}
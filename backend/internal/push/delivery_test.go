@@ -0,0 +1,207 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+)
+
+// scriptedPush fails the tokens listed in errs and accepts the rest.
+type scriptedPush struct {
+	errs map[string]error
+}
+
+func (p *scriptedPush) Send(ctx context.Context, token string, n *Notification) error {
+	return p.errs[token]
+}
+
+func (p *scriptedPush) SendMultiple(ctx context.Context, tokens []string, n *Notification) map[string]error {
+	failed := map[string]error{}
+	for _, t := range tokens {
+		if err := p.errs[t]; err != nil {
+			failed[t] = err
+		}
+	}
+	return failed
+}
+
+func TestDelivery_SendToUser_PrunesDeadTokens(t *testing.T) {
+	database, err := db.NewSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user, err := database.GetOrCreateUserByProvider("test", "dlv", "dlv@test.com", "Dlv", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	for _, tok := range []string{"ok", "unregistered", "invalid", "flaky"} {
+		if _, err := database.CreateDeviceToken(user.ID, tok, "android"); err != nil {
+			t.Fatalf("create token %s: %v", tok, err)
+		}
+	}
+
+	p := &scriptedPush{errs: map[string]error{
+		"unregistered": &ProviderError{Provider: "fcm", Status: 404, Reason: "UNREGISTERED", Kind: ErrUnregistered},
+		"invalid":      &ProviderError{Provider: "fcm", Status: 403, Reason: "SENDER_ID_MISMATCH", Kind: ErrInvalidToken},
+		"flaky":        &ProviderError{Provider: "fcm", Status: 503, Reason: "UNAVAILABLE", Kind: ErrUnavailable},
+	}}
+	d := NewDelivery(database, NewDispatcher(p), nil)
+
+	result, err := d.SendToUser(context.Background(), user.ID, &Notification{Title: "t", Body: "b"})
+	if err != nil {
+		t.Fatalf("SendToUser: %v", err)
+	}
+	if result.Sent != 1 || result.Failed != 3 || result.Pruned != 2 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	tokens, err := database.GetDeviceTokensByUserID(user.ID)
+	if err != nil {
+		t.Fatalf("list tokens: %v", err)
+	}
+	remaining := map[string]bool{}
+	for _, tok := range tokens {
+		remaining[tok.Token] = true
+		if tok.Token == "ok" && tok.LastUsedAt == nil {
+			t.Error("expected last_used_at to be set after a successful send")
+		}
+		if tok.Token == "flaky" && tok.LastUsedAt != nil {
+			t.Error("expected last_used_at to stay unset after a transient failure")
+		}
+	}
+	if len(remaining) != 2 || !remaining["ok"] || !remaining["flaky"] {
+		t.Errorf("expected only ok and flaky tokens to remain, got %v", remaining)
+	}
+}
+
+func TestDelivery_SendToUser_NoDevices(t *testing.T) {
+	database, err := db.NewSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	p := &scriptedPush{errs: map[string]error{"x": errors.New("should not be called")}}
+	result, err := NewDelivery(database, NewDispatcher(p), nil).SendToUser(context.Background(), "nobody", &Notification{})
+	if err != nil {
+		t.Fatalf("SendToUser: %v", err)
+	}
+	if result.Sent != 0 || result.Failed != 0 || result.Pruned != 0 {
+		t.Errorf("expected empty result, got %+v", result)
+	}
+}
+
+func TestDispatcher_RoutesByPlatform(t *testing.T) {
+	database, err := db.NewSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user, err := database.GetOrCreateUserByProvider("test", "route", "route@test.com", "Route", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := database.CreateDeviceToken(user.ID, "phone", "android"); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if _, err := database.CreateDeviceToken(user.ID, "browser", "web"); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	// Each service fails every token it is given, so the error map reveals
+	// which service handled which token.
+	native := &scriptedPush{errs: map[string]error{"phone": errors.New("native"), "browser": errors.New("native")}}
+	web := &scriptedPush{errs: map[string]error{"phone": ErrUnregistered, "browser": ErrUnregistered}}
+	dispatcher := NewDispatcher(native)
+	dispatcher.Route("web", web)
+	d := NewDelivery(database, dispatcher, nil)
+
+	result, err := d.SendToUser(context.Background(), user.ID, &Notification{Title: "t"})
+	if err != nil {
+		t.Fatalf("SendToUser: %v", err)
+	}
+	// Only the browser token went through the web service and was pruned.
+	if result.Pruned != 1 || result.Failed != 2 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	tokens, _ := database.GetDeviceTokensByUserID(user.ID)
+	if len(tokens) != 1 || tokens[0].Token != "phone" {
+		t.Errorf("expected only the phone token to remain, got %+v", tokens)
+	}
+}
+
+func TestDispatcher_KeepsTokensOfUnroutedPlatforms(t *testing.T) {
+	database, err := db.NewSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user, err := database.GetOrCreateUserByProvider("test", "unrouted", "unrouted@test.com", "Unrouted", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	browser, err := database.CreateDeviceToken(user.ID, `{"endpoint":"https://fcm.googleapis.com/fcm/send/x"}`, "web")
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	// The android service would call any token it cannot parse dead.
+	native := &scriptedPush{errs: map[string]error{browser.Token: ErrInvalidToken}}
+	d := NewDelivery(database, NewDispatcher(native), nil)
+
+	err = d.SendToDevice(context.Background(), *browser, &Notification{Title: "t"})
+	if !errors.Is(err, ErrNotConfigured) || IsTokenDead(err) || IsRetryable(err) {
+		t.Errorf("expected a not-configured error, got %v", err)
+	}
+	if tokens, _ := database.GetDeviceTokensByUserID(user.ID); len(tokens) != 1 {
+		t.Errorf("expected the browser token kept, got %+v", tokens)
+	}
+}
+
+func TestDispatcher_IOSWithoutAPNsGoesNowhere(t *testing.T) {
+	database, err := db.NewSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user, err := database.GetOrCreateUserByProvider("test", "no-apns", "no-apns@test.com", "iOS", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	for tok, platform := range map[string]string{"phone": "android", "iphone": "ios"} {
+		if _, err := database.CreateDeviceToken(user.ID, tok, platform); err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+	}
+
+	// FCM would reject an APNs token as invalid and get it pruned.
+	fcm := &scriptedPush{errs: map[string]error{"iphone": ErrInvalidToken}}
+	result, err := NewDelivery(database, NewDispatcher(fcm), nil).SendToUser(context.Background(), user.ID, &Notification{Title: "t"})
+	if err != nil {
+		t.Fatalf("SendToUser: %v", err)
+	}
+	if result.Sent != 1 || result.Failed != 1 || result.Pruned != 0 {
+		t.Errorf("expected the android send only, got %+v", result)
+	}
+	if tokens, _ := database.GetDeviceTokensByUserID(user.ID); len(tokens) != 2 {
+		t.Errorf("expected both tokens kept, got %+v", tokens)
+	}
+}
@@ -0,0 +1,70 @@
+package push
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apsv/goal-tracker/backend/internal/models"
+)
+
+// Dispatcher routes each device token to the PushService for its stored
+// platform ("android", "ios", "web"). A platform without a route fails with
+// ErrNotConfigured rather than going to a provider that cannot parse its
+// tokens, which would report them dead and get them pruned.
+type Dispatcher struct {
+	platforms map[string]PushService
+}
+
+// NewDispatcher creates a dispatcher that sends "android" tokens through
+// android. Other platforms are registered with Route.
+func NewDispatcher(android PushService) *Dispatcher {
+	return &Dispatcher{platforms: map[string]PushService{"android": android}}
+}
+
+// Route sends tokens registered for platform through svc. Call before the
+// dispatcher is shared between goroutines.
+func (d *Dispatcher) Route(platform string, svc PushService) {
+	d.platforms[platform] = svc
+}
+
+// ServiceFor returns the PushService responsible for a platform.
+func (d *Dispatcher) ServiceFor(platform string) PushService {
+	if svc, ok := d.platforms[platform]; ok {
+		return svc
+	}
+	return unroutedService{platform: platform}
+}
+
+// unroutedService fails every send to a platform the dispatcher has no
+// service for.
+type unroutedService struct {
+	platform string
+}
+
+func (u unroutedService) Send(ctx context.Context, token string, notification *Notification) error {
+	return &ProviderError{Provider: u.platform, Kind: ErrNotConfigured, Err: fmt.Errorf("no push service for platform %q", u.platform)}
+}
+
+func (u unroutedService) SendMultiple(ctx context.Context, tokens []string, notification *Notification) map[string]error {
+	failed := make(map[string]error, len(tokens))
+	for _, t := range tokens {
+		failed[t] = u.Send(ctx, t, notification)
+	}
+	return failed
+}
+
+// SendToDevices groups devices by platform, sends one SendMultiple per
+// provider, and returns the merged failures keyed by token.
+func (d *Dispatcher) SendToDevices(ctx context.Context, devices []models.DeviceToken, notification *Notification) map[string]error {
+	byPlatform := map[string][]string{}
+	for _, dt := range devices {
+		byPlatform[dt.Platform] = append(byPlatform[dt.Platform], dt.Token)
+	}
+	failed := map[string]error{}
+	for platform, tokens := range byPlatform {
+		for token, err := range d.ServiceFor(platform).SendMultiple(ctx, tokens, notification) {
+			failed[token] = err
+		}
+	}
+	return failed
+}
@@ -0,0 +1,73 @@
+package push
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Classified send failures. Provider implementations wrap one of these in a
+// *ProviderError so callers can decide what to do with a token (drop it,
+// retry later, alert an operator) without knowing which provider was used.
+var (
+	// ErrUnregistered means the provider no longer recognises the token,
+	// typically because the app was uninstalled or the token was rotated.
+	ErrUnregistered = errors.New("push: token unregistered")
+	// ErrInvalidToken means the token is malformed or belongs to another app.
+	ErrInvalidToken = errors.New("push: invalid token")
+	// ErrUnavailable is a transient failure (rate limit, provider outage,
+	// network error). The same send may succeed later.
+	ErrUnavailable = errors.New("push: provider unavailable")
+	// ErrAuth means the provider rejected the server's credentials.
+	ErrAuth = errors.New("push: provider authentication failed")
+	// ErrRejected covers any other permanent rejection (e.g. payload too large).
+	ErrRejected = errors.New("push: notification rejected")
+	// ErrNotConfigured means no provider is set up for the token's platform.
+	// The token is kept: it becomes deliverable once one is.
+	ErrNotConfigured = errors.New("push: provider not configured")
+)
+
+// ProviderError describes a failed send to a single token.
+type ProviderError struct {
+	Provider   string        // "fcm", "apns", "webpush"
+	Status     int           // HTTP status from the provider, 0 for transport errors
+	Reason     string        // provider-specific reason code, e.g. "UNREGISTERED"
+	RetryAfter time.Duration // provider-suggested backoff, 0 if none given
+	Kind       error         // one of the Err* sentinels above
+	Err        error         // underlying transport error, if any
+}
+
+func (e *ProviderError) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.Provider, e.Kind)
+	if e.Status != 0 {
+		msg += fmt.Sprintf(" (status %d", e.Status)
+		if e.Reason != "" {
+			msg += ", " + e.Reason
+		}
+		msg += ")"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap exposes both the classification sentinel and the transport error to
+// errors.Is / errors.As.
+func (e *ProviderError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// IsTokenDead reports whether err means the token will never be deliverable
+// again and should be removed from storage.
+func IsTokenDead(err error) bool {
+	return errors.Is(err, ErrUnregistered) || errors.Is(err, ErrInvalidToken)
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrUnavailable)
+}
@@ -0,0 +1,291 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const (
+	// DefaultFCMEndpoint is the production FCM HTTP v1 API base URL.
+	DefaultFCMEndpoint = "https://fcm.googleapis.com"
+
+	fcmScope              = "https://www.googleapis.com/auth/firebase.messaging"
+	defaultFCMTokenURL    = "https://oauth2.googleapis.com/token"
+	defaultFCMConcurrency = 10
+	// fcmBatchSize caps how many tokens a single SendMultiple fan-out keeps
+	// in flight at once, mirroring the legacy multicast limit.
+	fcmBatchSize = 500
+)
+
+// FCMConfig configures an FCMService.
+type FCMConfig struct {
+	// CredentialsJSON is the contents of a Firebase service account key file.
+	CredentialsJSON []byte
+	// Endpoint overrides the FCM API base URL (tests point this at a fake server).
+	// Defaults to DefaultFCMEndpoint.
+	Endpoint string
+	// HTTPClient is used for both the OAuth token exchange and message sends.
+	// Defaults to a client with a 10s timeout.
+	HTTPClient *http.Client
+	// Concurrency is the number of parallel sends used by SendMultiple.
+	// Defaults to 10.
+	Concurrency int
+	Logger      *slog.Logger
+}
+
+// serviceAccount is the subset of a Google service account key file we need.
+type serviceAccount struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// FCMService sends notifications through the Firebase Cloud Messaging HTTP v1
+// API, authenticating with a service-account signed JWT.
+type FCMService struct {
+	client      *http.Client
+	sendURL     string
+	concurrency int
+	logger      *slog.Logger
+}
+
+// NewFCMService parses the service account credentials and returns a service
+// ready to send. Access tokens are fetched lazily and cached until expiry.
+func NewFCMService(cfg FCMConfig) (*FCMService, error) {
+	var sa serviceAccount
+	if err := json.Unmarshal(cfg.CredentialsJSON, &sa); err != nil {
+		return nil, fmt.Errorf("parse fcm credentials: %w", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, errors.New("fcm credentials must include project_id, client_email and private_key")
+	}
+
+	tokenURL := sa.TokenURI
+	if tokenURL == "" {
+		tokenURL = defaultFCMTokenURL
+	}
+	endpoint := strings.TrimRight(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = DefaultFCMEndpoint
+	}
+	baseClient := cfg.HTTPClient
+	if baseClient == nil {
+		baseClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultFCMConcurrency
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	jwtConfig := &jwt.Config{
+		Email:        sa.ClientEmail,
+		PrivateKey:   []byte(sa.PrivateKey),
+		PrivateKeyID: sa.PrivateKeyID,
+		Scopes:       []string{fcmScope},
+		TokenURL:     tokenURL,
+	}
+	// The oauth2 package picks the transport for token requests out of the
+	// context, so the token exchange uses the same client as the sends.
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, baseClient)
+	client := oauth2.NewClient(ctx, jwtConfig.TokenSource(ctx))
+	client.Timeout = baseClient.Timeout
+
+	return &FCMService{
+		client:      client,
+		sendURL:     fmt.Sprintf("%s/v1/projects/%s/messages:send", endpoint, sa.ProjectID),
+		concurrency: concurrency,
+		logger:      logger,
+	}, nil
+}
+
+// fcmMessage is the HTTP v1 request body.
+type fcmMessage struct {
+	Message fcmMessageBody `json:"message"`
+}
+
+type fcmMessageBody struct {
+	Token        string            `json:"token"`
+	Notification *fcmNotification  `json:"notification,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	Android      *fcmAndroidConfig `json:"android,omitempty"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+}
+
+type fcmAndroidConfig struct {
+	Priority    string `json:"priority,omitempty"`
+	CollapseKey string `json:"collapse_key,omitempty"`
+}
+
+// fcmErrorResponse is the google.rpc.Status envelope FCM returns on failure.
+type fcmErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// Send delivers a notification to a single FCM registration token.
+func (s *FCMService) Send(ctx context.Context, token string, notification *Notification) error {
+	msg := fcmMessage{Message: fcmMessageBody{
+		Token:   token,
+		Data:    notification.Data,
+		Android: &fcmAndroidConfig{Priority: "high", CollapseKey: notification.CollapseKey},
+	}}
+	if notification.Title != "" || notification.Body != "" {
+		msg.Message.Notification = &fcmNotification{Title: notification.Title, Body: notification.Body}
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal fcm message: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.sendURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build fcm request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// Token exchange failures surface here too, wrapped in *url.Error.
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) {
+			pe := &ProviderError{Provider: "fcm", Kind: ErrAuth, Err: err}
+			if retrieveErr.Response != nil {
+				pe.Status = retrieveErr.Response.StatusCode
+			}
+			return pe
+		}
+		return &ProviderError{Provider: "fcm", Kind: ErrUnavailable, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return classifyFCMError(resp, respBody)
+}
+
+// classifyFCMError maps an FCM error response onto the push error sentinels.
+// See https://firebase.google.com/docs/reference/fcm/rest/v1/ErrorCode.
+func classifyFCMError(resp *http.Response, body []byte) *ProviderError {
+	pe := &ProviderError{Provider: "fcm", Status: resp.StatusCode}
+
+	var parsed fcmErrorResponse
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		pe.Reason = parsed.Error.Status
+		for _, d := range parsed.Error.Details {
+			if d.ErrorCode != "" {
+				pe.Reason = d.ErrorCode
+				break
+			}
+		}
+	}
+
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			pe.RetryAfter = time.Duration(secs) * time.Second
+		}
+	}
+
+	switch pe.Reason {
+	case "UNREGISTERED", "NOT_FOUND":
+		pe.Kind = ErrUnregistered
+	case "SENDER_ID_MISMATCH":
+		pe.Kind = ErrInvalidToken
+	case "INVALID_ARGUMENT":
+		// Also returned for a bad message (e.g. oversized data), which says
+		// nothing about the token, so it is not treated as dead.
+		pe.Kind = ErrRejected
+	case "QUOTA_EXCEEDED", "UNAVAILABLE", "INTERNAL", "RESOURCE_EXHAUSTED":
+		pe.Kind = ErrUnavailable
+	case "THIRD_PARTY_AUTH_ERROR", "UNAUTHENTICATED", "PERMISSION_DENIED":
+		pe.Kind = ErrAuth
+	default:
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			pe.Kind = ErrUnregistered
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			pe.Kind = ErrAuth
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+			pe.Kind = ErrUnavailable
+		default:
+			pe.Kind = ErrRejected
+		}
+	}
+	return pe
+}
+
+// SendMultiple fans the notification out to every token with bounded
+// concurrency. FCM v1 has no multicast endpoint, so each token is its own
+// request; tokens are processed in batches to cap goroutine count.
+func (s *FCMService) SendMultiple(ctx context.Context, tokens []string, notification *Notification) map[string]error {
+	var (
+		mu     sync.Mutex
+		failed = make(map[string]error)
+	)
+
+	for start := 0; start < len(tokens); start += fcmBatchSize {
+		end := min(start+fcmBatchSize, len(tokens))
+		batch := tokens[start:end]
+
+		sem := make(chan struct{}, s.concurrency)
+		var wg sync.WaitGroup
+		for _, token := range batch {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(token string) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if err := s.Send(ctx, token, notification); err != nil {
+					s.logger.Warn("fcm send failed",
+						slog.String("token", maskToken(token)),
+						slog.String("error", err.Error()),
+					)
+					mu.Lock()
+					failed[token] = err
+					mu.Unlock()
+				}
+			}(token)
+		}
+		wg.Wait()
+	}
+
+	return failed
+}
+
+// Ensure FCMService implements PushService
+var _ PushService = (*FCMService)(nil)
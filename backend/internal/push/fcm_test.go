@@ -0,0 +1,268 @@
+package push
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+)
+
+// fakeFCM is a local stand-in for both the Google OAuth token endpoint and
+// the FCM v1 send endpoint. Tokens listed in failures get the mapped error.
+type fakeFCM struct {
+	server     *httptest.Server
+	tokenCalls atomic.Int32
+	sent       chan fcmMessage
+	failures   map[string]fakeFCMFailure
+}
+
+type fakeFCMFailure struct {
+	status    int
+	errorCode string
+}
+
+func newFakeFCM(t *testing.T) *fakeFCM {
+	t.Helper()
+	f := &fakeFCM{
+		sent:     make(chan fcmMessage, 100),
+		failures: map[string]fakeFCMFailure{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		f.tokenCalls.Add(1)
+		if err := r.ParseForm(); err != nil || r.Form.Get("assertion") == "" {
+			http.Error(w, "missing assertion", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"fake-access-token","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/v1/projects/test-project/messages:send", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer fake-access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":401,"status":"UNAUTHENTICATED"}}`))
+			return
+		}
+		var msg fcmMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, "bad body", http.StatusBadRequest)
+			return
+		}
+		if fail, ok := f.failures[msg.Message.Token]; ok {
+			w.WriteHeader(fail.status)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": map[string]any{
+					"code":   fail.status,
+					"status": "ERROR",
+					"details": []map[string]string{{
+						"@type":     "type.googleapis.com/google.firebase.fcm.v1.FcmError",
+						"errorCode": fail.errorCode,
+					}},
+				},
+			})
+			return
+		}
+		f.sent <- msg
+		w.Write([]byte(`{"name":"projects/test-project/messages/1"}`))
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func testServiceAccountJSON(t *testing.T, tokenURL string) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	creds, _ := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "test-project",
+		"private_key_id": "key-1",
+		"private_key":    string(pemKey),
+		"client_email":   "fcm@test-project.iam.gserviceaccount.com",
+		"token_uri":      tokenURL,
+	})
+	return creds
+}
+
+func newTestFCMService(t *testing.T, f *fakeFCM) *FCMService {
+	t.Helper()
+	svc, err := NewFCMService(FCMConfig{
+		CredentialsJSON: testServiceAccountJSON(t, f.server.URL+"/token"),
+		Endpoint:        f.server.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewFCMService: %v", err)
+	}
+	return svc
+}
+
+func TestFCMService_Send(t *testing.T) {
+	f := newFakeFCM(t)
+	svc := newTestFCMService(t, f)
+
+	err := svc.Send(context.Background(), "device-token-1", &Notification{
+		Title: "Hello",
+		Body:  "World",
+		Data:  map[string]string{"kind": "reminder"},
+	})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	msg := <-f.sent
+	if msg.Message.Token != "device-token-1" {
+		t.Errorf("expected token device-token-1, got %q", msg.Message.Token)
+	}
+	if msg.Message.Notification == nil || msg.Message.Notification.Title != "Hello" {
+		t.Errorf("expected notification title Hello, got %+v", msg.Message.Notification)
+	}
+	if msg.Message.Data["kind"] != "reminder" {
+		t.Errorf("expected data kind=reminder, got %v", msg.Message.Data)
+	}
+}
+
+func TestFCMService_Send_ReusesAccessToken(t *testing.T) {
+	f := newFakeFCM(t)
+	svc := newTestFCMService(t, f)
+
+	for i := 0; i < 3; i++ {
+		if err := svc.Send(context.Background(), "tok", &Notification{Title: "t"}); err != nil {
+			t.Fatalf("Send %d failed: %v", i, err)
+		}
+		<-f.sent
+	}
+	if n := f.tokenCalls.Load(); n != 1 {
+		t.Errorf("expected 1 token exchange, got %d", n)
+	}
+}
+
+func TestFCMService_Send_DataOnlyOmitsNotification(t *testing.T) {
+	f := newFakeFCM(t)
+	svc := newTestFCMService(t, f)
+
+	if err := svc.Send(context.Background(), "tok", &Notification{Data: map[string]string{"a": "b"}}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	msg := <-f.sent
+	if msg.Message.Notification != nil {
+		t.Errorf("expected no notification block for data-only message, got %+v", msg.Message.Notification)
+	}
+}
+
+func TestFCMService_ErrorClassification(t *testing.T) {
+	f := newFakeFCM(t)
+	f.failures["gone"] = fakeFCMFailure{http.StatusNotFound, "UNREGISTERED"}
+	f.failures["bad"] = fakeFCMFailure{http.StatusBadRequest, "INVALID_ARGUMENT"}
+	f.failures["other-app"] = fakeFCMFailure{http.StatusForbidden, "SENDER_ID_MISMATCH"}
+	f.failures["busy"] = fakeFCMFailure{http.StatusServiceUnavailable, "UNAVAILABLE"}
+	f.failures["quota"] = fakeFCMFailure{http.StatusTooManyRequests, "QUOTA_EXCEEDED"}
+	f.failures["auth"] = fakeFCMFailure{http.StatusUnauthorized, "THIRD_PARTY_AUTH_ERROR"}
+	svc := newTestFCMService(t, f)
+
+	cases := []struct {
+		token string
+		want  error
+	}{
+		{"gone", ErrUnregistered},
+		{"bad", ErrRejected},
+		{"other-app", ErrInvalidToken},
+		{"busy", ErrUnavailable},
+		{"quota", ErrUnavailable},
+		{"auth", ErrAuth},
+	}
+	for _, tc := range cases {
+		err := svc.Send(context.Background(), tc.token, &Notification{Title: "t"})
+		if !errors.Is(err, tc.want) {
+			t.Errorf("token %q: expected %v, got %v", tc.token, tc.want, err)
+		}
+		var pe *ProviderError
+		if !errors.As(err, &pe) || pe.Provider != "fcm" {
+			t.Errorf("token %q: expected *ProviderError from fcm, got %T", tc.token, err)
+		}
+	}
+
+	if !IsTokenDead(svc.Send(context.Background(), "gone", &Notification{})) {
+		t.Error("expected unregistered token to be reported dead")
+	}
+	if !IsRetryable(svc.Send(context.Background(), "busy", &Notification{})) {
+		t.Error("expected unavailable error to be retryable")
+	}
+}
+
+func TestFCMService_InvalidArgumentKeepsToken(t *testing.T) {
+	database, err := db.NewSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user, err := database.GetOrCreateUserByProvider("test", "fcm-bad", "fcm-bad@test.com", "FCM", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if _, err := database.CreateDeviceToken(user.ID, "phone", "android"); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	// FCM rejects the message itself, e.g. for an oversized data payload.
+	f := newFakeFCM(t)
+	f.failures["phone"] = fakeFCMFailure{http.StatusBadRequest, "INVALID_ARGUMENT"}
+	d := NewDelivery(database, NewDispatcher(newTestFCMService(t, f)), nil)
+
+	result, err := d.SendToUser(context.Background(), user.ID, &Notification{Title: "t"})
+	if err != nil {
+		t.Fatalf("SendToUser: %v", err)
+	}
+	if result.Failed != 1 || result.Pruned != 0 {
+		t.Errorf("expected a failure without pruning, got %+v", result)
+	}
+	if tokens, _ := database.GetDeviceTokensByUserID(user.ID); len(tokens) != 1 {
+		t.Errorf("expected the token kept, got %+v", tokens)
+	}
+}
+
+func TestFCMService_SendMultiple_ReportsOnlyFailures(t *testing.T) {
+	f := newFakeFCM(t)
+	f.failures["gone"] = fakeFCMFailure{http.StatusNotFound, "UNREGISTERED"}
+	svc := newTestFCMService(t, f)
+
+	tokens := []string{"ok-1", "gone", "ok-2", "ok-3"}
+	errs := svc.SendMultiple(context.Background(), tokens, &Notification{Title: "t"})
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 failure, got %d: %v", len(errs), errs)
+	}
+	if !errors.Is(errs["gone"], ErrUnregistered) {
+		t.Errorf("expected gone to be unregistered, got %v", errs["gone"])
+	}
+	if len(f.sent) != 3 {
+		t.Errorf("expected 3 delivered messages, got %d", len(f.sent))
+	}
+}
+
+func TestNewFCMService_RejectsIncompleteCredentials(t *testing.T) {
+	_, err := NewFCMService(FCMConfig{CredentialsJSON: []byte(`{"project_id":"p"}`)})
+	if err == nil || !strings.Contains(err.Error(), "client_email") {
+		t.Errorf("expected missing-field error, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+)
+
+const (
+	// DefaultOutboxMaxAttempts bounds retries of a transient failure. With
+	// the backoff below the last attempt happens roughly an hour after the
+	// first.
+	DefaultOutboxMaxAttempts = 8
+
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = 30 * time.Minute
+	// outboxLease is how long a claimed entry stays invisible to other
+	// claims. A worker that dies mid-send leaves the entry claimable again
+	// once the lease runs out.
+	outboxLease     = 5 * time.Minute
+	outboxBatchSize = 100
+)
+
+// Outbox queues notifications in the push_outbox table and delivers them
+// with retries, so a provider outage delays a notification instead of
+// dropping it. Each queued notification becomes one entry per device.
+type Outbox struct {
+	db          db.Database
+	delivery    *Delivery
+	logger      *slog.Logger
+	maxAttempts int
+	now         func() time.Time
+}
+
+// NewOutbox creates an outbox that sends through delivery.
+func NewOutbox(database db.Database, delivery *Delivery, logger *slog.Logger) *Outbox {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Outbox{
+		db:          database,
+		delivery:    delivery,
+		logger:      logger,
+		maxAttempts: DefaultOutboxMaxAttempts,
+		now:         func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Enqueue queues the notification for every device the user has registered
+// and returns how many entries were created. category labels the entries
+// for inspection (e.g. "reminder").
+func (o *Outbox) Enqueue(userID, category string, notification *Notification) (int, error) {
+	entries, err := o.Entries(userID, category, notification)
+	if err != nil {
+		return 0, err
+	}
+	for i := range entries {
+		if err := o.db.CreatePushOutboxEntry(&entries[i]); err != nil {
+			return i, fmt.Errorf("enqueue push: %w", err)
+		}
+	}
+	return len(entries), nil
+}
+
+// Entries returns the entries Enqueue would create, without queueing them,
+// for callers that queue them in the same transaction as another write.
+func (o *Outbox) Entries(userID, category string, notification *Notification) ([]models.PushOutboxEntry, error) {
+	tokens, err := o.db.GetDeviceTokensByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("get device tokens: %w", err)
+	}
+	now := o.now()
+	entries := make([]models.PushOutboxEntry, 0, len(tokens))
+	for _, t := range tokens {
+		entries = append(entries, models.PushOutboxEntry{
+			UserID:        userID,
+			DeviceTokenID: t.ID,
+			Platform:      t.Platform,
+			Token:         t.Token,
+			Category:      category,
+			Title:         notification.Title,
+			Body:          notification.Body,
+			Data:          notification.Data,
+			CollapseKey:   notification.CollapseKey,
+			NextAttemptAt: now,
+		})
+	}
+	return entries, nil
+}
+
+// RunOnce claims due entries in batches and attempts each one, until no due
+// entries remain. It returns how many entries were attempted.
+func (o *Outbox) RunOnce(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		if ctx.Err() != nil {
+			return attempted, ctx.Err()
+		}
+		entries, err := o.db.ClaimPushOutbox(o.now(), outboxLease, outboxBatchSize)
+		if err != nil {
+			return attempted, fmt.Errorf("claim push outbox: %w", err)
+		}
+		for i := range entries {
+			if ctx.Err() != nil {
+				// Unattempted entries become claimable again when their lease expires.
+				return attempted, ctx.Err()
+			}
+			o.attempt(ctx, &entries[i])
+			attempted++
+		}
+		if len(entries) < outboxBatchSize {
+			return attempted, nil
+		}
+	}
+}
+
+// attempt sends one entry and records the outcome: sent, retry later, or
+// failed for good.
+func (o *Outbox) attempt(ctx context.Context, e *models.PushOutboxEntry) {
+	device := models.DeviceToken{ID: e.DeviceTokenID, UserID: e.UserID, Platform: e.Platform, Token: e.Token}
+	err := o.delivery.SendToDevice(ctx, device, &Notification{Title: e.Title, Body: e.Body, Data: e.Data, CollapseKey: e.CollapseKey})
+
+	now := o.now()
+	switch {
+	case err == nil:
+		e.Status = models.PushOutboxSent
+		e.SentAt = &now
+		e.LastError = ""
+	case IsRetryable(err) && e.Attempts < o.maxAttempts:
+		e.Status = models.PushOutboxPending
+		e.NextAttemptAt = now.Add(outboxBackoff(e.Attempts, err))
+		e.LastError = err.Error()
+	default:
+		e.Status = models.PushOutboxFailed
+		e.LastError = err.Error()
+	}
+
+	if err := o.db.UpdatePushOutboxEntry(e); err != nil {
+		o.logger.Error("record push outcome failed", slog.String("entry_id", e.ID), slog.String("error", err.Error()))
+		return
+	}
+	if e.Status == models.PushOutboxFailed {
+		o.logger.Warn("push delivery failed",
+			slog.String("entry_id", e.ID),
+			slog.String("user_id", e.UserID),
+			slog.String("category", e.Category),
+			slog.Int("attempts", e.Attempts),
+			slog.String("error", e.LastError),
+		)
+	}
+}
+
+// outboxBackoff doubles the delay with each attempt, capped at
+// outboxMaxBackoff, and honours a longer provider Retry-After.
+func outboxBackoff(attempts int, err error) time.Duration {
+	delay := outboxBaseBackoff
+	for i := 1; i < attempts && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, outboxMaxBackoff)
+	var pe *ProviderError
+	if errors.As(err, &pe) && pe.RetryAfter > delay {
+		delay = pe.RetryAfter
+	}
+	return delay
+}
+
+// Prune deletes finished entries older than retention.
+func (o *Outbox) Prune(retention time.Duration) (int64, error) {
+	n, err := o.db.DeleteOldPushOutbox(o.now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("delete old push outbox: %w", err)
+	}
+	return n, nil
+}
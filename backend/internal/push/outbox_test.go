@@ -0,0 +1,164 @@
+package push
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+)
+
+func newTestOutbox(t *testing.T, p PushService) (*Outbox, db.Database, *models.User, *time.Time) {
+	t.Helper()
+	database, err := db.NewSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user, err := database.GetOrCreateUserByProvider("test", "outbox", "outbox@test.com", "Outbox", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	clock := time.Now().UTC()
+	o := NewOutbox(database, NewDelivery(database, NewDispatcher(p), nil), nil)
+	o.now = func() time.Time { return clock }
+	return o, database, user, &clock
+}
+
+func outboxEntries(t *testing.T, database db.Database, userID string) map[string]models.PushOutboxEntry {
+	t.Helper()
+	entries, err := database.ListPushOutbox(db.PushOutboxFilter{UserID: &userID})
+	if err != nil {
+		t.Fatalf("list outbox: %v", err)
+	}
+	byToken := map[string]models.PushOutboxEntry{}
+	for _, e := range entries {
+		byToken[e.Token] = e
+	}
+	return byToken
+}
+
+func TestOutbox_DeliversAndRecordsOutcomes(t *testing.T) {
+	p := &scriptedPush{errs: map[string]error{
+		"dead": &ProviderError{Provider: "fcm", Status: 404, Reason: "UNREGISTERED", Kind: ErrUnregistered},
+	}}
+	o, database, user, _ := newTestOutbox(t, p)
+	for _, tok := range []string{"ok", "dead"} {
+		if _, err := database.CreateDeviceToken(user.ID, tok, "android"); err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+	}
+
+	n, err := o.Enqueue(user.ID, "reminder", &Notification{Title: "Read", Data: map[string]string{"goal_id": "g1"}})
+	if err != nil || n != 2 {
+		t.Fatalf("Enqueue: n=%d err=%v", n, err)
+	}
+	if attempted, err := o.RunOnce(context.Background()); err != nil || attempted != 2 {
+		t.Fatalf("RunOnce: attempted=%d err=%v", attempted, err)
+	}
+
+	entries := outboxEntries(t, database, user.ID)
+	if e := entries["ok"]; e.Status != models.PushOutboxSent || e.SentAt == nil || e.Attempts != 1 {
+		t.Errorf("expected ok entry sent on first attempt, got %+v", e)
+	}
+	if e := entries["dead"]; e.Status != models.PushOutboxFailed || e.LastError == "" {
+		t.Errorf("expected dead entry failed with an error, got %+v", e)
+	}
+	tokens, _ := database.GetDeviceTokensByUserID(user.ID)
+	if len(tokens) != 1 || tokens[0].Token != "ok" {
+		t.Errorf("expected the dead token to be pruned, got %+v", tokens)
+	}
+
+	// Nothing is left to do.
+	if attempted, _ := o.RunOnce(context.Background()); attempted != 0 {
+		t.Errorf("expected no further attempts, got %d", attempted)
+	}
+}
+
+func TestOutbox_KeepsTheWholeNotification(t *testing.T) {
+	p := &recordingPush{}
+	o, database, user, _ := newTestOutbox(t, p)
+	if _, err := database.CreateDeviceToken(user.ID, "phone", "android"); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	sent := &Notification{Title: "Read", Body: "Still time today", Data: map[string]string{"goal_id": "g1"}, CollapseKey: "reminder-g1"}
+	if _, err := o.Enqueue(user.ID, "reminder", sent); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if e := outboxEntries(t, database, user.ID)["phone"]; e.CollapseKey != "reminder-g1" {
+		t.Errorf("expected the collapse key stored, got %+v", e)
+	}
+	o.RunOnce(context.Background())
+
+	got := p.last
+	if got == nil || got.Title != sent.Title || got.Body != sent.Body || got.Data["goal_id"] != "g1" || got.CollapseKey != sent.CollapseKey {
+		t.Errorf("expected %+v delivered, got %+v", sent, got)
+	}
+}
+
+func TestOutbox_RetriesTransientFailures(t *testing.T) {
+	p := &scriptedPush{errs: map[string]error{
+		"flaky": &ProviderError{Provider: "fcm", Status: 503, Reason: "UNAVAILABLE", Kind: ErrUnavailable},
+	}}
+	o, database, user, clock := newTestOutbox(t, p)
+	o.maxAttempts = 3
+	if _, err := database.CreateDeviceToken(user.ID, "flaky", "android"); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if _, err := o.Enqueue(user.ID, "reminder", &Notification{Title: "Read"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	o.RunOnce(context.Background())
+	e := outboxEntries(t, database, user.ID)["flaky"]
+	if e.Status != models.PushOutboxPending || e.Attempts != 1 {
+		t.Fatalf("expected entry rescheduled after first failure, got %+v", e)
+	}
+	if wait := e.NextAttemptAt.Sub(*clock); wait < outboxBaseBackoff-time.Second {
+		t.Errorf("expected backoff of at least %v, got %v", outboxBaseBackoff, wait)
+	}
+
+	// Not due yet: nothing is attempted.
+	if attempted, _ := o.RunOnce(context.Background()); attempted != 0 {
+		t.Errorf("expected entry to wait for its backoff, got %d attempts", attempted)
+	}
+
+	for i := 0; i < 2; i++ {
+		*clock = clock.Add(time.Hour)
+		o.RunOnce(context.Background())
+	}
+	e = outboxEntries(t, database, user.ID)["flaky"]
+	if e.Status != models.PushOutboxFailed || e.Attempts != 3 {
+		t.Errorf("expected entry failed after max attempts, got %+v", e)
+	}
+	// A transient failure never prunes the token.
+	if tokens, _ := database.GetDeviceTokensByUserID(user.ID); len(tokens) != 1 {
+		t.Errorf("expected token to be kept, got %+v", tokens)
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		err      error
+		want     time.Duration
+	}{
+		{1, ErrUnavailable, 30 * time.Second},
+		{2, ErrUnavailable, time.Minute},
+		{4, ErrUnavailable, 4 * time.Minute},
+		{20, ErrUnavailable, outboxMaxBackoff},
+		{1, &ProviderError{Kind: ErrUnavailable, RetryAfter: 10 * time.Minute}, 10 * time.Minute},
+		{4, &ProviderError{Kind: ErrUnavailable, RetryAfter: time.Second}, 4 * time.Minute},
+	}
+	for _, tc := range cases {
+		if got := outboxBackoff(tc.attempts, tc.err); got != tc.want {
+			t.Errorf("outboxBackoff(%d, %v) = %v, want %v", tc.attempts, tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package push
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+)
+
+const (
+	// DefaultSyncDebounce is how long SyncNotifier waits after a change
+	// before pushing, so a burst of writes produces a single push.
+	DefaultSyncDebounce = 2 * time.Second
+
+	// SyncCollapseKey is the collapse key of "data changed" pushes; a device
+	// that was offline receives one of them, not one per change.
+	SyncCollapseKey = "sync"
+
+	syncSendTimeout = 30 * time.Second
+)
+
+// DataChangedNotification is the silent push that tells a device to sync. It
+// has no title or body, so providers deliver it as a data-only/background
+// message the app handles without showing anything.
+func DataChangedNotification() *Notification {
+	return &Notification{
+		Data:        map[string]string{"type": "sync"},
+		CollapseKey: SyncCollapseKey,
+	}
+}
+
+// SyncNotifier pushes DataChangedNotification to a user's devices after
+// their data changes, so other devices sync right away instead of waiting
+// for their next poll. Changes are debounced per user: every change inside
+// the window is covered by one push, sent when the window closes.
+//
+// Web subscriptions are skipped. Browsers require each push to show a
+// visible notification, so a silent sync push is not possible there.
+type SyncNotifier struct {
+	db       db.Database
+	delivery *Delivery
+	debounce time.Duration
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]*pendingSync
+}
+
+// pendingSync is a user's push waiting for its debounce window to close.
+type pendingSync struct {
+	// origin is the device to leave out, or "" when changes in the window
+	// came from more than one device (or an unidentified one).
+	origin string
+	timer  *time.Timer
+}
+
+// NewSyncNotifier creates a notifier that sends through delivery. A
+// non-positive debounce uses DefaultSyncDebounce.
+func NewSyncNotifier(database db.Database, delivery *Delivery, debounce time.Duration, logger *slog.Logger) *SyncNotifier {
+	if debounce <= 0 {
+		debounce = DefaultSyncDebounce
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &SyncNotifier{
+		db:       database,
+		delivery: delivery,
+		debounce: debounce,
+		logger:   logger,
+		pending:  make(map[string]*pendingSync),
+	}
+}
+
+// Notify records that the user's data changed. originDeviceID is the
+// device_tokens ID of the device that made the change, which already has it
+// and is not pushed to; pass "" when unknown.
+func (n *SyncNotifier) Notify(userID, originDeviceID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if p, ok := n.pending[userID]; ok {
+		if p.origin != originDeviceID {
+			p.origin = ""
+		}
+		return
+	}
+	n.pending[userID] = &pendingSync{
+		origin: originDeviceID,
+		timer:  time.AfterFunc(n.debounce, func() { n.flush(userID) }),
+	}
+}
+
+// flush sends the pending push for a user, if any.
+func (n *SyncNotifier) flush(userID string) {
+	n.mu.Lock()
+	p, ok := n.pending[userID]
+	if ok {
+		p.timer.Stop()
+		delete(n.pending, userID)
+	}
+	n.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	tokens, err := n.db.GetDeviceTokensByUserID(userID)
+	if err != nil {
+		n.logger.Error("sync push: get device tokens failed", slog.String("user_id", userID), slog.String("error", err.Error()))
+		return
+	}
+	devices := make([]models.DeviceToken, 0, len(tokens))
+	for _, t := range tokens {
+		if t.ID == p.origin || t.Platform == "web" {
+			continue
+		}
+		devices = append(devices, t)
+	}
+	if len(devices) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), syncSendTimeout)
+	defer cancel()
+	result := n.delivery.SendToDevices(ctx, devices, DataChangedNotification())
+	if result.Failed > 0 {
+		n.logger.Warn("sync push partially failed",
+			slog.String("user_id", userID),
+			slog.Int("sent", result.Sent),
+			slog.Int("failed", result.Failed),
+			slog.Int("pruned", result.Pruned),
+		)
+	}
+}
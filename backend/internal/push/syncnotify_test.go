@@ -0,0 +1,129 @@
+package push
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+)
+
+// recordingPush records every token it is asked to send to.
+type recordingPush struct {
+	mu    sync.Mutex
+	sends [][]string
+	last  *Notification
+}
+
+func (p *recordingPush) Send(ctx context.Context, token string, n *Notification) error {
+	p.SendMultiple(ctx, []string{token}, n)
+	return nil
+}
+
+func (p *recordingPush) SendMultiple(ctx context.Context, tokens []string, n *Notification) map[string]error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sorted := append([]string(nil), tokens...)
+	sort.Strings(sorted)
+	p.sends = append(p.sends, sorted)
+	p.last = n
+	return nil
+}
+
+func (p *recordingPush) calls() [][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]string(nil), p.sends...)
+}
+
+// tokens flattens every call; the dispatcher sends once per platform.
+func (p *recordingPush) tokens() []string {
+	var all []string
+	for _, c := range p.calls() {
+		all = append(all, c...)
+	}
+	sort.Strings(all)
+	return all
+}
+
+func setupSyncNotifier(t *testing.T, debounce time.Duration) (*SyncNotifier, *recordingPush, db.Database, map[string]models.DeviceToken) {
+	t.Helper()
+	database, err := db.NewSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	user, err := database.GetOrCreateUserByProvider("test", "syncn", "syncn@test.com", "Sync", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	devices := map[string]models.DeviceToken{}
+	for tok, platform := range map[string]string{"phone": "android", "tablet": "ios", "browser": "web"} {
+		dt, err := database.CreateDeviceToken(user.ID, tok, platform)
+		if err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+		devices[tok] = *dt
+	}
+
+	p := &recordingPush{}
+	dispatcher := NewDispatcher(p)
+	dispatcher.Route("ios", p)
+	n := NewSyncNotifier(database, NewDelivery(database, dispatcher, nil), debounce, nil)
+	return n, p, database, devices
+}
+
+func TestSyncNotifier_ExcludesOriginAndWeb(t *testing.T) {
+	n, p, _, devices := setupSyncNotifier(t, time.Hour)
+	userID := devices["phone"].UserID
+
+	n.Notify(userID, devices["phone"].ID)
+	n.flush(userID)
+
+	calls := p.calls()
+	if len(calls) != 1 || len(calls[0]) != 1 || calls[0][0] != "tablet" {
+		t.Fatalf("expected a single push to the tablet, got %v", calls)
+	}
+	if p.last.Title != "" || p.last.Body != "" || p.last.CollapseKey != SyncCollapseKey || p.last.Data["type"] != "sync" {
+		t.Errorf("expected a silent collapsible sync push, got %+v", p.last)
+	}
+}
+
+func TestSyncNotifier_DebouncesPerUser(t *testing.T) {
+	n, p, _, devices := setupSyncNotifier(t, 50*time.Millisecond)
+	userID := devices["phone"].UserID
+
+	for i := 0; i < 5; i++ {
+		n.Notify(userID, devices["phone"].ID)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(p.calls()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if calls := p.calls(); len(calls) != 1 {
+		t.Errorf("expected one push for a burst of changes, got %v", calls)
+	}
+}
+
+func TestSyncNotifier_MixedOriginsNotifyEveryone(t *testing.T) {
+	n, p, _, devices := setupSyncNotifier(t, time.Hour)
+	userID := devices["phone"].UserID
+
+	// Both native devices changed data in the same window, so each needs
+	// the other's changes.
+	n.Notify(userID, devices["phone"].ID)
+	n.Notify(userID, devices["tablet"].ID)
+	n.flush(userID)
+
+	if got := p.tokens(); len(got) != 2 || got[0] != "phone" || got[1] != "tablet" {
+		t.Fatalf("expected a push to both native devices, got %v", got)
+	}
+}
@@ -0,0 +1,182 @@
+package push
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FallbackLocale is used for users whose locale has no catalog, and for
+// kinds a catalog does not define.
+const FallbackLocale = "en"
+
+// Notification kinds rendered from the catalogs in templates/.
+const (
+	KindGoalReminder     = "goal_reminder"
+	KindCheckInReminder  = "checkin_reminder"
+	KindTestNotification = "test_notification"
+	KindStreakAtRisk     = "streak_at_risk"
+)
+
+//go:embed templates/*.json
+var templateFS embed.FS
+
+// TemplateArgs fills the placeholders of a template: {goal} is the goal name
+// and {count} the number that also selects the plural form.
+type TemplateArgs struct {
+	Goal  string
+	Count int
+}
+
+// Templates renders notification kinds in a user's locale. Each catalog is a
+// JSON file named after its locale (en.json, pt-BR.json) mapping a kind to a
+// title and body. A title or body is either a string or an object of CLDR
+// plural forms ("one", "other") chosen by TemplateArgs.Count.
+type Templates struct {
+	catalogs map[string]map[string]template
+}
+
+type template struct {
+	Title pluralText `json:"title"`
+	Body  pluralText `json:"body"`
+}
+
+// pluralText holds a message's plural forms; a plain string is stored as
+// the "other" form.
+type pluralText map[string]string
+
+func (p *pluralText) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*p = pluralText{"other": s}
+		return nil
+	}
+	var forms map[string]string
+	if err := json.Unmarshal(b, &forms); err != nil {
+		return fmt.Errorf("template text must be a string or an object of plural forms: %w", err)
+	}
+	if _, ok := forms["other"]; !ok {
+		return fmt.Errorf("plural forms must include \"other\"")
+	}
+	*p = forms
+	return nil
+}
+
+var (
+	defaultTemplatesOnce sync.Once
+	defaultTemplates     *Templates
+)
+
+// DefaultTemplates returns the catalogs embedded in the binary.
+func DefaultTemplates() *Templates {
+	defaultTemplatesOnce.Do(func() {
+		t, err := LoadTemplates(templateFS, "templates")
+		if err != nil {
+			// The catalogs are compiled in; TestDefaultTemplates keeps them valid.
+			panic(err)
+		}
+		defaultTemplates = t
+	})
+	return defaultTemplates
+}
+
+// LoadTemplates reads every <locale>.json file in dir. A catalog for
+// FallbackLocale is required.
+func LoadTemplates(fsys fs.FS, dir string) (*Templates, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{catalogs: make(map[string]map[string]template, len(files))}
+	for _, f := range files {
+		raw, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		var catalog map[string]template
+		if err := json.Unmarshal(raw, &catalog); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", f, err)
+		}
+		t.catalogs[strings.TrimSuffix(path.Base(f), ".json")] = catalog
+	}
+	if _, ok := t.catalogs[FallbackLocale]; !ok {
+		return nil, fmt.Errorf("missing %s catalog", FallbackLocale)
+	}
+	return t, nil
+}
+
+// resolve picks the catalog for locale: an exact (case-insensitive) match,
+// then any catalog with the same base language ("pt" or "pt-PT" → "pt-BR"),
+// then FallbackLocale.
+func (t *Templates) resolve(locale string) string {
+	for l := range t.catalogs {
+		if strings.EqualFold(l, locale) {
+			return l
+		}
+	}
+	base := baseLanguage(locale)
+	for l := range t.catalogs {
+		if strings.EqualFold(baseLanguage(l), base) {
+			return l
+		}
+	}
+	return FallbackLocale
+}
+
+func baseLanguage(locale string) string {
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		return locale[:i]
+	}
+	return locale
+}
+
+// Render builds the notification for kind in locale. Kinds missing from the
+// locale's catalog are rendered in English. The returned notification has no
+// Data; callers add their own.
+func (t *Templates) Render(locale, kind string, args TemplateArgs) (*Notification, error) {
+	resolved := t.resolve(locale)
+	tmpl, ok := t.catalogs[resolved][kind]
+	if !ok {
+		resolved = FallbackLocale
+		if tmpl, ok = t.catalogs[FallbackLocale][kind]; !ok {
+			return nil, fmt.Errorf("unknown notification kind %q", kind)
+		}
+	}
+	form := pluralForm(resolved, args.Count)
+	return &Notification{
+		Title: tmpl.Title.format(form, args),
+		Body:  tmpl.Body.format(form, args),
+	}, nil
+}
+
+func (p pluralText) format(form string, args TemplateArgs) string {
+	text, ok := p[form]
+	if !ok {
+		text = p["other"]
+	}
+	return strings.NewReplacer(
+		"{goal}", args.Goal,
+		"{count}", strconv.Itoa(args.Count),
+	).Replace(text)
+}
+
+// pluralForm returns the CLDR cardinal category of n for integer counts.
+// English uses "one" only for 1; Portuguese also for 0.
+func pluralForm(locale string, n int) string {
+	switch strings.ToLower(baseLanguage(locale)) {
+	case "pt":
+		if n == 0 || n == 1 {
+			return "one"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
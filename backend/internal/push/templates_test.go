@@ -0,0 +1,96 @@
+package push
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+// TestDefaultTemplates checks the embedded catalogs load and that every
+// locale defines every kind the English catalog does.
+func TestDefaultTemplates(t *testing.T) {
+	tmpl := DefaultTemplates()
+	en := tmpl.catalogs[FallbackLocale]
+	for _, kind := range []string{KindGoalReminder, KindCheckInReminder, KindTestNotification, KindStreakAtRisk} {
+		if _, ok := en[kind]; !ok {
+			t.Errorf("en catalog is missing %q", kind)
+		}
+	}
+	for locale, catalog := range tmpl.catalogs {
+		for kind := range en {
+			if _, ok := catalog[kind]; !ok {
+				t.Errorf("%s catalog is missing %q", locale, kind)
+			}
+		}
+	}
+}
+
+func TestTemplates_Render(t *testing.T) {
+	tmpl := DefaultTemplates()
+	cases := []struct {
+		name, locale, kind string
+		args               TemplateArgs
+		title, body        string
+	}{
+		{"goal name substituted", "en", KindGoalReminder, TemplateArgs{Goal: "Read"},
+			"Read", "Did you complete this goal today?"},
+		{"english singular", "en", KindCheckInReminder, TemplateArgs{Count: 1},
+			"Time to check in", "You have 1 goal left to log today."},
+		{"english plural", "en", KindCheckInReminder, TemplateArgs{Count: 3},
+			"Time to check in", "You have 3 goals left to log today."},
+		{"portuguese plural", "pt-BR", KindCheckInReminder, TemplateArgs{Count: 2},
+			"Hora de registrar", "Faltam 2 objetivos para registrar hoje."},
+		{"portuguese treats zero as singular", "pt-BR", KindCheckInReminder, TemplateArgs{Count: 0},
+			"Hora de registrar", "Falta 0 objetivo para registrar hoje."},
+		{"case-insensitive match", "PT-br", KindGoalReminder, TemplateArgs{Goal: "Ler"},
+			"Ler", "Você completou este objetivo hoje?"},
+		{"base language match", "pt-PT", KindTestNotification, TemplateArgs{},
+			"Notificação de teste", "As notificações estão funcionando neste dispositivo."},
+		{"unknown locale falls back to english", "fr", KindTestNotification, TemplateArgs{},
+			"Test notification", "Notifications are working on this device."},
+		{"empty locale falls back to english", "", KindGoalReminder, TemplateArgs{Goal: "Run"},
+			"Run", "Did you complete this goal today?"},
+		{"portuguese plural title", "pt-BR", KindStreakAtRisk, TemplateArgs{Goal: "Ler", Count: 5},
+			"Não perca sua sequência de 5 dias", "Ler ainda não foi feito hoje."},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := tmpl.Render(tc.locale, tc.kind, tc.args)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if n.Title != tc.title || n.Body != tc.body {
+				t.Errorf("got %q / %q, want %q / %q", n.Title, n.Body, tc.title, tc.body)
+			}
+		})
+	}
+
+	if _, err := tmpl.Render("en", "no_such_kind", TemplateArgs{}); err == nil {
+		t.Error("expected an error for an unknown kind")
+	}
+}
+
+func TestLoadTemplates_FallsBackPerKind(t *testing.T) {
+	fsys := fstest.MapFS{
+		"t/en.json": {Data: []byte(`{"a":{"title":"A","body":"a"},"b":{"title":"B","body":{"one":"one b","other":"{count} bs"}}}`)},
+		"t/de.json": {Data: []byte(`{"a":{"title":"A (de)","body":"a (de)"}}`)},
+	}
+	tmpl, err := LoadTemplates(fsys, "t")
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+	n, err := tmpl.Render("de", "b", TemplateArgs{Count: 4})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if n.Title != "B" || n.Body != "4 bs" {
+		t.Errorf("expected the english template for a kind missing in de, got %+v", n)
+	}
+
+	if _, err := LoadTemplates(fstest.MapFS{"t/de.json": fsys["t/de.json"]}, "t"); err == nil {
+		t.Error("expected an error without an en catalog")
+	}
+	bad := fstest.MapFS{"t/en.json": {Data: []byte(`{"a":{"title":"A","body":{"one":"x"}}}`)}}
+	if _, err := LoadTemplates(bad, "t"); err == nil {
+		t.Error("expected an error for plural forms without \"other\"")
+	}
+}
@@ -7,6 +7,10 @@ type Notification struct {
 	Title string            `json:"title"`
 	Body  string            `json:"body"`
 	Data  map[string]string `json:"data,omitempty"`
+	// CollapseKey lets the provider replace an undelivered notification with
+	// a newer one carrying the same key, so a device that was offline
+	// receives only the latest. Empty means no collapsing.
+	CollapseKey string `json:"collapse_key,omitempty"`
 }
 
 // PushService defines the interface for sending push notifications.
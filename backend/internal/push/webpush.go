@@ -0,0 +1,538 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// webPushRecordSize is the aes128gcm record size we advertise. Payloads
+	// are sent as a single record, so this also bounds the notification size.
+	webPushRecordSize = 4096
+	// webPushHeaderSize is the aes128gcm header sent before the record: the
+	// 16-byte salt, the record size, the key length and the 65-byte
+	// ephemeral public key.
+	webPushHeaderSize = 16 + 4 + 1 + 65
+	// webPushMaxPayload is the largest plaintext whose request body, header
+	// included, fits the 4096 bytes push services must accept (RFC 8030
+	// section 7.2), after the padding delimiter and the 16-byte GCM tag.
+	webPushMaxPayload = webPushRecordSize - webPushHeaderSize - 1 - 16
+
+	defaultWebPushTTL         = 24 * time.Hour
+	defaultWebPushConcurrency = 10
+	// vapidTokenLifetime is how long a signed VAPID JWT is valid. RFC 8292
+	// caps this at 24h; push services commonly reject anything longer.
+	vapidTokenLifetime = 12 * time.Hour
+)
+
+// defaultWebPushHosts are the push services of the major browsers, which
+// WebPushConfig.Hosts defaults to. A leading "*." matches any subdomain.
+var defaultWebPushHosts = []string{
+	"fcm.googleapis.com",                // Chrome, Edge, Opera
+	"updates.push.services.mozilla.com", // Firefox
+	"*.notify.windows.com",              // legacy Edge
+	"web.push.apple.com",                // Safari
+}
+
+// WebPushConfig configures a WebPushService.
+type WebPushConfig struct {
+	// VAPIDPrivateKey is the application server's P-256 private key as a
+	// base64url-encoded 32-byte scalar (the format GenerateVAPIDKeys emits).
+	VAPIDPrivateKey string
+	// Subject identifies the sender to push services, a "mailto:" or
+	// "https:" URL (RFC 8292 section 2.1).
+	Subject string
+	// HTTPClient defaults to a client with a 10s timeout.
+	HTTPClient *http.Client
+	// TTL is how long the push service should hold an undelivered message.
+	// Defaults to 24h.
+	TTL time.Duration
+	// Concurrency is the number of parallel sends used by SendMultiple.
+	// Defaults to 10.
+	Concurrency int
+	// Hosts are the push services subscriptions may point at, so a client
+	// cannot make the server post to hosts of its choosing. A leading "*."
+	// matches any subdomain. Defaults to the major browsers' push services.
+	Hosts  []string
+	Logger *slog.Logger
+}
+
+// WebSubscription is a browser PushSubscription as returned by
+// PushSubscription.toJSON(). For the "web" platform the device token stored
+// in device_tokens is this struct encoded by Token.
+type WebSubscription struct {
+	Endpoint string              `json:"endpoint"`
+	Keys     WebSubscriptionKeys `json:"keys"`
+}
+
+// WebSubscriptionKeys holds the subscription's base64url-encoded P-256 public
+// key and 16-byte authentication secret.
+type WebSubscriptionKeys struct {
+	P256dh string `json:"p256dh"`
+	Auth   string `json:"auth"`
+}
+
+// Token encodes the subscription for storage as a device token. The encoding
+// is deterministic, so re-registering the same subscription hits the
+// device_tokens unique constraint instead of adding a row. It checks the
+// subscription's form only; WebPushService.SubscriptionToken also checks
+// that the endpoint is a known push service.
+func (sub WebSubscription) Token() (string, error) {
+	if err := sub.validate(); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(sub)
+	if err != nil {
+		return "", fmt.Errorf("marshal web subscription: %w", err)
+	}
+	return string(b), nil
+}
+
+func (sub WebSubscription) validate() error {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("endpoint must be an https URL")
+	}
+	if key, err := decodeBase64URL(sub.Keys.P256dh); err != nil || len(key) != 65 {
+		return errors.New("keys.p256dh must be a base64url-encoded uncompressed P-256 point")
+	}
+	if auth, err := decodeBase64URL(sub.Keys.Auth); err != nil || len(auth) != 16 {
+		return errors.New("keys.auth must be a base64url-encoded 16-byte secret")
+	}
+	return nil
+}
+
+// ParseWebSubscription decodes a device token produced by
+// WebSubscription.Token.
+func ParseWebSubscription(token string) (*WebSubscription, error) {
+	var sub WebSubscription
+	if err := json.Unmarshal([]byte(token), &sub); err != nil {
+		return nil, fmt.Errorf("parse web subscription: %w", err)
+	}
+	if err := sub.validate(); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// WebPushService delivers notifications to browsers using the Web Push
+// protocol (RFC 8030) with VAPID authentication (RFC 8292) and aes128gcm
+// payload encryption (RFC 8291).
+type WebPushService struct {
+	client      *http.Client
+	key         *ecdsa.PrivateKey
+	publicKey   string
+	subject     string
+	ttl         time.Duration
+	concurrency int
+	hosts       []string
+	logger      *slog.Logger
+	now         func() time.Time
+
+	// Signed VAPID tokens are cached per push service origin.
+	mu     sync.Mutex
+	tokens map[string]vapidToken
+}
+
+type vapidToken struct {
+	jwt     string
+	expires time.Time
+}
+
+// GenerateVAPIDKeys creates a new application server key pair, returning the
+// base64url-encoded private scalar and uncompressed public point. The public
+// key is what browsers pass to pushManager.subscribe as applicationServerKey.
+func GenerateVAPIDKeys() (privateKey, publicKey string, err error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("generate vapid key: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(key.Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// NewWebPushService parses the VAPID private key and returns a service ready
+// to send.
+func NewWebPushService(cfg WebPushConfig) (*WebPushService, error) {
+	if cfg.Subject == "" {
+		return nil, errors.New("web push subject is required")
+	}
+	if !strings.HasPrefix(cfg.Subject, "mailto:") && !strings.HasPrefix(cfg.Subject, "https://") {
+		return nil, errors.New("web push subject must be a mailto: or https: URL")
+	}
+	key, publicKey, err := parseVAPIDPrivateKey(cfg.VAPIDPrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultWebPushTTL
+	}
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultWebPushConcurrency
+	}
+	hosts := cfg.Hosts
+	if len(hosts) == 0 {
+		hosts = defaultWebPushHosts
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &WebPushService{
+		client:      client,
+		key:         key,
+		publicKey:   base64.RawURLEncoding.EncodeToString(publicKey),
+		subject:     cfg.Subject,
+		ttl:         ttl,
+		concurrency: concurrency,
+		hosts:       hosts,
+		logger:      logger,
+		now:         time.Now,
+		tokens:      make(map[string]vapidToken),
+	}, nil
+}
+
+// PublicKey returns the base64url-encoded VAPID public key for clients.
+func (s *WebPushService) PublicKey() string {
+	return s.publicKey
+}
+
+// SubscriptionToken validates sub, including that its endpoint is one of the
+// service's push hosts, and encodes it as a device token.
+func (s *WebPushService) SubscriptionToken(sub WebSubscription) (string, error) {
+	token, err := sub.Token()
+	if err != nil {
+		return "", err
+	}
+	if err := s.checkEndpoint(sub.Endpoint); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// checkEndpoint reports an error unless endpoint is on one of s.hosts.
+func (s *WebPushService) checkEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return errors.New("endpoint must be an https URL")
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range s.hosts {
+		if suffix, ok := strings.CutPrefix(h, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return nil
+			}
+		} else if host == h {
+			return nil
+		}
+	}
+	return fmt.Errorf("endpoint host %q is not a known push service", host)
+}
+
+// parseVAPIDPrivateKey turns a raw base64url P-256 scalar into an ECDSA key
+// and its uncompressed public point.
+func parseVAPIDPrivateKey(encoded string) (*ecdsa.PrivateKey, []byte, error) {
+	raw, err := decodeBase64URL(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decode vapid private key: %w", err)
+	}
+	// crypto/ecdh validates the scalar and derives the public point.
+	ecdhKey, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid vapid private key: %w", err)
+	}
+	pub := ecdhKey.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(pub[1:33]),
+			Y:     new(big.Int).SetBytes(pub[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}
+	return key, pub, nil
+}
+
+// webPushPayload is the JSON document the service worker receives.
+type webPushPayload struct {
+	Title string            `json:"title,omitempty"`
+	Body  string            `json:"body,omitempty"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// Send encrypts the notification for the subscription encoded in token and
+// posts it to the subscription's push service.
+func (s *WebPushService) Send(ctx context.Context, token string, notification *Notification) error {
+	sub, err := ParseWebSubscription(token)
+	if err != nil {
+		return &ProviderError{Provider: "webpush", Kind: ErrInvalidToken, Err: err}
+	}
+	if err := s.checkEndpoint(sub.Endpoint); err != nil {
+		return &ProviderError{Provider: "webpush", Kind: ErrInvalidToken, Err: err}
+	}
+
+	plaintext, err := json.Marshal(webPushPayload{
+		Title: notification.Title,
+		Body:  notification.Body,
+		Data:  notification.Data,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal web push payload: %w", err)
+	}
+	body, err := encryptWebPush(plaintext, sub, rand.Reader)
+	if err != nil {
+		var pe *ProviderError
+		if errors.As(err, &pe) {
+			return pe
+		}
+		return &ProviderError{Provider: "webpush", Kind: ErrInvalidToken, Err: err}
+	}
+
+	endpoint, _ := url.Parse(sub.Endpoint)
+	audience := endpoint.Scheme + "://" + endpoint.Host
+	jwt, err := s.vapidJWT(audience)
+	if err != nil {
+		return fmt.Errorf("sign vapid token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build web push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(s.ttl.Seconds())))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", jwt, s.publicKey))
+	if notification.CollapseKey != "" {
+		// RFC 8030 topics: at most 32 characters of the URL-safe base64 alphabet.
+		req.Header.Set("Topic", notification.CollapseKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &ProviderError{Provider: "webpush", Kind: ErrUnavailable, Err: err}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return classifyWebPushError(resp)
+}
+
+// classifyWebPushError maps a push service response onto the push error
+// sentinels. Push services report state through status codes only
+// (RFC 8030 section 8); 404 and 410 mean the subscription is gone.
+func classifyWebPushError(resp *http.Response) *ProviderError {
+	pe := &ProviderError{Provider: "webpush", Status: resp.StatusCode, Reason: http.StatusText(resp.StatusCode)}
+	if ra := resp.Header.Get("Retry-After"); ra != "" {
+		if secs, err := strconv.Atoi(ra); err == nil {
+			pe.RetryAfter = time.Duration(secs) * time.Second
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		pe.Kind = ErrUnregistered
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		pe.Kind = ErrAuth
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		pe.Kind = ErrUnavailable
+	default:
+		pe.Kind = ErrRejected
+	}
+	return pe
+}
+
+// SendMultiple sends to every subscription with bounded concurrency.
+func (s *WebPushService) SendMultiple(ctx context.Context, tokens []string, notification *Notification) map[string]error {
+	var (
+		mu     sync.Mutex
+		failed = make(map[string]error)
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, s.concurrency)
+	)
+	for _, token := range tokens {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(token string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := s.Send(ctx, token, notification); err != nil {
+				s.logger.Warn("web push send failed", slog.String("error", err.Error()))
+				mu.Lock()
+				failed[token] = err
+				mu.Unlock()
+			}
+		}(token)
+	}
+	wg.Wait()
+	return failed
+}
+
+// vapidJWT returns a signed ES256 token for the given push service origin,
+// reusing a cached one until it is within an hour of expiring.
+func (s *WebPushService) vapidJWT(audience string) (string, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok, ok := s.tokens[audience]; ok && now.Add(time.Hour).Before(tok.expires) {
+		return tok.jwt, nil
+	}
+
+	expires := now.Add(vapidTokenLifetime)
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": audience,
+		"exp": expires.Unix(),
+		"sub": s.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	sig, err := signES256(s.key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	jwt := signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+	s.tokens[audience] = vapidToken{jwt: jwt, expires: expires}
+	return jwt, nil
+}
+
+// signES256 produces a JWS ES256 signature: the raw 64-byte r||s
+// concatenation rather than the ASN.1 form crypto/ecdsa returns.
+func signES256(key *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+	r, sVal, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	sVal.FillBytes(sig[32:])
+	return sig, nil
+}
+
+// encryptWebPush encrypts plaintext for the subscription as a single
+// aes128gcm record (RFC 8188) using the Web Push key derivation of RFC 8291.
+// random supplies the ephemeral key and salt; tests pass a fixed reader to
+// reproduce the RFC 8291 appendix A vector.
+func encryptWebPush(plaintext []byte, sub *WebSubscription, random io.Reader) ([]byte, error) {
+	if len(plaintext) > webPushMaxPayload {
+		return nil, &ProviderError{Provider: "webpush", Kind: ErrRejected, Reason: "payload too large"}
+	}
+	uaPublicRaw, err := decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("decode p256dh: %w", err)
+	}
+	authSecret, err := decodeBase64URL(sub.Keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("decode auth: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicRaw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh: %w", err)
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(random)
+	if err != nil {
+		return nil, fmt.Errorf("generate ephemeral key: %w", err)
+	}
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	return sealWebPush(plaintext, uaPublic, authSecret, asPrivate, salt)
+}
+
+func sealWebPush(plaintext []byte, uaPublic *ecdh.PublicKey, authSecret []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("ecdh: %w", err)
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	// RFC 8291 section 3.4: mix the auth secret into the shared secret.
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic.Bytes()...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+
+	// RFC 8188 section 2.2: content encryption key and nonce.
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// A single, final record: plaintext followed by the 0x02 delimiter.
+	record := append(append([]byte{}, plaintext...), 0x02)
+
+	header := make([]byte, 0, webPushHeaderSize)
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+// hkdf is HKDF-SHA256 (RFC 5869) limited to a single output block, which is
+// all Web Push needs.
+func hkdf(salt, secret, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{0x01})
+	return expand.Sum(nil)[:length]
+}
+
+// decodeBase64URL accepts base64url with or without padding, which is how
+// browsers and key generators variously emit keys.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// Ensure WebPushService implements PushService
+var _ PushService = (*WebPushService)(nil)
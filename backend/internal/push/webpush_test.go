@@ -0,0 +1,366 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func b64(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := decodeBase64URL(s)
+	if err != nil {
+		t.Fatalf("decode %q: %v", s, err)
+	}
+	return b
+}
+
+// TestSealWebPush_RFC8291Vector checks the encryption against the worked
+// example in RFC 8291 appendix A.
+func TestSealWebPush_RFC8291Vector(t *testing.T) {
+	asPrivate, err := ecdh.P256().NewPrivateKey(b64(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatalf("as private: %v", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(b64(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"))
+	if err != nil {
+		t.Fatalf("ua public: %v", err)
+	}
+	authSecret := b64(t, "BTBZMqHH6r4Tts7J_aSIgg")
+	salt := b64(t, "DGv6ra1nlYgDCS1FRnbzlw")
+
+	got, err := sealWebPush([]byte("When I grow up, I want to be a watermelon"), uaPublic, authSecret, asPrivate, salt)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if enc := base64.RawURLEncoding.EncodeToString(got); enc != want {
+		t.Errorf("ciphertext mismatch\n got: %s\nwant: %s", enc, want)
+	}
+}
+
+func TestEncryptWebPush_LargestPayloadFitsOneRequest(t *testing.T) {
+	sub := &WebSubscription{Keys: WebSubscriptionKeys{
+		P256dh: "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4",
+		Auth:   "BTBZMqHH6r4Tts7J_aSIgg",
+	}}
+
+	body, err := encryptWebPush(make([]byte, webPushMaxPayload), sub, rand.Reader)
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	if webPushMaxPayload != 3993 || len(body) != 4096 {
+		t.Errorf("expected a %d-byte payload to make a 4096-byte body, got %d bytes", webPushMaxPayload, len(body))
+	}
+	if _, err := encryptWebPush(make([]byte, webPushMaxPayload+1), sub, rand.Reader); !errors.Is(err, ErrRejected) {
+		t.Errorf("expected a larger payload rejected, got %v", err)
+	}
+}
+
+// fakePushEndpoint stands in for a browser vendor's push service: it checks
+// the VAPID header, decrypts the payload with the subscriber's private key
+// and records what it received.
+type fakePushEndpoint struct {
+	server     *httptest.Server
+	uaPrivate  *ecdh.PrivateKey
+	authSecret []byte
+	status     int
+
+	mu       sync.Mutex
+	payloads []webPushPayload
+	authz    []string
+}
+
+func newFakePushEndpoint(t *testing.T) *fakePushEndpoint {
+	t.Helper()
+	uaPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ua key: %v", err)
+	}
+	f := &fakePushEndpoint{uaPrivate: uaPrivate, authSecret: make([]byte, 16), status: http.StatusCreated}
+	rand.Read(f.authSecret)
+
+	f.server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+			http.Error(w, "missing headers", http.StatusBadRequest)
+			return
+		}
+		plaintext, err := f.decrypt(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var p webPushPayload
+		if err := json.Unmarshal(plaintext, &p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.payloads = append(f.payloads, p)
+		f.authz = append(f.authz, r.Header.Get("Authorization"))
+		status := f.status
+		f.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// host is the fake's address, which its services accept as a push host.
+func (f *fakePushEndpoint) host() string {
+	return f.server.Listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+func (f *fakePushEndpoint) subscription(path string) WebSubscription {
+	return WebSubscription{
+		Endpoint: f.server.URL + path,
+		Keys: WebSubscriptionKeys{
+			P256dh: base64.RawURLEncoding.EncodeToString(f.uaPrivate.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(f.authSecret),
+		},
+	}
+}
+
+// decrypt is the user-agent side of RFC 8291.
+func (f *fakePushEndpoint) decrypt(body []byte) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, errors.New("short body")
+	}
+	salt := body[:16]
+	rs := binary.BigEndian.Uint32(body[16:20])
+	idlen := int(body[20])
+	if rs != webPushRecordSize || len(body) < 21+idlen {
+		return nil, errors.New("bad header")
+	}
+	asPublic, err := ecdh.P256().NewPublicKey(body[21 : 21+idlen])
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := f.uaPrivate.ECDH(asPublic)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := append([]byte("WebPush: info\x00"), f.uaPrivate.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, asPublic.Bytes()...)
+	ikm := hkdf(f.authSecret, ecdhSecret, keyInfo, 32)
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	record, err := gcm.Open(nil, nonce, body[21+idlen:], nil)
+	if err != nil {
+		return nil, err
+	}
+	// Strip padding back to the 0x02 last-record delimiter.
+	i := bytes.LastIndexByte(record, 0x02)
+	if i < 0 {
+		return nil, errors.New("missing delimiter")
+	}
+	return record[:i], nil
+}
+
+func newTestWebPushService(t *testing.T, f *fakePushEndpoint) *WebPushService {
+	t.Helper()
+	priv, _, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("generate vapid keys: %v", err)
+	}
+	svc, err := NewWebPushService(WebPushConfig{
+		VAPIDPrivateKey: priv,
+		Subject:         "mailto:test@example.com",
+		HTTPClient:      f.server.Client(),
+		Hosts:           []string{f.host()},
+	})
+	if err != nil {
+		t.Fatalf("NewWebPushService: %v", err)
+	}
+	return svc
+}
+
+// verifyVAPID checks the "vapid t=<jwt>, k=<key>" header signature and claims.
+func verifyVAPID(t *testing.T, header, publicKey, audience string) {
+	t.Helper()
+	if !strings.HasPrefix(header, "vapid t=") {
+		t.Fatalf("unexpected authorization header %q", header)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(header, "vapid t="), ", k=", 2)
+	if len(parts) != 2 || parts[1] != publicKey {
+		t.Fatalf("authorization header does not carry the public key: %q", header)
+	}
+	segs := strings.Split(parts[0], ".")
+	if len(segs) != 3 {
+		t.Fatalf("malformed jwt %q", parts[0])
+	}
+
+	pub := b64(t, publicKey)
+	key := ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(pub[1:33]), Y: new(big.Int).SetBytes(pub[33:])}
+	sig := b64(t, segs[2])
+	digest := sha256.Sum256([]byte(segs[0] + "." + segs[1]))
+	if len(sig) != 64 || !ecdsa.Verify(&key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Fatal("vapid jwt signature does not verify")
+	}
+
+	var claims struct {
+		Aud string `json:"aud"`
+		Sub string `json:"sub"`
+		Exp int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(b64(t, segs[1]), &claims); err != nil {
+		t.Fatalf("decode claims: %v", err)
+	}
+	if claims.Aud != audience || claims.Sub != "mailto:test@example.com" || claims.Exp == 0 {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestWebPushService_SendDeliversEncryptedPayload(t *testing.T) {
+	f := newFakePushEndpoint(t)
+	svc := newTestWebPushService(t, f)
+
+	token, err := f.subscription("/push/abc").Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	n := &Notification{Title: "Read", Body: "Did you complete this goal today?", Data: map[string]string{"goal_id": "g1"}}
+	if err := svc.Send(context.Background(), token, n); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if len(f.payloads) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(f.payloads))
+	}
+	got := f.payloads[0]
+	if got.Title != n.Title || got.Body != n.Body || got.Data["goal_id"] != "g1" {
+		t.Errorf("unexpected payload %+v", got)
+	}
+	verifyVAPID(t, f.authz[0], svc.PublicKey(), f.server.URL)
+}
+
+func TestWebPushService_ClassifiesErrors(t *testing.T) {
+	cases := []struct {
+		status int
+		kind   error
+	}{
+		{http.StatusGone, ErrUnregistered},
+		{http.StatusNotFound, ErrUnregistered},
+		{http.StatusTooManyRequests, ErrUnavailable},
+		{http.StatusForbidden, ErrAuth},
+		{http.StatusRequestEntityTooLarge, ErrRejected},
+	}
+	for _, tc := range cases {
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			f := newFakePushEndpoint(t)
+			f.status = tc.status
+			svc := newTestWebPushService(t, f)
+			token, _ := f.subscription("/push/x").Token()
+
+			err := svc.Send(context.Background(), token, &Notification{Title: "t"})
+			if !errors.Is(err, tc.kind) {
+				t.Errorf("expected %v, got %v", tc.kind, err)
+			}
+		})
+	}
+}
+
+func TestWebPushService_RejectsMalformedToken(t *testing.T) {
+	f := newFakePushEndpoint(t)
+	svc := newTestWebPushService(t, f)
+
+	err := svc.Send(context.Background(), "not-a-subscription", &Notification{Title: "t"})
+	if !IsTokenDead(err) {
+		t.Errorf("expected a dead-token error, got %v", err)
+	}
+}
+
+func TestWebSubscription_TokenValidates(t *testing.T) {
+	f := newFakePushEndpoint(t)
+	good := f.subscription("/push/ok")
+
+	token, err := good.Token()
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	parsed, err := ParseWebSubscription(token)
+	if err != nil || parsed.Endpoint != good.Endpoint {
+		t.Fatalf("round trip failed: %+v, %v", parsed, err)
+	}
+
+	bad := good
+	bad.Endpoint = "http://insecure.example.com/push"
+	if _, err := bad.Token(); err == nil {
+		t.Error("expected non-https endpoint to be rejected")
+	}
+	bad = good
+	bad.Keys.Auth = "short"
+	if _, err := bad.Token(); err == nil {
+		t.Error("expected short auth secret to be rejected")
+	}
+}
+
+func TestWebPushService_SubscriptionTokenChecksHost(t *testing.T) {
+	f := newFakePushEndpoint(t)
+	priv, _, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatalf("generate vapid keys: %v", err)
+	}
+	svc, err := NewWebPushService(WebPushConfig{VAPIDPrivateKey: priv, Subject: "mailto:test@example.com"})
+	if err != nil {
+		t.Fatalf("NewWebPushService: %v", err)
+	}
+
+	sub := f.subscription("/push/ok")
+	for _, endpoint := range []string{
+		"https://169.254.169.254/latest/meta-data",
+		"https://localhost/push",
+		"https://internal.example.com/push",
+		"https://notify.windows.com.evil.example/push",
+		sub.Endpoint, // the fake is only a push host for its own services
+	} {
+		bad := sub
+		bad.Endpoint = endpoint
+		if _, err := svc.SubscriptionToken(bad); err == nil {
+			t.Errorf("expected endpoint %s to be rejected", endpoint)
+		}
+	}
+	for _, endpoint := range []string{
+		"https://fcm.googleapis.com/fcm/send/abc",
+		"https://updates.push.services.mozilla.com/wpush/v2/abc",
+		"https://wns2-by3p.notify.windows.com/w/?token=abc",
+		"https://web.push.apple.com/abc",
+	} {
+		ok := sub
+		ok.Endpoint = endpoint
+		if _, err := svc.SubscriptionToken(ok); err != nil {
+			t.Errorf("expected endpoint %s to be accepted, got %v", endpoint, err)
+		}
+	}
+
+	// A stored token for a host the service does not accept is dead.
+	token, _ := sub.Token()
+	if err := svc.Send(context.Background(), token, &Notification{Title: "t"}); !IsTokenDead(err) {
+		t.Errorf("expected a dead-token error, got %v", err)
+	}
+	if len(f.payloads) != 0 {
+		t.Errorf("expected nothing posted to an unknown host, got %d", len(f.payloads))
+	}
+}
@@ -0,0 +1,190 @@
+// Package rank generates lexicographic sort keys for ordered lists. A new key
+// can be made between any two others, so moving an item rewrites only that
+// item's key.
+//
+// Keys are strings of base-62 digits read as fractions: "V" is about one
+// half, "0V" about one 124th. Comparing keys as strings orders them.
+package rank
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// digits are the key digits, in ascending byte order.
+const digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// MaxLength is the key length past which a list should be rebalanced.
+const MaxLength = 24
+
+// positionWidth is the length of keys made by FromPosition.
+const positionWidth = 6
+
+// FromPosition returns the key for an integer position, for items written by
+// clients that only know positions. Keys of increasing positions increase.
+func FromPosition(position int) string {
+	return fmt.Sprintf("%0*d", positionWidth, max(position, 0))
+}
+
+// Valid reports whether key is a non-empty string of key digits.
+func Valid(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(digits, key[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Between returns a key that sorts after a and before b. An empty a or b
+// leaves that side open. It returns false if no key fits, because b is not
+// after a or differs from it only by trailing zeros; the list must then be
+// rebalanced.
+func Between(a, b string) (string, bool) {
+	if b != "" && a >= b {
+		return "", false
+	}
+	return between(a, b)
+}
+
+func between(a, b string) (string, bool) {
+	if b == "" {
+		return after(a), true
+	}
+
+	// Skip the common prefix, reading a as zeros past its end.
+	n := 0
+	for n < len(b) && digitAt(a, n) == b[n] {
+		n++
+	}
+	if n == len(b) {
+		return "", false
+	}
+	if n > 0 {
+		rest, ok := between(tail(a, n), b[n:])
+		return b[:n] + rest, ok
+	}
+
+	da, db := value(digitAt(a, 0)), value(b[0])
+	if db-da > 1 {
+		return string(digits[(da+db)/2]), true
+	}
+	if len(b) > 1 {
+		return b[:1], true
+	}
+	// The first digits are adjacent: keep a's and go one digit deeper,
+	// halfway up if a ends here.
+	rest := tail(a, 1)
+	if rest == "" {
+		return string(digits[da]) + string(digits[len(digits)/2]), true
+	}
+	return string(digits[da]) + after(rest), true
+}
+
+// after returns a short key that sorts after a.
+func after(a string) string {
+	for i := 0; i < len(a); i++ {
+		if a[i] != digits[len(digits)-1] {
+			return a[:i] + string(digits[value(a[i])+1])
+		}
+	}
+	return a + string(digits[1])
+}
+
+func digitAt(key string, i int) byte {
+	if i < len(key) {
+		return key[i]
+	}
+	return digits[0]
+}
+
+func tail(key string, n int) string {
+	if n >= len(key) {
+		return ""
+	}
+	return key[n:]
+}
+
+func value(digit byte) int {
+	return strings.IndexByte(digits, digit)
+}
+
+// Item is an entry of a list being reordered.
+type Item struct {
+	ID  string
+	Key string
+}
+
+// less orders items by key, then by ID, since concurrent moves can give two
+// items the same key.
+func less(a, b Item) bool {
+	if a.Key != b.Key {
+		return a.Key < b.Key
+	}
+	return a.ID < b.ID
+}
+
+// Reorder returns keys that put items in the order given, keeping as many
+// of their current keys as possible: the longest run of items already in
+// order keeps its keys and only the others move. It returns false if a key
+// could not be made or grew longer than MaxLength; rebalance and retry.
+func Reorder(items []Item) ([]string, bool) {
+	keep := inOrder(items)
+
+	keys := make([]string, len(items))
+	for i, item := range items {
+		if keep[i] {
+			keys[i] = item.Key
+			continue
+		}
+		lower := ""
+		if i > 0 {
+			lower = keys[i-1]
+		}
+		upper := ""
+		for j := i + 1; j < len(items); j++ {
+			if keep[j] {
+				upper = items[j].Key
+				break
+			}
+		}
+		key, ok := Between(lower, upper)
+		if !ok || len(key) > MaxLength {
+			return nil, false
+		}
+		keys[i] = key
+	}
+	return keys, true
+}
+
+// inOrder marks a longest subsequence of items that is already in order.
+func inOrder(items []Item) []bool {
+	// tails[k] is the index of the smallest item ending an ordered
+	// subsequence of length k+1; prev links each item to the one before it.
+	var tails []int
+	prev := make([]int, len(items))
+	for i, item := range items {
+		k := sort.Search(len(tails), func(k int) bool { return !less(items[tails[k]], item) })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	keep := make([]bool, len(items))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			keep[i] = true
+		}
+	}
+	return keep
+}
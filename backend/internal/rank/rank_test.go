@@ -0,0 +1,98 @@
+package rank
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBetween_SortsBetweenItsBounds(t *testing.T) {
+	cases := []struct{ a, b string }{
+		{"", ""},
+		{"", "V"},
+		{"V", ""},
+		{"1", "2"},
+		{"19", "2"},
+		{"000003", "000004"},
+		{"", "000001"},
+		{"z", ""},
+		{"zz", ""},
+		{"0000019", "00002"},
+	}
+	for _, tc := range cases {
+		key, ok := Between(tc.a, tc.b)
+		if !ok {
+			t.Errorf("Between(%q, %q): expected a key", tc.a, tc.b)
+			continue
+		}
+		if !Valid(key) || key <= tc.a || (tc.b != "" && key >= tc.b) || key[len(key)-1] == '0' {
+			t.Errorf("Between(%q, %q) = %q", tc.a, tc.b, key)
+		}
+	}
+}
+
+func TestBetween_FailsWithoutRoom(t *testing.T) {
+	for _, tc := range []struct{ a, b string }{
+		{"V", "V"},
+		{"k", "V"},
+		{"1", "10"},
+		{"", "000000"},
+	} {
+		if key, ok := Between(tc.a, tc.b); ok {
+			t.Errorf("Between(%q, %q): expected no key, got %q", tc.a, tc.b, key)
+		}
+	}
+}
+
+func TestBetween_RepeatedInsertsStayShort(t *testing.T) {
+	// Appending and prepending are the common moves.
+	last, first := "V", "V"
+	for i := 0; i < 100; i++ {
+		last, _ = Between(last, "")
+		first, _ = Between("", first)
+	}
+	if len(last) > 3 || len(first) > MaxLength {
+		t.Errorf("expected short keys, got %q and %q", last, first)
+	}
+}
+
+func TestReorder_MovesOnlyWhatItMust(t *testing.T) {
+	items := []Item{
+		{ID: "c", Key: FromPosition(3)},
+		{ID: "a", Key: FromPosition(1)},
+		{ID: "b", Key: FromPosition(2)},
+		{ID: "d", Key: FromPosition(4)},
+	}
+	keys, ok := Reorder(items)
+	if !ok {
+		t.Fatal("expected keys")
+	}
+	moved := 0
+	for i := range items {
+		if keys[i] != items[i].Key {
+			moved++
+		}
+		if i > 0 && keys[i] <= keys[i-1] {
+			t.Errorf("keys out of order: %v", keys)
+		}
+	}
+	if moved != 1 {
+		t.Errorf("expected only c to move, got %v", keys)
+	}
+}
+
+func TestReorder_NeedsRebalanceForTiedKeys(t *testing.T) {
+	// Two items share a key; nothing fits between them.
+	items := []Item{{ID: "a", Key: "V"}, {ID: "c", Key: "k"}, {ID: "b", Key: "V"}}
+	if keys, ok := Reorder(items); ok {
+		t.Errorf("expected a rebalance, got %v", keys)
+	}
+	if _, ok := Reorder([]Item{{ID: "a", Key: "V"}, {ID: "b", Key: "V"}}); !ok {
+		t.Errorf("expected tied keys in ID order to be kept")
+	}
+}
+
+func ExampleBetween() {
+	key, _ := Between("000003", "000004")
+	fmt.Println(key)
+	// Output: 000003V
+}
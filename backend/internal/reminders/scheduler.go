@@ -0,0 +1,264 @@
+// Package reminders computes which server-side reminder schedules are due and
+// queues them in the push outbox.
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/push"
+)
+
+// DefaultGracePeriod bounds how late a reminder may still be delivered. If the
+// scheduler was down when a reminder came due, anything older than this is
+// dropped rather than arriving hours late.
+const DefaultGracePeriod = time.Hour
+
+// Scheduler finds reminders whose wall-clock time has passed in the owner's
+// timezone and queues them for the owner's registered devices.
+type Scheduler struct {
+	db        db.Database
+	outbox    *push.Outbox
+	templates *push.Templates
+	logger    *slog.Logger
+	grace     time.Duration
+	now       func() time.Time
+}
+
+// recipient is the per-user context a reminder is rendered in.
+type recipient struct {
+	loc    *time.Location
+	locale string
+}
+
+// NewScheduler creates a reminder scheduler.
+func NewScheduler(database db.Database, outbox *push.Outbox, logger *slog.Logger) *Scheduler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Scheduler{
+		db:        database,
+		outbox:    outbox,
+		templates: push.DefaultTemplates(),
+		logger:    logger,
+		grace:     DefaultGracePeriod,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// RunOnce performs a single scheduling pass: every enabled reminder that has
+// come due since it was last sent is either queued or skipped (because the
+// goal is already done today) and then marked as handled.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	reminders, err := s.db.ListEnabledReminders()
+	if err != nil {
+		return fmt.Errorf("list enabled reminders: %w", err)
+	}
+
+	now := s.now()
+	recipients := map[string]recipient{}
+
+	for _, r := range reminders {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		to, ok := recipients[r.UserID]
+		if !ok {
+			to = s.recipient(r.UserID)
+			recipients[r.UserID] = to
+		}
+
+		occurrence, err := LastOccurrence(r, now, to.loc)
+		if err != nil {
+			s.logger.Warn("invalid reminder schedule", slog.String("reminder_id", r.ID), slog.String("error", err.Error()))
+			continue
+		}
+		if !s.isDue(r, occurrence, now) {
+			continue
+		}
+
+		if err := s.deliver(r, occurrence, now, occurrence.In(to.loc).Format("2006-01-02"), to.locale); err != nil {
+			s.logger.Error("reminder enqueue failed", slog.String("reminder_id", r.ID), slog.String("error", err.Error()))
+			continue
+		}
+	}
+	return nil
+}
+
+// isDue reports whether the occurrence still needs handling: it is recent
+// enough, was not already sent, and was scheduled after the reminder was last
+// edited (so saving a 08:00 reminder at 08:30 doesn't fire immediately).
+func (s *Scheduler) isDue(r models.Reminder, occurrence, now time.Time) bool {
+	if now.Sub(occurrence) > s.grace {
+		return false
+	}
+	if occurrence.Before(r.UpdatedAt) {
+		return false
+	}
+	return r.LastSentAt == nil || r.LastSentAt.Before(occurrence)
+}
+
+// deliver claims the occurrence and queues the reminder, rendered in
+// locale, unless the relevant goal(s) are already completed on the given
+// local date. Claiming and queueing happen together, so the occurrence is
+// queued once even when several schedulers run.
+func (s *Scheduler) deliver(r models.Reminder, occurrence, now time.Time, day, locale string) error {
+	notification, skip, err := s.buildNotification(r, day, locale)
+	if err != nil {
+		return err
+	}
+	var entries []models.PushOutboxEntry
+	if !skip {
+		entries, err = s.outbox.Entries(r.UserID, "reminder", notification)
+		if err != nil {
+			return err
+		}
+	}
+
+	claimed, err := s.db.ClaimReminder(r.ID, occurrence, now, entries)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+	if skip {
+		s.logger.Info("reminder skipped, already completed", slog.String("reminder_id", r.ID), slog.String("user_id", r.UserID))
+		return nil
+	}
+	s.logger.Info("reminder queued",
+		slog.String("reminder_id", r.ID),
+		slog.String("user_id", r.UserID),
+		slog.Int("devices", len(entries)),
+	)
+	return nil
+}
+
+// buildNotification returns the reminder's notification, or skip=true when
+// there is nothing left to remind about for that day.
+func (s *Scheduler) buildNotification(r models.Reminder, day, locale string) (*push.Notification, bool, error) {
+	userID := r.UserID
+	data := map[string]string{"type": "reminder", "reminder_id": r.ID}
+
+	if r.GoalID != nil {
+		goal, err := s.db.GetGoal(&userID, *r.GoalID)
+		if err != nil {
+			return nil, false, fmt.Errorf("get goal: %w", err)
+		}
+		if goal == nil || goal.ArchivedAt != nil || goal.DeletedAt != nil {
+			return nil, true, nil
+		}
+		completions, err := s.db.ListCompletions(&userID, day, day, r.GoalID)
+		if err != nil {
+			return nil, false, fmt.Errorf("list completions: %w", err)
+		}
+		if len(completions) > 0 {
+			return nil, true, nil
+		}
+		data["goal_id"] = goal.ID
+		n, err := s.templates.Render(locale, push.KindGoalReminder, push.TemplateArgs{Goal: goal.Name})
+		if err != nil {
+			return nil, false, err
+		}
+		n.Data = data
+		return n, false, nil
+	}
+
+	goals, err := s.db.ListGoals(&userID, false)
+	if err != nil {
+		return nil, false, fmt.Errorf("list goals: %w", err)
+	}
+	completions, err := s.db.ListCompletions(&userID, day, day, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("list completions: %w", err)
+	}
+	done := make(map[string]bool, len(completions))
+	for _, c := range completions {
+		done[c.GoalID] = true
+	}
+	pending := 0
+	for _, g := range goals {
+		if !done[g.ID] {
+			pending++
+		}
+	}
+	if pending == 0 {
+		return nil, true, nil
+	}
+	n, err := s.templates.Render(locale, push.KindCheckInReminder, push.TemplateArgs{Count: pending})
+	if err != nil {
+		return nil, false, err
+	}
+	n.Data = data
+	return n, false, nil
+}
+
+// recipient resolves the user's timezone and locale, falling back to UTC and
+// English for unknown users or zone names the runtime can't load.
+func (s *Scheduler) recipient(userID string) recipient {
+	to := recipient{loc: time.UTC, locale: push.FallbackLocale}
+	user, err := s.db.GetUserByID(userID)
+	if err != nil || user == nil {
+		return to
+	}
+	if user.Locale != "" {
+		to.locale = user.Locale
+	}
+	if user.Timezone != "" {
+		if loc, err := time.LoadLocation(user.Timezone); err == nil {
+			to.loc = loc
+		}
+	}
+	return to
+}
+
+// LastOccurrence returns the most recent scheduled time of r at or before now,
+// evaluated as wall-clock time in loc. DST gaps are normalised by time.Date.
+func LastOccurrence(r models.Reminder, now time.Time, loc *time.Location) (time.Time, error) {
+	hour, minute, err := ParseTimeOfDay(r.Time)
+	if err != nil {
+		return time.Time{}, err
+	}
+	local := now.In(loc)
+	candidate := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc)
+
+	switch r.Frequency {
+	case "daily":
+		if candidate.After(local) {
+			candidate = candidate.AddDate(0, 0, -1)
+		}
+	case "weekly":
+		back := (int(local.Weekday()) - r.Weekday + 7) % 7
+		candidate = candidate.AddDate(0, 0, -back)
+		if candidate.After(local) {
+			candidate = candidate.AddDate(0, 0, -7)
+		}
+	default:
+		return time.Time{}, fmt.Errorf("unknown frequency %q", r.Frequency)
+	}
+	return candidate, nil
+}
+
+// ParseTimeOfDay parses a 24-hour "HH:MM" string.
+func ParseTimeOfDay(s string) (hour, minute int, err error) {
+	h, m, ok := strings.Cut(s, ":")
+	if !ok || len(h) != 2 || len(m) != 2 {
+		return 0, 0, fmt.Errorf("invalid time %q: expected HH:MM", s)
+	}
+	hour, err = strconv.Atoi(h)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("invalid hour in %q", s)
+	}
+	minute, err = strconv.Atoi(m)
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid minute in %q", s)
+	}
+	return hour, minute, nil
+}
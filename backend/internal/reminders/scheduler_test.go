@@ -0,0 +1,307 @@
+package reminders
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/push"
+)
+
+// recordingPush captures every notification instead of sending it.
+type recordingPush struct {
+	mu   sync.Mutex
+	sent []sentNotification
+}
+
+type sentNotification struct {
+	token        string
+	notification *push.Notification
+}
+
+func (p *recordingPush) Send(ctx context.Context, token string, n *push.Notification) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, sentNotification{token, n})
+	return nil
+}
+
+func (p *recordingPush) SendMultiple(ctx context.Context, tokens []string, n *push.Notification) map[string]error {
+	for _, t := range tokens {
+		p.Send(ctx, t, n)
+	}
+	return nil
+}
+
+func (p *recordingPush) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sent)
+}
+
+// runPass runs one scheduler pass and then drains the outbox it fed.
+func runPass(t *testing.T, s *Scheduler) {
+	t.Helper()
+	if err := s.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if _, err := s.outbox.RunOnce(context.Background()); err != nil {
+		t.Fatalf("outbox RunOnce: %v", err)
+	}
+}
+
+func setupScheduler(t *testing.T, timezone string) (*Scheduler, *recordingPush, db.Database, string) {
+	t.Helper()
+	database, err := db.NewSQLite(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	user, err := database.GetOrCreateUserByProvider("test", "rem", "rem@test.com", "Rem", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := database.UpdateUserTimezone(user.ID, timezone); err != nil {
+		t.Fatalf("update timezone: %v", err)
+	}
+	if _, err := database.CreateDeviceToken(user.ID, "device-token", "android"); err != nil {
+		t.Fatalf("create device token: %v", err)
+	}
+
+	p := &recordingPush{}
+	outbox := push.NewOutbox(database, push.NewDelivery(database, push.NewDispatcher(p), nil), nil)
+	return NewScheduler(database, outbox, nil), p, database, user.ID
+}
+
+func TestLastOccurrence(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	// Wednesday 2026-03-11 22:30 UTC == 19:30 in São Paulo (UTC-3)
+	now := time.Date(2026, 3, 11, 22, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		r    models.Reminder
+		loc  *time.Location
+		want time.Time
+	}{
+		{"daily earlier today", models.Reminder{Frequency: "daily", Time: "19:00"}, saoPaulo,
+			time.Date(2026, 3, 11, 19, 0, 0, 0, saoPaulo)},
+		{"daily later today falls back to yesterday", models.Reminder{Frequency: "daily", Time: "20:00"}, saoPaulo,
+			time.Date(2026, 3, 10, 20, 0, 0, 0, saoPaulo)},
+		{"daily evaluated in UTC", models.Reminder{Frequency: "daily", Time: "20:00"}, time.UTC,
+			time.Date(2026, 3, 11, 20, 0, 0, 0, time.UTC)},
+		{"weekly same weekday earlier", models.Reminder{Frequency: "weekly", Time: "08:00", Weekday: 3}, saoPaulo,
+			time.Date(2026, 3, 11, 8, 0, 0, 0, saoPaulo)},
+		{"weekly same weekday later goes back a week", models.Reminder{Frequency: "weekly", Time: "21:00", Weekday: 3}, saoPaulo,
+			time.Date(2026, 3, 4, 21, 0, 0, 0, saoPaulo)},
+		{"weekly sunday", models.Reminder{Frequency: "weekly", Time: "10:00", Weekday: 0}, saoPaulo,
+			time.Date(2026, 3, 8, 10, 0, 0, 0, saoPaulo)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := LastOccurrence(tc.r, now, tc.loc)
+			if err != nil {
+				t.Fatalf("LastOccurrence: %v", err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("want %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseTimeOfDay_RejectsInvalid(t *testing.T) {
+	for _, in := range []string{"", "7:00", "24:00", "12:60", "ab:cd", "12-30"} {
+		if _, _, err := ParseTimeOfDay(in); err == nil {
+			t.Errorf("ParseTimeOfDay(%q): expected error", in)
+		}
+	}
+}
+
+func TestRunOnce_SendsDueReminderOnce(t *testing.T) {
+	s, p, database, userID := setupScheduler(t, "UTC")
+
+	goalID := "goal-1"
+	if err := database.CreateGoal(&models.Goal{ID: goalID, Name: "Read", Color: "#000000", UserID: &userID, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+	r := &models.Reminder{UserID: userID, GoalID: &goalID, Frequency: "daily", Time: "20:00", Enabled: true}
+	if err := database.CreateReminder(r); err != nil {
+		t.Fatalf("create reminder: %v", err)
+	}
+
+	// Pretend the reminder was saved yesterday and it's now 20:05 UTC.
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	s.now = func() time.Time {
+		return time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 20, 5, 0, 0, time.UTC)
+	}
+
+	runPass(t, s)
+	if p.count() != 1 {
+		t.Fatalf("expected 1 notification, got %d", p.count())
+	}
+	if p.sent[0].token != "device-token" || p.sent[0].notification.Data["goal_id"] != goalID {
+		t.Errorf("unexpected notification: %+v", p.sent[0])
+	}
+
+	// A second pass for the same occurrence must not resend.
+	runPass(t, s)
+	if p.count() != 1 {
+		t.Errorf("expected reminder to be sent once, got %d", p.count())
+	}
+}
+
+// staleReminders serves a reminder list read before another scheduler's
+// pass, as a concurrent replica would see it.
+type staleReminders struct {
+	db.Database
+	reminders []models.Reminder
+}
+
+func (s staleReminders) ListEnabledReminders() ([]models.Reminder, error) {
+	return s.reminders, nil
+}
+
+func TestRunOnce_ConcurrentSchedulersSendOnce(t *testing.T) {
+	s, p, database, userID := setupScheduler(t, "UTC")
+
+	r := &models.Reminder{UserID: userID, Frequency: "daily", Time: "20:00", Enabled: true}
+	if err := database.CreateReminder(r); err != nil {
+		t.Fatalf("create reminder: %v", err)
+	}
+	if err := database.CreateGoal(&models.Goal{ID: "goal-1", Name: "Read", Color: "#000000", UserID: &userID, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+	reminders, err := database.ListEnabledReminders()
+	if err != nil {
+		t.Fatalf("list reminders: %v", err)
+	}
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	now := func() time.Time {
+		return time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 20, 5, 0, 0, time.UTC)
+	}
+	s.now = now
+	runPass(t, s)
+	if p.count() != 1 {
+		t.Fatalf("expected 1 notification, got %d", p.count())
+	}
+
+	other := NewScheduler(staleReminders{database, reminders}, s.outbox, nil)
+	other.now = now
+	runPass(t, other)
+	if p.count() != 1 {
+		t.Errorf("expected the second scheduler to queue nothing, got %d notifications", p.count())
+	}
+}
+
+func TestRunOnce_SkipsWhenGoalCompletedToday(t *testing.T) {
+	s, p, database, userID := setupScheduler(t, "UTC")
+
+	goalID := "goal-done"
+	if err := database.CreateGoal(&models.Goal{ID: goalID, Name: "Run", Color: "#000000", UserID: &userID, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+	if err := database.CreateReminder(&models.Reminder{UserID: userID, GoalID: &goalID, Frequency: "daily", Time: "20:00", Enabled: true}); err != nil {
+		t.Fatalf("create reminder: %v", err)
+	}
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	now := time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 20, 5, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	if err := database.CreateCompletion(&models.Completion{ID: "c1", GoalID: goalID, Date: now.Format("2006-01-02"), CreatedAt: now}); err != nil {
+		t.Fatalf("create completion: %v", err)
+	}
+
+	runPass(t, s)
+	if p.count() != 0 {
+		t.Errorf("expected no notification for a completed goal, got %d", p.count())
+	}
+}
+
+func TestRunOnce_UsesUserTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Tokyo"); err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	s, p, database, userID := setupScheduler(t, "Asia/Tokyo")
+
+	if err := database.CreateGoal(&models.Goal{ID: "g", Name: "Stretch", Color: "#000000", UserID: &userID, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+	if err := database.CreateReminder(&models.Reminder{UserID: userID, Frequency: "daily", Time: "09:00", Enabled: true}); err != nil {
+		t.Fatalf("create reminder: %v", err)
+	}
+
+	// 00:10 UTC tomorrow is 09:10 in Tokyo: due there, though not in UTC.
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	s.now = func() time.Time {
+		return time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 0, 10, 0, 0, time.UTC)
+	}
+
+	runPass(t, s)
+	if p.count() != 1 {
+		t.Errorf("expected reminder due in Tokyo time, got %d notifications", p.count())
+	}
+}
+
+func TestRunOnce_DropsStaleOccurrences(t *testing.T) {
+	s, p, database, userID := setupScheduler(t, "UTC")
+
+	if err := database.CreateGoal(&models.Goal{ID: "g", Name: "Stretch", Color: "#000000", UserID: &userID, CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+	if err := database.CreateReminder(&models.Reminder{UserID: userID, Frequency: "daily", Time: "08:00", Enabled: true}); err != nil {
+		t.Fatalf("create reminder: %v", err)
+	}
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	s.now = func() time.Time {
+		return time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 14, 0, 0, 0, time.UTC)
+	}
+
+	runPass(t, s)
+	if p.count() != 0 {
+		t.Errorf("expected stale reminder to be dropped, got %d notifications", p.count())
+	}
+}
+
+func TestRunOnce_RendersInUserLocale(t *testing.T) {
+	s, p, database, userID := setupScheduler(t, "UTC")
+	if err := database.UpdateUserLocale(userID, "pt-BR"); err != nil {
+		t.Fatalf("update locale: %v", err)
+	}
+	for _, id := range []string{"goal-a", "goal-b"} {
+		if err := database.CreateGoal(&models.Goal{ID: id, Name: id, Color: "#000000", UserID: &userID, CreatedAt: time.Now().UTC()}); err != nil {
+			t.Fatalf("create goal: %v", err)
+		}
+	}
+	// A check-in reminder (no goal) counts the goals still open today.
+	r := &models.Reminder{UserID: userID, Frequency: "daily", Time: "20:00", Enabled: true}
+	if err := database.CreateReminder(r); err != nil {
+		t.Fatalf("create reminder: %v", err)
+	}
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	s.now = func() time.Time {
+		return time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 20, 5, 0, 0, time.UTC)
+	}
+
+	runPass(t, s)
+	if p.count() != 1 {
+		t.Fatalf("expected 1 notification, got %d", p.count())
+	}
+	n := p.sent[0].notification
+	if n.Title != "Hora de registrar" || n.Body != "Faltam 2 objetivos para registrar hoje." {
+		t.Errorf("expected a Portuguese check-in, got %q / %q", n.Title, n.Body)
+	}
+}
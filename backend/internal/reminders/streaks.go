@@ -0,0 +1,170 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/push"
+)
+
+// MinAlertStreak is the shortest streak worth an alert. A single day is not
+// much of a streak, and alerting on it would fire for nearly every goal.
+const MinAlertStreak = 2
+
+const dateLayout = "2006-01-02"
+
+// StreakAlerts sends the evening "don't break your N-day streak" push: once
+// the user's local send time has passed, each goal with a running streak and
+// no completion yet today gets one notification. Each user is handled at most
+// once per local day, even if a goal becomes at risk later that evening.
+type StreakAlerts struct {
+	db        db.Database
+	outbox    *push.Outbox
+	templates *push.Templates
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+// NewStreakAlerts creates the streak alert job.
+func NewStreakAlerts(database db.Database, outbox *push.Outbox, logger *slog.Logger) *StreakAlerts {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &StreakAlerts{
+		db:        database,
+		outbox:    outbox,
+		templates: push.DefaultTemplates(),
+		logger:    logger,
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// RunOnce alerts every opted-in user whose send time has passed today and
+// who has not been handled yet today.
+func (a *StreakAlerts) RunOnce(ctx context.Context) error {
+	recipients, err := a.db.ListStreakAlertRecipients()
+	if err != nil {
+		return fmt.Errorf("list streak alert recipients: %w", err)
+	}
+
+	now := a.now()
+	for _, r := range recipients {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		loc := time.UTC
+		if r.Timezone != "" {
+			if l, err := time.LoadLocation(r.Timezone); err == nil {
+				loc = l
+			}
+		}
+		local := now.In(loc)
+		today := local.Format(dateLayout)
+		if r.LastSentOn == today {
+			continue
+		}
+		hour, minute, err := ParseTimeOfDay(r.Time)
+		if err != nil {
+			a.logger.Warn("invalid streak alert time", slog.String("user_id", r.UserID), slog.String("error", err.Error()))
+			continue
+		}
+		if local.Before(time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc)) {
+			continue
+		}
+
+		entries, goals, err := a.alerts(r, today)
+		if err != nil {
+			a.logger.Error("streak alert failed", slog.String("user_id", r.UserID), slog.String("error", err.Error()))
+			continue
+		}
+		// Claiming the day and queueing happen together, so a user is
+		// alerted once even when several servers run this job.
+		claimed, err := a.db.ClaimStreakAlert(r.UserID, today, entries)
+		if err != nil {
+			return fmt.Errorf("claim streak alert: %w", err)
+		}
+		if claimed && goals > 0 {
+			a.logger.Info("streak alerts queued",
+				slog.String("user_id", r.UserID),
+				slog.Int("goals", goals),
+				slog.Int("entries", len(entries)),
+			)
+		}
+	}
+	return nil
+}
+
+// alerts returns the outbox entries of one notification per goal whose
+// streak is at risk on the local date today, and how many goals that is.
+func (a *StreakAlerts) alerts(r models.StreakAlertRecipient, today string) ([]models.PushOutboxEntry, int, error) {
+	userID := r.UserID
+	goals, err := a.db.ListGoals(&userID, false)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list goals: %w", err)
+	}
+	if len(goals) == 0 {
+		return nil, 0, nil
+	}
+	// Streaks can be arbitrarily long, so read the whole history.
+	completions, err := a.db.ListAllCompletions(&userID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list completions: %w", err)
+	}
+	days := make(map[string]map[string]bool, len(goals))
+	for _, c := range completions {
+		if days[c.GoalID] == nil {
+			days[c.GoalID] = map[string]bool{}
+		}
+		days[c.GoalID][c.Date] = true
+	}
+
+	var entries []models.PushOutboxEntry
+	atRisk := 0
+	for _, g := range goals {
+		if days[g.ID][today] {
+			continue
+		}
+		streak, err := StreakBefore(days[g.ID], today)
+		if err != nil {
+			return nil, 0, err
+		}
+		if streak < MinAlertStreak {
+			continue
+		}
+
+		n, err := a.templates.Render(r.Locale, push.KindStreakAtRisk, push.TemplateArgs{Goal: g.Name, Count: streak})
+		if err != nil {
+			return nil, 0, err
+		}
+		n.Data = map[string]string{"type": "streak", "goal_id": g.ID}
+		goalEntries, err := a.outbox.Entries(userID, "streak", n)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, goalEntries...)
+		atRisk++
+	}
+	return entries, atRisk, nil
+}
+
+// StreakBefore returns how many consecutive days up to and including the day
+// before today (a YYYY-MM-DD date) are in days.
+func StreakBefore(days map[string]bool, today string) (int, error) {
+	d, err := time.Parse(dateLayout, today)
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %q: %w", today, err)
+	}
+	streak := 0
+	for {
+		d = d.AddDate(0, 0, -1)
+		if !days[d.Format(dateLayout)] {
+			return streak, nil
+		}
+		streak++
+	}
+}
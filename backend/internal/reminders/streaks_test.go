@@ -0,0 +1,141 @@
+package reminders
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+)
+
+func TestStreakBefore(t *testing.T) {
+	days := map[string]bool{"2026-02-27": true, "2026-02-28": true, "2026-03-01": true, "2026-03-03": true}
+	cases := []struct {
+		today string
+		want  int
+	}{
+		{"2026-03-02", 3}, // crosses the month boundary
+		{"2026-03-04", 1},
+		{"2026-03-03", 0}, // yesterday missed
+		{"2026-03-10", 0},
+	}
+	for _, tc := range cases {
+		got, err := StreakBefore(days, tc.today)
+		if err != nil {
+			t.Fatalf("StreakBefore(%s): %v", tc.today, err)
+		}
+		if got != tc.want {
+			t.Errorf("StreakBefore(%s): want %d, got %d", tc.today, tc.want, got)
+		}
+	}
+}
+
+// setupStreakAlerts creates a user with one device and these goals, each
+// completed on the given number of days before 2026-03-11.
+func setupStreakAlerts(t *testing.T, streaks map[string]int) (*StreakAlerts, *recordingPush, db.Database, string) {
+	t.Helper()
+	s, p, database, userID := setupScheduler(t, "UTC")
+	today := time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)
+	for goalID, n := range streaks {
+		if err := database.CreateGoal(&models.Goal{ID: goalID, Name: goalID, Color: "#000000", UserID: &userID, CreatedAt: today}); err != nil {
+			t.Fatalf("create goal: %v", err)
+		}
+		for i := 1; i <= n; i++ {
+			date := today.AddDate(0, 0, -i).Format("2006-01-02")
+			if err := database.CreateCompletion(&models.Completion{ID: goalID + date, GoalID: goalID, Date: date, CreatedAt: today}); err != nil {
+				t.Fatalf("create completion: %v", err)
+			}
+		}
+	}
+	return NewStreakAlerts(database, s.outbox, nil), p, database, userID
+}
+
+func runStreakPass(t *testing.T, a *StreakAlerts, now time.Time) {
+	t.Helper()
+	a.now = func() time.Time { return now }
+	if err := a.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if _, err := a.outbox.RunOnce(context.Background()); err != nil {
+		t.Fatalf("outbox RunOnce: %v", err)
+	}
+}
+
+func TestStreakAlerts_AlertsAtRiskGoalsOncePerDay(t *testing.T) {
+	a, p, database, userID := setupStreakAlerts(t, map[string]int{"Read": 3, "Run": 1, "Stretch": 4})
+	// Stretch is already done today; Run's one-day streak is too short.
+	if err := database.CreateCompletion(&models.Completion{ID: "today", GoalID: "Stretch", Date: "2026-03-11", CreatedAt: time.Now().UTC()}); err != nil {
+		t.Fatalf("create completion: %v", err)
+	}
+
+	runStreakPass(t, a, time.Date(2026, 3, 11, 20, 5, 0, 0, time.UTC))
+	if p.count() != 1 {
+		t.Fatalf("expected 1 notification, got %d", p.count())
+	}
+	n := p.sent[0].notification
+	if n.Title != "Don't break your 3-day streak" || n.Body != "Read isn't done yet today." || n.Data["goal_id"] != "Read" {
+		t.Errorf("unexpected notification: %+v", n)
+	}
+
+	runStreakPass(t, a, time.Date(2026, 3, 11, 22, 0, 0, 0, time.UTC))
+	if p.count() != 1 {
+		t.Errorf("expected a single alert per day, got %d", p.count())
+	}
+
+	settings, err := database.GetStreakAlertSettings(userID)
+	if err != nil || !settings.Enabled || settings.Time != db.DefaultStreakAlertTime {
+		t.Errorf("marking sent must keep the default settings, got %+v, %v", settings, err)
+	}
+}
+
+func TestStreakAlerts_RespectsSendTimeAndOptOut(t *testing.T) {
+	a, p, database, userID := setupStreakAlerts(t, map[string]int{"Read": 5})
+	if err := database.SaveStreakAlertSettings(userID, models.StreakAlertSettings{Enabled: true, Time: "21:00"}); err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+
+	runStreakPass(t, a, time.Date(2026, 3, 11, 20, 30, 0, 0, time.UTC))
+	if p.count() != 0 {
+		t.Fatalf("expected no alert before the send time, got %d", p.count())
+	}
+
+	if err := database.SaveStreakAlertSettings(userID, models.StreakAlertSettings{Enabled: false, Time: "21:00"}); err != nil {
+		t.Fatalf("save settings: %v", err)
+	}
+	runStreakPass(t, a, time.Date(2026, 3, 11, 21, 30, 0, 0, time.UTC))
+	if p.count() != 0 {
+		t.Errorf("expected no alert after opting out, got %d", p.count())
+	}
+}
+
+// staleRecipients serves a recipient list read before another server's run,
+// as a concurrent replica would see it.
+type staleRecipients struct {
+	db.Database
+	recipients []models.StreakAlertRecipient
+}
+
+func (s staleRecipients) ListStreakAlertRecipients() ([]models.StreakAlertRecipient, error) {
+	return s.recipients, nil
+}
+
+func TestStreakAlerts_ConcurrentRunsAlertOnce(t *testing.T) {
+	a, p, database, _ := setupStreakAlerts(t, map[string]int{"Read": 3, "Write": 2})
+	recipients, err := database.ListStreakAlertRecipients()
+	if err != nil {
+		t.Fatalf("list recipients: %v", err)
+	}
+
+	now := time.Date(2026, 3, 11, 20, 5, 0, 0, time.UTC)
+	runStreakPass(t, a, now)
+	if p.count() != 2 {
+		t.Fatalf("expected 2 notifications, got %d", p.count())
+	}
+
+	other := NewStreakAlerts(staleRecipients{database, recipients}, a.outbox, nil)
+	runStreakPass(t, other, now)
+	if p.count() != 2 {
+		t.Errorf("expected the second run to queue nothing, got %d notifications", p.count())
+	}
+}
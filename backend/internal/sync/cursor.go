@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+)
+
+// ErrInvalidCursor is returned for a sync cursor the server did not issue.
+var ErrInvalidCursor = errors.New("invalid sync cursor")
+
+// ErrResyncRequired is returned for a cursor older than the user's tombstone
+// horizon: deletes made after it may have been purged, so the client must
+// discard its local state and pull everything again.
+var ErrResyncRequired = errors.New("full resync required")
+
+// cursorVersion prefixes the encoded position so the format can change
+// without misreading cursors clients already hold.
+const cursorVersion = "v1:"
+
+// EncodeCursor turns a change sequence number into the opaque cursor clients
+// send back on their next sync.
+func EncodeCursor(seq int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorVersion + strconv.FormatInt(seq, 10)))
+}
+
+// DecodeCursor returns the change sequence number of a cursor made by
+// EncodeCursor.
+func DecodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	rest, ok := strings.CutPrefix(string(raw), cursorVersion)
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	seq, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return seq, nil
+}
+
+// ErrInvalidPageToken is returned for a page token the server did not issue.
+var ErrInvalidPageToken = errors.New("invalid sync page token")
+
+// pageTokenVersion prefixes encoded page tokens, like cursorVersion.
+const pageTokenVersion = "p1:"
+
+// Page phases: a pull sends every goal before any completion, so a client
+// never receives a completion for a goal it has not seen.
+const (
+	phaseGoals       = "g"
+	phaseCompletions = "c"
+)
+
+// pageToken is the position of a paginated pull. The pull covers changes
+// numbered above from and at most upTo; phase and after mark the last row
+// sent. A from of -1 is an initial pull, which also covers rows written
+// before change sequences existed.
+type pageToken struct {
+	from  int64
+	upTo  int64
+	phase string
+	after db.ChangeKey
+}
+
+// cursor returns the cursor the pull started from; "" for an initial pull.
+func (t pageToken) cursor() string {
+	if t.from < 0 {
+		return ""
+	}
+	return EncodeCursor(t.from)
+}
+
+// start is the key before the pull's first row. IDs are never empty, so
+// every row numbered above from sorts after it.
+func (t pageToken) start() db.ChangeKey {
+	return db.ChangeKey{Seq: t.from + 1}
+}
+
+func encodePageToken(t pageToken) string {
+	raw := fmt.Sprintf("%s%d:%d:%s:%d:%s", pageTokenVersion, t.from, t.upTo, t.phase, t.after.Seq, t.after.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePageToken(token string) (pageToken, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return pageToken{}, ErrInvalidPageToken
+	}
+	rest, ok := strings.CutPrefix(string(raw), pageTokenVersion)
+	if !ok {
+		return pageToken{}, ErrInvalidPageToken
+	}
+	// The ID comes last and may itself contain colons.
+	parts := strings.SplitN(rest, ":", 5)
+	if len(parts) != 5 {
+		return pageToken{}, ErrInvalidPageToken
+	}
+	from, err1 := strconv.ParseInt(parts[0], 10, 64)
+	upTo, err2 := strconv.ParseInt(parts[1], 10, 64)
+	afterSeq, err3 := strconv.ParseInt(parts[3], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || from < -1 || upTo < from {
+		return pageToken{}, ErrInvalidPageToken
+	}
+	if parts[2] != phaseGoals && parts[2] != phaseCompletions {
+		return pageToken{}, ErrInvalidPageToken
+	}
+	return pageToken{
+		from:  from,
+		upTo:  upTo,
+		phase: parts[2],
+		after: db.ChangeKey{Seq: afterSeq, ID: parts[4]},
+	}, nil
+}
@@ -0,0 +1,148 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strconv"
+
+	"github.com/apsv/goal-tracker/backend/internal/models"
+)
+
+// Digest summarizes a user's live goals and completions as a hash tree, so a
+// client can check its local state against the server's without pulling it.
+// If Root differs, the client compares Goals and each month and re-pulls
+// only what differs.
+//
+// Hashes are SHA-256, hex encoded, and depend only on values clients hold,
+// never on server timestamps, so they are the same on every backend:
+//
+//   - A goal's leaf hashes 0x00 followed by its ID, name, color, rank, target
+//     count (decimal, or empty), target period (or empty) and archived state
+//     ("true" or "false"), each as a 4-byte big-endian length and the UTF-8
+//     bytes.
+//   - A completion's leaf hashes 0x00 followed by its goal ID and date
+//     (YYYY-MM-DD), encoded the same way.
+//   - A node hashes 0x01 followed by its children's 32-byte hashes. Goals is
+//     the node of every goal leaf ordered by ID; a month is the node of its
+//     completion leaves ordered by date, then goal ID; Root is the node of
+//     Goals followed by each month's hash, oldest month first.
+//
+// Only completions of live goals count, and months without completions are
+// left out.
+type Digest struct {
+	Root   string        `json:"root"`
+	Goals  string        `json:"goals"`
+	Months []MonthDigest `json:"months"`
+	// Cursor is the sync position the digest reflects at least; changes
+	// after it may or may not be included.
+	Cursor string `json:"cursor"`
+}
+
+// MonthDigest is the hash of one month's completions.
+type MonthDigest struct {
+	Month       string `json:"month"` // YYYY-MM
+	Hash        string `json:"hash"`
+	Completions int    `json:"completions"`
+}
+
+// Digest returns the digest of the user's current goals and completions.
+func (s *Service) Digest(userID string) (*Digest, error) {
+	// As in ChangesSince, read the position first.
+	seq, err := s.db.GetChangeSeq(&userID)
+	if err != nil {
+		return nil, err
+	}
+	goals, err := s.db.ListGoals(&userID, true)
+	if err != nil {
+		return nil, err
+	}
+	completions, err := s.db.ListAllCompletions(&userID)
+	if err != nil {
+		return nil, err
+	}
+
+	d := buildDigest(goals, completions)
+	d.Cursor = EncodeCursor(seq)
+	return d, nil
+}
+
+// buildDigest hashes goals and completions as described on Digest.
+func buildDigest(goals []models.Goal, completions []models.Completion) *Digest {
+	sort.Slice(goals, func(i, j int) bool { return goals[i].ID < goals[j].ID })
+	live := make(map[string]bool, len(goals))
+	goalLeaves := make([][]byte, 0, len(goals))
+	for _, g := range goals {
+		live[g.ID] = true
+		goalLeaves = append(goalLeaves, digestLeaf(
+			g.ID, g.Name, g.Color, g.Rank,
+			digestTargetCount(g.TargetCount), digestString(g.TargetPeriod), strconv.FormatBool(g.ArchivedAt != nil),
+		))
+	}
+	goalsHash := digestNode(goalLeaves)
+
+	type entry struct{ goalID, date string }
+	var entries []entry
+	for _, c := range completions {
+		if live[c.GoalID] && len(c.Date) == len("2006-01-02") {
+			entries = append(entries, entry{c.GoalID, c.Date})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].date != entries[j].date {
+			return entries[i].date < entries[j].date
+		}
+		return entries[i].goalID < entries[j].goalID
+	})
+
+	d := &Digest{Goals: hex.EncodeToString(goalsHash), Months: []MonthDigest{}}
+	rootChildren := [][]byte{goalsHash}
+	for start := 0; start < len(entries); {
+		month := entries[start].date[:len("2006-01")]
+		var leaves [][]byte
+		end := start
+		for ; end < len(entries) && entries[end].date[:len("2006-01")] == month; end++ {
+			leaves = append(leaves, digestLeaf(entries[end].goalID, entries[end].date))
+		}
+		monthHash := digestNode(leaves)
+		d.Months = append(d.Months, MonthDigest{Month: month, Hash: hex.EncodeToString(monthHash), Completions: end - start})
+		rootChildren = append(rootChildren, monthHash)
+		start = end
+	}
+	d.Root = hex.EncodeToString(digestNode(rootChildren))
+	return d
+}
+
+func digestLeaf(fields ...string) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	for _, f := range fields {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(f))))
+		h.Write([]byte(f))
+	}
+	return h.Sum(nil)
+}
+
+func digestNode(children [][]byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	for _, c := range children {
+		h.Write(c)
+	}
+	return h.Sum(nil)
+}
+
+func digestTargetCount(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func digestString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
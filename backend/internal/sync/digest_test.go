@@ -0,0 +1,120 @@
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestBuildDigest_DependsOnlyOnClientValues(t *testing.T) {
+	week := "week"
+	three := 3
+	archived := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	goals := []models.Goal{
+		{ID: "goal-b", Name: "Read", Color: "#0000FF", Rank: "000002", ArchivedAt: &archived},
+		{ID: "goal-a", Name: "Run", Color: "#FF0000", Rank: "000001", TargetCount: &three, TargetPeriod: &week},
+	}
+	completions := []models.Completion{
+		{GoalID: "goal-a", Date: "2026-02-03"},
+		{GoalID: "goal-b", Date: "2026-01-10"},
+		{GoalID: "goal-a", Date: "2026-01-10"},
+		{GoalID: "goal-gone", Date: "2026-01-11"},
+	}
+	d := buildDigest(goals, completions)
+
+	// Pinned so the format cannot change under clients that compute it.
+	if want := "7e1de7558e55e41f3324d79038efc736a1b780d0d00808f111ab8d1b7196f83f"; d.Root != want {
+		t.Errorf("expected root %s, got %s", want, d.Root)
+	}
+	if len(d.Months) != 2 || d.Months[0].Month != "2026-01" || d.Months[0].Completions != 2 || d.Months[1].Month != "2026-02" {
+		t.Errorf("expected January with 2 and February, got %+v", d.Months)
+	}
+
+	// Timestamps and input order do not matter.
+	goals[0].UpdatedAt = time.Now()
+	goals[0], goals[1] = goals[1], goals[0]
+	completions[0], completions[2] = completions[2], completions[0]
+	completions[1].CreatedAt = time.Now()
+	if again := buildDigest(goals, completions); again.Root != d.Root {
+		t.Errorf("expected the same root, got %s and %s", d.Root, again.Root)
+	}
+}
+
+func TestDigest_ChangesOnlyTheAffectedMonth(t *testing.T) {
+	database, cleanup := setupTestSyncDB(t)
+	defer cleanup()
+
+	testDigestChangesOnlyTheAffectedMonth(t, database, "digest", "goal-digest")
+}
+
+// TestPostgresDigest_ChangesOnlyTheAffectedMonth runs against the database in
+// TEST_POSTGRES_URL, e.g. postgres://localhost/goals_test?sslmode=disable.
+func TestPostgresDigest_ChangesOnlyTheAffectedMonth(t *testing.T) {
+	connStr := os.Getenv("TEST_POSTGRES_URL")
+	if connStr == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+
+	database, err := db.NewPostgres(connStr)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	// Fresh names, so reruns against the same database start empty.
+	id := uuid.NewString()
+	testDigestChangesOnlyTheAffectedMonth(t, database, "digest-"+id, id)
+}
+
+func testDigestChangesOnlyTheAffectedMonth(t *testing.T, database db.Database, providerUserID, goalID string) {
+	svc := NewService(database)
+	user, err := database.GetOrCreateUserByProvider("test", providerUserID, providerUserID+"@test.com", "Test", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	now := time.Now().UTC()
+	if _, err := svc.ApplyChanges(user.ID, &SyncRequest{
+		Goals: []GoalChange{{ID: goalID, Name: "Run", Color: "#000000", UpdatedAt: now}},
+		Completions: []CompletionChange{
+			{GoalID: goalID, Date: "2026-01-10", Completed: true, UpdatedAt: now},
+			{GoalID: goalID, Date: "2026-02-10", Completed: true, UpdatedAt: now},
+		},
+	}); err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	before, err := svc.Digest(user.ID)
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+
+	if _, err := svc.ApplyChanges(user.ID, &SyncRequest{
+		Completions: []CompletionChange{{GoalID: goalID, Date: "2026-02-11", Completed: true, UpdatedAt: now}},
+	}); err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	after, err := svc.Digest(user.ID)
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+
+	if after.Root == before.Root || after.Cursor == before.Cursor {
+		t.Error("expected the root and cursor to change")
+	}
+	if after.Goals != before.Goals {
+		t.Error("expected the goals hash unchanged")
+	}
+	if len(after.Months) != 2 || after.Months[0] != before.Months[0] {
+		t.Errorf("expected January unchanged, got %+v then %+v", before.Months, after.Months)
+	}
+	if after.Months[1].Hash == before.Months[1].Hash || after.Months[1].Completions != 2 {
+		t.Errorf("expected February changed, got %+v then %+v", before.Months[1], after.Months[1])
+	}
+}
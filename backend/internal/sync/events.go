@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"sort"
 	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/rank"
 )
 
 // EventRequest represents a single event from the client.
@@ -11,7 +15,18 @@ type EventRequest struct {
 	ID        string          `json:"id"`
 	Type      string          `json:"type"`
 	Timestamp time.Time       `json:"timestamp"`
-	Payload   EventPayload    `json:"payload"`
+	// HLC orders the event against other changes to the same item. Clients
+	// that do not send one are ordered by Timestamp.
+	HLC     HLC          `json:"hlc,omitzero"`
+	Payload EventPayload `json:"payload"`
+}
+
+// Clock returns the event's HLC, falling back to Timestamp.
+func (e EventRequest) Clock() HLC {
+	if e.HLC.IsZero() {
+		return HLCFromTime(e.Timestamp, "")
+	}
+	return e.HLC
 }
 
 // EventPayload contains the event-type-specific data.
@@ -23,10 +38,18 @@ type EventPayload struct {
 	Position     int     `json:"position"`
 	TargetCount  *int    `json:"target_count,omitempty"`
 	TargetPeriod *string `json:"target_period,omitempty"`
+	// Rank is the goal's rank for goal_upsert; see GoalChange.Rank.
+	Rank string `json:"rank,omitempty"`
+
+	// Fields holds per-field clocks for goal_upsert; see GoalChange.Fields.
+	Fields *GoalFieldHLCs `json:"fields,omitempty"`
 
 	// Completion fields
 	GoalID string `json:"goal_id,omitempty"`
 	Date   string `json:"date,omitempty"`
+
+	// GoalIDs is the new order of goals for goal_reorder, first to last.
+	GoalIDs []string `json:"goal_ids,omitempty"`
 }
 
 // EventsRequest is the top-level request body for the events endpoint.
@@ -36,7 +59,17 @@ type EventsRequest struct {
 
 // EventsResponse is the response from the events endpoint.
 type EventsResponse struct {
+	// Processed lists every event the client can drop from its queue,
+	// including rejected ones.
 	Processed []string `json:"processed"`
+	// Results holds each event's outcome, in processing order.
+	Results []ItemResult `json:"results"`
+	// HLC is the server clock after processing the batch.
+	HLC HLC `json:"hlc"`
+	// Applied counts events that changed stored data; resent events and
+	// events that lost a last-write-wins merge are not counted. Not sent to
+	// clients.
+	Applied int `json:"-"`
 }
 
 // Valid event types.
@@ -45,15 +78,27 @@ const (
 	EventTypeGoalDelete     = "goal_delete"
 	EventTypeCompletionSet  = "completion_set"
 	EventTypeCompletionUnset = "completion_unset"
+	// goal_archive and goal_unarchive change only the archived state, and
+	// goal_reorder only the positions of the goals it lists, so they merge
+	// with concurrent edits to a goal's other fields.
+	EventTypeGoalArchive   = "goal_archive"
+	EventTypeGoalUnarchive = "goal_unarchive"
+	EventTypeGoalReorder   = "goal_reorder"
 )
 
 // ProcessEvents processes a batch of events for a user.
-// Events are sorted by timestamp and processed in order.
-// Duplicate event IDs (already processed) are skipped but still reported as processed.
+// Events are sorted by their hybrid logical clock and processed in order.
+// An event ID the user already sent is not applied again; it is reported
+// with the outcome it got the first time.
+// Each event is applied and recorded as processed in a single transaction.
+// Invalid events are rejected and marked processed without stopping the
+// batch; only storage errors abort it.
 func (s *Service) ProcessEvents(userID string, events []EventRequest) (*EventsResponse, error) {
-	userLock := s.getUserLock(userID)
-	userLock.Lock()
-	defer userLock.Unlock()
+	unlock, err := s.lockUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
 	// Lazily prune old processed events (older than 30 days), at most once per hour
 	now := time.Now().UTC()
@@ -70,65 +115,99 @@ func (s *Service) ProcessEvents(userID string, events []EventRequest) (*EventsRe
 		s.mu.Unlock()
 	}
 
-	// Sort events by timestamp to process in order
+	// Sort events by clock to process in order
 	sorted := make([]EventRequest, len(events))
 	copy(sorted, events)
-	sort.Slice(sorted, func(i, j int) bool {
-		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Clock().Compare(sorted[j].Clock()) < 0
 	})
 
 	processed := make([]string, 0, len(sorted))
+	results := make([]ItemResult, 0, len(sorted))
+	applied := 0
 
 	for _, event := range sorted {
-		// Check idempotency
-		alreadyProcessed, err := s.db.IsEventProcessed(event.ID)
-		if err != nil {
-			return nil, fmt.Errorf("check event idempotency: %w", err)
-		}
-		if alreadyProcessed {
-			processed = append(processed, event.ID)
-			continue
-		}
-
-		// Process based on event type
-		switch event.Type {
-		case EventTypeGoalUpsert:
-			if err := s.processGoalUpsert(userID, event); err != nil {
-				return nil, fmt.Errorf("process goal_upsert event %s: %w", event.ID, err)
+		result := ItemResult{ID: event.ID}
+
+		// Each event and its idempotency record commit together, so a failure
+		// leaves neither behind and the client can safely resend the event.
+		var o outcome
+		var replayed bool
+		err := s.db.InTx(userID, func(tx db.Tx) error {
+			prior, err := tx.IsEventProcessed(userID, event.ID)
+			if err != nil {
+				return fmt.Errorf("check event idempotency: %w", err)
 			}
-		case EventTypeGoalDelete:
-			if err := s.processGoalDelete(userID, event); err != nil {
-				return nil, fmt.Errorf("process goal_delete event %s: %w", event.ID, err)
+			if prior != nil {
+				o = outcome{status: prior.Status, reason: prior.Reason}
+				replayed = true
+				return nil
 			}
-		case EventTypeCompletionSet:
-			if err := s.processCompletionSet(userID, event); err != nil {
-				return nil, fmt.Errorf("process completion_set event %s: %w", event.ID, err)
+
+			event.HLC = s.clock.Receive(event.Clock())
+
+			// Process based on event type
+			switch event.Type {
+			case EventTypeGoalUpsert:
+				o, err = s.processGoalUpsert(tx, userID, event)
+			case EventTypeGoalDelete:
+				o, err = s.processGoalDelete(tx, userID, event)
+			case EventTypeGoalArchive:
+				o, err = s.processGoalArchive(tx, userID, event, true)
+			case EventTypeGoalUnarchive:
+				o, err = s.processGoalArchive(tx, userID, event, false)
+			case EventTypeGoalReorder:
+				o, err = s.processGoalReorder(tx, userID, event)
+			case EventTypeCompletionSet:
+				o, err = s.processCompletionSet(tx, userID, event)
+			case EventTypeCompletionUnset:
+				o, err = s.processCompletionUnset(tx, userID, event)
+			case "":
+				o = rejected(ReasonMissingType)
+			default:
+				o = rejected(ReasonUnknownType)
 			}
-		case EventTypeCompletionUnset:
-			if err := s.processCompletionUnset(userID, event); err != nil {
-				return nil, fmt.Errorf("process completion_unset event %s: %w", event.ID, err)
+			if err != nil {
+				return fmt.Errorf("process %s event %s: %w", event.Type, event.ID, err)
 			}
-		default:
-			return nil, fmt.Errorf("unknown event type: %s", event.Type)
-		}
 
-		// Mark as processed
-		if err := s.db.MarkEventProcessed(event.ID); err != nil {
-			return nil, fmt.Errorf("mark event processed: %w", err)
+			if err := tx.MarkEventProcessed(&db.ProcessedEvent{
+				UserID:  userID,
+				EventID: event.ID,
+				Status:  o.status,
+				Reason:  o.reason,
+			}); err != nil {
+				return fmt.Errorf("mark event processed: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
 
+		if o.status == StatusApplied && !replayed {
+			applied++
+		}
 		processed = append(processed, event.ID)
+		results = append(results, result.with(o))
+	}
+
+	if applied > 0 {
+		s.publishChange(userID)
 	}
 
-	return &EventsResponse{Processed: processed}, nil
+	return &EventsResponse{Processed: processed, Results: results, HLC: s.clock.Now(), Applied: applied}, nil
 }
 
-func (s *Service) processGoalUpsert(userID string, event EventRequest) error {
+func (s *Service) processGoalUpsert(tx db.Tx, userID string, event EventRequest) (outcome, error) {
 	p := event.Payload
 
 	// Validate target_period if provided
-	if p.TargetPeriod != nil && *p.TargetPeriod != "week" && *p.TargetPeriod != "month" {
-		return fmt.Errorf("invalid target_period: %s", *p.TargetPeriod)
+	if !validTargetPeriod(p.TargetPeriod) {
+		return rejected(ReasonInvalidTargetPeriod), nil
+	}
+	if !validRank(p.Rank) {
+		return rejected(ReasonInvalidRank), nil
 	}
 
 	change := GoalChange{
@@ -136,50 +215,61 @@ func (s *Service) processGoalUpsert(userID string, event EventRequest) error {
 		Name:         p.Name,
 		Color:        p.Color,
 		Position:     p.Position,
+		Rank:         p.Rank,
 		TargetCount:  p.TargetCount,
 		TargetPeriod: p.TargetPeriod,
-		UpdatedAt:    event.Timestamp,
+		HLC:          event.HLC,
+		Fields:       p.Fields,
 		Deleted:      false,
 	}
+	// The event's HLC was received with the event; receiving it again would
+	// tick the clock and stamp the goal later than the event.
+	s.receiveFieldClocks(&change)
 
-	serverGoal, err := s.db.GetGoalByID(p.ID)
+	serverGoal, err := tx.GetGoalByID(p.ID)
 	if err != nil {
-		return err
+		return outcome{}, err
 	}
 
 	// Verify ownership if goal exists
 	if serverGoal != nil && (serverGoal.UserID == nil || *serverGoal.UserID != userID) {
-		return fmt.Errorf("goal %s not owned by user", p.ID)
+		return rejected(ReasonNotOwned), nil
 	}
 
+	return s.applyGoal(tx, userID, change, serverGoal)
+}
+
+// applyGoal merges change into serverGoal and stores the result.
+func (s *Service) applyGoal(tx db.Tx, userID string, change GoalChange, serverGoal *models.Goal) (outcome, error) {
 	mergedGoal, shouldApply := MergeGoal(change, serverGoal)
-	if shouldApply {
-		if serverGoal == nil {
-			mergedGoal.UserID = &userID
-		}
-		if err := s.db.UpsertGoal(mergedGoal); err != nil {
-			return err
-		}
+	if !shouldApply {
+		return superseded(ReasonStale), nil
 	}
-
-	return nil
+	if serverGoal == nil {
+		mergedGoal.UserID = &userID
+	}
+	if err := upsertGoal(tx, userID, mergedGoal); err != nil {
+		return outcome{}, err
+	}
+	return appliedOutcome, nil
 }
 
-func (s *Service) processGoalDelete(userID string, event EventRequest) error {
+func (s *Service) processGoalDelete(tx db.Tx, userID string, event EventRequest) (outcome, error) {
 	change := GoalChange{
 		ID:        event.Payload.ID,
-		UpdatedAt: event.Timestamp,
+		UpdatedAt: event.HLC.Wall,
+		HLC:       event.HLC,
 		Deleted:   true,
 	}
 
-	serverGoal, err := s.db.GetGoalByID(event.Payload.ID)
+	serverGoal, err := tx.GetGoalByID(event.Payload.ID)
 	if err != nil {
-		return err
+		return outcome{}, err
 	}
 
 	// Verify ownership if goal exists
 	if serverGoal != nil && (serverGoal.UserID == nil || *serverGoal.UserID != userID) {
-		return nil
+		return rejected(ReasonNotOwned), nil
 	}
 
 	// Preserve metadata from existing server goal for archival integrity
@@ -191,82 +281,160 @@ func (s *Service) processGoalDelete(userID string, event EventRequest) error {
 		change.TargetPeriod = serverGoal.TargetPeriod
 	}
 
-	mergedGoal, shouldApply := MergeGoal(change, serverGoal)
-	if shouldApply {
-		if serverGoal == nil {
-			mergedGoal.UserID = &userID
-		}
-		if err := s.db.UpsertGoal(mergedGoal); err != nil {
-			return err
-		}
-	}
-	return nil
+	return s.applyGoal(tx, userID, change, serverGoal)
 }
 
-func (s *Service) processCompletionSet(userID string, event EventRequest) error {
-	p := event.Payload
-
-	// Verify goal ownership
-	goal, err := s.db.GetGoalByID(p.GoalID)
-	if err != nil {
-		return err
+// processGoalArchive archives or unarchives an existing goal.
+func (s *Service) processGoalArchive(tx db.Tx, userID string, event EventRequest, archived bool) (outcome, error) {
+	goal, o, err := liveOwnedGoal(tx, userID, event.Payload.ID)
+	if goal == nil || err != nil {
+		return o, err
+	}
+	if !MergeGoalArchived(goal, archived, event.HLC) {
+		return superseded(ReasonStale), nil
 	}
-	if goal == nil || goal.UserID == nil || *goal.UserID != userID {
-		return fmt.Errorf("goal %s not owned by user", p.GoalID)
+	if err := tx.UpsertGoal(goal); err != nil {
+		return outcome{}, err
 	}
+	return appliedOutcome, nil
+}
 
-	change := CompletionChange{
-		GoalID:    p.GoalID,
-		Date:      p.Date,
-		Completed: true,
-		UpdatedAt: event.Timestamp,
+// processGoalReorder ranks the listed goals in the order given, like the
+// REST reorder endpoint: only goals out of place get new ranks, and goals not
+// listed keep theirs. Each goal's rank merges on its own, so the event is
+// applied if it wins for any of them. If any listed goal is invalid, none
+// move.
+func (s *Service) processGoalReorder(tx db.Tx, userID string, event EventRequest) (outcome, error) {
+	ids := event.Payload.GoalIDs
+	if len(ids) == 0 {
+		return rejected(ReasonInvalidOrder), nil
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return rejected(ReasonInvalidOrder), nil
+		}
+		seen[id] = true
 	}
 
-	serverCompletion, err := s.db.GetCompletionByGoalAndDateIncludingDeleted(p.GoalID, p.Date)
-	if err != nil {
-		return err
+	goals, o, err := liveOwnedGoals(tx, userID, ids)
+	if goals == nil || err != nil {
+		return o, err
+	}
+	keys, ok := rank.Reorder(rankItems(goals))
+	if !ok {
+		// No ranks fit between the current ones; respace them and retry.
+		if err := tx.RebalanceGoalRanks(userID); err != nil {
+			return outcome{}, err
+		}
+		if goals, o, err = liveOwnedGoals(tx, userID, ids); goals == nil || err != nil {
+			return o, err
+		}
+		if keys, ok = rank.Reorder(rankItems(goals)); !ok {
+			return outcome{}, fmt.Errorf("no ranks fit after rebalancing")
+		}
 	}
 
-	mergedCompletion, shouldApply := MergeCompletion(change, serverCompletion)
-	if shouldApply && mergedCompletion != nil {
-		if err := s.db.UpsertCompletion(mergedCompletion); err != nil {
-			return err
+	moved := false
+	for position, goal := range goals {
+		if keys[position] == goal.Rank || !MergeGoalPosition(goal, position, keys[position], event.HLC) {
+			continue
+		}
+		if err := tx.UpsertGoal(goal); err != nil {
+			return outcome{}, err
 		}
+		moved = true
+	}
+	if !moved {
+		return superseded(ReasonStale), nil
 	}
+	return appliedOutcome, nil
+}
 
-	return nil
+// liveOwnedGoals is liveOwnedGoal for each of ids.
+func liveOwnedGoals(tx db.Tx, userID string, ids []string) ([]*models.Goal, outcome, error) {
+	goals := make([]*models.Goal, 0, len(ids))
+	for _, id := range ids {
+		goal, o, err := liveOwnedGoal(tx, userID, id)
+		if goal == nil || err != nil {
+			return nil, o, err
+		}
+		goals = append(goals, goal)
+	}
+	return goals, outcome{}, nil
 }
 
-func (s *Service) processCompletionUnset(userID string, event EventRequest) error {
-	p := event.Payload
+func rankItems(goals []*models.Goal) []rank.Item {
+	items := make([]rank.Item, len(goals))
+	for i, g := range goals {
+		items[i] = rank.Item{ID: g.ID, Key: g.Rank}
+	}
+	return items
+}
 
-	// Verify goal ownership
-	goal, err := s.db.GetGoalByID(p.GoalID)
+// liveOwnedGoal loads the goal an event changes in place. If the goal is
+// missing, deleted or not the user's, it returns nil and the rejection.
+func liveOwnedGoal(tx db.Tx, userID, id string) (*models.Goal, outcome, error) {
+	goal, err := tx.GetGoalByID(id)
 	if err != nil {
-		return err
+		return nil, outcome{}, err
 	}
-	if goal == nil || goal.UserID == nil || *goal.UserID != userID {
-		return fmt.Errorf("goal %s not owned by user", p.GoalID)
+	if goal == nil || goal.DeletedAt != nil {
+		return nil, rejected(ReasonGoalNotFound), nil
 	}
+	if goal.UserID == nil || *goal.UserID != userID {
+		return nil, rejected(ReasonNotOwned), nil
+	}
+	return goal, outcome{}, nil
+}
+
+func (s *Service) processCompletionSet(tx db.Tx, userID string, event EventRequest) (outcome, error) {
+	p := event.Payload
+	return s.applyCompletion(tx, userID, CompletionChange{
+		GoalID:    p.GoalID,
+		Date:      p.Date,
+		Completed: true,
+		UpdatedAt: event.HLC.Wall,
+		HLC:       event.HLC,
+	})
+}
 
-	change := CompletionChange{
+func (s *Service) processCompletionUnset(tx db.Tx, userID string, event EventRequest) (outcome, error) {
+	p := event.Payload
+	return s.applyCompletion(tx, userID, CompletionChange{
 		GoalID:    p.GoalID,
 		Date:      p.Date,
 		Completed: false,
-		UpdatedAt: event.Timestamp,
+		UpdatedAt: event.HLC.Wall,
+		HLC:       event.HLC,
+	})
+}
+
+// applyCompletion verifies the user owns the completion's goal, then merges
+// change into the stored completion and stores the result.
+func (s *Service) applyCompletion(tx db.Tx, userID string, change CompletionChange) (outcome, error) {
+	goal, err := tx.GetGoalByID(change.GoalID)
+	if err != nil {
+		return outcome{}, err
+	}
+	if goal == nil {
+		return rejected(ReasonGoalNotFound), nil
+	}
+	if goal.UserID == nil || *goal.UserID != userID {
+		return rejected(ReasonNotOwned), nil
 	}
 
-	serverCompletion, err := s.db.GetCompletionByGoalAndDateIncludingDeleted(p.GoalID, p.Date)
+	serverCompletion, err := tx.GetCompletionByGoalAndDateIncludingDeleted(change.GoalID, change.Date)
 	if err != nil {
-		return err
+		return outcome{}, err
 	}
 
 	mergedCompletion, shouldApply := MergeCompletion(change, serverCompletion)
-	if shouldApply && mergedCompletion != nil {
-		if err := s.db.UpsertCompletion(mergedCompletion); err != nil {
-			return err
-		}
+	if !shouldApply || mergedCompletion == nil {
+		return superseded(ReasonStale), nil
 	}
-
-	return nil
+	if err := tx.UpsertCompletion(mergedCompletion); err != nil {
+		return outcome{}, err
+	}
+	return appliedOutcome, nil
 }
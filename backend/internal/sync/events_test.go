@@ -1,6 +1,8 @@
 package sync
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -70,6 +72,36 @@ func TestProcessEvents_GoalUpsert(t *testing.T) {
 	}
 }
 
+func TestProcessEvents_GoalUpsertReceivesClockOnce(t *testing.T) {
+	svc, userID, cleanup := setupEventsTest(t)
+	defer cleanup()
+
+	now := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	svc.clock.now = func() time.Time { return now }
+
+	resp, err := svc.ProcessEvents(userID, []EventRequest{{
+		ID:      "evt-clock",
+		Type:    EventTypeGoalUpsert,
+		HLC:     HLC{Wall: now, Node: "phone"},
+		Payload: EventPayload{ID: "goal-clock", Name: "Run", Color: "#FF0000"},
+	}})
+	if err != nil {
+		t.Fatalf("ProcessEvents failed: %v", err)
+	}
+
+	// One tick receiving the event and one for the response.
+	if want := (HLC{Wall: now, Logical: 2, Node: ServerNode}); resp.HLC != want {
+		t.Errorf("expected the clock to tick once per step, got %v, want %v", resp.HLC, want)
+	}
+	goal, err := svc.db.GetGoalByID("goal-clock")
+	if err != nil || goal == nil {
+		t.Fatalf("expected goal, got %v, %v", goal, err)
+	}
+	if !goal.UpdatedAt.Equal(now) {
+		t.Errorf("expected the goal stamped with the event's clock, got %v", goal.UpdatedAt)
+	}
+}
+
 func TestProcessEvents_GoalUpsertWithTargets(t *testing.T) {
 	svc, userID, cleanup := setupEventsTest(t)
 	defer cleanup()
@@ -320,6 +352,13 @@ func TestProcessEvents_Idempotency(t *testing.T) {
 	if len(resp2.Processed) != 1 || resp2.Processed[0] != "evt-idem" {
 		t.Errorf("expected processed=[evt-idem], got %v", resp2.Processed)
 	}
+	// The retry gets the first outcome back but changed nothing this time.
+	if r := resp2.Results[0]; r.Status != StatusApplied || r.Reason != "" {
+		t.Errorf("expected the original applied result, got %+v", r)
+	}
+	if resp2.Applied != 0 {
+		t.Errorf("expected nothing applied by the retry, got %d", resp2.Applied)
+	}
 
 	// Verify the goal was NOT updated (idempotency prevented re-processing)
 	goal, err := svc.db.GetGoalByID("goal-idem")
@@ -396,18 +435,75 @@ func TestProcessEvents_InvalidEventType(t *testing.T) {
 	svc, userID, cleanup := setupEventsTest(t)
 	defer cleanup()
 
+	now := time.Now().UTC()
 	events := []EventRequest{
 		{
 			ID:        "evt-bad",
 			Type:      "invalid_type",
-			Timestamp: time.Now().UTC(),
+			Timestamp: now,
 			Payload:   EventPayload{},
 		},
+		{
+			ID:        "evt-after-bad",
+			Type:      EventTypeGoalUpsert,
+			Timestamp: now.Add(time.Second),
+			Payload:   EventPayload{ID: "goal-after-bad", Name: "Read", Color: "#000000"},
+		},
+	}
+
+	resp, err := svc.ProcessEvents(userID, events)
+	if err != nil {
+		t.Fatalf("an invalid event must not fail the batch: %v", err)
+	}
+	want := []ItemResult{
+		{ID: "evt-bad", Status: StatusRejected, Reason: ReasonUnknownType},
+		{ID: "evt-after-bad", Status: StatusApplied},
+	}
+	if len(resp.Results) != 2 || resp.Results[0] != want[0] || resp.Results[1] != want[1] {
+		t.Errorf("expected results %+v, got %+v", want, resp.Results)
+	}
+	if len(resp.Processed) != 2 {
+		t.Errorf("expected both events processed, got %v", resp.Processed)
+	}
+
+	// The rejected event no longer blocks the queue: a retry is rejected
+	// again for the same reason.
+	resp, err = svc.ProcessEvents(userID, events[:1])
+	if err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+	if resp.Results[0] != want[0] {
+		t.Errorf("expected the retried event reported as %+v, got %+v", want[0], resp.Results[0])
+	}
+}
+
+func TestProcessEvents_IdempotencyIsPerUser(t *testing.T) {
+	svc, userID, cleanup := setupEventsTest(t)
+	defer cleanup()
+
+	other, err := svc.db.GetOrCreateUserByProvider("test", "events-other", "other@test.com", "Other", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
 	}
 
-	_, err := svc.ProcessEvents(userID, events)
-	if err == nil {
-		t.Fatal("expected error for invalid event type")
+	// Both users send an event with the same ID; neither skips the other's.
+	now := time.Now().UTC()
+	for i, id := range []string{userID, other.ID} {
+		resp, err := svc.ProcessEvents(id, []EventRequest{{
+			ID:        "evt-shared",
+			Type:      EventTypeGoalUpsert,
+			Timestamp: now,
+			Payload:   EventPayload{ID: fmt.Sprintf("goal-shared-%d", i), Name: "Run", Color: "#000000"},
+		}})
+		if err != nil {
+			t.Fatalf("ProcessEvents: %v", err)
+		}
+		if resp.Applied != 1 {
+			t.Errorf("expected user %d's event applied, got %+v", i, resp.Results)
+		}
+		if goal, _ := svc.db.GetGoalByID(fmt.Sprintf("goal-shared-%d", i)); goal == nil || *goal.UserID != id {
+			t.Errorf("expected user %d's goal created, got %+v", i, goal)
+		}
 	}
 }
 
@@ -449,9 +545,15 @@ func TestProcessEvents_GoalOwnership(t *testing.T) {
 		},
 	}
 
-	_, err = svc.ProcessEvents(userID, events)
-	if err == nil {
-		t.Fatal("expected error when modifying another user's goal")
+	resp, err := svc.ProcessEvents(userID, events)
+	if err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+	if len(resp.Results) != 1 || resp.Results[0].Status != StatusRejected || resp.Results[0].Reason != ReasonNotOwned {
+		t.Fatalf("expected the event rejected as not owned, got %+v", resp.Results)
+	}
+	if got, _ := svc.db.GetGoalByID("goal-other"); got.Name != "OtherGoal" {
+		t.Errorf("another user's goal must not change, got %q", got.Name)
 	}
 }
 
@@ -491,9 +593,25 @@ func TestProcessEvents_CompletionOwnershipCheck(t *testing.T) {
 		},
 	}
 
-	_, err = svc.ProcessEvents(userID, events)
-	if err == nil {
-		t.Fatal("expected error when setting completion on another user's goal")
+	events = append(events, EventRequest{
+		ID:        "evt-comp-missing",
+		Type:      EventTypeCompletionSet,
+		Timestamp: time.Now().UTC(),
+		Payload:   EventPayload{GoalID: "goal-missing", Date: "2026-04-05"},
+	})
+
+	resp, err := svc.ProcessEvents(userID, events)
+	if err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+	want := map[string]string{"evt-comp-own": ReasonNotOwned, "evt-comp-missing": ReasonGoalNotFound}
+	for _, r := range resp.Results {
+		if r.Status != StatusRejected || r.Reason != want[r.ID] {
+			t.Errorf("event %s: expected rejected/%s, got %s/%s", r.ID, want[r.ID], r.Status, r.Reason)
+		}
+	}
+	if c, _ := svc.db.GetCompletionByGoalAndDateIncludingDeleted("goal-comp-other", "2026-04-05"); c != nil {
+		t.Errorf("expected no completion on another user's goal, got %+v", c)
 	}
 }
 
@@ -694,3 +812,268 @@ func TestProcessEvents_GoalUpsertStaleTimestamp_LWWRejects(t *testing.T) {
 		t.Errorf("expected position 1 (server wins), got %d", goal.Position)
 	}
 }
+
+func TestProcessEvents_CountsAppliedChanges(t *testing.T) {
+	svc, userID, cleanup := setupEventsTest(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	upsert := EventRequest{
+		ID:        "evt-applied-1",
+		Type:      EventTypeGoalUpsert,
+		Timestamp: now,
+		Payload:   EventPayload{ID: "goal-applied", Name: "Run", Color: "#FF0000"},
+	}
+	resp, err := svc.ProcessEvents(userID, []EventRequest{upsert})
+	if err != nil {
+		t.Fatalf("ProcessEvents failed: %v", err)
+	}
+	if resp.Applied != 1 {
+		t.Errorf("expected 1 applied event, got %d", resp.Applied)
+	}
+
+	// A replayed event and an older write that loses the merge change nothing.
+	stale := EventRequest{
+		ID:        "evt-applied-2",
+		Type:      EventTypeGoalUpsert,
+		Timestamp: now.Add(-time.Hour),
+		Payload:   EventPayload{ID: "goal-applied", Name: "Walk", Color: "#00FF00"},
+	}
+	resp, err = svc.ProcessEvents(userID, []EventRequest{upsert, stale})
+	if err != nil {
+		t.Fatalf("ProcessEvents failed: %v", err)
+	}
+	if resp.Applied != 0 || len(resp.Processed) != 2 {
+		t.Errorf("expected 2 processed and 0 applied, got %+v", resp)
+	}
+}
+
+func TestProcessEvents_GoalUpsert_MergesFieldsFromTwoDevices(t *testing.T) {
+	svc, userID, cleanup := setupEventsTest(t)
+	defer cleanup()
+
+	created := time.Now().UTC().Add(-time.Minute).Truncate(time.Millisecond)
+	base := HLCFromTime(created, "phone")
+	_, err := svc.ProcessEvents(userID, []EventRequest{{
+		ID: "evt-create", Type: EventTypeGoalUpsert, HLC: base,
+		Payload: EventPayload{ID: "goal-fields", Name: "Read", Color: "#000000"},
+	}})
+	if err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+
+	// Offline edits from two devices, each sending its full record with the
+	// clock of the one field it changed.
+	phone := HLCFromTime(created.Add(10*time.Second), "phone")
+	tablet := HLCFromTime(created.Add(5*time.Second), "tablet")
+	_, err = svc.ProcessEvents(userID, []EventRequest{
+		{
+			ID: "evt-rename", Type: EventTypeGoalUpsert, HLC: phone,
+			Payload: EventPayload{ID: "goal-fields", Name: "Read daily", Color: "#000000",
+				Fields: &GoalFieldHLCs{Name: phone, Color: base, Position: base, Target: base, Archived: base}},
+		},
+		{
+			ID: "evt-recolor", Type: EventTypeGoalUpsert, HLC: tablet,
+			Payload: EventPayload{ID: "goal-fields", Name: "Read", Color: "#3366FF",
+				Fields: &GoalFieldHLCs{Name: base, Color: tablet, Position: base, Target: base, Archived: base}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+
+	goal, err := svc.db.GetGoalByID("goal-fields")
+	if err != nil || goal == nil {
+		t.Fatalf("GetGoalByID: %v", err)
+	}
+	if goal.Name != "Read daily" || goal.Color != "#3366FF" {
+		t.Errorf("expected both edits to survive, got %q/%q", goal.Name, goal.Color)
+	}
+	if fields := GoalFieldClocks(goal); fields.Color.Compare(tablet) != 0 || fields.Name.Compare(phone) != 0 {
+		t.Errorf("expected the field clocks stored, got %+v", goal.FieldClocks)
+	}
+}
+
+func TestProcessEvents_GoalArchive_MergesWithOtherEdits(t *testing.T) {
+	svc, userID, cleanup := setupEventsTest(t)
+	defer cleanup()
+
+	created := time.Now().UTC().Add(-time.Minute).Truncate(time.Millisecond)
+	at := func(offset time.Duration, node string) HLC { return HLCFromTime(created.Add(offset), node) }
+	_, err := svc.ProcessEvents(userID, []EventRequest{{
+		ID: "evt-create", Type: EventTypeGoalUpsert, HLC: at(0, "phone"),
+		Payload: EventPayload{ID: "goal-archive", Name: "Read", Color: "#000000"},
+	}})
+	if err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+
+	// The phone renamed the goal after the tablet archived it offline; the
+	// rename carries the clock of the one field it changed.
+	base := at(0, "phone")
+	rename := at(10*time.Second, "phone")
+	_, err = svc.ProcessEvents(userID, []EventRequest{
+		{
+			ID: "evt-rename", Type: EventTypeGoalUpsert, HLC: rename,
+			Payload: EventPayload{ID: "goal-archive", Name: "Read daily", Color: "#000000",
+				Fields: &GoalFieldHLCs{Name: rename, Color: base, Position: base, Target: base, Archived: base}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+	resp, err := svc.ProcessEvents(userID, []EventRequest{
+		{ID: "evt-archive", Type: EventTypeGoalArchive, HLC: at(5*time.Second, "tablet"), Payload: EventPayload{ID: "goal-archive"}},
+	})
+	if err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+	if r := resp.Results[0]; r.Status != StatusApplied {
+		t.Errorf("expected the archive applied, got %+v", r)
+	}
+
+	// An unarchive older than the archive loses.
+	resp, err = svc.ProcessEvents(userID, []EventRequest{
+		{ID: "evt-stale-unarchive", Type: EventTypeGoalUnarchive, HLC: at(3*time.Second, "web"), Payload: EventPayload{ID: "goal-archive"}},
+	})
+	if err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+	if r := resp.Results[0]; r.Status != StatusSuperseded || r.Reason != ReasonStale {
+		t.Errorf("expected the older unarchive superseded, got %+v", r)
+	}
+
+	goal, err := svc.db.GetGoalByID("goal-archive")
+	if err != nil || goal == nil {
+		t.Fatalf("GetGoalByID: %v", err)
+	}
+	if goal.Name != "Read daily" || goal.ArchivedAt == nil {
+		t.Errorf("expected the rename and the archive to survive, got %q archived at %v", goal.Name, goal.ArchivedAt)
+	}
+	if goal.DeletedAt != nil {
+		t.Error("expected archiving not to delete the goal")
+	}
+
+	if _, err := svc.ProcessEvents(userID, []EventRequest{
+		{ID: "evt-unarchive", Type: EventTypeGoalUnarchive, HLC: at(20*time.Second, "web"), Payload: EventPayload{ID: "goal-archive"}},
+	}); err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+	goal, _ = svc.db.GetGoalByID("goal-archive")
+	if goal.ArchivedAt != nil || goal.Name != "Read daily" {
+		t.Errorf("expected the goal unarchived and still renamed, got %+v", goal)
+	}
+
+	// Archiving never creates a goal.
+	resp, err = svc.ProcessEvents(userID, []EventRequest{
+		{ID: "evt-missing", Type: EventTypeGoalArchive, Timestamp: time.Now().UTC(), Payload: EventPayload{ID: "no-such-goal"}},
+	})
+	if err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+	if r := resp.Results[0]; r.Status != StatusRejected || r.Reason != ReasonGoalNotFound {
+		t.Errorf("expected goal_not_found, got %+v", r)
+	}
+	if g, _ := svc.db.GetGoalByID("no-such-goal"); g != nil {
+		t.Errorf("expected no goal created, got %+v", g)
+	}
+}
+
+func TestProcessEvents_GoalReorder(t *testing.T) {
+	svc, userID, cleanup := setupEventsTest(t)
+	defer cleanup()
+
+	created := time.Now().UTC().Add(-time.Minute).Truncate(time.Millisecond)
+	at := func(offset time.Duration) HLC { return HLCFromTime(created.Add(offset), "phone") }
+	var events []EventRequest
+	for i, id := range []string{"goal-a", "goal-b", "goal-c"} {
+		events = append(events, EventRequest{
+			ID: "evt-create-" + id, Type: EventTypeGoalUpsert, HLC: at(0),
+			Payload: EventPayload{ID: id, Name: id, Color: "#000000", Position: i},
+		})
+	}
+	if _, err := svc.ProcessEvents(userID, events); err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+
+	other, err := svc.db.GetOrCreateUserByProvider("test", "other-user", "other@test.com", "Other", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := svc.db.CreateGoal(&models.Goal{ID: "goal-other", Name: "Other", Color: "#000000", UserID: &other.ID, CreatedAt: created}); err != nil {
+		t.Fatalf("create goal: %v", err)
+	}
+
+	order := func() string {
+		t.Helper()
+		goals, err := svc.db.ListGoals(&userID, false)
+		if err != nil {
+			t.Fatalf("ListGoals: %v", err)
+		}
+		var ids []string
+		for _, g := range goals {
+			ids = append(ids, g.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	reorder := func(id string, clock HLC, ids ...string) ItemResult {
+		t.Helper()
+		resp, err := svc.ProcessEvents(userID, []EventRequest{
+			{ID: id, Type: EventTypeGoalReorder, HLC: clock, Payload: EventPayload{GoalIDs: ids}},
+		})
+		if err != nil {
+			t.Fatalf("ProcessEvents: %v", err)
+		}
+		return resp.Results[0]
+	}
+
+	if r := reorder("evt-reorder", at(10*time.Second), "goal-c", "goal-a", "goal-b"); r.Status != StatusApplied {
+		t.Fatalf("expected the reorder applied, got %+v", r)
+	}
+	want := "goal-c,goal-a,goal-b"
+	if got := order(); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	// Invalid reorders move nothing.
+	for _, tc := range []struct {
+		ids    []string
+		reason string
+	}{
+		{nil, ReasonInvalidOrder},
+		{[]string{"goal-a", "goal-b", "goal-a"}, ReasonInvalidOrder},
+		{[]string{"goal-a", "no-such-goal"}, ReasonGoalNotFound},
+		{[]string{"goal-b", "goal-other"}, ReasonNotOwned},
+	} {
+		r := reorder("evt-invalid-"+fmt.Sprint(tc.ids), at(20*time.Second), tc.ids...)
+		if r.Status != StatusRejected || r.Reason != tc.reason {
+			t.Errorf("%v: expected rejected %s, got %+v", tc.ids, tc.reason, r)
+		}
+	}
+	if got := order(); got != want {
+		t.Errorf("expected rejected reorders to move nothing, got %s", got)
+	}
+
+	// An older reorder made offline would move goal-c back, but goal-c has
+	// moved since.
+	if r := reorder("evt-stale", at(5*time.Second), "goal-a", "goal-b", "goal-c"); r.Status != StatusSuperseded || r.Reason != ReasonStale {
+		t.Errorf("expected the older reorder superseded, got %+v", r)
+	}
+	if got := order(); got != want {
+		t.Errorf("expected the newer order kept, got %s", got)
+	}
+
+	// Another device moved goal-b to the front. Only goal-b's rank changes,
+	// so both moves survive.
+	before, _ := svc.db.GetGoalByID("goal-c")
+	if r := reorder("evt-move-b", at(12*time.Second), "goal-b", "goal-c", "goal-a"); r.Status != StatusApplied {
+		t.Fatalf("expected the reorder applied, got %+v", r)
+	}
+	if got := order(); got != "goal-b,goal-c,goal-a" {
+		t.Errorf("expected goal-b,goal-c,goal-a, got %s", got)
+	}
+	if after, _ := svc.db.GetGoalByID("goal-c"); after.Rank != before.Rank {
+		t.Errorf("expected goal-c's rank kept, got %q then %q", before.Rank, after.Rank)
+	}
+}
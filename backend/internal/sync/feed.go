@@ -0,0 +1,64 @@
+package sync
+
+import "sync"
+
+// changeFeed tells subscribers when a user's data changes. A signal carries
+// no data: subscribers read the changes themselves, so a slow one only
+// misses signals it would have coalesced anyway.
+type changeFeed struct {
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+}
+
+func newChangeFeed() *changeFeed {
+	return &changeFeed{subs: make(map[string]map[chan struct{}]struct{})}
+}
+
+// subscribe returns a channel signalled after each change to userID's data,
+// and a function that ends the subscription.
+func (f *changeFeed) subscribe(userID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	f.mu.Lock()
+	if f.subs[userID] == nil {
+		f.subs[userID] = make(map[chan struct{}]struct{})
+	}
+	f.subs[userID][ch] = struct{}{}
+	f.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			delete(f.subs[userID], ch)
+			if len(f.subs[userID]) == 0 {
+				delete(f.subs, userID)
+			}
+		})
+	}
+}
+
+// publish signals every subscriber of userID without blocking, or every
+// subscriber if userID is "" (see bus.Bus). A subscriber that has not taken
+// its last signal yet keeps just the one.
+func (f *changeFeed) publish(userID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if userID != "" {
+		signal(f.subs[userID])
+		return
+	}
+	for _, subs := range f.subs {
+		signal(subs)
+	}
+}
+
+func signal(subs map[chan struct{}]struct{}) {
+	for ch := range subs {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
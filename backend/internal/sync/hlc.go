@@ -0,0 +1,171 @@
+package sync
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+)
+
+// DefaultMaxDrift bounds how far ahead of the server a client clock may be.
+// Timestamps further in the future are re-stamped with the server's clock, so
+// a device set a year ahead cannot win every conflict.
+const DefaultMaxDrift = 5 * time.Minute
+
+// ServerNode is the node ID of the server's own clock.
+const ServerNode = "server"
+
+// maxNodeLength bounds client-chosen node IDs.
+const maxNodeLength = 64
+
+// HLC is a hybrid logical clock timestamp. Wall is physical time at
+// millisecond precision, Logical orders events that share a Wall, and Node
+// identifies the clock that issued it. Comparing Wall, then Logical, then Node
+// gives every replica the same total order.
+//
+// On the wire an HLC is the string "<unix ms>-<logical hex>-<node>", e.g.
+// "1773259500123-0002-phone-7f3a", which sorts the same way as Compare.
+type HLC struct {
+	Wall    time.Time
+	Logical uint32
+	Node    string
+}
+
+// HLCFromTime returns the timestamp of a change made at t by a client that
+// does not send an HLC.
+func HLCFromTime(t time.Time, node string) HLC {
+	return HLC{Wall: t.UTC().Truncate(time.Millisecond), Node: node}
+}
+
+// IsZero reports whether h is unset.
+func (h HLC) IsZero() bool {
+	return h.Wall.IsZero() && h.Logical == 0 && h.Node == ""
+}
+
+// Compare returns -1, 0 or +1 as h orders before, equal to or after o.
+func (h HLC) Compare(o HLC) int {
+	if c := h.Wall.Compare(o.Wall); c != 0 {
+		return c
+	}
+	switch {
+	case h.Logical < o.Logical:
+		return -1
+	case h.Logical > o.Logical:
+		return 1
+	}
+	return strings.Compare(h.Node, o.Node)
+}
+
+// After reports whether h orders after o.
+func (h HLC) After(o HLC) bool {
+	return h.Compare(o) > 0
+}
+
+func (h HLC) String() string {
+	return fmt.Sprintf("%013d-%04x-%s", h.Wall.UnixMilli(), h.Logical, h.Node)
+}
+
+func (h HLC) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+func (h *HLC) UnmarshalText(b []byte) error {
+	parsed, err := ParseHLC(string(b))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// ParseHLC parses the wire form of an HLC.
+func ParseHLC(s string) (HLC, error) {
+	parts := strings.SplitN(s, "-", 3)
+	if len(parts) != 3 {
+		return HLC{}, fmt.Errorf("invalid hlc %q", s)
+	}
+	ms, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || ms < 0 {
+		return HLC{}, fmt.Errorf("invalid hlc wall time %q", parts[0])
+	}
+	logical, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return HLC{}, fmt.Errorf("invalid hlc counter %q", parts[1])
+	}
+	if len(parts[2]) > maxNodeLength {
+		return HLC{}, fmt.Errorf("hlc node longer than %d characters", maxNodeLength)
+	}
+	return HLC{Wall: time.UnixMilli(ms).UTC(), Logical: uint32(logical), Node: parts[2]}, nil
+}
+
+// Clock is the server's hybrid logical clock. It never runs backwards and
+// moves past every timestamp it receives, so server-issued timestamps order
+// after everything the server has seen.
+type Clock struct {
+	node     string
+	maxDrift time.Duration
+	now      func() time.Time
+
+	mu   gosync.Mutex
+	last HLC
+}
+
+// NewClock creates a clock for node. A non-positive maxDrift uses
+// DefaultMaxDrift.
+func NewClock(node string, maxDrift time.Duration) *Clock {
+	if maxDrift <= 0 {
+		maxDrift = DefaultMaxDrift
+	}
+	return &Clock{
+		node:     node,
+		maxDrift: maxDrift,
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Now ticks the clock and returns the new timestamp.
+func (c *Clock) Now() HLC {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tick()
+}
+
+func (c *Clock) tick() HLC {
+	pt := c.now().UTC().Truncate(time.Millisecond)
+	if pt.After(c.last.Wall) {
+		c.last = HLC{Wall: pt, Node: c.node}
+	} else {
+		c.last.Logical++
+	}
+	return c.last
+}
+
+// Receive merges a client timestamp into the clock and returns the timestamp
+// the change should be recorded with: remote itself, or, when remote is more
+// than maxDrift ahead of the server, a fresh server timestamp that keeps
+// remote's node for tie-breaking.
+func (c *Clock) Receive(remote HLC) HLC {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pt := c.now().UTC().Truncate(time.Millisecond)
+	if remote.Wall.After(pt.Add(c.maxDrift)) {
+		h := c.tick()
+		h.Node = remote.Node
+		return h
+	}
+
+	switch {
+	case pt.After(c.last.Wall) && pt.After(remote.Wall):
+		c.last = HLC{Wall: pt}
+	case remote.Wall.After(c.last.Wall):
+		c.last = HLC{Wall: remote.Wall, Logical: remote.Logical + 1}
+	case c.last.Wall.After(remote.Wall):
+		c.last.Logical++
+	default:
+		c.last.Logical = max(c.last.Logical, remote.Logical) + 1
+	}
+	c.last.Node = c.node
+	return remote
+}
@@ -0,0 +1,138 @@
+package sync
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Locker serializes sync work per user, so two requests for one user never
+// merge against each other's half-written state.
+type Locker interface {
+	// Lock blocks until the caller holds userID's lock, and returns the
+	// function that releases it.
+	Lock(userID string) (unlock func(), err error)
+	// Stats reports contention since the locker was created.
+	Stats() LockStats
+}
+
+// LockStats counts lock acquisitions and how long they waited.
+type LockStats struct {
+	// Acquired counts locks taken.
+	Acquired int64 `json:"acquired"`
+	// Contended counts locks that were held by someone else when requested.
+	Contended int64 `json:"contended"`
+	// Failed counts lock requests that returned an error.
+	Failed int64 `json:"failed"`
+	// Held is the number of locks held right now.
+	Held int64 `json:"held"`
+	// WaitSeconds is the total time spent waiting for contended locks, and
+	// MaxWaitSeconds the longest single wait.
+	WaitSeconds    float64 `json:"wait_seconds"`
+	MaxWaitSeconds float64 `json:"max_wait_seconds"`
+}
+
+// lockMetrics records LockStats for a locker.
+type lockMetrics struct {
+	acquired  atomic.Int64
+	contended atomic.Int64
+	failed    atomic.Int64
+	held      atomic.Int64
+	waitNanos atomic.Int64
+	maxWait   atomic.Int64
+}
+
+func (m *lockMetrics) acquire(contended bool, wait time.Duration) {
+	m.acquired.Add(1)
+	m.held.Add(1)
+	if !contended {
+		return
+	}
+	m.contended.Add(1)
+	m.waitNanos.Add(int64(wait))
+	for {
+		max := m.maxWait.Load()
+		if int64(wait) <= max || m.maxWait.CompareAndSwap(max, int64(wait)) {
+			return
+		}
+	}
+}
+
+func (m *lockMetrics) release() {
+	m.held.Add(-1)
+}
+
+func (m *lockMetrics) Stats() LockStats {
+	return LockStats{
+		Acquired:       m.acquired.Load(),
+		Contended:      m.contended.Load(),
+		Failed:         m.failed.Load(),
+		Held:           m.held.Load(),
+		WaitSeconds:    time.Duration(m.waitNanos.Load()).Seconds(),
+		MaxWaitSeconds: time.Duration(m.maxWait.Load()).Seconds(),
+	}
+}
+
+// MemoryLocker is a Locker for a single server process. Replicas sharing a
+// PostgreSQL database are serialized by the lock db.Database.InTx takes.
+// A user's mutex exists only while someone holds or waits for it.
+type MemoryLocker struct {
+	lockMetrics
+
+	mu    sync.Mutex
+	locks map[string]*userMutex
+}
+
+// userMutex is a user's lock and the number of callers holding or waiting
+// for it.
+type userMutex struct {
+	sync.Mutex
+	refs int
+}
+
+var _ Locker = (*MemoryLocker)(nil)
+
+// NewMemoryLocker creates an in-process locker.
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{locks: make(map[string]*userMutex)}
+}
+
+func (l *MemoryLocker) Lock(userID string) (func(), error) {
+	l.mu.Lock()
+	m, ok := l.locks[userID]
+	if !ok {
+		m = &userMutex{}
+		l.locks[userID] = m
+	}
+	m.refs++
+	l.mu.Unlock()
+
+	start := time.Now()
+	contended := !m.TryLock()
+	if contended {
+		m.Lock()
+	}
+	l.acquire(contended, time.Since(start))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.Unlock()
+			l.release()
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			m.refs--
+			if m.refs == 0 {
+				delete(l.locks, userID)
+			}
+		})
+	}, nil
+}
+
+// size returns the number of users with a live mutex.
+func (l *MemoryLocker) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.locks)
+}
@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/db"
+	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/google/uuid"
+)
+
+// testLockerContention checks that l serializes one user, leaves other users
+// alone and counts the contention.
+func testLockerContention(t *testing.T, l Locker) {
+	t.Helper()
+
+	unlock, err := l.Lock("user-1")
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	// Another user is not blocked.
+	unlockOther, err := l.Lock("user-2")
+	if err != nil {
+		t.Fatalf("Lock other user: %v", err)
+	}
+	unlockOther()
+
+	acquired := make(chan func())
+	go func() {
+		unlock, err := l.Lock("user-1")
+		if err != nil {
+			t.Errorf("Lock: %v", err)
+			close(acquired)
+			return
+		}
+		acquired <- unlock
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected the second lock to wait for the first")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if held := l.Stats().Held; held != 1 {
+		t.Errorf("expected 1 lock held, got %d", held)
+	}
+
+	unlock()
+	select {
+	case unlock := <-acquired:
+		if unlock != nil {
+			unlock()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the second lock once the first was released")
+	}
+
+	stats := l.Stats()
+	if stats.Acquired != 3 || stats.Contended != 1 || stats.Held != 0 {
+		t.Errorf("expected 3 acquired, 1 contended, 0 held; got %+v", stats)
+	}
+	if stats.WaitSeconds < 0.05 || stats.MaxWaitSeconds < 0.05 {
+		t.Errorf("expected the contended wait recorded, got %+v", stats)
+	}
+}
+
+func TestMemoryLocker_SerializesAndEvicts(t *testing.T) {
+	l := NewMemoryLocker()
+	testLockerContention(t, l)
+
+	if n := l.size(); n != 0 {
+		t.Errorf("expected no mutexes left once released, got %d", n)
+	}
+}
+
+// TestPostgresInTx_LocksUserAgainstOtherWrites runs against the database in
+// TEST_POSTGRES_URL, e.g. postgres://localhost/goals_test?sslmode=disable.
+func TestPostgresInTx_LocksUserAgainstOtherWrites(t *testing.T) {
+	connStr := os.Getenv("TEST_POSTGRES_URL")
+	if connStr == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+
+	database, err := db.NewPostgres(connStr)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer database.Close()
+	if err := database.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	// Fresh names, so reruns against the same database start empty.
+	var users [2]string
+	var goals [2]string
+	for i := range users {
+		id := uuid.NewString()
+		user, err := database.GetOrCreateUserByProvider("test", "lock-"+id, id+"@test.com", "Test", "")
+		if err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		users[i] = user.ID
+		goals[i] = uuid.NewString()
+		if err := database.CreateGoal(&models.Goal{ID: goals[i], Name: "Run", Color: "#000000", UserID: &users[i], CreatedAt: time.Now().UTC()}); err != nil {
+			t.Fatalf("CreateGoal: %v", err)
+		}
+	}
+
+	held := make(chan struct{})
+	release := make(chan struct{})
+	txDone := make(chan error, 1)
+	go func() {
+		txDone <- database.InTx(users[0], func(tx db.Tx) error {
+			close(held)
+			<-release
+			return nil
+		})
+	}()
+	<-held
+
+	// A REST write for another user goes ahead.
+	name := "Walk"
+	if err := database.UpdateGoal(&users[1], goals[1], &name, nil, nil, nil); err != nil {
+		t.Fatalf("UpdateGoal other user: %v", err)
+	}
+
+	// One for the same user waits for the transaction.
+	written := make(chan error, 1)
+	go func() {
+		written <- database.UpdateGoal(&users[0], goals[0], &name, nil, nil, nil)
+	}()
+	select {
+	case err := <-written:
+		t.Fatalf("expected the write to wait for the transaction, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-txDone; err != nil {
+		t.Fatalf("InTx: %v", err)
+	}
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatalf("UpdateGoal: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the write once the transaction ended")
+	}
+}
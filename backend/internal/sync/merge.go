@@ -8,8 +8,18 @@ import (
 )
 
 // MergeGoal merges a client goal change with a server goal using Last-Write-Wins strategy.
+// Name, color, position, target and archived state are merged field by field,
+// each keeping the value with the later clock, so concurrent edits to
+// different fields both survive. Deletion applies to the whole goal and
+// follows the change's own clock. Clocks are hybrid logical clocks, so ties
+// on wall time are broken by the logical counter and then by node ID.
 // Returns the merged goal and whether it should be applied (updated/created).
 func MergeGoal(clientChange GoalChange, serverGoal *models.Goal) (*models.Goal, bool) {
+	clientHLC := clientChange.Clock()
+	fields := clientChange.FieldClocks()
+	// The goal's own clock is the latest of any of its parts.
+	record := maxClock(clientHLC, fields.Name, fields.Color, fields.Position, fields.Target, fields.Archived)
+
 	// If no server goal exists, client wins (new goal)
 	if serverGoal == nil {
 		now := time.Now().UTC()
@@ -18,60 +28,150 @@ func MergeGoal(clientChange GoalChange, serverGoal *models.Goal) (*models.Goal,
 			Name:         clientChange.Name,
 			Color:        clientChange.Color,
 			Position:     clientChange.Position,
+			Rank:         clientChange.RankKey(),
 			TargetCount:  clientChange.TargetCount,
 			TargetPeriod: clientChange.TargetPeriod,
-			UpdatedAt:    clientChange.UpdatedAt,
+			UpdatedAt:    record.Wall,
+			ClockLogical: record.Logical,
+			ClockNode:    record.Node,
 			CreatedAt:    now,
 		}
 		if clientChange.Deleted {
-			goal.DeletedAt = &clientChange.UpdatedAt
+			deletedAt := clientHLC.Wall
+			goal.DeletedAt = &deletedAt
 		}
 		if clientChange.Archived {
-			goal.ArchivedAt = &clientChange.UpdatedAt
+			archivedAt := fields.Archived.Wall
+			goal.ArchivedAt = &archivedAt
 		}
+		storeFieldClocks(goal, fields)
 		return goal, true
 	}
 
-	// Last-Write-Wins: client wins if its timestamp is newer
-	if clientChange.UpdatedAt.After(serverGoal.UpdatedAt) {
+	serverHLC := GoalClock(serverGoal)
+	serverFields := GoalFieldClocks(serverGoal)
+	applied := false
+
+	// Last-Write-Wins per field: client wins a field if its clock is later
+	if fields.Name.After(serverFields.Name) {
 		serverGoal.Name = clientChange.Name
+		serverFields.Name = fields.Name
+		applied = true
+	}
+	if fields.Color.After(serverFields.Color) {
 		serverGoal.Color = clientChange.Color
+		serverFields.Color = fields.Color
+		applied = true
+	}
+	if fields.Position.After(serverFields.Position) {
 		serverGoal.Position = clientChange.Position
+		serverGoal.Rank = clientChange.RankKey()
+		serverFields.Position = fields.Position
+		applied = true
+	}
+	if fields.Target.After(serverFields.Target) {
 		serverGoal.TargetCount = clientChange.TargetCount
 		serverGoal.TargetPeriod = clientChange.TargetPeriod
-		serverGoal.UpdatedAt = clientChange.UpdatedAt
+		serverFields.Target = fields.Target
+		applied = true
+	}
+	if fields.Archived.After(serverFields.Archived) {
+		if clientChange.Archived {
+			archivedAt := fields.Archived.Wall
+			serverGoal.ArchivedAt = &archivedAt
+		} else {
+			serverGoal.ArchivedAt = nil
+		}
+		serverFields.Archived = fields.Archived
+		applied = true
+	}
+	if clientHLC.After(serverHLC) {
 		if clientChange.Deleted {
-			serverGoal.DeletedAt = &clientChange.UpdatedAt
+			deletedAt := clientHLC.Wall
+			serverGoal.DeletedAt = &deletedAt
 		} else {
 			serverGoal.DeletedAt = nil
 		}
-		if clientChange.Archived {
-			serverGoal.ArchivedAt = &clientChange.UpdatedAt
+		applied = true
+	}
+
+	// Server wins every field, no update needed
+	if !applied {
+		return serverGoal, false
+	}
+
+	record = maxClock(serverHLC, record)
+	serverGoal.UpdatedAt = record.Wall
+	serverGoal.ClockLogical = record.Logical
+	serverGoal.ClockNode = record.Node
+	storeFieldClocks(serverGoal, serverFields)
+	return serverGoal, true
+}
+
+// MergeGoalArchived applies an archive (or unarchive) made at clock to goal,
+// if it is later than the goal's archived state. The goal's other fields and
+// its deletion are untouched. Returns whether goal changed.
+func MergeGoalArchived(goal *models.Goal, archived bool, clock HLC) bool {
+	return mergeGoalField(goal, clock, func(f *GoalFieldHLCs) *HLC { return &f.Archived }, func() {
+		if archived {
+			archivedAt := clock.Wall
+			goal.ArchivedAt = &archivedAt
 		} else {
-			serverGoal.ArchivedAt = nil
+			goal.ArchivedAt = nil
 		}
-		return serverGoal, true
+	})
+}
+
+// MergeGoalPosition moves goal to rank key, at position, if clock is later
+// than the goal's position, leaving its other fields untouched. Returns
+// whether goal changed.
+func MergeGoalPosition(goal *models.Goal, position int, key string, clock HLC) bool {
+	return mergeGoalField(goal, clock, func(f *GoalFieldHLCs) *HLC { return &f.Position }, func() {
+		goal.Position = position
+		goal.Rank = key
+	})
+}
+
+// mergeGoalField runs set and records clock as the clock of the field
+// picked by field, if clock is later than it.
+func mergeGoalField(goal *models.Goal, clock HLC, field func(*GoalFieldHLCs) *HLC, set func()) bool {
+	fields := GoalFieldClocks(goal)
+	current := field(&fields)
+	if !clock.After(*current) {
+		return false
 	}
+	set()
+	*current = clock
 
-	// Server wins, no update needed
-	return serverGoal, false
+	record := maxClock(GoalClock(goal), clock)
+	goal.UpdatedAt = record.Wall
+	goal.ClockLogical = record.Logical
+	goal.ClockNode = record.Node
+	storeFieldClocks(goal, fields)
+	return true
 }
 
 // MergeCompletion merges a client completion change with a server completion using Last-Write-Wins strategy.
-// For ties, ADD wins (bias toward completion).
+// Versions are ordered by hybrid logical clock; for identical clocks, ADD wins
+// (bias toward completion).
 // Returns the merged completion and whether it should be applied (updated/created).
 func MergeCompletion(clientChange CompletionChange, serverCompletion *models.Completion) (*models.Completion, bool) {
+	clientHLC := clientChange.Clock()
+	updatedAt := clientHLC.Wall
+
 	// If no server completion exists
 	if serverCompletion == nil {
 		// Only create if client is marking as completed
 		if clientChange.Completed {
 			now := time.Now().UTC()
 			completion := &models.Completion{
-				ID:        generateCompletionID(clientChange.GoalID, clientChange.Date),
-				GoalID:    clientChange.GoalID,
-				Date:      clientChange.Date,
-				UpdatedAt: clientChange.UpdatedAt,
-				CreatedAt: now,
+				ID:           generateCompletionID(clientChange.GoalID, clientChange.Date),
+				GoalID:       clientChange.GoalID,
+				Date:         clientChange.Date,
+				UpdatedAt:    updatedAt,
+				ClockLogical: clientHLC.Logical,
+				ClockNode:    clientHLC.Node,
+				CreatedAt:    now,
 			}
 			return completion, true
 		}
@@ -79,9 +179,10 @@ func MergeCompletion(clientChange CompletionChange, serverCompletion *models.Com
 		return nil, false
 	}
 
-	// Handle timestamp comparison
-	clientNewer := clientChange.UpdatedAt.After(serverCompletion.UpdatedAt)
-	sameTime := clientChange.UpdatedAt.Equal(serverCompletion.UpdatedAt)
+	// Handle clock comparison
+	order := clientHLC.Compare(CompletionClock(serverCompletion))
+	clientNewer := order > 0
+	sameTime := order == 0
 
 	// Check if server completion is deleted
 	serverDeleted := serverCompletion.DeletedAt != nil
@@ -91,12 +192,13 @@ func MergeCompletion(clientChange CompletionChange, serverCompletion *models.Com
 		if clientChange.Completed {
 			// Mark as completed (remove deleted_at if it exists)
 			serverCompletion.DeletedAt = nil
-			serverCompletion.UpdatedAt = clientChange.UpdatedAt
-			return serverCompletion, true
+		} else {
+			// Mark as deleted (soft delete)
+			serverCompletion.DeletedAt = &updatedAt
 		}
-		// Mark as deleted (soft delete)
-		serverCompletion.DeletedAt = &clientChange.UpdatedAt
-		serverCompletion.UpdatedAt = clientChange.UpdatedAt
+		serverCompletion.UpdatedAt = updatedAt
+		serverCompletion.ClockLogical = clientHLC.Logical
+		serverCompletion.ClockNode = clientHLC.Node
 		return serverCompletion, true
 	}
 
@@ -106,14 +208,18 @@ func MergeCompletion(clientChange CompletionChange, serverCompletion *models.Com
 
 // GoalToChange converts a models.Goal to a GoalChange
 func GoalToChange(goal *models.Goal) GoalChange {
+	fields := GoalFieldClocks(goal)
 	return GoalChange{
 		ID:           goal.ID,
 		Name:         goal.Name,
 		Color:        goal.Color,
 		Position:     goal.Position,
+		Rank:         goal.Rank,
 		TargetCount:  goal.TargetCount,
 		TargetPeriod: goal.TargetPeriod,
 		UpdatedAt:    goal.UpdatedAt,
+		HLC:          GoalClock(goal),
+		Fields:       &fields,
 		Deleted:      goal.DeletedAt != nil,
 		Archived:     goal.ArchivedAt != nil,
 	}
@@ -126,9 +232,72 @@ func CompletionToChange(completion *models.Completion) CompletionChange {
 		Date:      completion.Date,
 		Completed: completion.DeletedAt == nil,
 		UpdatedAt: completion.UpdatedAt,
+		HLC:       CompletionClock(completion),
+	}
+}
+
+// GoalClock returns the hybrid logical clock of a stored goal.
+func GoalClock(goal *models.Goal) HLC {
+	return HLC{Wall: goal.UpdatedAt.UTC().Truncate(time.Millisecond), Logical: goal.ClockLogical, Node: goal.ClockNode}
+}
+
+// GoalFieldClocks returns the clock of every field of a stored goal.
+func GoalFieldClocks(goal *models.Goal) GoalFieldHLCs {
+	record := GoalClock(goal)
+	parse := func(text string) HLC {
+		if text == "" {
+			return record
+		}
+		h, err := ParseHLC(text)
+		if err != nil {
+			return record
+		}
+		return h
+	}
+	return GoalFieldHLCs{
+		Name:     parse(goal.FieldClocks.Name),
+		Color:    parse(goal.FieldClocks.Color),
+		Position: parse(goal.FieldClocks.Position),
+		Target:   parse(goal.FieldClocks.Target),
+		Archived: parse(goal.FieldClocks.Archived),
 	}
 }
 
+// storeFieldClocks records fields on goal. Fields whose clock is the goal's
+// own are stored empty.
+func storeFieldClocks(goal *models.Goal, fields GoalFieldHLCs) {
+	record := GoalClock(goal)
+	text := func(h HLC) string {
+		if h.Compare(record) == 0 {
+			return ""
+		}
+		return h.String()
+	}
+	goal.FieldClocks = models.GoalFieldClocks{
+		Name:     text(fields.Name),
+		Color:    text(fields.Color),
+		Position: text(fields.Position),
+		Target:   text(fields.Target),
+		Archived: text(fields.Archived),
+	}
+}
+
+// maxClock returns the latest of clocks.
+func maxClock(first HLC, rest ...HLC) HLC {
+	latest := first
+	for _, h := range rest {
+		if h.After(latest) {
+			latest = h
+		}
+	}
+	return latest
+}
+
+// CompletionClock returns the hybrid logical clock of a stored completion.
+func CompletionClock(completion *models.Completion) HLC {
+	return HLC{Wall: completion.UpdatedAt.UTC().Truncate(time.Millisecond), Logical: completion.ClockLogical, Node: completion.ClockNode}
+}
+
 // completionNamespace is a fixed UUID v5 namespace for generating deterministic completion IDs.
 var completionNamespace = uuid.MustParse("a3c1f8d2-7b4e-4f9a-b6c5-d8e2f1a0b3c4")
 
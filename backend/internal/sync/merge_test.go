@@ -309,3 +309,197 @@ func TestMergeCompletion_NewCompletion_UsesDeterministicID(t *testing.T) {
 		t.Errorf("expected deterministic ID %q, got %q", expectedID, merged.ID)
 	}
 }
+
+// --- Clock skew tests ---
+
+func TestMergeGoal_FarFutureClock_IsClampedByServer(t *testing.T) {
+	now := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	clock := NewClock(ServerNode, time.Minute)
+	clock.now = func() time.Time { return now }
+
+	// A phone set a year ahead edits the goal.
+	ahead := HLC{Wall: now.AddDate(1, 0, 0), Node: "phone"}
+	stamped := clock.Receive(ahead)
+	if !stamped.Wall.Equal(now) || stamped.Node != "phone" {
+		t.Fatalf("expected the future clock to be re-stamped at %v keeping its node, got %v", now, stamped)
+	}
+	merged, _ := MergeGoal(GoalChange{ID: "g1", Name: "Phone Name", HLC: stamped}, nil)
+
+	// A laptop with a correct clock edits it a second later and wins.
+	now = now.Add(time.Second)
+	laptop := clock.Receive(HLC{Wall: now, Node: "laptop"})
+	merged, shouldApply := MergeGoal(GoalChange{ID: "g1", Name: "Laptop Name", HLC: laptop}, merged)
+	if !shouldApply || merged.Name != "Laptop Name" {
+		t.Fatalf("later edit should win over the clamped one, got apply=%v name=%q", shouldApply, merged.Name)
+	}
+	if merged.UpdatedAt.After(now) {
+		t.Errorf("UpdatedAt must not come from the skewed clock, got %v", merged.UpdatedAt)
+	}
+}
+
+func TestMergeGoal_ClockWithinDrift_IsKept(t *testing.T) {
+	now := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	clock := NewClock(ServerNode, time.Minute)
+	clock.now = func() time.Time { return now }
+
+	ahead := HLC{Wall: now.Add(30 * time.Second), Logical: 3, Node: "phone"}
+	if got := clock.Receive(ahead); got != ahead {
+		t.Fatalf("a clock within the drift bound should be kept, got %v", got)
+	}
+	// The server clock moves past it, so its own timestamps order later.
+	if next := clock.Now(); !next.After(ahead) {
+		t.Errorf("server clock should tick past %v, got %v", ahead, next)
+	}
+}
+
+func TestMergeGoal_SameWallTime_LogicalCounterOrders(t *testing.T) {
+	wall := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	server := &models.Goal{ID: "g1", Name: "First", UpdatedAt: wall, ClockLogical: 1, ClockNode: "phone"}
+
+	_, shouldApply := MergeGoal(GoalChange{ID: "g1", Name: "Earlier", HLC: HLC{Wall: wall, Logical: 0, Node: "phone"}}, server)
+	if shouldApply {
+		t.Fatal("lower logical counter should lose")
+	}
+
+	merged, shouldApply := MergeGoal(GoalChange{ID: "g1", Name: "Second", HLC: HLC{Wall: wall, Logical: 2, Node: "phone"}}, server)
+	if !shouldApply || merged.Name != "Second" || merged.ClockLogical != 2 {
+		t.Fatalf("higher logical counter should win, got apply=%v %+v", shouldApply, merged)
+	}
+}
+
+func TestMergeGoal_IdenticalWallAndCounter_NodeBreaksTie(t *testing.T) {
+	wall := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	a := GoalChange{ID: "g1", Name: "From A", HLC: HLC{Wall: wall, Node: "device-a"}}
+	b := GoalChange{ID: "g1", Name: "From B", HLC: HLC{Wall: wall, Node: "device-b"}}
+
+	// Whichever change reaches the server first, device-b's version survives.
+	for _, order := range [][2]GoalChange{{a, b}, {b, a}} {
+		stored, _ := MergeGoal(order[0], nil)
+		merged, _ := MergeGoal(order[1], stored)
+		if merged.Name != "From B" || merged.ClockNode != "device-b" {
+			t.Errorf("applying %q then %q: expected device-b to win, got %q", order[0].Name, order[1].Name, merged.Name)
+		}
+	}
+}
+
+func TestMergeCompletion_IdenticalWallAndCounter_NodeBreaksTie(t *testing.T) {
+	wall := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	server := &models.Completion{
+		ID: "c1", GoalID: "g1", Date: "2026-03-11",
+		UpdatedAt: wall, ClockNode: "device-b",
+	}
+	// An ADD from a lower node loses to device-b's completion state; only an
+	// identical clock falls back to ADD-wins.
+	deletedAt := wall
+	server.DeletedAt = &deletedAt
+	client := CompletionChange{GoalID: "g1", Date: "2026-03-11", Completed: true, HLC: HLC{Wall: wall, Node: "device-a"}}
+
+	if _, shouldApply := MergeCompletion(client, server); shouldApply {
+		t.Fatal("device-b's delete should win the node tie-break")
+	}
+
+	client.HLC.Node = "device-c"
+	merged, shouldApply := MergeCompletion(client, server)
+	if !shouldApply || merged.DeletedAt != nil {
+		t.Fatal("device-c's add should win the node tie-break")
+	}
+}
+
+func TestMergeCompletion_LegacyClientWithoutHLC_UsesUpdatedAt(t *testing.T) {
+	wall := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	server := &models.Completion{ID: "c1", GoalID: "g1", Date: "2026-03-11", UpdatedAt: wall, ClockLogical: 4, ClockNode: "phone"}
+	client := CompletionChange{GoalID: "g1", Date: "2026-03-11", Completed: false, UpdatedAt: wall.Add(time.Millisecond)}
+
+	merged, shouldApply := MergeCompletion(client, server)
+	if !shouldApply || merged.DeletedAt == nil {
+		t.Fatal("a later UpdatedAt should win when the client sends no HLC")
+	}
+	if merged.ClockLogical != 0 || merged.ClockNode != "" {
+		t.Errorf("expected the legacy clock to be stored, got %d/%q", merged.ClockLogical, merged.ClockNode)
+	}
+}
+
+func TestHLC_TextRoundTripPreservesOrder(t *testing.T) {
+	wall := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	clocks := []HLC{
+		{Wall: wall, Logical: 0, Node: "b"},
+		{Wall: wall, Logical: 1, Node: "a"},
+		{Wall: wall, Logical: 1, Node: "b"},
+		{Wall: wall.Add(time.Millisecond), Node: "a"},
+	}
+	for i, h := range clocks {
+		text, _ := h.MarshalText()
+		var parsed HLC
+		if err := parsed.UnmarshalText(text); err != nil || parsed != h {
+			t.Fatalf("round trip of %v: got %v, %v", h, parsed, err)
+		}
+		if i > 0 && (!h.After(clocks[i-1]) || string(text) <= clocks[i-1].String()) {
+			t.Errorf("expected %v to order after %v", h, clocks[i-1])
+		}
+	}
+	for _, bad := range []string{"", "12-0", "x-0-a", "12-zz-a"} {
+		if _, err := ParseHLC(bad); err == nil {
+			t.Errorf("ParseHLC(%q): expected an error", bad)
+		}
+	}
+}
+
+// --- Field-level goal merge tests ---
+
+func TestMergeGoal_ConcurrentEditsToDifferentFields_BothSurvive(t *testing.T) {
+	base := HLC{Wall: time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC), Node: "server"}
+	target := 3
+	// Device A renames the goal; device B changes its color and target.
+	rename := GoalChange{
+		ID: "g1", Name: "Run 5k", Color: "#000000",
+		HLC:    HLC{Wall: base.Wall.Add(2 * time.Second), Node: "device-a"},
+		Fields: &GoalFieldHLCs{Color: base, Position: base, Target: base, Archived: base},
+	}
+	recolor := GoalChange{
+		ID: "g1", Name: "Run", Color: "#00FF00", TargetCount: &target,
+		HLC:    HLC{Wall: base.Wall.Add(time.Second), Node: "device-b"},
+		Fields: &GoalFieldHLCs{Name: base, Position: base, Archived: base},
+	}
+
+	for _, order := range [][2]GoalChange{{rename, recolor}, {recolor, rename}} {
+		server := &models.Goal{ID: "g1", Name: "Run", Color: "#000000", UpdatedAt: base.Wall, ClockNode: base.Node}
+		for _, change := range order {
+			if _, shouldApply := MergeGoal(change, server); !shouldApply {
+				t.Fatalf("%q should apply", change.Name)
+			}
+		}
+		if server.Name != "Run 5k" || server.Color != "#00FF00" || server.TargetCount == nil || *server.TargetCount != 3 {
+			t.Errorf("expected both edits to survive, got name=%q color=%q target=%v", server.Name, server.Color, server.TargetCount)
+		}
+		if got := GoalClock(server); got.Compare(rename.HLC) != 0 {
+			t.Errorf("expected the goal clock to be the latest edit %v, got %v", rename.HLC, got)
+		}
+	}
+}
+
+func TestMergeGoal_LegacyFullRecord_OnlyOverwritesOlderFields(t *testing.T) {
+	t0 := time.Date(2026, 3, 11, 12, 0, 0, 0, time.UTC)
+	renamed := HLC{Wall: t0.Add(3 * time.Second), Node: "phone"}
+	server := &models.Goal{ID: "g1", Name: "Renamed", Color: "#000000", UpdatedAt: renamed.Wall, ClockNode: renamed.Node}
+	storeFieldClocks(server, GoalFieldHLCs{Name: renamed, Color: HLCFromTime(t0, ""), Position: HLCFromTime(t0, ""), Target: HLCFromTime(t0, ""), Archived: HLCFromTime(t0, "")})
+
+	// An older client sends its whole record, with no field clocks.
+	legacy := GoalChange{ID: "g1", Name: "Old Name", Color: "#FF0000", UpdatedAt: t0.Add(2 * time.Second)}
+	merged, shouldApply := MergeGoal(legacy, server)
+	if !shouldApply {
+		t.Fatal("the color is older on the server, so the change should apply")
+	}
+	if merged.Name != "Renamed" || merged.Color != "#FF0000" {
+		t.Errorf("expected the newer name kept and the color taken, got %q/%q", merged.Name, merged.Color)
+	}
+	if !merged.UpdatedAt.Equal(renamed.Wall) {
+		t.Errorf("the goal clock must not move backwards, got %v", merged.UpdatedAt)
+	}
+
+	// A legacy record newer than every field replaces the whole goal.
+	legacy.UpdatedAt = t0.Add(4 * time.Second)
+	merged, _ = MergeGoal(legacy, merged)
+	if merged.Name != "Old Name" || merged.FieldClocks != (models.GoalFieldClocks{}) {
+		t.Errorf("expected the whole record replaced with no per-field clocks left, got %q %+v", merged.Name, merged.FieldClocks)
+	}
+}
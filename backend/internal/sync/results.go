@@ -0,0 +1,70 @@
+package sync
+
+import "github.com/apsv/goal-tracker/backend/internal/rank"
+
+// Statuses reported for each client change and event.
+const (
+	// StatusApplied means the change was written.
+	StatusApplied = "applied"
+	// StatusSuperseded means the server kept its own version; the client
+	// should take the server's copy and drop the change.
+	StatusSuperseded = "superseded"
+	// StatusRejected means the change is invalid and will never be applied.
+	StatusRejected = "rejected"
+)
+
+// Reasons given with superseded and rejected results.
+const (
+	ReasonStale               = "stale" // the server has the same or a newer version
+	ReasonMissingType         = "missing_type"
+	ReasonUnknownType         = "unknown_type"
+	ReasonInvalidTargetPeriod = "invalid_target_period"
+	ReasonGoalNotFound        = "goal_not_found"
+	ReasonNotOwned            = "not_owned"
+	ReasonInvalidOrder        = "invalid_order" // a reorder lists no goals or one goal twice
+	ReasonInvalidRank         = "invalid_rank"
+)
+
+// ItemResult is the outcome of one client change or event. Events and goals
+// are identified by ID, completions by GoalID and Date.
+type ItemResult struct {
+	ID     string `json:"id,omitempty"`
+	GoalID string `json:"goal_id,omitempty"`
+	Date   string `json:"date,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// outcome is an item status with its reason, before the item is identified.
+type outcome struct {
+	status string
+	reason string
+}
+
+var appliedOutcome = outcome{status: StatusApplied}
+
+// with returns r carrying outcome o.
+func (r ItemResult) with(o outcome) ItemResult {
+	r.Status = o.status
+	r.Reason = o.reason
+	return r
+}
+
+func superseded(reason string) outcome {
+	return outcome{status: StatusSuperseded, reason: reason}
+}
+
+func rejected(reason string) outcome {
+	return outcome{status: StatusRejected, reason: reason}
+}
+
+// validRank reports whether a client-sent goal rank is usable; empty means
+// none was sent.
+func validRank(key string) bool {
+	return key == "" || rank.Valid(key)
+}
+
+// validTargetPeriod reports whether a goal's target period is supported.
+func validTargetPeriod(period *string) bool {
+	return period == nil || *period == "week" || *period == "month"
+}
@@ -1,37 +1,87 @@
 package sync
 
 import (
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
+	"github.com/apsv/goal-tracker/backend/internal/bus"
 	"github.com/apsv/goal-tracker/backend/internal/db"
 	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/rank"
 )
 
 // Service handles sync operations
 type Service struct {
 	db            db.Database
 	mu            sync.Mutex
-	locks         map[string]*sync.Mutex
+	locker        Locker
 	lastPruneTime time.Time
+	clock         *Clock
+	feed          *changeFeed
+	bus           bus.Bus
+	unsubscribe   func()
 }
 
-// NewService creates a new sync service
+// NewService creates a new sync service. Users are locked within this
+// process, and change notifications stay within it until UseBus is called.
 func NewService(database db.Database) *Service {
-	return &Service{
-		db:    database,
-		locks: make(map[string]*sync.Mutex),
+	s := &Service{
+		db:     database,
+		locker: NewMemoryLocker(),
+		clock:  NewClock(ServerNode, DefaultMaxDrift),
+		feed:   newChangeFeed(),
 	}
+	s.UseBus(bus.NewMemory())
+	return s
 }
 
-// getUserLock returns a mutex for the given user ID, creating one if needed.
-func (s *Service) getUserLock(userID string) *sync.Mutex {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.locks[userID]; !ok {
-		s.locks[userID] = &sync.Mutex{}
+// UseLocker serializes each user's sync work with l instead of an
+// in-process lock. Must be called before the service is used.
+func (s *Service) UseLocker(l Locker) {
+	s.locker = l
+}
+
+// LockStats reports contention on the service's per-user locks.
+func (s *Service) LockStats() LockStats {
+	return s.locker.Stats()
+}
+
+// lockUser blocks until the caller holds the user's sync lock.
+func (s *Service) lockUser(userID string) (func(), error) {
+	unlock, err := s.locker.Lock(userID)
+	if err != nil {
+		return nil, fmt.Errorf("lock user: %w", err)
+	}
+	return unlock, nil
+}
+
+// UseBus sends change notifications through b, so subscribers on every
+// instance sharing b hear about changes made here. Must be called before the
+// service is used.
+func (s *Service) UseBus(b bus.Bus) {
+	if s.unsubscribe != nil {
+		s.unsubscribe()
+	}
+	s.bus = b
+	s.unsubscribe = b.Subscribe(bus.TopicChanges, s.feed.publish)
+}
+
+// publishChange notifies subscribers on every instance that the user's data
+// changed. The change is already committed, so if the bus fails only this
+// instance's subscribers are told.
+func (s *Service) publishChange(userID string) {
+	if err := s.bus.Publish(bus.TopicChanges, userID); err != nil {
+		slog.Warn("publish change failed", slog.String("user_id", userID), slog.String("error", err.Error()))
+		s.feed.publish(userID)
 	}
-	return s.locks[userID]
+}
+
+// PublishChange notifies subscribers that the user's data changed outside
+// ApplyChanges, ProcessEvents and Restore, such as through the REST API.
+func (s *Service) PublishChange(userID string) {
+	s.publishChange(userID)
 }
 
 // getChangesSince returns all goals and completions modified since the given timestamp.
@@ -65,87 +115,387 @@ func (s *Service) getChangesSince(userID string, since *time.Time) (*SyncRespons
 	}, nil
 }
 
-// ApplyChanges merges client changes with server using LWW strategy
-func (s *Service) ApplyChanges(userID string, req *SyncRequest) (*SyncResponse, error) {
-	userLock := s.getUserLock(userID)
-	userLock.Lock()
-	defer userLock.Unlock()
+// getChangesSinceSeq returns all goals and completions written after the
+// given change sequence number.
+func (s *Service) getChangesSinceSeq(userID string, seq int64) (*SyncResponse, error) {
+	goals, err := s.db.GetGoalChangesSinceSeq(&userID, seq)
+	if err != nil {
+		return nil, err
+	}
 
-	serverTime := time.Now().UTC()
+	completions, err := s.db.GetCompletionChangesSinceSeq(&userID, seq)
+	if err != nil {
+		return nil, err
+	}
 
-	// Track what changes to send back to client (server updates that override client changes)
-	// Initialize as empty slices (not nil) to ensure JSON encodes as [] not null
-	serverGoalChanges := []GoalChange{}
-	serverCompletionChanges := []CompletionChange{}
+	goalChanges := make([]GoalChange, len(goals))
+	for i, g := range goals {
+		goalChanges[i] = GoalToChange(&g)
+	}
 
-	// Process goal changes from client
-	for _, clientGoal := range req.Goals {
-		// Validate target_period if provided
-		if clientGoal.TargetPeriod != nil && *clientGoal.TargetPeriod != "week" && *clientGoal.TargetPeriod != "month" {
-			continue // Skip goals with invalid target_period
-		}
+	completionChanges := make([]CompletionChange, len(completions))
+	for i, c := range completions {
+		completionChanges[i] = CompletionToChange(&c)
+	}
+
+	return &SyncResponse{
+		Goals:       goalChanges,
+		Completions: completionChanges,
+	}, nil
+}
+
+// Subscribe returns a channel that is signalled after ApplyChanges,
+// ProcessEvents, Restore or a PublishChange caller writes any of the user's
+// data, on this or any instance sharing the bus, and a function that ends the
+// subscription. Signals coalesce; read the changes with ChangesSince.
+func (s *Service) Subscribe(userID string) (<-chan struct{}, func()) {
+	return s.feed.subscribe(userID)
+}
 
-		serverGoal, err := s.db.GetGoalByID(clientGoal.ID)
+// ChangesSince returns the user's goals and completions written after cursor,
+// and the cursor to continue from. An empty cursor returns no changes, only
+// the current cursor. It returns ErrInvalidCursor if cursor was not issued by
+// the server, and ErrResyncRequired if it predates purged tombstones.
+func (s *Service) ChangesSince(userID, cursor string) (*SyncResponse, error) {
+	var cursorSeq int64
+	if cursor != "" {
+		seq, err := DecodeCursor(cursor)
 		if err != nil {
 			return nil, err
 		}
-
-		// Verify ownership if goal exists
-		if serverGoal != nil && (serverGoal.UserID == nil || *serverGoal.UserID != userID) {
-			// Skip goals not owned by this user
-			continue
+		cursorSeq = seq
+		resync, err := s.behindTombstoneHorizon(userID, &pageToken{from: seq}, nil)
+		if err != nil {
+			return nil, err
 		}
-
-		mergedGoal, shouldApply := MergeGoal(clientGoal, serverGoal)
-		if shouldApply {
-			// Set user ID for new goals
-			if serverGoal == nil {
-				mergedGoal.UserID = &userID
-			}
-			if err := s.db.UpsertGoal(mergedGoal); err != nil {
-				return nil, err
-			}
-		} else if serverGoal != nil {
-			// Server version wins, send it back to client
-			serverGoalChanges = append(serverGoalChanges, GoalToChange(serverGoal))
+		if resync {
+			return nil, ErrResyncRequired
 		}
 	}
 
-	// Process completion changes from client
-	for _, clientCompletion := range req.Completions {
-		// Get the goal to verify ownership
-		goal, err := s.db.GetGoalByID(clientCompletion.GoalID)
+	// As in ApplyChanges, read the position first; later changes are
+	// returned again from the new cursor.
+	seq, err := s.db.GetChangeSeq(&userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SyncResponse{Goals: []GoalChange{}, Completions: []CompletionChange{}}
+	if cursor != "" {
+		resp, err = s.getChangesSinceSeq(userID, cursorSeq)
 		if err != nil {
 			return nil, err
 		}
-		if goal == nil || goal.UserID == nil || *goal.UserID != userID {
-			// Skip completions for goals not owned by this user
-			continue
+	}
+	resp.ServerTime = time.Now().UTC()
+	resp.HLC = s.clock.Now()
+	resp.Cursor = EncodeCursor(seq)
+	return resp, nil
+}
+
+// behindTombstoneHorizon reports whether a pull from page, or from
+// lastSyncedAt when page is nil, starts before tombstones that have since
+// been purged, so the client may still hold rows deleted on the server.
+func (s *Service) behindTombstoneHorizon(userID string, page *pageToken, lastSyncedAt *time.Time) (bool, error) {
+	horizon, err := s.db.GetTombstoneHorizon(&userID)
+	if err != nil {
+		return false, err
+	}
+	if page != nil {
+		// An initial pull has no local state to go stale.
+		return page.from >= 0 && page.from < horizon.Seq, nil
+	}
+	return lastSyncedAt != nil && lastSyncedAt.Before(horizon.Before), nil
+}
+
+// Restore rewrites the user's goals and completions to their state at the
+// given time, replayed from the event log, and returns how many rows changed.
+// The rewrites are ordinary changes: clients pull them on their next sync.
+func (s *Service) Restore(userID string, at time.Time) (int, error) {
+	unlock, err := s.lockUser(userID)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	n, err := s.db.RestoreToTime(userID, at)
+	if err != nil {
+		return 0, fmt.Errorf("restore: %w", err)
+	}
+	if n > 0 {
+		s.publishChange(userID)
+	}
+	return n, nil
+}
+
+// Page sizes of paginated pulls, counted in goals plus completions.
+const (
+	DefaultPageSize = 500
+	MaxPageSize     = 2000
+)
+
+func pageSize(requested int) int {
+	if requested <= 0 {
+		return DefaultPageSize
+	}
+	return min(requested, MaxPageSize)
+}
+
+func nextPageToken(next *pageToken) string {
+	if next == nil {
+		return ""
+	}
+	return encodePageToken(*next)
+}
+
+// pullPage returns up to size changes from the pull at t, goals first, and
+// the position of the next page, or nil if this page ends the pull.
+func (s *Service) pullPage(userID string, t pageToken, size int) (*SyncResponse, *pageToken, error) {
+	resp := &SyncResponse{Goals: []GoalChange{}, Completions: []CompletionChange{}}
+
+	if t.phase == phaseGoals {
+		// One extra row tells whether another page follows.
+		goals, err := s.db.GetGoalChangesPage(&userID, t.after, t.upTo, size+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		more := len(goals) > size
+		if more {
+			goals = goals[:size]
 		}
+		for i := range goals {
+			resp.Goals = append(resp.Goals, GoalToChange(&goals[i]))
+		}
+		if more {
+			last := goals[len(goals)-1]
+			t.after = db.ChangeKey{Seq: last.ChangeSeq, ID: last.ID}
+			return resp, &t, nil
+		}
+		size -= len(goals)
+		t.phase = phaseCompletions
+		t.after = t.start()
+	}
 
-		// Get existing completion (including soft-deleted ones)
-		serverCompletion, err := s.getCompletionIncludingDeleted(clientCompletion.GoalID, clientCompletion.Date)
+	completions, err := s.db.GetCompletionChangesPage(&userID, t.after, t.upTo, size+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	more := len(completions) > size
+	if more {
+		completions = completions[:size]
+	}
+	for i := range completions {
+		resp.Completions = append(resp.Completions, CompletionToChange(&completions[i]))
+	}
+	if !more {
+		return resp, nil, nil
+	}
+	// With no room left after the goals, the next page starts at the
+	// first completion.
+	if size > 0 {
+		last := completions[size-1]
+		t.after = db.ChangeKey{Seq: last.ChangeSeq, ID: last.ID}
+	}
+	return resp, &t, nil
+}
+
+// ApplyChanges merges client changes with server using LWW strategy.
+// Client clocks pass through the server's hybrid logical clock first, which
+// re-stamps any that run too far ahead.
+// Pulls by cursor, and initial pulls with neither cursor nor LastSyncedAt,
+// are paginated; see SyncResponse.HasMore.
+// It returns ErrInvalidCursor or ErrInvalidPageToken if req.Cursor or
+// req.PageToken was not issued by the server.
+func (s *Service) ApplyChanges(userID string, req *SyncRequest) (*SyncResponse, error) {
+	// Pulls by cursor, and initial pulls with neither cursor nor
+	// LastSyncedAt, are paginated.
+	var page *pageToken
+	switch {
+	case req.PageToken != "":
+		t, err := decodePageToken(req.PageToken)
 		if err != nil {
 			return nil, err
 		}
+		page = &t
+	case req.Cursor != "":
+		seq, err := DecodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		page = &pageToken{from: seq}
+	case req.LastSyncedAt == nil:
+		page = &pageToken{from: -1}
+	}
+
+	unlock, err := s.lockUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	serverTime := time.Now().UTC()
+
+	// Track what changes to send back to client (server updates that override client changes)
+	// Initialize as empty slices (not nil) to ensure JSON encodes as [] not null
+	serverGoalChanges := []GoalChange{}
+	serverCompletionChanges := []CompletionChange{}
+	applied := 0
+
+	goalResults := make([]ItemResult, 0, len(req.Goals))
+	completionResults := make([]ItemResult, 0, len(req.Completions))
+
+	// The whole batch commits together: a storage error leaves none of it
+	// written, so the client can resend it unchanged.
+	err = s.db.InTx(userID, func(tx db.Tx) error {
+		// Process goal changes from client
+		for _, clientGoal := range req.Goals {
+			result := ItemResult{ID: clientGoal.ID}
+
+			// Validate target_period if provided
+			if !validTargetPeriod(clientGoal.TargetPeriod) {
+				goalResults = append(goalResults, result.with(rejected(ReasonInvalidTargetPeriod)))
+				continue
+			}
+			if !validRank(clientGoal.Rank) {
+				goalResults = append(goalResults, result.with(rejected(ReasonInvalidRank)))
+				continue
+			}
 
-		mergedCompletion, shouldApply := MergeCompletion(clientCompletion, serverCompletion)
-		if shouldApply && mergedCompletion != nil {
-			if err := s.db.UpsertCompletion(mergedCompletion); err != nil {
-				return nil, err
+			serverGoal, err := tx.GetGoalByID(clientGoal.ID)
+			if err != nil {
+				return err
+			}
+
+			// Verify ownership if goal exists
+			if serverGoal != nil && (serverGoal.UserID == nil || *serverGoal.UserID != userID) {
+				goalResults = append(goalResults, result.with(rejected(ReasonNotOwned)))
+				continue
+			}
+
+			s.receiveGoalChange(&clientGoal)
+
+			mergedGoal, shouldApply := MergeGoal(clientGoal, serverGoal)
+			if shouldApply {
+				// Set user ID for new goals
+				if serverGoal == nil {
+					mergedGoal.UserID = &userID
+				}
+				if err := upsertGoal(tx, userID, mergedGoal); err != nil {
+					return err
+				}
+				applied++
+				goalResults = append(goalResults, result.with(appliedOutcome))
+				// Fields the server kept are sent back so the client converges
+				if merged := GoalToChange(mergedGoal); !sameGoalValues(merged, clientGoal) {
+					serverGoalChanges = append(serverGoalChanges, merged)
+				}
+			} else {
+				// Server version wins, send it back to client
+				goalResults = append(goalResults, result.with(superseded(ReasonStale)))
+				serverGoalChanges = append(serverGoalChanges, GoalToChange(serverGoal))
 			}
-		} else if serverCompletion != nil {
-			// Server version wins, send it back to client
-			serverCompletionChanges = append(serverCompletionChanges, CompletionToChange(serverCompletion))
 		}
+
+		// Process completion changes from client
+		for _, clientCompletion := range req.Completions {
+			result := ItemResult{GoalID: clientCompletion.GoalID, Date: clientCompletion.Date}
+
+			// Get the goal to verify ownership
+			goal, err := tx.GetGoalByID(clientCompletion.GoalID)
+			if err != nil {
+				return err
+			}
+			if goal == nil {
+				completionResults = append(completionResults, result.with(rejected(ReasonGoalNotFound)))
+				continue
+			}
+			if goal.UserID == nil || *goal.UserID != userID {
+				completionResults = append(completionResults, result.with(rejected(ReasonNotOwned)))
+				continue
+			}
+
+			// Get existing completion (including soft-deleted ones)
+			serverCompletion, err := tx.GetCompletionByGoalAndDateIncludingDeleted(clientCompletion.GoalID, clientCompletion.Date)
+			if err != nil {
+				return err
+			}
+
+			clientCompletion.HLC = s.clock.Receive(clientCompletion.Clock())
+			clientCompletion.UpdatedAt = clientCompletion.HLC.Wall
+
+			mergedCompletion, shouldApply := MergeCompletion(clientCompletion, serverCompletion)
+			if shouldApply && mergedCompletion != nil {
+				if err := tx.UpsertCompletion(mergedCompletion); err != nil {
+					return err
+				}
+				applied++
+				completionResults = append(completionResults, result.with(appliedOutcome))
+			} else {
+				completionResults = append(completionResults, result.with(superseded(ReasonStale)))
+				if serverCompletion != nil {
+					// Server version wins, send it back to client
+					serverCompletionChanges = append(serverCompletionChanges, CompletionToChange(serverCompletion))
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Get all server changes since the client's last sync (to include changes from other devices)
-	if req.LastSyncedAt != nil {
-		serverChanges, err := s.getChangesSince(userID, req.LastSyncedAt)
-		if err != nil {
-			return nil, err
+	// Read the position before the changes: anything written after it is
+	// either in this response or returned again by the next sync.
+	seq, err := s.db.GetChangeSeq(&userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resync, err := s.behindTombstoneHorizon(userID, page, req.LastSyncedAt)
+	if err != nil {
+		return nil, err
+	}
+	if resync {
+		if applied > 0 {
+			s.publishChange(userID)
 		}
+		return &SyncResponse{
+			ServerTime:        serverTime,
+			HLC:               s.clock.Now(),
+			FullResync:        true,
+			Goals:             []GoalChange{},
+			Completions:       []CompletionChange{},
+			GoalResults:       goalResults,
+			CompletionResults: completionResults,
+			Applied:           applied,
+		}, nil
+	}
+
+	// Get server changes since the client's last sync (to include changes from other devices)
+	cursor := EncodeCursor(seq)
+	var serverChanges *SyncResponse
+	var next *pageToken
+	if page != nil {
+		if req.PageToken == "" {
+			// A new pull covers everything committed so far; later changes
+			// come with the next sync.
+			page.upTo = seq
+			page.phase = phaseGoals
+			page.after = page.start()
+		}
+		serverChanges, next, err = s.pullPage(userID, *page, pageSize(req.PageSize))
+		if next != nil {
+			cursor = page.cursor()
+		} else {
+			cursor = EncodeCursor(page.upTo)
+		}
+	} else {
+		serverChanges, err = s.getChangesSince(userID, req.LastSyncedAt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if serverChanges != nil {
 
 		// Merge with conflict responses
 		for _, change := range serverChanges.Goals {
@@ -176,14 +526,71 @@ func (s *Service) ApplyChanges(userID string, req *SyncRequest) (*SyncResponse,
 		}
 	}
 
+	if applied > 0 {
+		s.publishChange(userID)
+	}
+
 	return &SyncResponse{
-		ServerTime:  serverTime,
-		Goals:       serverGoalChanges,
-		Completions: serverCompletionChanges,
+		ServerTime:        serverTime,
+		HLC:               s.clock.Now(),
+		Cursor:            cursor,
+		HasMore:           next != nil,
+		NextPageToken:     nextPageToken(next),
+		Goals:             serverGoalChanges,
+		Completions:       serverCompletionChanges,
+		GoalResults:       goalResults,
+		CompletionResults: completionResults,
+		Applied:           applied,
 	}, nil
 }
 
-// getCompletionIncludingDeleted gets a completion by goal and date, including soft-deleted ones
-func (s *Service) getCompletionIncludingDeleted(goalID, date string) (*models.Completion, error) {
-	return s.db.GetCompletionByGoalAndDateIncludingDeleted(goalID, date)
+// receiveGoalChange passes a client goal change's clocks through the server
+// clock, which re-stamps any that run too far ahead.
+func (s *Service) receiveGoalChange(change *GoalChange) {
+	change.HLC = s.clock.Receive(change.Clock())
+	s.receiveFieldClocks(change)
+}
+
+// receiveFieldClocks passes the field clocks of a goal change whose HLC was
+// already received through the server clock, and sets UpdatedAt from the HLC.
+func (s *Service) receiveFieldClocks(change *GoalChange) {
+	change.UpdatedAt = change.HLC.Wall
+	if change.Fields != nil {
+		for _, h := range change.Fields.clocks() {
+			if !h.IsZero() {
+				*h = s.clock.Receive(*h)
+			}
+		}
+	}
+}
+
+// upsertGoal stores goal and, if a client gave it a rank too long to keep,
+// rebalances the user's ranks.
+func upsertGoal(tx db.Tx, userID string, goal *models.Goal) error {
+	if err := tx.UpsertGoal(goal); err != nil {
+		return err
+	}
+	if len(goal.Rank) > rank.MaxLength {
+		return tx.RebalanceGoalRanks(userID)
+	}
+	return nil
+}
+
+// sameGoalValues reports whether two goal changes carry the same values.
+func sameGoalValues(a, b GoalChange) bool {
+	return a.Name == b.Name &&
+		a.Color == b.Color &&
+		a.Position == b.Position &&
+		a.RankKey() == b.RankKey() &&
+		equalPtr(a.TargetCount, b.TargetCount) &&
+		equalPtr(a.TargetPeriod, b.TargetPeriod) &&
+		a.Deleted == b.Deleted &&
+		a.Archived == b.Archived
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
@@ -1,12 +1,16 @@
 package sync
 
 import (
+	"errors"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/apsv/goal-tracker/backend/internal/bus"
 	"github.com/apsv/goal-tracker/backend/internal/db"
 	"github.com/apsv/goal-tracker/backend/internal/models"
+	"github.com/apsv/goal-tracker/backend/internal/rank"
 )
 
 func setupTestSyncDB(t *testing.T) (db.Database, func()) {
@@ -82,3 +86,496 @@ func TestApplyChanges_SerializesPerUser(t *testing.T) {
 		}
 	}
 }
+
+func TestApplyChanges_CountsAppliedChanges(t *testing.T) {
+	database, cleanup := setupTestSyncDB(t)
+	defer cleanup()
+
+	svc := NewService(database)
+	user, err := database.GetOrCreateUserByProvider("test", "applied", "applied@test.com", "Test", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	now := time.Now().UTC()
+	req := &SyncRequest{
+		Goals:       []GoalChange{{ID: "goal-count", Name: "Read", Color: "#123456", UpdatedAt: now}},
+		Completions: []CompletionChange{{GoalID: "goal-count", Date: "2026-01-10", Completed: true, UpdatedAt: now}},
+	}
+	resp, err := svc.ApplyChanges(user.ID, req)
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	if resp.Applied != 2 {
+		t.Errorf("expected 2 applied changes, got %d", resp.Applied)
+	}
+
+	// Resending the same state is a no-op.
+	resp, err = svc.ApplyChanges(user.ID, req)
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	if resp.Applied != 0 {
+		t.Errorf("expected no applied changes on resend, got %d", resp.Applied)
+	}
+}
+
+func TestApplyChanges_CursorIgnoresClientClocks(t *testing.T) {
+	database, cleanup := setupTestSyncDB(t)
+	defer cleanup()
+
+	svc := NewService(database)
+	user, err := database.GetOrCreateUserByProvider("test", "cursor", "cursor@test.com", "Test", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// Device A syncs and holds the returned cursor.
+	first, err := svc.ApplyChanges(user.ID, &SyncRequest{})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	if first.Cursor == "" {
+		t.Fatal("expected a cursor")
+	}
+
+	// Device B's clock is a day behind, so its changes carry old timestamps.
+	skewed := time.Now().UTC().Add(-24 * time.Hour)
+	_, err = svc.ApplyChanges(user.ID, &SyncRequest{
+		Goals:       []GoalChange{{ID: "goal-skew", Name: "Read", Color: "#123456", UpdatedAt: skewed}},
+		Completions: []CompletionChange{{GoalID: "goal-skew", Date: "2026-01-10", Completed: true, UpdatedAt: skewed}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+
+	// Device A still receives them.
+	next, err := svc.ApplyChanges(user.ID, &SyncRequest{Cursor: first.Cursor})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	if len(next.Goals) != 1 || next.Goals[0].ID != "goal-skew" || len(next.Completions) != 1 {
+		t.Fatalf("expected the skewed changes, got %+v / %+v", next.Goals, next.Completions)
+	}
+
+	// Nothing new after that.
+	last, err := svc.ApplyChanges(user.ID, &SyncRequest{Cursor: next.Cursor})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	if len(last.Goals) != 0 || len(last.Completions) != 0 {
+		t.Errorf("expected no changes past the cursor, got %+v / %+v", last.Goals, last.Completions)
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	seq, err := DecodeCursor(EncodeCursor(42))
+	if err != nil || seq != 42 {
+		t.Fatalf("round trip: got %d, %v", seq, err)
+	}
+	for _, c := range []string{"42", "not base64!", EncodeCursor(-1), "djI6NDI"} { // "v2:42"
+		if _, err := DecodeCursor(c); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q): expected ErrInvalidCursor, got %v", c, err)
+		}
+	}
+}
+
+func TestApplyChanges_FutureClockDoesNotWinLaterEdits(t *testing.T) {
+	database, cleanup := setupTestSyncDB(t)
+	defer cleanup()
+
+	svc := NewService(database)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	svc.clock.now = func() time.Time { return now }
+	user, err := database.GetOrCreateUserByProvider("test", "skew", "skew@test.com", "Test", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// A phone set a year ahead creates the goal.
+	_, err = svc.ApplyChanges(user.ID, &SyncRequest{
+		Goals: []GoalChange{{ID: "goal-future", Name: "Phone", Color: "#123456", UpdatedAt: now.AddDate(1, 0, 0)}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+
+	// A laptop renames it a minute later and must win.
+	now = now.Add(time.Minute)
+	resp, err := svc.ApplyChanges(user.ID, &SyncRequest{
+		Goals: []GoalChange{{ID: "goal-future", Name: "Laptop", Color: "#123456", HLC: HLC{Wall: now, Node: "laptop"}}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	if resp.Applied != 1 {
+		t.Fatalf("expected the laptop edit to apply, got %d", resp.Applied)
+	}
+	if !resp.HLC.After(HLC{Wall: now, Node: "laptop"}) {
+		t.Errorf("expected the server clock past the laptop's, got %v", resp.HLC)
+	}
+
+	goal, err := database.GetGoalByID("goal-future")
+	if err != nil || goal == nil {
+		t.Fatalf("GetGoalByID: %v", err)
+	}
+	if goal.Name != "Laptop" || goal.ClockNode != "laptop" || !goal.UpdatedAt.Equal(now) {
+		t.Errorf("expected the laptop version stored at %v, got %q/%q at %v", now, goal.Name, goal.ClockNode, goal.UpdatedAt)
+	}
+}
+
+func TestApplyChanges_ReportsResultPerItem(t *testing.T) {
+	database, cleanup := setupTestSyncDB(t)
+	defer cleanup()
+
+	svc := NewService(database)
+	user, err := database.GetOrCreateUserByProvider("test", "results", "results@test.com", "Test", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	userID := user.ID
+	now := time.Now().UTC()
+	if err := database.UpsertGoal(&models.Goal{ID: "goal-newer", Name: "Server", Color: "#000000", UserID: &userID, CreatedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatalf("upsert goal: %v", err)
+	}
+
+	badPeriod := "year"
+	resp, err := svc.ApplyChanges(userID, &SyncRequest{
+		Goals: []GoalChange{
+			{ID: "goal-new", Name: "Read", Color: "#123456", UpdatedAt: now},
+			{ID: "goal-bad", Name: "Bad", Color: "#123456", TargetPeriod: &badPeriod, UpdatedAt: now},
+			{ID: "goal-newer", Name: "Stale", Color: "#123456", UpdatedAt: now.Add(-time.Hour)},
+		},
+		Completions: []CompletionChange{
+			{GoalID: "goal-new", Date: "2026-01-10", Completed: true, UpdatedAt: now},
+			{GoalID: "goal-missing", Date: "2026-01-10", Completed: true, UpdatedAt: now},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+
+	wantGoals := []ItemResult{
+		{ID: "goal-new", Status: StatusApplied},
+		{ID: "goal-bad", Status: StatusRejected, Reason: ReasonInvalidTargetPeriod},
+		{ID: "goal-newer", Status: StatusSuperseded, Reason: ReasonStale},
+	}
+	if len(resp.GoalResults) != len(wantGoals) {
+		t.Fatalf("expected %d goal results, got %+v", len(wantGoals), resp.GoalResults)
+	}
+	for i, want := range wantGoals {
+		if resp.GoalResults[i] != want {
+			t.Errorf("goal result %d: expected %+v, got %+v", i, want, resp.GoalResults[i])
+		}
+	}
+
+	wantCompletions := []ItemResult{
+		{GoalID: "goal-new", Date: "2026-01-10", Status: StatusApplied},
+		{GoalID: "goal-missing", Date: "2026-01-10", Status: StatusRejected, Reason: ReasonGoalNotFound},
+	}
+	if len(resp.CompletionResults) != len(wantCompletions) {
+		t.Fatalf("expected %d completion results, got %+v", len(wantCompletions), resp.CompletionResults)
+	}
+	for i, want := range wantCompletions {
+		if resp.CompletionResults[i] != want {
+			t.Errorf("completion result %d: expected %+v, got %+v", i, want, resp.CompletionResults[i])
+		}
+	}
+}
+
+func TestSubscribe_HearsChangesFromServicesSharingABus(t *testing.T) {
+	database, cleanup := setupTestSyncDB(t)
+	defer cleanup()
+
+	// Two services on one bus stand in for two server instances.
+	shared := bus.NewMemory()
+	a, b := NewService(database), NewService(database)
+	a.UseBus(shared)
+	b.UseBus(shared)
+
+	user, err := database.GetOrCreateUserByProvider("test", "feed", "feed@test.com", "Test", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	other, unsubscribeOther := b.Subscribe("someone-else")
+	defer unsubscribeOther()
+	changed, unsubscribe := b.Subscribe(user.ID)
+	defer unsubscribe()
+
+	req := &SyncRequest{Goals: []GoalChange{{ID: "goal-feed", Name: "Read", Color: "#000000", UpdatedAt: time.Now().UTC()}}}
+	if _, err := a.ApplyChanges(user.ID, req); err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("expected the other service's subscriber to be signalled")
+	}
+	select {
+	case <-other:
+		t.Error("expected no signal for another user")
+	default:
+	}
+
+	// Nothing is signalled when no change is written.
+	if _, err := a.ApplyChanges(user.ID, &SyncRequest{}); err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	select {
+	case <-changed:
+		t.Error("expected no signal for an empty sync")
+	default:
+	}
+}
+
+func TestApplyChanges_PaginatesPullsGoalsFirst(t *testing.T) {
+	database, cleanup := setupTestSyncDB(t)
+	defer cleanup()
+
+	svc := NewService(database)
+	user, err := database.GetOrCreateUserByProvider("test", "pages", "pages@test.com", "Test", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	now := time.Now().UTC()
+	req := &SyncRequest{}
+	for _, id := range []string{"goal-a", "goal-b", "goal-c"} {
+		req.Goals = append(req.Goals, GoalChange{ID: id, Name: id, Color: "#000000", UpdatedAt: now})
+	}
+	for _, date := range []string{"2026-01-01", "2026-01-02", "2026-01-03", "2026-01-04"} {
+		req.Completions = append(req.Completions, CompletionChange{GoalID: "goal-a", Date: date, Completed: true, UpdatedAt: now})
+	}
+	if _, err := svc.ApplyChanges(user.ID, req); err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	// Rows written before change sequences existed are all numbered 0.
+	if _, err := database.(*db.SQLiteDB).Exec(`UPDATE goals SET change_seq = 0 WHERE id IN ('goal-a', 'goal-b')`); err != nil {
+		t.Fatalf("reset change_seq: %v", err)
+	}
+
+	// A new device pulls everything, three rows at a time.
+	var goals []string
+	var completions []string
+	resp, err := svc.ApplyChanges(user.ID, &SyncRequest{PageSize: 3})
+	for page := 1; ; page++ {
+		if err != nil {
+			t.Fatalf("page %d: %v", page, err)
+		}
+		if len(resp.Goals)+len(resp.Completions) > 3 {
+			t.Fatalf("page %d: expected at most 3 rows, got %d", page, len(resp.Goals)+len(resp.Completions))
+		}
+		if len(resp.Goals) > 0 && len(completions) > 0 {
+			t.Fatalf("page %d: goal after a completion", page)
+		}
+		for _, g := range resp.Goals {
+			goals = append(goals, g.ID)
+		}
+		for _, c := range resp.Completions {
+			completions = append(completions, c.Date)
+		}
+		if !resp.HasMore {
+			break
+		}
+		if resp.Cursor != "" {
+			t.Fatalf("page %d: expected no cursor before the last page, got %q", page, resp.Cursor)
+		}
+		if page == 1 {
+			// A write during the pull arrives with the next sync instead.
+			if _, err := svc.ApplyChanges(user.ID, &SyncRequest{Cursor: EncodeCursor(0), Goals: []GoalChange{{ID: "goal-d", Name: "d", Color: "#000000", UpdatedAt: now}}}); err != nil {
+				t.Fatalf("ApplyChanges: %v", err)
+			}
+		}
+		resp, err = svc.ApplyChanges(user.ID, &SyncRequest{PageToken: resp.NextPageToken, PageSize: 3})
+	}
+	if len(goals) != 3 || len(completions) != 4 {
+		t.Fatalf("expected 3 goals and 4 completions, got %v / %v", goals, completions)
+	}
+
+	next, err := svc.ApplyChanges(user.ID, &SyncRequest{Cursor: resp.Cursor})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	if len(next.Goals) != 1 || next.Goals[0].ID != "goal-d" || next.HasMore {
+		t.Errorf("expected only goal-d after the pull, got %+v", next.Goals)
+	}
+
+	if _, err := svc.ApplyChanges(user.ID, &SyncRequest{PageToken: "bogus"}); err != ErrInvalidPageToken {
+		t.Errorf("expected ErrInvalidPageToken, got %v", err)
+	}
+}
+
+func TestApplyChanges_RequiresFullResyncBehindPurgedTombstones(t *testing.T) {
+	database, cleanup := setupTestSyncDB(t)
+	defer cleanup()
+
+	svc := NewService(database)
+	user, err := database.GetOrCreateUserByProvider("test", "purge", "purge@test.com", "Test", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	now := time.Now().UTC()
+	resp, err := svc.ApplyChanges(user.ID, &SyncRequest{Goals: []GoalChange{
+		{ID: "kept", Name: "Kept", Color: "#000000", UpdatedAt: now},
+		{ID: "deleted", Name: "Deleted", Color: "#000000", UpdatedAt: now},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	stale := resp.Cursor
+
+	if err := database.SoftDeleteGoal(&user.ID, "deleted"); err != nil {
+		t.Fatalf("delete goal: %v", err)
+	}
+	purgedBefore := time.Now().UTC().Add(time.Minute)
+	if _, err := database.PurgeTombstones(purgedBefore); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+
+	// The stale client never saw the delete: its changes still apply, but
+	// it must start over.
+	resp, err = svc.ApplyChanges(user.ID, &SyncRequest{
+		Cursor: stale,
+		Goals:  []GoalChange{{ID: "new", Name: "New", Color: "#000000", UpdatedAt: now}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	if !resp.FullResync || resp.Cursor != "" || len(resp.Goals) != 0 {
+		t.Fatalf("expected a full resync with no cursor or changes, got %+v", resp)
+	}
+	if resp.Applied != 1 {
+		t.Errorf("expected the client's goal applied, got %d", resp.Applied)
+	}
+	if _, err := svc.ChangesSince(user.ID, stale); !errors.Is(err, ErrResyncRequired) {
+		t.Errorf("expected ErrResyncRequired from the stale cursor, got %v", err)
+	}
+
+	// Timestamp clients are held to the purge cutoff.
+	old := purgedBefore.Add(-time.Hour)
+	if resp, _ := svc.ApplyChanges(user.ID, &SyncRequest{LastSyncedAt: &old}); !resp.FullResync {
+		t.Error("expected a full resync for a last sync before the purge")
+	}
+	recent := purgedBefore.Add(time.Second)
+	if resp, _ := svc.ApplyChanges(user.ID, &SyncRequest{LastSyncedAt: &recent}); resp.FullResync {
+		t.Error("expected no resync for a last sync after the purge")
+	}
+
+	// The full resync pulls what is left, and its cursor is current.
+	resp, err = svc.ApplyChanges(user.ID, &SyncRequest{})
+	if err != nil || resp.FullResync {
+		t.Fatalf("expected an initial pull to succeed, got %+v, %v", resp, err)
+	}
+	if len(resp.Goals) != 2 {
+		t.Errorf("expected the two live goals, got %+v", resp.Goals)
+	}
+	resp, err = svc.ApplyChanges(user.ID, &SyncRequest{Cursor: resp.Cursor})
+	if err != nil || resp.FullResync {
+		t.Errorf("expected the new cursor to sync normally, got %+v, %v", resp, err)
+	}
+}
+
+func TestApplyChanges_RanksGoals(t *testing.T) {
+	database, cleanup := setupTestSyncDB(t)
+	defer cleanup()
+
+	svc := NewService(database)
+	user, err := database.GetOrCreateUserByProvider("test", "ranks", "ranks@test.com", "Test", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	now := time.Now().UTC()
+	resp, err := svc.ApplyChanges(user.ID, &SyncRequest{Goals: []GoalChange{
+		{ID: "ranked", Name: "Ranked", Color: "#000000", Rank: "V", UpdatedAt: now},
+		{ID: "legacy", Name: "Legacy", Color: "#000000", Position: 3, UpdatedAt: now},
+		{ID: "bad", Name: "Bad", Color: "#000000", Rank: "not a rank", UpdatedAt: now},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	if r := resp.GoalResults[2]; r.Status != StatusRejected || r.Reason != ReasonInvalidRank {
+		t.Errorf("expected the bad rank rejected, got %+v", r)
+	}
+	if g, _ := database.GetGoalByID("ranked"); g.Rank != "V" {
+		t.Errorf("expected the client's rank stored, got %q", g.Rank)
+	}
+	if g, _ := database.GetGoalByID("legacy"); g.Rank != rank.FromPosition(3) {
+		t.Errorf("expected the rank of position 3, got %q", g.Rank)
+	}
+
+	// A rank too long to keep respaces the user's ranks, in the same order.
+	long := "V" + strings.Repeat("0", rank.MaxLength) + "1"
+	if _, err := svc.ApplyChanges(user.ID, &SyncRequest{Goals: []GoalChange{
+		{ID: "ranked", Name: "Ranked", Color: "#000000", Rank: long, UpdatedAt: now.Add(time.Second)},
+	}}); err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+	goals, err := database.ListGoals(&user.ID, false)
+	if err != nil || len(goals) != 2 {
+		t.Fatalf("expected two goals, got %+v, %v", goals, err)
+	}
+	if goals[0].ID != "legacy" || goals[1].ID != "ranked" {
+		t.Errorf("expected the order kept, got %s, %s", goals[0].ID, goals[1].ID)
+	}
+	for _, g := range goals {
+		if len(g.Rank) > rank.MaxLength {
+			t.Errorf("expected %s rebalanced, got rank %q", g.ID, g.Rank)
+		}
+	}
+}
+
+func TestRestore_RevertsEventsAndSyncedChanges(t *testing.T) {
+	database, cleanup := setupTestSyncDB(t)
+	defer cleanup()
+
+	svc := NewService(database)
+	user, err := database.GetOrCreateUserByProvider("test", "restore", "restore@test.com", "Test", "")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	now := time.Now().UTC()
+	if _, err := svc.ProcessEvents(user.ID, []EventRequest{{
+		ID:        "evt-create",
+		Type:      EventTypeGoalUpsert,
+		Timestamp: now,
+		Payload:   EventPayload{ID: "goal-restore", Name: "Run", Color: "#000000"},
+	}}); err != nil {
+		t.Fatalf("ProcessEvents: %v", err)
+	}
+	before := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+
+	if _, err := svc.ApplyChanges(user.ID, &SyncRequest{
+		Goals:       []GoalChange{{ID: "goal-restore", Name: "Walk", Color: "#000000", UpdatedAt: now.Add(time.Second)}},
+		Completions: []CompletionChange{{GoalID: "goal-restore", Date: "2026-03-01", Completed: true, UpdatedAt: now.Add(time.Second)}},
+	}); err != nil {
+		t.Fatalf("ApplyChanges: %v", err)
+	}
+
+	changes, unsubscribe := svc.Subscribe(user.ID)
+	defer unsubscribe()
+
+	n, err := svc.Restore(user.ID, before)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected the goal and completion restored, got %d", n)
+	}
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Error("expected subscribers told about the restore")
+	}
+
+	if g, _ := database.GetGoalByID("goal-restore"); g == nil || g.Name != "Run" {
+		t.Errorf("expected the goal's name restored, got %+v", g)
+	}
+	if c, _ := database.GetCompletionByGoalAndDate("goal-restore", "2026-03-01"); c != nil {
+		t.Errorf("expected the later completion removed, got %+v", c)
+	}
+}
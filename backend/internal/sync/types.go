@@ -1,19 +1,55 @@
 package sync
 
-import "time"
+import (
+	"time"
+
+	"github.com/apsv/goal-tracker/backend/internal/rank"
+)
 
 // SyncRequest represents a client sync request
 type SyncRequest struct {
+	// Cursor is the value returned by the previous sync. It takes precedence
+	// over LastSyncedAt, which is kept for clients that predate cursors.
+	Cursor       string             `json:"cursor,omitempty"`
 	LastSyncedAt *time.Time         `json:"last_synced_at"`
 	Goals        []GoalChange       `json:"goals"`
 	Completions  []CompletionChange `json:"completions"`
+	// PageToken continues a paginated pull; see SyncResponse.HasMore. It
+	// takes precedence over Cursor.
+	PageToken string `json:"page_token,omitempty"`
+	// PageSize caps the goals plus completions pulled per response. Zero
+	// means DefaultPageSize; larger values are capped at MaxPageSize.
+	PageSize int `json:"page_size,omitempty"`
 }
 
 // SyncResponse represents a server sync response
 type SyncResponse struct {
-	ServerTime  time.Time          `json:"server_time"`
+	ServerTime time.Time `json:"server_time"`
+	// HLC is the server clock after this sync; clients merge it into their
+	// own clock so their next changes order after everything they received.
+	HLC         HLC                `json:"hlc"`
 	Goals       []GoalChange       `json:"goals"`
 	Completions []CompletionChange `json:"completions"`
+	// Cursor covers every change up to this response; send it with the next
+	// sync to receive only later changes.
+	Cursor string `json:"cursor"`
+	// HasMore is set when the pull continues on another page; send
+	// NextPageToken to fetch it. Until the last page, Cursor stays where the
+	// pull started, so a client that stops early loses nothing. Goals are
+	// sent before completions.
+	HasMore       bool   `json:"has_more"`
+	NextPageToken string `json:"next_page_token,omitempty"`
+	// FullResync is set when the client last synced before deletes the
+	// server has since purged. Its changes were still applied but nothing
+	// was pulled and Cursor is empty: the client must discard its local
+	// state and pull again without a cursor.
+	FullResync bool `json:"full_resync"`
+	// GoalResults and CompletionResults hold the outcome of each client
+	// change, in request order.
+	GoalResults       []ItemResult `json:"goal_results"`
+	CompletionResults []ItemResult `json:"completion_results"`
+	// Applied counts client changes that were written. Not sent to clients.
+	Applied int `json:"-"`
 }
 
 // GoalChange represents a goal change for sync
@@ -25,8 +61,63 @@ type GoalChange struct {
 	TargetCount  *int      `json:"target_count,omitempty"`
 	TargetPeriod *string   `json:"target_period,omitempty"`
 	UpdatedAt    time.Time `json:"updated_at"`
-	Deleted      bool      `json:"deleted"`
-	Archived     bool      `json:"archived"`
+	// HLC orders this change against other versions of the goal. Clients that
+	// do not send one are ordered by UpdatedAt.
+	HLC HLC `json:"hlc,omitzero"`
+	// Fields holds per-field clocks, so concurrent edits to different fields
+	// both survive. Older clients omit it and every field takes HLC.
+	Fields   *GoalFieldHLCs `json:"fields,omitempty"`
+	Deleted  bool           `json:"deleted"`
+	Archived bool           `json:"archived"`
+	// Rank orders the goal among the user's others; see package rank. It
+	// merges with Position, under the position clock. Changes without a
+	// rank take the rank of their position.
+	Rank string `json:"rank,omitempty"`
+}
+
+// GoalFieldHLCs holds the clock of each goal field that merges separately.
+// A zero clock means the field was written with the change's own HLC.
+type GoalFieldHLCs struct {
+	Name     HLC `json:"name,omitzero"`
+	Color    HLC `json:"color,omitzero"`
+	Position HLC `json:"position,omitzero"`
+	// Target covers target_count and target_period together.
+	Target   HLC `json:"target,omitzero"`
+	Archived HLC `json:"archived,omitzero"`
+}
+
+func (f *GoalFieldHLCs) clocks() []*HLC {
+	return []*HLC{&f.Name, &f.Color, &f.Position, &f.Target, &f.Archived}
+}
+
+// Clock returns the change's HLC, falling back to UpdatedAt.
+func (c GoalChange) Clock() HLC {
+	if c.HLC.IsZero() {
+		return HLCFromTime(c.UpdatedAt, "")
+	}
+	return c.HLC
+}
+
+// RankKey returns the change's rank, or the rank of its position.
+func (c GoalChange) RankKey() string {
+	if c.Rank == "" {
+		return rank.FromPosition(c.Position)
+	}
+	return c.Rank
+}
+
+// FieldClocks returns the clock of every field of the change.
+func (c GoalChange) FieldClocks() GoalFieldHLCs {
+	var f GoalFieldHLCs
+	if c.Fields != nil {
+		f = *c.Fields
+	}
+	for _, h := range f.clocks() {
+		if h.IsZero() {
+			*h = c.Clock()
+		}
+	}
+	return f
 }
 
 // CompletionChange represents a completion change for sync
@@ -35,4 +126,15 @@ type CompletionChange struct {
 	Date      string    `json:"date"`
 	Completed bool      `json:"completed"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// HLC orders this change against other versions of the completion.
+	// Clients that do not send one are ordered by UpdatedAt.
+	HLC HLC `json:"hlc,omitzero"`
+}
+
+// Clock returns the change's HLC, falling back to UpdatedAt.
+func (c CompletionChange) Clock() HLC {
+	if c.HLC.IsZero() {
+		return HLCFromTime(c.UpdatedAt, "")
+	}
+	return c.HLC
 }
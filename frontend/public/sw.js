@@ -158,3 +158,47 @@ async function cacheFirstWithNetworkFallback(request) {
     throw error;
   }
 }
+
+/**
+ * Push event: Show notifications sent by the backend over Web Push
+ * The payload is JSON: { title, body, data } (see backend/internal/push/webpush.go)
+ */
+self.addEventListener('push', (event) => {
+  let payload = {};
+  try {
+    payload = event.data ? event.data.json() : {};
+  } catch (error) {
+    console.error('[Service Worker] Invalid push payload', error);
+    return;
+  }
+
+  // Data-only pushes carry no title and are not shown
+  if (!payload.title) {
+    return;
+  }
+
+  event.waitUntil(
+    self.registration.showNotification(payload.title, {
+      body: payload.body || '',
+      icon: '/icon-192.svg',
+      data: payload.data || {},
+    })
+  );
+});
+
+/**
+ * Notification click: Focus an open app window or open a new one
+ */
+self.addEventListener('notificationclick', (event) => {
+  event.notification.close();
+  event.waitUntil(
+    self.clients.matchAll({ type: 'window', includeUncontrolled: true }).then((windows) => {
+      for (const client of windows) {
+        if ('focus' in client) {
+          return client.focus();
+        }
+      }
+      return self.clients.openWindow('/');
+    })
+  );
+});
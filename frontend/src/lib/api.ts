@@ -383,6 +383,39 @@ export async function logout(): Promise<void> {
   }
 }
 
+/**
+ * Save the user's language so server-sent notifications use it
+ * @param locale - e.g. 'en' or 'pt-BR'
+ */
+export async function updateAccountLocale(locale: string): Promise<void> {
+  await request<User>('/account', {
+    method: 'PATCH',
+    body: JSON.stringify({ locale }),
+  });
+}
+
+// Evening "don't break your streak" push preferences
+export interface StreakAlertSettings {
+  enabled: boolean;
+  time: string; // HH:MM in the account timezone
+}
+
+export async function getStreakAlertSettings(): Promise<StreakAlertSettings> {
+  return request<StreakAlertSettings>('/streak-alerts');
+}
+
+/**
+ * Update streak alert preferences; omitted fields keep their current value
+ */
+export async function updateStreakAlertSettings(
+  settings: Partial<StreakAlertSettings>
+): Promise<StreakAlertSettings> {
+  return request<StreakAlertSettings>('/streak-alerts', {
+    method: 'PATCH',
+    body: JSON.stringify(settings),
+  });
+}
+
 // Get all completions (for statistics - no date filter)
 export async function getAllCompletions(): Promise<Completion[]> {
   await ensureStorageInitialized();
@@ -461,9 +494,12 @@ async function getLocalCompletionsForRange(from: string, to: string): Promise<Co
 
 export interface Device {
   id: string;
-  token: string;
   platform: string;
+  name: string;
+  app_version: string;
   created_at: string;
+  last_used_at?: string;
+  last_seen_at?: string;
 }
 
 /**
@@ -478,6 +514,35 @@ export async function registerDevice(token: string, platform: string): Promise<D
   });
 }
 
+/**
+ * List the devices registered for the current user, newest first
+ */
+export async function listDevices(): Promise<Device[]> {
+  return request<Device[]>('/devices');
+}
+
+/**
+ * Rename a registered device
+ * @param id - Device ID
+ * @param name - New name; empty clears it
+ */
+export async function renameDevice(id: string, name: string): Promise<Device> {
+  return request<Device>(`/devices/${id}`, {
+    method: 'PATCH',
+    body: JSON.stringify({ name }),
+  });
+}
+
+/**
+ * Send a test notification to one device
+ * @param id - Device ID
+ */
+export async function sendTestNotification(id: string): Promise<void> {
+  await request<{ status: string }>(`/devices/${id}/test`, {
+    method: 'POST',
+  });
+}
+
 /**
  * Unregister a device from push notifications
  * @param id - Device ID returned from registerDevice
@@ -0,0 +1,12 @@
+// The backend's ID for this device's push registration (returned by
+// POST /devices). Sent with writes as X-Device-ID so the server leaves this
+// device out of the "data changed" push it sends to the user's other devices.
+let registeredDeviceId: string | null = null;
+
+export function setRegisteredDeviceId(id: string | null): void {
+  registeredDeviceId = id;
+}
+
+export function getRegisteredDeviceId(): string | null {
+  return registeredDeviceId;
+}
@@ -5,6 +5,7 @@ import {
 } from './storage';
 import type { SyncEvent } from './events';
 import { getToken } from './token-storage';
+import { getRegisteredDeviceId } from './device-id';
 import { get, writable } from 'svelte/store';
 import { authStore } from './stores';
 import { getApiBase } from './config';
@@ -18,6 +19,13 @@ export type SyncStatus =
 
 export const syncStatus = writable<SyncStatus>({ state: 'idle' });
 
+/** Outcome of one event, as reported by the events endpoint. */
+export interface EventResult {
+  id: string;
+  status: 'applied' | 'superseded' | 'rejected';
+  reason?: string;
+}
+
 const FLUSH_INTERVAL_MS = 5 * 60 * 1000; // 5 minutes safety net
 
 let isFlushing = false;
@@ -37,6 +45,8 @@ export async function sendEvent(event: SyncEvent): Promise<void> {
     const headers: Record<string, string> = { 'Content-Type': 'application/json' };
     const token = await getToken();
     if (token) headers['Authorization'] = `Bearer ${token}`;
+    const deviceId = getRegisteredDeviceId();
+    if (deviceId) headers['X-Device-ID'] = deviceId;
 
     const res = await fetch(`${getApiBase()}/events/`, {
       method: 'POST',
@@ -86,6 +96,8 @@ export async function flushPendingEvents(): Promise<void> {
     const headers: Record<string, string> = { 'Content-Type': 'application/json' };
     const token = await getToken();
     if (token) headers['Authorization'] = `Bearer ${token}`;
+    const deviceId = getRegisteredDeviceId();
+    if (deviceId) headers['X-Device-ID'] = deviceId;
 
     const res = await fetch(`${getApiBase()}/events/`, {
       method: 'POST',
@@ -112,7 +124,14 @@ export async function flushPendingEvents(): Promise<void> {
       } catch {
         // Prune failure should not affect sync status
       }
-      breadcrumbSync('end', { processed_count: data.processed?.length ?? 0 });
+      // Rejected events are in `processed` too; the server will never apply
+      // them, so they are dropped rather than retried.
+      const rejected = (data.results as EventResult[] | undefined)?.filter(r => r.status === 'rejected') ?? [];
+      breadcrumbSync('end', {
+        processed_count: data.processed?.length ?? 0,
+        rejected_count: rejected.length,
+        ...(rejected.length > 0 && { rejected_reasons: rejected.map(r => r.reason) }),
+      });
     } else {
       breadcrumbSync('error', { status: res.status });
       syncStatus.set({ state: 'error', message: 'Sync failed', canRetry: true });
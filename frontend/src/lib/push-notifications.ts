@@ -7,6 +7,10 @@ interface FirebaseCheckPlugin {
 
 const FirebaseCheck = registerPlugin<FirebaseCheckPlugin>('FirebaseCheck');
 import { registerDevice, unregisterDevice } from './api';
+import { setRegisteredDeviceId } from './device-id';
+
+// Dispatched on window when the server reports data changed on another device
+export const REMOTE_CHANGE_EVENT = 'goals:remote-change';
 
 // Store the device ID returned from backend for unregistration
 let currentDeviceId: string | null = null;
@@ -52,6 +56,7 @@ export async function initPushNotifications(): Promise<void> {
         // Register the token with our backend
         const device = await registerDevice(token.value, platform);
         currentDeviceId = device.id;
+        setRegisteredDeviceId(device.id);
         console.log('[Push] Device registered with backend, ID:', device.id);
       } catch (error) {
         console.error('[Push] Failed to register device with backend:', error);
@@ -66,7 +71,10 @@ export async function initPushNotifications(): Promise<void> {
     // Handle push notification received while app is in foreground
     await PushNotifications.addListener('pushNotificationReceived', (notification: PushNotificationSchema) => {
       console.log('[Push] Notification received in foreground:', notification);
-      // Could show an in-app notification banner here
+      // Silent "data changed" push: another device wrote, so reload
+      if (notification.data?.type === 'sync') {
+        window.dispatchEvent(new Event(REMOTE_CHANGE_EVENT));
+      }
     });
 
     // Handle user tapping on a push notification
@@ -100,6 +108,7 @@ export async function unregisterPushNotifications(): Promise<void> {
         console.error('[Push] Failed to unregister device from backend:', error);
       }
       currentDeviceId = null;
+      setRegisteredDeviceId(null);
     }
 
     // Remove all listeners